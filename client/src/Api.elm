@@ -1,19 +1,31 @@
 module Api exposing (..)
 
-import Folders.Commands exposing (backupRequestEncoder, foldersDecoder, worldDecoder, worldsDecoder)
+import Folders.Commands exposing (backupRequestEncoder, foldersDecoder, worldsDecoder)
 import Folders.Models exposing (BackupId, FolderId, WorldId)
 import Http
 import Json.Decode as Decode exposing (Decoder)
+import Json.Encode as Encode
+import Models exposing (Flags)
 import Msgs exposing (Msg)
 import RemoteData exposing (WebData)
 import Urls
 
 
-delete : String -> Decode.Decoder a -> Http.Request a
-delete url decoder =
+authHeaders : Flags -> List Http.Header
+authHeaders flags =
+    case flags.token of
+        Just token ->
+            [ Http.header "Authorization" ("Bearer " ++ token) ]
+
+        Nothing ->
+            []
+
+
+get : Flags -> String -> Decoder a -> Http.Request a
+get flags url decoder =
     Http.request
-        { method = "DELETE"
-        , headers = []
+        { method = "GET"
+        , headers = authHeaders flags
         , url = url
         , body = Http.emptyBody
         , expect = Http.expectJson decoder
@@ -22,24 +34,24 @@ delete url decoder =
         }
 
 
-post : String -> Http.Body -> Decode.Decoder a -> Http.Request a
-post url body decoder =
+postNoResponse : Flags -> String -> Http.Body -> Http.Request ()
+postNoResponse flags url body =
     Http.request
         { method = "POST"
-        , headers = []
+        , headers = authHeaders flags
         , url = url
         , body = body
-        , expect = Http.expectJson decoder
+        , expect = Http.expectStringResponse (\_ -> Ok ())
         , timeout = Nothing
         , withCredentials = False
         }
 
 
-deleteNoResponse : String -> Http.Request ()
-deleteNoResponse url =
+deleteNoResponse : Flags -> String -> Http.Request ()
+deleteNoResponse flags url =
     Http.request
         { method = "DELETE"
-        , headers = []
+        , headers = authHeaders flags
         , url = url
         , body = Http.emptyBody
         , expect = Http.expectStringResponse (\_ -> Ok ())
@@ -48,11 +60,11 @@ deleteNoResponse url =
         }
 
 
-patch : String -> Http.Body -> Http.Request ()
-patch url body =
+patch : Flags -> String -> Http.Body -> Http.Request ()
+patch flags url body =
     Http.request
         { method = "PATCH"
-        , headers = []
+        , headers = authHeaders flags
         , url = url
         , body = body
         , expect = Http.expectStringResponse (\_ -> Ok ())
@@ -61,55 +73,69 @@ patch url body =
         }
 
 
-fetchFolders : String -> Cmd Msg
-fetchFolders baseApiUrl =
-    Http.get (Urls.folders baseApiUrl) foldersDecoder
+login : String -> String -> String -> Cmd Msg
+login baseApiUrl name password =
+    let
+        body =
+            Encode.object
+                [ ( "name", Encode.string name )
+                , ( "password", Encode.string password )
+                ]
+                |> Http.jsonBody
+    in
+    Http.post (Urls.login baseApiUrl) body (Decode.field "token" Decode.string)
+        |> Http.send Msgs.OnLogin
+
+
+fetchFolders : Flags -> Cmd Msg
+fetchFolders flags =
+    get flags (Urls.folders flags.apiUrl) foldersDecoder
         |> RemoteData.sendRequest
         |> Cmd.map Msgs.OnFetchFolders
 
 
-fetchFolderWorlds : String -> FolderId -> Cmd Msg
-fetchFolderWorlds baseApiUrl folderId =
-    Http.get (Urls.worlds baseApiUrl folderId) worldsDecoder
+fetchFolderWorlds : Flags -> FolderId -> Cmd Msg
+fetchFolderWorlds flags folderId =
+    get flags (Urls.worlds flags.apiUrl folderId) worldsDecoder
         |> RemoteData.sendRequest
         |> Cmd.map (Msgs.OnFetchWorlds folderId)
 
 
-deleteWorld : String -> FolderId -> WorldId -> Cmd Msg
-deleteWorld baseApiUrl folderId worldId =
+deleteWorld : Flags -> FolderId -> WorldId -> Cmd Msg
+deleteWorld flags folderId worldId =
     let
         request =
-            deleteNoResponse (Urls.world baseApiUrl folderId worldId)
+            deleteNoResponse flags (Urls.world flags.apiUrl folderId worldId)
     in
     Http.send (Msgs.OnWorldDeleted folderId worldId) request
 
 
-deleteBackup : String -> FolderId -> WorldId -> BackupId -> Cmd Msg
-deleteBackup baseApiUrl folderId worldId backupId =
+deleteBackup : Flags -> FolderId -> WorldId -> BackupId -> Cmd Msg
+deleteBackup flags folderId worldId backupId =
     let
         request =
-            delete (Urls.backup baseApiUrl folderId worldId backupId) worldDecoder
+            deleteNoResponse flags (Urls.backup flags.apiUrl folderId worldId backupId)
     in
     Http.send (Msgs.OnBackupDeleted folderId worldId backupId) request
 
 
-restoreBackup : String -> FolderId -> WorldId -> BackupId -> Cmd Msg
-restoreBackup baseApiUrl folderId worldId backupId =
+restoreBackup : Flags -> FolderId -> WorldId -> BackupId -> Cmd Msg
+restoreBackup flags folderId worldId backupId =
     let
         request =
-            patch (Urls.backup baseApiUrl folderId worldId backupId) Http.emptyBody
+            patch flags (Urls.backup flags.apiUrl folderId worldId backupId) Http.emptyBody
     in
     Http.send (Msgs.OnBackupRestored folderId worldId backupId) request
 
 
-backupWorld : String -> FolderId -> WorldId -> String -> Cmd Msg
-backupWorld baseApiUrl folderId worldId backupName =
+backupWorld : Flags -> FolderId -> WorldId -> String -> Cmd Msg
+backupWorld flags folderId worldId backupName =
     let
         backupRequestBody =
             backupRequestEncoder { name = backupName }
                 |> Http.jsonBody
 
         request =
-            post (Urls.backups baseApiUrl folderId worldId) backupRequestBody worldDecoder
+            postNoResponse flags (Urls.backups flags.apiUrl folderId worldId) backupRequestBody
     in
     Http.send (Msgs.OnWorldBackedUp folderId worldId) request
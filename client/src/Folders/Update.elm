@@ -20,7 +20,7 @@ updateFolder msg model =
             )
 
         Msgs.DeleteWorld folderId worldId ->
-            ( model, Api.deleteWorld model.flags.apiUrl folderId worldId )
+            ( model, Api.deleteWorld model.flags folderId worldId )
 
         Msgs.DeleteBackupConfirm backupId backupName ->
             ( { model
@@ -41,13 +41,13 @@ updateFolder msg model =
             )
 
         Msgs.DeleteBackup folderId worldId backupId ->
-            ( model, Api.deleteBackup model.flags.apiUrl folderId worldId backupId )
+            ( model, Api.deleteBackup model.flags folderId worldId backupId )
 
         Msgs.RestoreBackup folderId worldId backupId ->
-            ( model, Api.restoreBackup model.flags.apiUrl folderId worldId backupId )
+            ( model, Api.restoreBackup model.flags folderId worldId backupId )
 
         Msgs.BackupWorld folderId worldId name ->
-            ( model, Api.backupWorld model.flags.apiUrl folderId worldId name )
+            ( model, Api.backupWorld model.flags folderId worldId name )
 
         Msgs.FilterWorlds filter ->
             ( { model | folders = setWorldFilter filter model.folders }, Cmd.none )
@@ -135,33 +135,6 @@ updateWorlds model folderId updatedWorlds =
     { model | folders = updatedFolders }
 
 
-updateWorld : FolderModel -> FolderId -> World -> FolderModel
-updateWorld model folderId updatedWorld =
-    let
-        findWorld currentWorld =
-            if updatedWorld.id == currentWorld.id then
-                updatedWorld
-            else
-                currentWorld
-
-        updateWorldsList worlds =
-            List.map findWorld worlds
-
-        findFolder currentFolder =
-            if folderId == currentFolder.id then
-                { currentFolder | worlds = RemoteData.map updateWorldsList currentFolder.worlds }
-            else
-                currentFolder
-
-        updateFolderList folders =
-            List.map findFolder folders
-
-        updatedFolders =
-            RemoteData.map updateFolderList model.folders
-    in
-    { model | folders = updatedFolders }
-
-
 deleteWorld : FolderModel -> FolderId -> WorldId -> FolderModel
 deleteWorld model folderId worldId =
     let
@@ -0,0 +1,63 @@
+module Login exposing (view)
+
+import Html exposing (..)
+import Html.Attributes exposing (class)
+import Html.Events exposing (onSubmit)
+import Material.Button as Button
+import Material.Grid as Grid exposing (Device(..), cell, grid, offset, size)
+import Material.Options as Options
+import Material.Textfield as Textfield
+import Models exposing (Model)
+import Msgs exposing (Msg)
+
+
+view : Model -> Html Msg
+view model =
+    grid []
+        [ cell [ offset Desktop 4, size Desktop 4, size Tablet 8, size Phone 4 ]
+            [ h4 [] [ text "Log in" ]
+            , Html.form [ onSubmit Msgs.Login ]
+                [ Textfield.render Msgs.Mdl
+                    [ 20 ]
+                    model.mdl
+                    [ Textfield.label "Name"
+                    , Textfield.floatingLabel
+                    , Textfield.value model.login.name
+                    , Options.css "width" "100%"
+                    , Options.onInput Msgs.UpdateLoginName
+                    ]
+                    []
+                , Textfield.render Msgs.Mdl
+                    [ 21 ]
+                    model.mdl
+                    [ Textfield.label "Password"
+                    , Textfield.floatingLabel
+                    , Textfield.password
+                    , Textfield.value model.login.password
+                    , Options.css "width" "100%"
+                    , Options.onInput Msgs.UpdateLoginPassword
+                    ]
+                    []
+                , loginError model
+                , Button.render Msgs.Mdl
+                    [ 22 ]
+                    model.mdl
+                    [ Button.ripple
+                    , Button.colored
+                    , Button.raised
+                    , Button.type_ "submit"
+                    ]
+                    [ text "Log in" ]
+                ]
+            ]
+        ]
+
+
+loginError : Model -> Html Msg
+loginError model =
+    case model.login.error of
+        Just message ->
+            p [ class "login-error" ] [ text message ]
+
+        Nothing ->
+            text ""
@@ -1,5 +1,6 @@
 module Main exposing (..)
 
+import Http
 import Material
 import Models exposing (Flags, Model, Route, initialModel)
 import Msgs exposing (Msg)
@@ -8,16 +9,17 @@ import Routing
 import Time exposing (Time, second)
 import Update exposing (update)
 import View exposing (view)
+import WebSocket
 
 
-initialCommands : String -> Route -> Cmd Msg
-initialCommands apiUrl currentRoute =
+initialCommands : Flags -> Route -> Cmd Msg
+initialCommands flags currentRoute =
     let
         folderCommand =
-            Routing.getLocationCommand apiUrl Models.FoldersRoute
+            Routing.getLocationCommand flags Models.FoldersRoute
 
         routeCommand =
-            Routing.getLocationCommand apiUrl currentRoute
+            Routing.getLocationCommand flags currentRoute
     in
     if currentRoute == Models.FoldersRoute then
         folderCommand
@@ -32,17 +34,23 @@ init flags location =
             Routing.parseLocation location
 
         cmds =
-            initialCommands flags.apiUrl currentRoute
+            initialCommands flags currentRoute
     in
     ( initialModel flags currentRoute, cmds )
 
 
 subscriptions : Model -> Sub Msg
 subscriptions model =
-    Sub.batch
-        [ Material.subscriptions Msgs.Mdl model
-        , Time.every (20 * second) Msgs.Poll
-        ]
+    case model.flags.token of
+        Just token ->
+            Sub.batch
+                [ Material.subscriptions Msgs.Mdl model
+                , Time.every (20 * second) Msgs.Poll
+                , WebSocket.listen (model.flags.eventsUrl ++ "?token=" ++ Http.encodeUri token) Msgs.OnEvent
+                ]
+
+        Nothing ->
+            Material.subscriptions Msgs.Mdl model
 
 
 
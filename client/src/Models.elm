@@ -13,6 +13,15 @@ type Route
 
 type alias Flags =
     { apiUrl : String
+    , eventsUrl : String
+    , token : Maybe String
+    }
+
+
+type alias LoginForm =
+    { name : String
+    , password : String
+    , error : Maybe String
     }
 
 
@@ -22,6 +31,7 @@ type alias Model =
     , snackbar : Snackbar.Model Int
     , route : Route
     , folders : Folders.FolderModel
+    , login : LoginForm
     }
 
 
@@ -32,6 +42,15 @@ initialModel flags route =
     , snackbar = Snackbar.model
     , route = route
     , folders = Folders.initialModel
+    , login = initialLogin
+    }
+
+
+initialLogin : LoginForm
+initialLogin =
+    { name = ""
+    , password = ""
+    , error = Nothing
     }
 
 
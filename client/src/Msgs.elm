@@ -14,17 +14,23 @@ type Msg
     | Snackbar (Snackbar.Msg Int)
     | DoNothing
     | Poll Time
+    | OnEvent String
     | ChangeLocation String
     | OnLocationChange Location
     | GoBack
     | AddToast String
+    | UpdateLoginName String
+    | UpdateLoginPassword String
+    | Login
+    | OnLogin (Result Http.Error String)
+    | Logout
     | FolderMsg FolderMsg
     | OnFetchFolders (WebData (List Folder))
     | OnFetchWorlds FolderId (WebData (List World))
     | OnWorldDeleted FolderId WorldId (Result Http.Error ())
-    | OnBackupDeleted FolderId WorldId BackupId (Result Http.Error World)
+    | OnBackupDeleted FolderId WorldId BackupId (Result Http.Error ())
     | OnBackupRestored FolderId WorldId BackupId (Result Http.Error ())
-    | OnWorldBackedUp FolderId WorldId (Result Http.Error World)
+    | OnWorldBackedUp FolderId WorldId (Result Http.Error ())
 
 
 type FolderMsg
@@ -0,0 +1,7 @@
+port module Ports exposing (storeToken)
+
+{-| Keeps the token in the browser, so a reload doesn't log out
+-}
+
+
+port storeToken : Maybe String -> Cmd msg
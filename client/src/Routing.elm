@@ -5,7 +5,7 @@ import Folders.Models exposing (FolderId)
 import Html exposing (Attribute)
 import Html.Events exposing (onWithOptions)
 import Json.Decode as Decode
-import Models exposing (Model, Route(..))
+import Models exposing (Flags, Model, Route(..))
 import Msgs exposing (Msg)
 import Navigation exposing (Location)
 import UrlParser exposing (..)
@@ -41,14 +41,14 @@ parseLocation location =
             NotFoundRoute
 
 
-getLocationCommand : String -> Route -> Cmd Msg
-getLocationCommand apiUrl route =
+getLocationCommand : Flags -> Route -> Cmd Msg
+getLocationCommand flags route =
     case route of
         Models.FoldersRoute ->
-            Api.fetchFolders apiUrl
+            Api.fetchFolders flags
 
         Models.FolderRoute id ->
-            Api.fetchFolderWorlds apiUrl id
+            Api.fetchFolderWorlds flags id
 
         _ ->
             Cmd.none
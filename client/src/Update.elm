@@ -1,13 +1,17 @@
 module Update exposing (..)
 
+import Api exposing (fetchFolderWorlds)
 import Debug exposing (log)
 import Folders.Update exposing (..)
+import Http
 import Material
 import Material.Helpers exposing (cssTransitionStep, delay, map1st, map2nd, pure)
 import Material.Snackbar as Snackbar
 import Models exposing (..)
 import Msgs exposing (Msg)
 import Navigation exposing (back, newUrl)
+import Ports
+import RemoteData exposing (WebData)
 import Routing exposing (getLocationCommand, parseLocation)
 import Task
 
@@ -44,14 +48,61 @@ update msg model =
                 |> map1st (\s -> { model | snackbar = s })
                 |> map2nd (Cmd.map Msgs.Snackbar)
 
+        Msgs.UpdateLoginName name ->
+            let
+                login =
+                    model.login
+            in
+            ( { model | login = { login | name = name } }, Cmd.none )
+
+        Msgs.UpdateLoginPassword password ->
+            let
+                login =
+                    model.login
+            in
+            ( { model | login = { login | password = password } }, Cmd.none )
+
+        Msgs.Login ->
+            ( model, Api.login model.flags.apiUrl model.login.name model.login.password )
+
+        Msgs.OnLogin result ->
+            case result of
+                Ok token ->
+                    let
+                        flags =
+                            model.flags
+
+                        newModel =
+                            { model | flags = { flags | token = Just token }, login = initialLogin }
+                    in
+                    ( newModel
+                    , Cmd.batch [ Ports.storeToken (Just token), reloadCommand newModel ]
+                    )
+
+                Err _ ->
+                    let
+                        login =
+                            model.login
+                    in
+                    ( { model | login = { login | password = "", error = Just "Wrong name or password" } }, Cmd.none )
+
+        Msgs.Logout ->
+            logout model
+
         Msgs.FolderMsg msg_ ->
             updateFolder msg_ model
 
         Msgs.OnFetchFolders response ->
-            ( { model | folders = updateFolders model.folders response }, Cmd.none )
+            if unauthorized response then
+                logout model
+            else
+                ( { model | folders = updateFolders model.folders response }, Cmd.none )
 
         Msgs.OnFetchWorlds folderId response ->
-            ( { model | folders = updateWorlds model.folders folderId response }, Cmd.none )
+            if unauthorized response then
+                logout model
+            else
+                ( { model | folders = updateWorlds model.folders folderId response }, Cmd.none )
 
         Msgs.OnLocationChange location ->
             let
@@ -59,12 +110,15 @@ update msg model =
                     parseLocation location
 
                 newCommand =
-                    getLocationCommand model.flags.apiUrl newRoute
+                    getLocationCommand model.flags newRoute
             in
             ( { model | route = newRoute }, newCommand )
 
         Msgs.Poll _ ->
-            ( model, getLocationCommand model.flags.apiUrl model.route )
+            ( model, getLocationCommand model.flags model.route )
+
+        Msgs.OnEvent _ ->
+            ( model, getLocationCommand model.flags model.route )
 
         Msgs.OnWorldDeleted folderId worldId result ->
             case result of
@@ -81,11 +135,12 @@ update msg model =
 
         Msgs.OnBackupDeleted folderId worldId backupId result ->
             case result of
-                Ok world ->
-                    ( { model | folders = updateWorld model.folders folderId world }
+                Ok _ ->
+                    ( model
                     , Cmd.batch
                         [ createCommand (Msgs.FolderMsg Msgs.CancelConfirm)
-                        , createToast "Backup has been deleted"
+                        , createToast "Deleting the backup"
+                        , fetchFolderWorlds model.flags folderId
                         ]
                     )
 
@@ -102,7 +157,7 @@ update msg model =
                     ( model
                     , Cmd.batch
                         [ createCommand (Msgs.FolderMsg Msgs.CancelConfirm)
-                        , createToast "Backup has been restored"
+                        , createToast "Restoring the backup"
                         ]
                     )
 
@@ -111,11 +166,12 @@ update msg model =
 
         Msgs.OnWorldBackedUp folderId worldId result ->
             case result of
-                Ok world ->
-                    ( { model | folders = updateWorld model.folders folderId world }
+                Ok _ ->
+                    ( model
                     , Cmd.batch
                         [ createCommand (Msgs.FolderMsg Msgs.CancelConfirm)
-                        , createToast "World was backed up"
+                        , createToast "Backing up the world"
+                        , fetchFolderWorlds model.flags folderId
                         ]
                     )
 
@@ -127,6 +183,38 @@ update msg model =
                     ( model, Cmd.none )
 
 
+{-| The token expired or the user is gone, so it is back to the login
+-}
+unauthorized : WebData a -> Bool
+unauthorized response =
+    case response of
+        RemoteData.Failure (Http.BadStatus r) ->
+            r.status.code == 401
+
+        _ ->
+            False
+
+
+logout : Model -> ( Model, Cmd Msg )
+logout model =
+    let
+        flags =
+            model.flags
+    in
+    ( { model | flags = { flags | token = Nothing } }, Ports.storeToken Nothing )
+
+
+reloadCommand : Model -> Cmd Msg
+reloadCommand model =
+    if model.route == FoldersRoute then
+        getLocationCommand model.flags model.route
+    else
+        Cmd.batch
+            [ getLocationCommand model.flags FoldersRoute
+            , getLocationCommand model.flags model.route
+            ]
+
+
 createCommand : msg -> Cmd msg
 createCommand msg =
     Task.succeed msg
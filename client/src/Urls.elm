@@ -3,6 +3,11 @@ module Urls exposing (..)
 import Folders.Models exposing (BackupId, FolderId, WorldId)
 
 
+login : String -> String
+login baseApiUrl =
+    baseApiUrl ++ "/auth/login"
+
+
 folders : String -> String
 folders baseApiUrl =
     baseApiUrl ++ "/folders"
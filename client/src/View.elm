@@ -5,6 +5,7 @@ import Folders.Models exposing (FolderId)
 import Folders.View
 import Html exposing (..)
 import Html.Attributes exposing (class, href, style)
+import Login
 import Material.Button as Button
 import Material.Layout as Layout
 import Material.Options as Options exposing (Style)
@@ -36,6 +37,7 @@ pageHeader model =
     h3 [ style [ ( "padding-left", "10px" ) ] ]
         [ homeButton model
         , text "World Backup"
+        , logoutButton model
         ]
 
 
@@ -51,8 +53,36 @@ homeButton model =
         [ i [ class "fa fa-home" ] [] ]
 
 
+logoutButton : Model -> Html Msg
+logoutButton model =
+    case model.flags.token of
+        Just _ ->
+            Button.render Msgs.Mdl
+                [ 1 ]
+                model.mdl
+                [ Button.icon
+                , Options.onClick Msgs.Logout
+                , Options.css "float" "right"
+                , Options.css "margin-right" "20px"
+                ]
+                [ i [ class "fa fa-sign-out" ] [] ]
+
+        Nothing ->
+            text ""
+
+
 page : Model -> Html Msgs.Msg
 page model =
+    case model.flags.token of
+        Just _ ->
+            routePage model
+
+        Nothing ->
+            Login.view model
+
+
+routePage : Model -> Html Msgs.Msg
+routePage model =
     case model.route of
         Models.FoldersRoute ->
             Folders.List.view model
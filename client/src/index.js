@@ -6,5 +6,22 @@ require('../styles/main.scss');
 const Elm = require('./Main.elm');
 const mountNode = document.getElementById('main');
 
+// the event stream is a websocket, which needs a full ws:// url even when
+// the api is on the same host
+const eventsUrl = new URL(window.options.apiUrl + '/events', window.location.href);
+eventsUrl.protocol = eventsUrl.protocol === 'https:' ? 'wss:' : 'ws:';
+window.options.eventsUrl = eventsUrl.href;
+
+// the token is kept between visits, Elm stores it through a port
+window.options.token = localStorage.getItem('token');
+
 // .embed() can take an optional second argument. This would be an object describing the data we need to start a program, i.e. a userID or some token
 const app = Elm.Main.embed(mountNode, window.options);
+
+app.ports.storeToken.subscribe(function (token) {
+	if (token) {
+		localStorage.setItem('token', token);
+	} else {
+		localStorage.removeItem('token');
+	}
+});
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"net/http"
+
+	"world-backup/server/audit"
+	"world-backup/server/auth"
+	"world-backup/server/data"
+
+	"github.com/labstack/echo"
+)
+
+var WorldNotFoundResponse = ErrorResponse{Message: "World not found"}
+
+type worldAccessRequest struct {
+	OwnerId    string   `json:"ownerId"`
+	SharedWith []string `json:"sharedWith"`
+}
+
+type folderAccessRequest struct {
+	DefaultOwnerId string `json:"defaultOwnerId"`
+}
+
+// canSee is true when the user may see the world. Parents and admins see
+// every world, players the ones they own or that were shared with them.
+func canSee(user *data.User, world *data.World) bool {
+	if user == nil || world == nil {
+		return false
+	}
+
+	return auth.Allows(user.Role, auth.Parent) || world.HasAccess(user.Id)
+}
+
+// visibleWorlds is the worlds in the folder the user may see
+func visibleWorlds(user *data.User, folder *data.Folder) []*data.World {
+	worlds := []*data.World{}
+	for _, w := range folder.Worlds {
+		if canSee(user, w) {
+			worlds = append(worlds, w)
+		}
+	}
+
+	return worlds
+}
+
+// findWorld looks for the world in every folder
+func (api *API) findWorld(worldId string) *data.World {
+	for _, f := range api.Db.Folders() {
+		if w := f.GetWorld(worldId); w != nil {
+			return w
+		}
+	}
+
+	return nil
+}
+
+// canSeeWorldId is canSee for things that only know the world id, like
+// jobs and events. Parents and admins also see those of removed worlds.
+func (api *API) canSeeWorldId(user *data.User, worldId string) bool {
+	if user != nil && auth.Allows(user.Role, auth.Parent) {
+		return true
+	}
+
+	return canSee(user, api.findWorld(worldId))
+}
+
+// routeWorld is the world the route is on, or nil when there is none
+func (api *API) routeWorld(ctx echo.Context) *data.World {
+	folder := api.Db.GetFolder(ctx.Param("id"))
+	if folder == nil {
+		return nil
+	}
+
+	return folder.GetWorld(ctx.Param("wid"))
+}
+
+// scopeWorlds answers as if a world the user may not see doesn't exist, for
+// every route on a world
+func (api *API) scopeWorlds(f echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		if ctx.Param("wid") == "" {
+			return f(ctx)
+		}
+
+		if !canSee(getUser(ctx), api.routeWorld(ctx)) {
+			return ctx.JSON(http.StatusNotFound, WorldNotFoundResponse)
+		}
+
+		return f(ctx)
+	}
+}
+
+// allowOwner lets through the owner of the world, and parents and admins
+func (api *API) allowOwner(f echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		user := getUser(ctx)
+		if user == nil {
+			return ctx.JSON(http.StatusForbidden, ForbiddenResponse)
+		}
+
+		if !auth.Allows(user.Role, auth.Parent) {
+			world := api.routeWorld(ctx)
+			if world == nil || world.OwnerId != user.Id {
+				return ctx.JSON(http.StatusForbidden, ForbiddenResponse)
+			}
+		}
+
+		return f(ctx)
+	}
+}
+
+// setWorldAccess gives the world to a user and shares it with others, an
+// empty owner leaves it to parents and admins
+func (api *API) setWorldAccess(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	r := new(worldAccessRequest)
+	if err := ctx.Bind(r); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	world := api.routeWorld(ctx)
+
+	ids := append([]string{r.OwnerId}, r.SharedWith...)
+	for _, id := range ids {
+		if id != "" && api.Db.GetUser(id) == nil {
+			return ctx.JSON(http.StatusBadRequest, UserNotFoundResponse)
+		}
+	}
+
+	entry := worldEntry(ctx, audit.WorldAccess)
+	entry.Before = world.OwnerId
+	entry.After = r.OwnerId
+
+	world.OwnerId = r.OwnerId
+	world.SharedWith = r.SharedWith
+
+	err := api.Db.Save()
+	api.audit(log, entry, err)
+	if err != nil {
+		log.Errorf("Failed to save access to world %s: %v", world.Id, err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+
+	log.Infof("World %s is owned by [%s] and shared with %v", world.Id, r.OwnerId, r.SharedWith)
+	return ctx.JSON(http.StatusOK, world)
+}
+
+// setFolderAccess sets who worlds found in the folder from now on belong to
+func (api *API) setFolderAccess(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	r := new(folderAccessRequest)
+	if err := ctx.Bind(r); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	folder := api.Db.GetFolder(ctx.Param("id"))
+	if folder == nil {
+		return ctx.JSON(http.StatusNotFound, FolderNotFoundResponse)
+	}
+
+	if r.DefaultOwnerId != "" && api.Db.GetUser(r.DefaultOwnerId) == nil {
+		return ctx.JSON(http.StatusBadRequest, UserNotFoundResponse)
+	}
+
+	folder.DefaultOwnerId = r.DefaultOwnerId
+
+	if err := api.Db.Save(); err != nil {
+		log.Errorf("Failed to save access to folder %s: %v", folder.Id, err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+
+	log.Infof("New worlds in folder %s belong to [%s]", folder.Id, r.DefaultOwnerId)
+	return ctx.JSON(http.StatusOK, folderToListItem(folder, folder.Worlds))
+}
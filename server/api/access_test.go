@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"world-backup/server/auth"
+	"world-backup/server/data"
+	"world-backup/server/events"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPI_Access(t *testing.T) {
+	Convey("Given two players sharing a folder", t, func() {
+		steve := &data.User{Id: "u1", Name: "steve", Role: auth.Player}
+		alex := &data.User{Id: "u2", Name: "alex", Role: auth.Player}
+		parent := &data.User{Id: "u3", Name: "mum", Role: auth.Parent}
+
+		mine := &data.World{Id: "w1", OwnerId: "u1"}
+		shared := &data.World{Id: "w2", OwnerId: "u2", SharedWith: []string{"u1"}}
+		theirs := &data.World{Id: "w3", OwnerId: "u2"}
+		saves := &data.Folder{Id: "f1", Worlds: []*data.World{mine, shared, theirs}}
+		other := &data.Folder{Id: "f2", Worlds: []*data.World{{Id: "w4"}}}
+
+		dbMock := new(ApiDbMock)
+		dbMock.On("Folders").Return([]*data.Folder{saves, other})
+		dbMock.On("GetFolder", "f1").Return(saves)
+		dbMock.On("GetFolder", "missing").Return((*data.Folder)(nil))
+		dbMock.On("GetUser", "u1").Return(steve)
+		dbMock.On("GetUser", "u2").Return(alex)
+		dbMock.On("GetUser", "nobody").Return((*data.User)(nil))
+		dbMock.On("Save").Return(nil)
+
+		api := &API{log: logrus.WithField("test", "TestAPI_Access"), Db: dbMock}
+
+		newContext := func(method, folderId, worldId, body string, as *data.User) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(method, "/api/folders/"+folderId+"/worlds/"+worldId, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id", "wid")
+			c.SetParamValues(folderId, worldId)
+			c.Set(userKey, as)
+			return c, rec
+		}
+
+		reached := 0
+		handler := func(ctx echo.Context) error {
+			reached++
+			return ctx.JSON(http.StatusOK, nil)
+		}
+
+		Convey("When a player lists the folders and worlds", func() {
+			c, rec := newContext(echo.GET, "", "", "", steve)
+			api.getFolders(c)
+			var folders []FolderListItem
+			json.Unmarshal(rec.Body.Bytes(), &folders)
+
+			c2, rec2 := newContext(echo.GET, "f1", "", "", steve)
+			api.getWorlds(c2)
+			var worlds []data.World
+			json.Unmarshal(rec2.Body.Bytes(), &worlds)
+
+			Convey("It should only show their own and shared worlds", func() {
+				So(len(folders), ShouldEqual, 1)
+				So(folders[0].NumberOfWorlds, ShouldEqual, 2)
+
+				So(len(worlds), ShouldEqual, 2)
+				So(worlds[0].Id, ShouldEqual, "w1")
+				So(worlds[1].Id, ShouldEqual, "w2")
+			})
+		})
+
+		Convey("When a parent lists the folders", func() {
+			c, rec := newContext(echo.GET, "", "", "", parent)
+			api.getFolders(c)
+			var folders []FolderListItem
+			json.Unmarshal(rec.Body.Bytes(), &folders)
+
+			Convey("It should show every world", func() {
+				So(len(folders), ShouldEqual, 2)
+				So(folders[0].NumberOfWorlds, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When a player goes to worlds", func() {
+			for _, id := range []string{"w1", "w2", "w3"} {
+				c, _ := newContext(echo.GET, "f1", id, "", steve)
+				api.scopeWorlds(handler)(c)
+			}
+			c, rec := newContext(echo.GET, "f1", "w3", "", steve)
+			api.scopeWorlds(handler)(c)
+			c2, rec2 := newContext(echo.GET, "missing", "w1", "", steve)
+			api.scopeWorlds(handler)(c2)
+
+			Convey("It should act as if the ones they can't see don't exist", func() {
+				So(reached, ShouldEqual, 2)
+				So(rec.Code, ShouldEqual, http.StatusNotFound)
+				So(rec2.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When players restore worlds", func() {
+			c, _ := newContext(echo.PATCH, "f1", "w1", "", steve)
+			api.allowOwner(handler)(c)
+			c2, rec2 := newContext(echo.PATCH, "f1", "w2", "", steve)
+			api.allowOwner(handler)(c2)
+			c3, _ := newContext(echo.PATCH, "f1", "w3", "", parent)
+			api.allowOwner(handler)(c3)
+
+			Convey("It should only let owners and parents", func() {
+				So(reached, ShouldEqual, 2)
+				So(rec2.Code, ShouldEqual, http.StatusForbidden)
+			})
+		})
+
+		Convey("When events and jobs are about other worlds", func() {
+			Convey("It should only let a player see their own", func() {
+				So(api.canSeeEvent(steve, events.Event{WorldId: "w1"}), ShouldBeTrue)
+				So(api.canSeeEvent(steve, events.Event{WorldId: "w3"}), ShouldBeFalse)
+				So(api.canSeeEvent(steve, events.Event{WorldId: "gone"}), ShouldBeFalse)
+				So(api.canSeeEvent(steve, events.Event{}), ShouldBeTrue)
+				So(api.canSeeWorldId(parent, "gone"), ShouldBeTrue)
+			})
+		})
+
+		Convey("When an admin gives a world to someone", func() {
+			c, rec := newContext(echo.PUT, "f1", "w3", `{"ownerId":"u1","sharedWith":["u2"]}`, parent)
+			api.setWorldAccess(c)
+
+			Convey("It should change hands", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(theirs.OwnerId, ShouldEqual, "u1")
+				So(theirs.SharedWith, ShouldResemble, []string{"u2"})
+				dbMock.AssertCalled(t, "Save")
+			})
+		})
+
+		Convey("When a world is given to someone who doesn't exist", func() {
+			c, rec := newContext(echo.PUT, "f1", "w3", `{"ownerId":"u1","sharedWith":["nobody"]}`, parent)
+			api.setWorldAccess(c)
+
+			Convey("It should be refused", func() {
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+				So(theirs.OwnerId, ShouldEqual, "u2")
+			})
+		})
+
+		Convey("When an admin sets who new worlds in a folder belong to", func() {
+			c, rec := newContext(echo.PUT, "f1", "", `{"defaultOwnerId":"u2"}`, parent)
+			api.setFolderAccess(c)
+			c2, rec2 := newContext(echo.PUT, "missing", "", `{"defaultOwnerId":"u2"}`, parent)
+			api.setFolderAccess(c2)
+
+			Convey("It should be kept with the folder", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(saves.DefaultOwnerId, ShouldEqual, "u2")
+				So(rec2.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"world-backup/server/audit"
+	"world-backup/server/conf"
+
+	"github.com/labstack/echo"
+)
+
+type IReloader interface {
+	Reload() (*conf.ReloadResult, error)
+}
+
+type IWatcher interface {
+	LastCheck() (time.Time, time.Duration)
+}
+
+// Check is one of the things the server needs to back worlds up, Message
+// says what is wrong when it isn't Ok
+type Check struct {
+	Name    string `json:"name"`
+	Ok      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// HealthResponse is the answer to probes of the server
+type HealthResponse struct {
+	Status string  `json:"status"`
+	Checks []Check `json:"checks,omitempty"`
+}
+
+// StatusError is the last error of a folder, or of a world when WorldId is
+// set
+type StatusError struct {
+	FolderId string    `json:"folderId"`
+	WorldId  string    `json:"worldId,omitempty"`
+	Path     string    `json:"path"`
+	Message  string    `json:"message"`
+	At       time.Time `json:"at"`
+}
+
+// StatusResponse is everything the server knows about its health
+type StatusResponse struct {
+	Ready     bool          `json:"ready"`
+	Checks    []Check       `json:"checks"`
+	LastCheck time.Time     `json:"lastCheck"`
+	Errors    []StatusError `json:"errors"`
+}
+
+// healthz answers as long as the server is running
+func (api *API) healthz(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// readyz answers 503 when the server can't back worlds up, naming the
+// checks that failed. What went wrong is only told by the status.
+func (api *API) readyz(ctx echo.Context) error {
+	checks, ready := api.readiness()
+	if ready {
+		return ctx.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+	}
+
+	failed := []Check{}
+	for _, c := range checks {
+		if !c.Ok {
+			failed = append(failed, Check{Name: c.Name})
+		}
+	}
+
+	return ctx.JSON(http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", Checks: failed})
+}
+
+// getStatus has the readiness checks with why they failed and the last
+// error of every folder and world that has one, to see why backups stalled
+func (api *API) getStatus(ctx echo.Context) error {
+	checks, ready := api.readiness()
+
+	status := StatusResponse{Ready: ready, Checks: checks, Errors: []StatusError{}}
+	if api.Watcher != nil {
+		status.LastCheck, _ = api.Watcher.LastCheck()
+	}
+
+	for _, f := range api.Db.Folders() {
+		if f.LastError != nil {
+			status.Errors = append(status.Errors, StatusError{FolderId: f.Id, Path: f.Path, Message: f.LastError.Message, At: f.LastError.At})
+		}
+
+		for _, w := range f.Worlds {
+			if w.LastError != nil {
+				status.Errors = append(status.Errors, StatusError{FolderId: f.Id, WorldId: w.Id, Path: w.FullPath, Message: w.LastError.Message, At: w.LastError.At})
+			}
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, status)
+}
+
+// readiness runs the checks, ready is true when all of them are ok
+func (api *API) readiness() (checks []Check, ready bool) {
+	config := api.getConfig()
+
+	checks = []Check{
+		api.checkCatalog(),
+		api.checkDirs("backupDir", []string{config.BackupDir}),
+		api.checkDirs("watchDirs", api.watchedDirs(config)),
+		api.checkFreeSpace(config),
+	}
+	if api.Watcher != nil {
+		checks = append(checks, api.checkWatcher())
+	}
+
+	ready = true
+	for _, c := range checks {
+		ready = ready && c.Ok
+	}
+
+	return checks, ready
+}
+
+// checkCatalog fails when the last save failed, or when the next one would
+func (api *API) checkCatalog() Check {
+	if err := api.Db.SaveError(); err != nil {
+		return Check{Name: "catalog", Message: fmt.Sprintf("Failed to save the catalog: %v", err)}
+	}
+
+	if err := api.Db.CheckWritable(); err != nil {
+		return Check{Name: "catalog", Message: fmt.Sprintf("Can't write next to the catalog: %v", err)}
+	}
+
+	return Check{Name: "catalog", Ok: true}
+}
+
+// watchedDirs are the watchDirs of the config along with the folders added
+// through the api, leaving out the paused ones
+func (api *API) watchedDirs(config *conf.Config) []string {
+	dirs := append([]string{}, config.WatchDirs...)
+	listed := map[string]bool{}
+	for _, d := range dirs {
+		listed[d] = true
+	}
+
+	for _, f := range api.Db.Folders() {
+		if f.Watched() && !listed[f.Path] {
+			dirs = append(dirs, f.Path)
+			listed[f.Path] = true
+		}
+	}
+
+	return dirs
+}
+
+func (api *API) checkDirs(name string, dirs []string) Check {
+	var missing []string
+	for _, d := range dirs {
+		if exists, err := api.Fs.DirExists(d); err != nil || !exists {
+			missing = append(missing, d)
+		}
+	}
+
+	if len(missing) > 0 {
+		return Check{Name: name, Message: "Missing " + strings.Join(missing, ", ")}
+	}
+
+	return Check{Name: name, Ok: true}
+}
+
+func (api *API) checkFreeSpace(config *conf.Config) Check {
+	free, err := api.Fs.FreeSpace(config.BackupDir)
+	if err != nil {
+		return Check{Name: "freeSpace", Message: fmt.Sprintf("Failed to read the free space of %s: %v", config.BackupDir, err)}
+	}
+
+	if min := config.Health.MinFreeBytes(); free < min {
+		return Check{Name: "freeSpace", Message: fmt.Sprintf("%d MB free in %s, %d MB needed", free/1024/1024, config.BackupDir, min/1024/1024)}
+	}
+
+	return Check{Name: "freeSpace", Ok: true}
+}
+
+// checkWatcher fails when the watcher missed two checks in a row, it is
+// stuck or stopped then
+func (api *API) checkWatcher() Check {
+	last, tick := api.Watcher.LastCheck()
+	if last.IsZero() {
+		return Check{Name: "watcher", Message: "The watcher hasn't checked the folders yet"}
+	}
+
+	if since := getNow().Sub(last); since > 2*tick {
+		return Check{Name: "watcher", Message: fmt.Sprintf("The watcher last checked the folders %s ago, it checks every %s", since/time.Second*time.Second, tick)}
+	}
+
+	return Check{Name: "watcher", Ok: true}
+}
+
+// reloadConfig reads the config file again and switches to it. A config
+// that can't be used is reported and the running one kept.
+func (api *API) reloadConfig(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	result, err := api.Reloader.Reload()
+	api.audit(log, auditEntry(ctx, audit.ConfigReloaded), err)
+	if err != nil {
+		log.Warnf("Kept the running config: %v", err)
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	log.Infof("Reloaded the config, restart needed for %v", result.RestartNeeded)
+	return ctx.JSON(http.StatusOK, result)
+}
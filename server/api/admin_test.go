@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"world-backup/server/conf"
+	"world-backup/server/data"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAPI_ReloadConfig(t *testing.T) {
+	Convey("Given an api that can reload its config", t, func() {
+		reloaderMock := new(ReloaderMock)
+		api := &API{log: logrus.WithField("test", "TestAPI_ReloadConfig"), Reloader: reloaderMock}
+
+		e := echo.New()
+		req, _ := http.NewRequest(echo.POST, "/api/admin/reload", strings.NewReader(""))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		Convey("When the config can be used", func() {
+			reloaderMock.On("Reload").Return(&conf.ReloadResult{Applied: true, RestartNeeded: []string{"port"}}, nil)
+			api.reloadConfig(c)
+
+			Convey("It should say what needs a restart", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(rec.Body.String(), ShouldContainSubstring, `"restartNeeded":["port"]`)
+			})
+		})
+
+		Convey("When the config can't be used", func() {
+			reloaderMock.On("Reload").Return((*conf.ReloadResult)(nil), errors.New("checkInterval [often] is not an interval like 1m"))
+			api.reloadConfig(c)
+
+			Convey("It should say why", func() {
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+				So(rec.Body.String(), ShouldContainSubstring, "checkInterval")
+			})
+		})
+	})
+}
+
+func TestAPI_Health(t *testing.T) {
+	Convey("Given an api with a watcher", t, func() {
+		now := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+		origGetNow := getNow
+		getNow = func() time.Time { return now }
+		defer func() { getNow = origGetNow }()
+
+		mockDb := new(ApiDbMock)
+		mockFs := new(ApiFsMock)
+		watcherMock := new(WatcherMock)
+		api := &API{
+			log:     logrus.WithField("test", "TestAPI_Health"),
+			config:  &conf.Config{BackupDir: "/backups", WatchDirs: []string{"/saves", "/server/saves"}, Health: conf.HealthConfig{MinFreeSpace: 100}},
+			Db:      mockDb,
+			Fs:      mockFs,
+			Watcher: watcherMock,
+		}
+
+		request := func(handler echo.HandlerFunc) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest(echo.GET, "/", nil)
+			rec := httptest.NewRecorder()
+			handler(echo.New().NewContext(req, rec))
+			return rec
+		}
+
+		Convey("When everything is there", func() {
+			mockDb.On("SaveError").Return(nil)
+			mockDb.On("CheckWritable").Return(nil)
+			mockDb.On("Folders").Return([]*data.Folder{{Id: "f1", Path: "/saves"}})
+			mockFs.On("DirExists", mock.Anything).Return(true, nil)
+			mockFs.On("FreeSpace", "/backups").Return(uint64(200*1024*1024), nil)
+			watcherMock.On("LastCheck").Return(now.Add(-time.Minute), time.Minute)
+
+			Convey("It should be ready", func() {
+				So(request(api.healthz).Code, ShouldEqual, http.StatusOK)
+				So(request(api.readyz).Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Convey("When a watch dir is gone, the disk is full and the watcher stopped", func() {
+			mockDb.On("SaveError").Return(nil)
+			mockDb.On("CheckWritable").Return(nil)
+			mockDb.On("Folders").Return([]*data.Folder{
+				{
+					Id:        "f1",
+					Path:      "/server/saves",
+					LastError: &data.Failure{Message: "open /server/saves: no such file or directory", At: now},
+					Worlds: []*data.World{
+						{Id: "w1", FullPath: "/server/saves/survival", LastError: &data.Failure{Message: "disk full", At: now}},
+						{Id: "w2", FullPath: "/server/saves/creative"},
+					},
+				},
+				{Id: "f2", Path: "/added/saves"},
+				{Id: "f3", Path: "/paused/saves", Paused: true},
+			})
+			mockFs.On("DirExists", "/server/saves").Return(false, nil)
+			mockFs.On("DirExists", "/added/saves").Return(false, nil)
+			mockFs.On("DirExists", "/paused/saves").Return(false, nil)
+			mockFs.On("DirExists", mock.Anything).Return(true, nil)
+			mockFs.On("FreeSpace", "/backups").Return(uint64(50*1024*1024), nil)
+			watcherMock.On("LastCheck").Return(now.Add(-5*time.Minute), time.Minute)
+
+			Convey("It should still be healthy", func() {
+				So(request(api.healthz).Code, ShouldEqual, http.StatusOK)
+			})
+
+			Convey("It should not be ready, naming what failed but not why", func() {
+				rec := request(api.readyz)
+				So(rec.Code, ShouldEqual, http.StatusServiceUnavailable)
+
+				var health HealthResponse
+				json.Unmarshal(rec.Body.Bytes(), &health)
+				So(health.Checks, ShouldResemble, []Check{{Name: "watchDirs"}, {Name: "freeSpace"}, {Name: "watcher"}})
+			})
+
+			Convey("The status should say why, along with the last errors", func() {
+				rec := request(api.getStatus)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+
+				var status StatusResponse
+				json.Unmarshal(rec.Body.Bytes(), &status)
+				So(status.Ready, ShouldBeFalse)
+				So(status.Checks[2].Message, ShouldEqual, "Missing /server/saves, /added/saves")
+				So(status.Checks[3].Message, ShouldEqual, "50 MB free in /backups, 100 MB needed")
+				So(status.Checks[4].Message, ShouldContainSubstring, "5m0s ago")
+				So(len(status.Errors), ShouldEqual, 2)
+				So(status.Errors[0].WorldId, ShouldEqual, "")
+				So(status.Errors[1].WorldId, ShouldEqual, "w1")
+				So(status.Errors[1].Message, ShouldEqual, "disk full")
+			})
+		})
+
+		Convey("When the catalog can't be saved", func() {
+			mockDb.On("SaveError").Return(errors.New("read-only file system"))
+			mockDb.On("Folders").Return([]*data.Folder{})
+			mockFs.On("DirExists", mock.Anything).Return(true, nil)
+			mockFs.On("FreeSpace", "/backups").Return(uint64(200*1024*1024), nil)
+			watcherMock.On("LastCheck").Return(now, time.Minute)
+
+			Convey("It should not be ready", func() {
+				So(request(api.readyz).Code, ShouldEqual, http.StatusServiceUnavailable)
+			})
+		})
+
+		Convey("When nothing can be written next to the catalog", func() {
+			mockDb.On("SaveError").Return(nil)
+			mockDb.On("CheckWritable").Return(errors.New("permission denied"))
+			mockDb.On("Folders").Return([]*data.Folder{})
+			mockFs.On("DirExists", mock.Anything).Return(true, nil)
+			mockFs.On("FreeSpace", "/backups").Return(uint64(200*1024*1024), nil)
+			watcherMock.On("LastCheck").Return(now, time.Minute)
+
+			Convey("It should not be ready before the next save fails", func() {
+				So(request(api.readyz).Code, ShouldEqual, http.StatusServiceUnavailable)
+
+				var status StatusResponse
+				json.Unmarshal(request(api.getStatus).Body.Bytes(), &status)
+				So(status.Checks[0].Message, ShouldEqual, "Can't write next to the catalog: permission denied")
+			})
+		})
+	})
+}
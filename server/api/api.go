@@ -1,64 +1,250 @@
 package api
 
 import (
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo"
 
 	"fmt"
+	"world-backup/server/auth"
 	"world-backup/server/conf"
+	"world-backup/server/crypt"
 	"world-backup/server/data"
+	"world-backup/server/events"
+	"world-backup/server/filter"
+	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/storage"
+	"world-backup/server/throttle"
+
+	"github.com/spf13/afero"
 )
 
 var getNow = time.Now
 
+const (
+	HeaderBackupPassphrase = "X-Backup-Passphrase"
+	HeaderBackupIdentity   = "X-Backup-Identity"
+)
+
 type IApiDb interface {
+	Lock()
+	Unlock()
+
 	Folders() []*data.Folder
 	GetFolder(id string) *data.Folder
+	AddFolder(path string) *data.Folder
+	InsertFolder(f *data.Folder)
+	GetFolderByPath(path string) *data.Folder
+	RemoveFolder(id string) bool
 	Save() error
+	SaveError() error
+	CheckWritable() error
+
+	Users() []*data.User
+	AddUser(name, passwordHash, role string) *data.User
+	GetUser(id string) *data.User
+	GetUserByName(name string) *data.User
+	DeleteUser(id string) bool
+}
+
+type IAuth interface {
+	Issue(user *data.User) (string, time.Time, error)
+	Parse(token string) (*jwt.Token, *auth.Claims, error)
+}
+
+type IReplicationQueue interface {
+	Enqueue(backup *data.Backup)
+	Forget(backupId string)
+	Status(backup *data.Backup) []data.Replication
+}
+
+type IJobs interface {
+	Submit(kind, worldId, backupId string, fn jobs.Func) jobs.Job
+	Get(id string) (jobs.Job, error)
+	List() []jobs.Job
+	Cancel(id string) (jobs.Job, error)
+}
+
+type IEventBus interface {
+	Subscribe(lastId int64) *events.Subscription
 }
 
 type IApiFileSystem interface {
 	Exists(path string) (bool, error)
+	DirExists(path string) (bool, error)
 	Remove(name string) error
 	RemoveAll(name string) error
-	Unzip(src, dest string) error
+	Extract(file fs.ArchiveFile, dest string) error
 	Rename(oldname, newname string) error
-	Getwd() (dir string, err error)
-	Chdir(dir string) error
-	Zip(source, target string) error
+	Archive(source, target string, opts fs.ArchiveOptions, rules filter.Rules) error
+	ExportMcworld(backup fs.ArchiveFile, worldDir string, w io.Writer) error
+	ImportMcworld(src io.ReaderAt, size int64, worldDir, target string, encryption *crypt.Config) error
+	OpenArchive(file fs.ArchiveFile) (fs.ArchiveReader, error)
+	VerifyArchive(file fs.ArchiveFile) error
+	CopyArchive(file fs.ArchiveFile, w io.Writer) error
+	ReadFile(filename string) ([]byte, error)
+	WriteFile(filename string, data []byte, perm os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+	Open(name string) (afero.File, error)
+	Create(name string) (afero.File, error)
+	FreeSpace(path string) (uint64, error)
 }
 
 // API is the data holder for the API
 type API struct {
-	log    *logrus.Entry
-	config *conf.Config
-	Server IServer
-	Db     IApiDb
-	Fs     IApiFileSystem
+	log          *logrus.Entry
+	config       *conf.Config
+	Server       IServer
+	Db           IApiDb
+	Fs           IApiFileSystem
+	Destinations storage.Set
+	Queue        IReplicationQueue
+	Throttle     *throttle.Throttle
+	Jobs         IJobs
+	Events       IEventBus
+	Auth         IAuth
+	Audit        IAudit
+	Reloader     IReloader
+	Watcher      IWatcher
+
+	mu sync.RWMutex
+}
+
+// getConfig is the config in use, it changes when the config is reloaded
+func (api *API) getConfig() *conf.Config {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	return api.config
+}
+
+// getDestinations are where backups are copied to
+func (api *API) getDestinations() storage.Set {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+
+	return api.Destinations
+}
+
+// Reload switches the api to a reloaded config and the destinations opened
+// from it, requests already running finish with the old ones
+func (api *API) Reload(c *conf.Config, destinations storage.Set) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.config = c
+	api.Destinations = destinations
 }
 
 type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
+// backupFile is where the backup is stored, in which format, and the keys
+// to decrypt it with. Keys given with the request are used along with the
+// configured ones, for backups the server can't decrypt on its own.
+func (api *API) backupFile(ctx echo.Context, backup *data.Backup) fs.ArchiveFile {
+	return fs.ArchiveFile{
+		Path:      path.Join(api.getConfig().BackupDir, backup.Name),
+		Format:    fs.Format(backup.Format),
+		Encrypted: backup.KeyId != "",
+		Keys:      crypt.Merge(api.getConfig().Keys(backup.KeyId), requestKeys(ctx)),
+	}
+}
+
+// localBackup makes sure the backup is in the backup folder, fetching it
+// from a destination that keeps a copy when the local file is gone. It is
+// false when there is no copy anywhere.
+func (api *API) localBackup(log *logrus.Entry, backup *data.Backup) (bool, error) {
+	fullBackupPath := path.Join(api.getConfig().BackupDir, backup.Name)
+
+	if exists, _ := api.Fs.Exists(fullBackupPath); exists {
+		return true, nil
+	}
+
+	if len(backup.Copies) == 0 {
+		return false, nil
+	}
+
+	if err := storage.Fetch(api.Fs, log, api.getDestinations(), backup, fullBackupPath); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// startJob runs fn in the background as a job on the world and answers with
+// the job, which can be followed at /api/jobs/:id
+func (api *API) startJob(ctx echo.Context, kind string, world *data.World, backupId string, fn jobs.Func) error {
+	job := api.Jobs.Submit(kind, world.Id, backupId, fn)
+	getLogger(ctx).Infof("Started %s job %s", kind, job.Id)
+
+	return ctx.JSON(http.StatusAccepted, job)
+}
+
+// replicate queues a new backup to be copied to the configured destinations
+func (api *API) replicate(backup *data.Backup) {
+	if len(api.getDestinations()) == 0 {
+		return
+	}
+
+	api.Queue.Enqueue(backup)
+}
+
+func requestKeys(ctx echo.Context) *crypt.Config {
+	header := ctx.Request().Header
+	passphrase := header.Get(HeaderBackupPassphrase)
+	identities := header[HeaderBackupIdentity]
+
+	if passphrase == "" && len(identities) == 0 {
+		return nil
+	}
+
+	return &crypt.Config{Passphrase: passphrase, Identities: identities}
+}
+
+// archiveError answers a request that failed to read a backup
+func archiveError(ctx echo.Context, err error) error {
+	if err == crypt.NoKeyError || err == crypt.WrongKeyError {
+		return ctx.JSON(http.StatusForbidden, ErrorResponse{Message: err.Error()})
+	}
+
+	return ctx.JSON(http.StatusInternalServerError, nil)
+}
+
 // Start will start the API on the specified port
 func (api *API) Start() error {
-	return api.Server.Start(fmt.Sprintf(":%d", api.config.Port))
+	return api.Server.Start(fmt.Sprintf(":%d", api.getConfig().Port))
 }
 
 // NewAPI will create an api instance that is ready to start
-func NewAPI(log *logrus.Entry, config *conf.Config, db IApiDb, fs IApiFileSystem) *API {
+func NewAPI(log *logrus.Entry, config *conf.Config, db IApiDb, fs IApiFileSystem, destinations storage.Set, queue IReplicationQueue, limits *throttle.Throttle, jobs IJobs, bus IEventBus, authenticator IAuth, auditLog IAudit, reloader IReloader, watcher IWatcher) *API {
 	echoServer := EchoServer{e: echo.New()}
 
 	// create the api
 	api := &API{
-		config: config,
-		log:    log.WithField("component", "api"),
-		Server: echoServer,
-		Db:     db,
-		Fs:     fs,
+		config:       config,
+		log:          log.WithField("component", "api"),
+		Server:       echoServer,
+		Db:           db,
+		Fs:           fs,
+		Destinations: destinations,
+		Queue:        queue,
+		Throttle:     limits,
+		Jobs:         jobs,
+		Events:       bus,
+		Auth:         authenticator,
+		Audit:        auditLog,
+		Reloader:     reloader,
+		Watcher:      watcher,
 	}
 
 	return api
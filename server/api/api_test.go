@@ -40,7 +40,7 @@ func TestNewAPI(t *testing.T) {
 		log := logrus.WithField("test", "TestNewApi")
 
 		Convey("It should return a new api object", func() {
-			api := NewAPI(log, &conf, db, fs)
+			api := NewAPI(log, &conf, db, fs, nil, nil, nil, nil, nil, nil, nil, nil, nil)
 
 			So(api, ShouldNotBeNil)
 			So(api.config, ShouldEqual, &conf)
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"world-backup/server/audit"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+)
+
+type IAudit interface {
+	Record(e audit.Entry) error
+	Query(f audit.Filter) ([]audit.Entry, error)
+}
+
+// auditEntry starts an entry for the action done by the logged in user
+func auditEntry(ctx echo.Context, action string) audit.Entry {
+	e := audit.Entry{Action: action, IP: ctx.RealIP()}
+	if user := getUser(ctx); user != nil {
+		e.Actor = user.Name
+		e.ActorId = user.Id
+	}
+
+	return e
+}
+
+// worldEntry starts an entry for the action on the world and backup in the
+// route
+func worldEntry(ctx echo.Context, action string) audit.Entry {
+	e := auditEntry(ctx, action)
+	e.FolderId = ctx.Param("id")
+	e.WorldId = ctx.Param("wid")
+	e.BackupId = ctx.Param("bid")
+
+	return e
+}
+
+// audit records the entry along with the error the action ended with.
+// Failing to record it is only logged, the action has already happened.
+func (api *API) audit(log *logrus.Entry, e audit.Entry, err error) {
+	if api.Audit == nil {
+		return
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	if err := api.Audit.Record(e); err != nil {
+		log.Errorf("Failed to record %s in the audit log: %v", e.Action, err)
+	}
+}
+
+// getAudit lists what was done, newest first. It can be narrowed down to a
+// folder, world, action and a time range given as RFC 3339 times.
+func (api *API) getAudit(ctx echo.Context) error {
+	f := audit.Filter{
+		FolderId: ctx.QueryParam("folder"),
+		WorldId:  ctx.QueryParam("world"),
+		Action:   ctx.QueryParam("action"),
+	}
+
+	var err error
+	if since := ctx.QueryParam("since"); since != "" {
+		if f.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "since must be an RFC 3339 time"})
+		}
+	}
+	if until := ctx.QueryParam("until"); until != "" {
+		if f.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "until must be an RFC 3339 time"})
+		}
+	}
+	if limit := ctx.QueryParam("limit"); limit != "" {
+		if f.Limit, err = strconv.Atoi(limit); err != nil || f.Limit < 0 {
+			return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "limit must be a positive number"})
+		}
+	}
+
+	if api.Audit == nil {
+		return ctx.JSON(http.StatusOK, []audit.Entry{})
+	}
+
+	entries, err := api.Audit.Query(f)
+	if err != nil {
+		getLogger(ctx).Errorf("Failed to read the audit log: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+
+	return ctx.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"world-backup/server/audit"
+	"world-backup/server/auth"
+	"world-backup/server/data"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+func TestAPI_Audit(t *testing.T) {
+	Convey("Given an api with an audit log", t, func() {
+		auditLog, _ := audit.Open(afero.NewMemMapFs(), audit.Config{})
+		parent := &data.User{Id: "u3", Name: "mum", Role: auth.Parent}
+
+		world := &data.World{Id: "w1", FullPath: "/saves/w1"}
+		folder := &data.Folder{Id: "f1", Worlds: []*data.World{world}}
+
+		dbMock := new(ApiDbMock)
+		dbMock.On("GetFolder", "f1").Return(folder)
+		dbMock.On("Save").Return(nil)
+		fsMock := new(ApiFsMock)
+		fsMock.On("RemoveAll", "/saves/w1").Return(nil)
+
+		api := &API{log: logrus.WithField("test", "TestAPI_Audit"), Db: dbMock, Fs: fsMock, Audit: auditLog}
+
+		newContext := func(method, target string) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(method, target, strings.NewReader(""))
+			req.Header.Set(echo.HeaderXRealIP, "10.0.0.2")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set(userKey, parent)
+			return c, rec
+		}
+
+		Convey("When a world is deleted", func() {
+			c, _ := newContext(echo.DELETE, "/api/folders/f1/worlds/w1")
+			c.SetParamNames("id", "wid")
+			c.SetParamValues("f1", "w1")
+			api.deleteWorld(c)
+
+			auditLog.Record(audit.Entry{Actor: audit.Watcher, Action: audit.BackupCreated, FolderId: "f2", WorldId: "w2"})
+
+			Convey("It should record who deleted it and from where", func() {
+				c, rec := newContext(echo.GET, "/api/audit?world=w1")
+				api.getAudit(c)
+
+				var entries []audit.Entry
+				json.Unmarshal(rec.Body.Bytes(), &entries)
+
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(len(entries), ShouldEqual, 1)
+				So(entries[0].Action, ShouldEqual, audit.WorldDeleted)
+				So(entries[0].Actor, ShouldEqual, "mum")
+				So(entries[0].ActorId, ShouldEqual, "u3")
+				So(entries[0].IP, ShouldEqual, "10.0.0.2")
+				So(entries[0].FolderId, ShouldEqual, "f1")
+				So(entries[0].Before, ShouldEqual, "/saves/w1")
+			})
+
+			Convey("It should filter by action and time", func() {
+				c, rec := newContext(echo.GET, "/api/audit?action=backup.create&since="+time.Now().Add(-time.Hour).Format(time.RFC3339))
+				api.getAudit(c)
+
+				var entries []audit.Entry
+				json.Unmarshal(rec.Body.Bytes(), &entries)
+
+				So(len(entries), ShouldEqual, 1)
+				So(entries[0].Actor, ShouldEqual, audit.Watcher)
+			})
+		})
+
+		Convey("When the time range isn't a time", func() {
+			c, rec := newContext(echo.GET, "/api/audit?until=yesterday")
+			api.getAudit(c)
+
+			Convey("It should be refused", func() {
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"world-backup/server/auth"
+	"world-backup/server/data"
+
+	"github.com/labstack/echo"
+)
+
+var UnauthorizedResponse = ErrorResponse{Message: "You need to log in"}
+var ForbiddenResponse = ErrorResponse{Message: "You are not allowed to do that"}
+
+type loginRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type loginResponse struct {
+	Token     string       `json:"token"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+	User      userResponse `json:"user"`
+}
+
+// userResponse is a user without the password hash
+type userResponse struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func newUserResponse(u *data.User) userResponse {
+	return userResponse{Id: u.Id, Name: u.Name, Role: u.Role, CreatedAt: u.CreatedAt}
+}
+
+// authenticate lets a request through with a valid token for a user that
+// still exists. Browsers can't set headers on event streams and download
+// links, so the token can be sent in the query too.
+func (api *API) authenticate(f echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		req := ctx.Request()
+
+		raw := req.URL.Query().Get("token")
+		if header := req.Header.Get(echo.HeaderAuthorization); strings.HasPrefix(header, "Bearer ") {
+			raw = strings.TrimPrefix(header, "Bearer ")
+		}
+
+		if raw == "" {
+			return ctx.JSON(http.StatusUnauthorized, UnauthorizedResponse)
+		}
+
+		token, claims, err := api.Auth.Parse(raw)
+		if err != nil {
+			return ctx.JSON(http.StatusUnauthorized, ErrorResponse{Message: err.Error()})
+		}
+
+		user := api.Db.GetUser(claims.Subject)
+		if user == nil {
+			return ctx.JSON(http.StatusUnauthorized, UnauthorizedResponse)
+		}
+
+		ctx.Set(tokenKey, token)
+		ctx.Set(userKey, user)
+		ctx.Set(loggerKey, getLogger(ctx).WithField("user", user.Name))
+
+		return f(ctx)
+	}
+}
+
+// allow only lets through users with the role, or one above it. The user's
+// role is read from the catalog, so changing it takes effect right away.
+func allow(role string) echo.MiddlewareFunc {
+	return func(f echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			user := getUser(ctx)
+			if user == nil || !auth.Allows(user.Role, role) {
+				return ctx.JSON(http.StatusForbidden, ForbiddenResponse)
+			}
+
+			return f(ctx)
+		}
+	}
+}
+
+// login hands out a token for the name and password
+func (api *API) login(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	r := new(loginRequest)
+	if err := ctx.Bind(r); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	// bcrypt is slow on purpose, the password is checked against a copy of
+	// the user without holding the catalog
+	var user *data.User
+	if u := api.Db.GetUserByName(r.Name); u != nil {
+		copied := *u
+		user = &copied
+	}
+	releaseCatalog(ctx)
+
+	if user == nil || !auth.CheckPassword(user, r.Password) {
+		log.Warnf("Failed login for %s", r.Name)
+		return ctx.JSON(http.StatusUnauthorized, ErrorResponse{Message: auth.InvalidLoginError.Error()})
+	}
+
+	token, expiresAt, err := api.Auth.Issue(user)
+	if err != nil {
+		log.Errorf("Failed to issue a token for %s: %v", user.Name, err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+
+	log.Infof("%s logged in", user.Name)
+	return ctx.JSON(http.StatusOK, loginResponse{Token: token, ExpiresAt: expiresAt, User: newUserResponse(user)})
+}
+
+// getMe returns who is logged in
+func (api *API) getMe(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, newUserResponse(getUser(ctx)))
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"world-backup/server/auth"
+	"world-backup/server/data"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPI_Auth(t *testing.T) {
+	Convey("Given an api with users", t, func() {
+		authenticator, _ := auth.New(auth.Config{Secret: "shh"})
+		hash, _ := auth.HashPassword("creeper")
+		steve := &data.User{Id: "u1", Name: "steve", PasswordHash: hash, Role: auth.Player}
+
+		dbMock := new(ApiDbMock)
+		dbMock.On("GetUser", "u1").Return(steve)
+		dbMock.On("GetUser", "gone").Return((*data.User)(nil))
+		dbMock.On("GetUserByName", "steve").Return(steve)
+		dbMock.On("GetUserByName", "alex").Return((*data.User)(nil))
+
+		api := &API{
+			log:  logrus.WithField("test", "TestAPI_Auth"),
+			Db:   dbMock,
+			Auth: authenticator,
+		}
+
+		newContext := func(method, target, body string) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(method, target, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			return e.NewContext(req, rec), rec
+		}
+
+		reached := false
+		handler := func(ctx echo.Context) error {
+			reached = true
+			return ctx.JSON(http.StatusOK, nil)
+		}
+
+		Convey("When logging in with the right password", func() {
+			c, rec := newContext(echo.POST, "/api/auth/login", `{"name":"steve","password":"creeper"}`)
+			api.login(c)
+
+			var result loginResponse
+			json.Unmarshal(rec.Body.Bytes(), &result)
+
+			Convey("It should hand out a token for the user", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(result.User.Name, ShouldEqual, "steve")
+				So(rec.Body.String(), ShouldNotContainSubstring, "passwordHash")
+
+				_, claims, err := authenticator.Parse(result.Token)
+				So(err, ShouldBeNil)
+				So(claims.Subject, ShouldEqual, "u1")
+			})
+
+			Convey("It should let requests with the token through", func() {
+				c, rec := newContext(echo.GET, "/api/folders", "")
+				c.Request().Header.Set(echo.HeaderAuthorization, "Bearer "+result.Token)
+				api.authenticate(handler)(c)
+
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(reached, ShouldBeTrue)
+				So(getUser(c), ShouldEqual, steve)
+				So(getToken(c), ShouldNotBeNil)
+			})
+
+			Convey("It should take the token from the query for event streams", func() {
+				c, _ := newContext(echo.GET, "/api/events?token="+result.Token, "")
+				api.authenticate(handler)(c)
+
+				So(reached, ShouldBeTrue)
+			})
+		})
+
+		Convey("When logging in while holding the catalog", func() {
+			c, rec := newContext(echo.POST, "/api/auth/login", `{"name":"steve","password":"creeper"}`)
+			api.holdCatalog(func(ctx echo.Context) error {
+				err := api.login(ctx)
+
+				// the password was checked with the catalog let go of
+				dbMock.Lock()
+				dbMock.Unlock()
+				return err
+			})(c)
+
+			Convey("It should still log in", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+			})
+		})
+
+		Convey("When logging in with the wrong password or name", func() {
+			c, rec := newContext(echo.POST, "/api/auth/login", `{"name":"steve","password":"zombie"}`)
+			api.login(c)
+			c2, rec2 := newContext(echo.POST, "/api/auth/login", `{"name":"alex","password":"creeper"}`)
+			api.login(c2)
+
+			Convey("It should be refused", func() {
+				So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+				So(rec2.Code, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+
+		Convey("When a request has no token or a bad one", func() {
+			c, rec := newContext(echo.GET, "/api/folders", "")
+			api.authenticate(handler)(c)
+
+			c2, rec2 := newContext(echo.GET, "/api/folders", "")
+			c2.Request().Header.Set(echo.HeaderAuthorization, "Bearer nonsense")
+			api.authenticate(handler)(c2)
+
+			Convey("It should be refused", func() {
+				So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+				So(rec2.Code, ShouldEqual, http.StatusUnauthorized)
+				So(reached, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the user of a token was deleted", func() {
+			token, _, _ := authenticator.Issue(&data.User{Id: "gone", Role: auth.Admin})
+			c, rec := newContext(echo.GET, "/api/folders", "")
+			c.Request().Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			api.authenticate(handler)(c)
+
+			Convey("It should be refused", func() {
+				So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+				So(reached, ShouldBeFalse)
+			})
+		})
+
+		Convey("When a player does what needs a parent", func() {
+			c, rec := newContext(echo.DELETE, "/api/folders/f1/worlds/w1", "")
+			c.Set(userKey, steve)
+			allow(auth.Parent)(handler)(c)
+
+			Convey("It should be forbidden", func() {
+				So(rec.Code, ShouldEqual, http.StatusForbidden)
+				So(reached, ShouldBeFalse)
+			})
+		})
+
+		Convey("When a parent does what needs a parent", func() {
+			c, rec := newContext(echo.DELETE, "/api/folders/f1/worlds/w1", "")
+			c.Set(userKey, &data.User{Id: "u2", Role: auth.Parent})
+			allow(auth.Parent)(handler)(c)
+
+			Convey("It should be allowed", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(reached, ShouldBeTrue)
+			})
+		})
+	})
+}
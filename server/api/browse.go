@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"world-backup/server/crypt"
+	"world-backup/server/fs"
+	"world-backup/server/jobs"
+
+	"github.com/labstack/echo"
+)
+
+// browseWorldBackup lists the files in a backup
+func (api *API) browseWorldBackup(ctx echo.Context) error {
+	folderId := ctx.Param("id")
+	worldId := ctx.Param("wid")
+	backupId := ctx.Param("bid")
+
+	log := getLogger(ctx)
+
+	log.Infof("Browsing backup F: %s W: %s B: %s", folderId, worldId, backupId)
+
+	folder := api.Db.GetFolder(folderId)
+	world := folder.GetWorld(worldId)
+	backup := world.GetBackup(backupId)
+
+	if backup == nil {
+		return ctx.JSON(http.StatusNotFound, BackupNotFoundResponse)
+	}
+
+	name, file := backup.Name, api.backupFile(ctx, backup)
+	releaseCatalog(ctx)
+
+	r, err := api.Fs.OpenArchive(file)
+	if err != nil {
+		log.Errorf("Failed to open backup %s: %v", name, err)
+		return archiveError(ctx, err)
+	}
+	defer r.Close()
+
+	entries := r.Entries()
+	if entries == nil {
+		entries = []fs.ArchiveEntry{}
+	}
+
+	return ctx.JSON(http.StatusOK, entries)
+}
+
+// verifyWorldBackup reads the whole backup to check it can still be
+// restored, the job fails when it can't
+func (api *API) verifyWorldBackup(ctx echo.Context) error {
+	folderId := ctx.Param("id")
+	worldId := ctx.Param("wid")
+	backupId := ctx.Param("bid")
+
+	log := getLogger(ctx)
+
+	log.Infof("Verifying backup F: %s W: %s B: %s", folderId, worldId, backupId)
+
+	folder := api.Db.GetFolder(folderId)
+	world := folder.GetWorld(worldId)
+	backup := world.GetBackup(backupId)
+
+	if backup == nil {
+		return ctx.JSON(http.StatusNotFound, BackupNotFoundResponse)
+	}
+
+	file := api.backupFile(ctx, backup)
+	if file.Encrypted && file.Keys == nil {
+		return archiveError(ctx, crypt.NoKeyError)
+	}
+
+	return api.startJob(ctx, jobs.Verify, world, backupId, func(p *jobs.Progress) error {
+		file.Progress = p
+		if err := api.Fs.VerifyArchive(file); err != nil {
+			log.Warnf("Backup %s failed to verify: %v", backup.Name, err)
+			return err
+		}
+
+		return nil
+	})
+}
+
+// downloadWorldBackup sends the backup archive, decrypted
+func (api *API) downloadWorldBackup(ctx echo.Context) error {
+	folderId := ctx.Param("id")
+	worldId := ctx.Param("wid")
+	backupId := ctx.Param("bid")
+
+	log := getLogger(ctx)
+
+	log.Infof("Downloading backup F: %s W: %s B: %s", folderId, worldId, backupId)
+
+	folder := api.Db.GetFolder(folderId)
+	world := folder.GetWorld(worldId)
+	backup := world.GetBackup(backupId)
+
+	if backup == nil {
+		return ctx.JSON(http.StatusNotFound, BackupNotFoundResponse)
+	}
+
+	// fetching and sending can take long, the catalog isn't held for it
+	backup = backup.Clone()
+	file := api.backupFile(ctx, backup)
+	releaseCatalog(ctx)
+
+	if exists, err := api.localBackup(log, backup); err != nil {
+		log.Errorf("Failed to fetch %s: %v", backup.Name, err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	} else if !exists {
+		return ctx.JSON(http.StatusNotFound, BackupNotFoundResponse)
+	}
+
+	// the status is only sent with the first write, so a missing key can
+	// still be answered
+	rsp := ctx.Response()
+	rsp.Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	rsp.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", strings.TrimSuffix(backup.Name, crypt.Extension)))
+
+	if err := api.Fs.CopyArchive(file, rsp); err != nil {
+		log.Errorf("Failed to send backup %s: %v", backup.Name, err)
+		if !rsp.Committed {
+			rsp.Header().Del(echo.HeaderContentDisposition)
+			return archiveError(ctx, err)
+		}
+		return err
+	}
+
+	return nil
+}
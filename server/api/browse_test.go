@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"world-backup/server/conf"
+	"world-backup/server/crypt"
+	"world-backup/server/data"
+	"world-backup/server/fs"
+	"world-backup/server/jobs"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+)
+
+type archiveStub struct {
+	entries []fs.ArchiveEntry
+}
+
+func (a *archiveStub) Entries() []fs.ArchiveEntry                               { return a.entries }
+func (a *archiveStub) ReadFile(name string) ([]byte, error)                     { return nil, nil }
+func (a *archiveStub) Walk(fn func(e fs.ArchiveEntry, r io.Reader) error) error { return nil }
+func (a *archiveStub) Close() error                                             { return nil }
+
+func TestAPI_BrowseAndVerifyWorldBackup(t *testing.T) {
+	Convey("Given an api and a world with a tar.zst backup", t, func() {
+		mockDb := new(ApiDbMock)
+		mockFs := new(ApiFsMock)
+
+		api := &API{
+			log:    logrus.WithField("test", "TestAPI_BrowseAndVerifyWorldBackup"),
+			config: &conf.Config{BackupDir: "/back/up/here"},
+			Db:     mockDb,
+			Fs:     mockFs,
+		}
+		wait := withJobs(api)
+
+		b1 := data.Backup{Id: "bid888", Name: "World.tar.zst", Format: "tar.zst"}
+		w1 := data.World{Id: "wid999", Name: "World", Backups: []*data.Backup{&b1}}
+		f1 := data.Folder{Id: "jk0069", Path: "/this/be/h", Worlds: []*data.World{&w1}}
+
+		mockDb.On("GetFolder", "jk0069").Return(&f1)
+
+		file := fs.ArchiveFile{Path: "/back/up/here/World.tar.zst", Format: fs.TarZst}
+
+		newContext := func(bid string) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(echo.GET, "/", strings.NewReader(""))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id", "wid", "bid")
+			c.SetParamValues("jk0069", "wid999", bid)
+			return c, rec
+		}
+
+		Convey("When the files are listed", func() {
+			mockFs.On("OpenArchive", file).Return(&archiveStub{entries: []fs.ArchiveEntry{{Name: "World/level.dat", Size: 10}}}, nil)
+			c, rec := newContext("bid888")
+
+			Convey("It should open it as tar.zst and return the entries", func() {
+				resultErr := api.browseWorldBackup(c)
+
+				mockFs.AssertExpectations(t)
+				So(resultErr, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+
+				var entries []fs.ArchiveEntry
+				json.Unmarshal(rec.Body.Bytes(), &entries)
+				So(entries[0].Name, ShouldEqual, "World/level.dat")
+			})
+		})
+
+		Convey("When the backup can't be opened", func() {
+			mockFs.On("OpenArchive", file).Return(nil, errors.New("gone"))
+			c, rec := newContext("bid888")
+
+			Convey("It should return http.StatusInternalServerError", func() {
+				api.browseWorldBackup(c)
+
+				So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+			})
+		})
+
+		Convey("When the backup is verified", func() {
+			c, rec := newContext("bid888")
+			verified := mock.MatchedBy(func(f fs.ArchiveFile) bool {
+				return f.Path == file.Path && f.Format == file.Format && f.Progress != nil
+			})
+
+			Convey("And it reads back", func() {
+				mockFs.On("VerifyArchive", verified).Return(nil)
+				api.verifyWorldBackup(c)
+				job := wait(rec)
+
+				Convey("The verify job should be done", func() {
+					So(job.Kind, ShouldEqual, jobs.Verify)
+					So(job.BackupId, ShouldEqual, "bid888")
+					So(job.State, ShouldEqual, jobs.Done)
+				})
+			})
+
+			Convey("And it is damaged", func() {
+				mockFs.On("VerifyArchive", verified).Return(errors.New("checksum mismatch"))
+				api.verifyWorldBackup(c)
+				job := wait(rec)
+
+				Convey("The verify job should fail saying why", func() {
+					So(job.State, ShouldEqual, jobs.Failed)
+					So(job.Error, ShouldEqual, "checksum mismatch")
+				})
+			})
+		})
+
+		Convey("When the backup does not exist", func() {
+			c, rec := newContext("nope")
+
+			Convey("It should return http.StatusNotFound", func() {
+				api.verifyWorldBackup(c)
+
+				So(rec.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestAPI_EncryptedBackups(t *testing.T) {
+	Convey("Given an api and a world with an encrypted backup", t, func() {
+		mockDb := new(ApiDbMock)
+		mockFs := new(ApiFsMock)
+
+		nas := &crypt.Config{KeyId: "nas", Recipients: []string{"age1nas"}}
+
+		api := &API{
+			log: logrus.WithField("test", "TestAPI_EncryptedBackups"),
+			config: &conf.Config{
+				BackupDir: "/back/up/here",
+				Folders:   []conf.FolderConfig{{Path: "/this/be/h", Encryption: nas}},
+			},
+			Db: mockDb,
+			Fs: mockFs,
+		}
+		wait := withJobs(api)
+
+		b1 := data.Backup{Id: "bid888", Name: "World.zip.age", Format: "zip", KeyId: "nas"}
+		b2 := data.Backup{Id: "bid999", Name: "Old.zip.age", Format: "zip", KeyId: "retired"}
+		w1 := data.World{Id: "wid999", Name: "World", Backups: []*data.Backup{&b1, &b2}}
+		f1 := data.Folder{Id: "jk0069", Path: "/this/be/h", Worlds: []*data.World{&w1}}
+
+		mockDb.On("GetFolder", "jk0069").Return(&f1)
+
+		newContext := func(bid string, identity string) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(echo.GET, "/", strings.NewReader(""))
+			if identity != "" {
+				req.Header.Set(HeaderBackupIdentity, identity)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id", "wid", "bid")
+			c.SetParamValues("jk0069", "wid999", bid)
+			return c, rec
+		}
+
+		Convey("When it is downloaded with the identity", func() {
+			file := fs.ArchiveFile{
+				Path:      "/back/up/here/World.zip.age",
+				Format:    fs.Zip,
+				Encrypted: true,
+				Keys:      &crypt.Config{KeyId: "nas", Recipients: []string{"age1nas"}, Identities: []string{"AGE-SECRET-KEY-1"}},
+			}
+			mockFs.On("Exists", file.Path).Return(true, nil)
+			mockFs.On("CopyArchive", file, mock.Anything).Return(nil)
+			c, rec := newContext("bid888", "AGE-SECRET-KEY-1")
+
+			Convey("It should send it decrypted with the configured and given keys", func() {
+				resultErr := api.downloadWorldBackup(c)
+
+				mockFs.AssertExpectations(t)
+				So(resultErr, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(rec.Header().Get(echo.HeaderContentDisposition), ShouldEqual, `attachment; filename="World.zip"`)
+			})
+		})
+
+		Convey("When no key is known for it", func() {
+			mockFs.On("Exists", "/back/up/here/Old.zip.age").Return(true, nil)
+			mockFs.On("CopyArchive", mock.Anything, mock.Anything).Return(crypt.NoKeyError)
+			c, rec := newContext("bid999", "")
+
+			Convey("It should return http.StatusForbidden", func() {
+				api.downloadWorldBackup(c)
+
+				So(rec.Code, ShouldEqual, http.StatusForbidden)
+				So(rec.Header().Get(echo.HeaderContentDisposition), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When it is verified with the wrong key", func() {
+			mockFs.On("VerifyArchive", mock.Anything).Return(crypt.WrongKeyError)
+			c, rec := newContext("bid888", "AGE-SECRET-KEY-2")
+
+			Convey("The verify job should fail", func() {
+				api.verifyWorldBackup(c)
+				job := wait(rec)
+
+				So(job.State, ShouldEqual, jobs.Failed)
+				So(job.Error, ShouldEqual, crypt.WrongKeyError.Error())
+			})
+		})
+
+		Convey("When it is verified with no key known for it", func() {
+			c, rec := newContext("bid999", "")
+
+			Convey("It should return http.StatusForbidden without starting a job", func() {
+				api.verifyWorldBackup(c)
+
+				So(rec.Code, ShouldEqual, http.StatusForbidden)
+				So(api.Jobs.List(), ShouldBeEmpty)
+			})
+		})
+	})
+}
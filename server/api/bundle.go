@@ -0,0 +1,115 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"world-backup/server/audit"
+	"world-backup/server/bundle"
+	"world-backup/server/data"
+
+	"github.com/labstack/echo"
+)
+
+// exportBundle sends the whole catalog with the backup archives as a
+// bundle, to import on another machine
+func (api *API) exportBundle(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	log.Info("Exporting the catalog")
+
+	// the archives take long to send, the catalog isn't held for it
+	folders, err := data.CopyFolders(api.Db.Folders())
+	if err != nil {
+		log.Errorf("Failed to export the catalog: %v", err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+	releaseCatalog(ctx)
+
+	// the status is only sent with the first write, so errors reading the
+	// catalog can still be answered
+	rsp := ctx.Response()
+	rsp.Header().Set(echo.HeaderContentType, "application/x-tar")
+	rsp.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", "world-backup-"+getNow().Format("20060102T150405")+".tar"))
+
+	_, err = bundle.Export(rsp, api.Fs, folders, api.getConfig().BackupDir)
+	api.audit(log, auditEntry(ctx, audit.CatalogExported), err)
+	if err != nil {
+		log.Errorf("Failed to export the catalog: %v", err)
+		if !rsp.Committed {
+			rsp.Header().Del(echo.HeaderContentDisposition)
+			return ctx.JSON(http.StatusInternalServerError, nil)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// importBundle adds the catalog and archives in an uploaded bundle. The
+// folders can be given other paths with map values of from=to, conflicts
+// are answered with 409 unless skipConflicts is true.
+func (api *API) importBundle(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	// the upload is read without the catalog held
+	releaseCatalog(ctx)
+
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	paths, err := bundle.ParsePaths(ctx.Request().MultipartForm.Value["map"])
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+	for _, p := range paths {
+		if !path.IsAbs(p) {
+			return ctx.JSON(http.StatusBadRequest, RelativePathResponse)
+		}
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+	defer src.Close()
+
+	b, err := bundle.Read(src)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	opts := bundle.Options{
+		Paths:         paths,
+		SkipConflicts: ctx.FormValue("skipConflicts") == "true",
+		DryRun:        ctx.FormValue("dryRun") == "true",
+	}
+
+	log.Infof("Importing %s made %s", file.Filename, b.Manifest.CreatedAt)
+
+	var result bundle.Result
+	err = api.withCatalog(func() (err error) {
+		result, err = b.Import(api.Db, api.Fs, api.getConfig().BackupDir, opts)
+		if err == nil && !opts.DryRun {
+			err = api.Db.Save()
+		}
+		return err
+	})
+	if _, ok := err.(*bundle.ConflictError); ok {
+		return ctx.JSON(http.StatusConflict, ErrorResponse{Message: err.Error()})
+	}
+	if opts.DryRun {
+		return ctx.JSON(http.StatusOK, result)
+	}
+
+	api.audit(log, auditEntry(ctx, audit.CatalogImported), err)
+	if err != nil {
+		log.Errorf("Failed to import %s: %v", file.Filename, err)
+		return ctx.JSON(http.StatusInternalServerError, ErrorResponse{Message: err.Error()})
+	}
+
+	return ctx.JSON(http.StatusOK, result)
+}
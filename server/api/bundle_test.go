@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"world-backup/server/bundle"
+	"world-backup/server/conf"
+	"world-backup/server/data"
+	"world-backup/server/fs"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAPI_Bundle(t *testing.T) {
+	Convey("Given an api with a world backed up", t, func() {
+		af := afero.Afero{Fs: afero.NewMemMapFs()}
+		af.WriteFile("/back/up/here/one.zip", []byte("the backup"), 0600)
+
+		mockDb := new(ApiDbMock)
+		api := &API{
+			log:    logrus.WithField("test", "TestAPI_Bundle"),
+			config: &conf.Config{BackupDir: "/back/up/here"},
+			Db:     mockDb,
+			Fs:     fs.NewFs(af),
+		}
+
+		b1 := data.Backup{Id: "b1", Name: "one.zip"}
+		w1 := data.World{Id: "w1", Name: "survival", FullPath: "/saves/survival", Backups: []*data.Backup{&b1}}
+		f1 := data.Folder{Id: "f1", Path: "/saves", Worlds: []*data.World{&w1}}
+
+		Convey("When the catalog is exported", func() {
+			mockDb.On("Folders").Return([]*data.Folder{&f1})
+
+			req, _ := http.NewRequest(echo.GET, "/api/bundle", nil)
+			rec := httptest.NewRecorder()
+			err := api.exportBundle(echo.New().NewContext(req, rec))
+
+			Convey("It should send a bundle with the backup in it", func() {
+				So(err, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(rec.Header().Get(echo.HeaderContentType), ShouldEqual, "application/x-tar")
+
+				b, err := bundle.Read(bytes.NewReader(rec.Body.Bytes()))
+				So(err, ShouldBeNil)
+				So(b.Manifest.Folders[0].Path, ShouldEqual, "/saves")
+				So(b.Manifest.Archives[0].Name, ShouldEqual, "one.zip")
+			})
+		})
+
+		var buf bytes.Buffer
+		bundle.Export(&buf, fs.NewFs(af), []*data.Folder{&f1}, "/back/up/here")
+
+		newContext := func(content []byte, values map[string]string) (echo.Context, *httptest.ResponseRecorder) {
+			body := new(bytes.Buffer)
+			writer := multipart.NewWriter(body)
+			part, _ := writer.CreateFormFile("file", "catalog.tar")
+			part.Write(content)
+			for k, v := range values {
+				writer.WriteField(k, v)
+			}
+			writer.Close()
+
+			req, _ := http.NewRequest(echo.POST, "/api/bundle", body)
+			req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+			rec := httptest.NewRecorder()
+			return echo.New().NewContext(req, rec), rec
+		}
+
+		Convey("When a bundle is imported to another path", func() {
+			// as if on another machine
+			af.Remove("/back/up/here/one.zip")
+
+			var inserted *data.Folder
+			mockDb.On("Folders").Return([]*data.Folder{})
+			mockDb.On("InsertFolder", mock.Anything).Run(func(args mock.Arguments) {
+				inserted = args.Get(0).(*data.Folder)
+			})
+			mockDb.On("Save").Return(nil)
+
+			c, rec := newContext(buf.Bytes(), map[string]string{"map": "/saves=/games/saves"})
+			err := api.importBundle(c)
+
+			Convey("It should add the folder there", func() {
+				So(err, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				mockDb.AssertExpectations(t)
+
+				var result bundle.Result
+				json.Unmarshal(rec.Body.Bytes(), &result)
+				So(result.Folders, ShouldEqual, 1)
+				So(result.Backups, ShouldEqual, 1)
+				So(inserted.Path, ShouldEqual, "/games/saves")
+
+				content, _ := af.ReadFile("/back/up/here/one.zip")
+				So(string(content), ShouldEqual, "the backup")
+			})
+		})
+
+		Convey("When a bundle conflicts with the catalog", func() {
+			mockDb.On("Folders").Return([]*data.Folder{{Id: "f1", Path: "/other/saves"}})
+
+			c, rec := newContext(buf.Bytes(), nil)
+			err := api.importBundle(c)
+
+			Convey("It should return http.StatusConflict and import nothing", func() {
+				So(err, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusConflict)
+				mockDb.AssertNotCalled(t, "InsertFolder", mock.Anything)
+				mockDb.AssertNotCalled(t, "Save")
+			})
+		})
+
+		Convey("When the upload is not a bundle", func() {
+			c, rec := newContext([]byte("not a bundle"), nil)
+			api.importBundle(c)
+
+			Convey("It should return http.StatusBadRequest", func() {
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When a path to import to is relative", func() {
+			c, rec := newContext(buf.Bytes(), map[string]string{"map": "/saves=saves"})
+			api.importBundle(c)
+
+			Convey("It should return http.StatusBadRequest", func() {
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"sync"
+
+	"world-backup/server/data"
+
+	"github.com/labstack/echo"
+)
+
+// holdCatalog holds the catalog while the request is handled, the watcher,
+// the replication queue and jobs wait for it to change anything. Handlers
+// that go on to stream or read uploads let go of it with releaseCatalog.
+func (api *API) holdCatalog(f echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		api.Db.Lock()
+
+		var once sync.Once
+		release := func() { once.Do(api.Db.Unlock) }
+		defer release()
+		ctx.Set(catalogKey, release)
+
+		return f(ctx)
+	}
+}
+
+// releaseCatalog lets go of the catalog before the request is done, what
+// is read from it after needs withCatalog
+func releaseCatalog(ctx echo.Context) {
+	if release, ok := ctx.Get(catalogKey).(func()); ok {
+		release()
+	}
+}
+
+// cloneBackup is the backup as it is now, for jobs that use it without the
+// catalog held
+func (api *API) cloneBackup(backup *data.Backup) *data.Backup {
+	api.Db.Lock()
+	defer api.Db.Unlock()
+
+	return backup.Clone()
+}
+
+// currentBackup is a clone of the world's backup as it is now, nil when it
+// was removed since the job was started
+func (api *API) currentBackup(world *data.World, id string) *data.Backup {
+	api.Db.Lock()
+	defer api.Db.Unlock()
+
+	if backup := world.GetBackup(id); backup != nil {
+		return backup.Clone()
+	}
+	return nil
+}
+
+// withCatalog runs fn holding the catalog, for jobs and for handlers once
+// they let go of it
+func (api *API) withCatalog(fn func() error) error {
+	api.Db.Lock()
+	defer api.Db.Unlock()
+
+	return fn()
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"world-backup/server/audit"
+	"world-backup/server/crypt"
+	"world-backup/server/data"
+	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/minecraft"
+	"world-backup/server/region"
+	"world-backup/server/restore"
+
+	"github.com/labstack/echo"
+)
+
+var isWorldOpen = minecraft.IsOpen
+
+var NotJavaResponse = ErrorResponse{Message: "Only Java worlds can restore chunks"}
+var WorldOpenError = errors.New("The world is open in the game, close it first")
+var InvalidAreaResponse = ErrorResponse{Message: "Unit must be chunk or block"}
+var AreaTooBigResponse = ErrorResponse{Message: restore.AreaTooBigError.Error()}
+
+type Point struct {
+	X int `json:"x"`
+	Z int `json:"z"`
+}
+
+type restoreChunksRequest struct {
+	Dimension string `json:"dimension"`
+	// Unit of the corners, chunk (default) or block
+	Unit string `json:"unit"`
+	From Point  `json:"from"`
+	To   Point  `json:"to"`
+}
+
+func (r *restoreChunksRequest) area() (restore.Area, bool) {
+	dimension := r.Dimension
+	if dimension == "" {
+		dimension = region.Overworld
+	}
+
+	switch r.Unit {
+	case "", "chunk":
+		return restore.ChunkArea(dimension, r.From.X, r.From.Z, r.To.X, r.To.Z), true
+	case "block":
+		return restore.BlockArea(dimension, r.From.X, r.From.Z, r.To.X, r.To.Z), true
+	}
+
+	return restore.Area{}, false
+}
+
+// restoreWorldChunks rolls back an area of the world to the backup, leaving
+// the rest of the map as it is. The job backs up the world first.
+func (api *API) restoreWorldChunks(ctx echo.Context) error {
+	r := new(restoreChunksRequest)
+	if err := ctx.Bind(r); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	area, ok := r.area()
+	if !ok {
+		return ctx.JSON(http.StatusBadRequest, InvalidAreaResponse)
+	}
+	if area.TooBig() {
+		return ctx.JSON(http.StatusBadRequest, AreaTooBigResponse)
+	}
+
+	folderId := ctx.Param("id")
+	worldId := ctx.Param("wid")
+	backupId := ctx.Param("bid")
+
+	log := getLogger(ctx)
+
+	log.Infof("Restoring chunks F: %s W: %s B: %s area: %+v", folderId, worldId, backupId, area)
+
+	folder := api.Db.GetFolder(folderId)
+	world := folder.GetWorld(worldId)
+	backup := world.GetBackup(backupId)
+
+	if backup == nil {
+		return ctx.JSON(http.StatusNotFound, BackupNotFoundResponse)
+	}
+
+	if world.Edition == string(minecraft.Bedrock) {
+		return ctx.JSON(http.StatusBadRequest, NotJavaResponse)
+	}
+
+	file := api.backupFile(ctx, backup)
+	if file.Encrypted && file.Keys == nil {
+		return archiveError(ctx, crypt.NoKeyError)
+	}
+
+	entry := worldEntry(ctx, audit.ChunksRestored)
+	entry.After = backup.Id
+
+	return api.startJob(ctx, jobs.Restore, world, backupId, func(p *jobs.Progress) (err error) {
+		defer func() { api.audit(log, entry, err) }()
+
+		exists, err := api.localBackup(log, api.cloneBackup(backup))
+		if err != nil {
+			return fmt.Errorf("Failed to fetch %s: %v", backup.Name, err)
+		}
+		if !exists {
+			return fmt.Errorf("%s is gone from the backup folder", backup.Name)
+		}
+
+		t := getNow()
+
+		var displayName string
+		api.withCatalog(func() error {
+			displayName = world.DisplayName()
+			return nil
+		})
+
+		opts := api.getConfig().ArchiveFor(folder.Path)
+		safetyName := fmt.Sprintf("%s-%s-before_chunk_restore-%s%s", fs.CleanName(displayName), world.Id, t.Format("20060102T150405"), opts.Extension())
+
+		rules := api.getConfig().RulesFor(folder.Path, world.Name)
+
+		if err := fs.CreateBackup(api.Fs, log, folder.Path, world.Name, api.getConfig().BackupDir, safetyName, opts, rules); err != nil {
+			return err
+		}
+
+		api.withCatalog(func() error {
+			folder.ModifiedAt = getNow()
+			safety := world.AddBackup(safetyName).SetFormat(string(opts.Format)).SetKeyId(opts.Encryption.Id())
+			safety.SetRules(rules)
+			// the backup the watcher makes of the restored world would
+			// supersede it, pruning has to leave it alone
+			safety.Kept = true
+			entry.Before = safety.Id
+			return api.Db.Save()
+		})
+
+		if err := worldClosed(world); err != nil {
+			return err
+		}
+
+		result, err := restore.Chunks(api.Fs, file, world.FullPath, area)
+		if err != nil {
+			return fmt.Errorf("Failed to restore chunks, %s has the world as it was: %v", safetyName, err)
+		}
+
+		log.Infof("Restored %d and removed %d chunks in %d regions", result.Restored, result.Removed, result.Regions)
+		p.SetResult(result)
+		return nil
+	})
+}
+
+// worldClosed fails when the game has the world open. Jobs check it right
+// before they touch the world, as they may have waited for others to finish.
+func worldClosed(world *data.World) error {
+	open, err := isWorldOpen(world.FullPath)
+	if err != nil {
+		return fmt.Errorf("Failed to check if the world is open: %v", err)
+	}
+	if open {
+		return WorldOpenError
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"world-backup/server/conf"
+	"world-backup/server/data"
+	"world-backup/server/filter"
+	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/restore"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPI_RestoreWorldChunks(t *testing.T) {
+	Convey("Given an api and a world with a backup", t, func() {
+		mockDb := new(ApiDbMock)
+		mockFs := new(ApiFsMock)
+
+		api := &API{
+			log:    logrus.WithField("test", "TestAPI_RestoreWorldChunks"),
+			config: &conf.Config{BackupDir: "/back/up/here"},
+			Db:     mockDb,
+			Fs:     mockFs,
+		}
+		wait := withJobs(api)
+
+		b1 := data.Backup{Id: "bid888", Name: "before.zip"}
+		w1 := data.World{Id: "wid999", Name: "World", FullPath: "/this/be/h/World", Edition: "java", Backups: []*data.Backup{&b1}}
+		f1 := data.Folder{Id: "jk0069", Path: "/this/be/h", Worlds: []*data.World{&w1}}
+
+		mockDb.On("GetFolder", "jk0069").Return(&f1)
+		mockDb.On("Save").Return(nil)
+		mockFs.On("Exists", "/back/up/here/before.zip").Return(true, nil)
+
+		now := time.Date(2017, 6, 1, 12, 30, 0, 0, time.UTC)
+		origGetNow := getNow
+		getNow = func() time.Time { return now }
+		defer func() { getNow = origGetNow }()
+
+		open := false
+		origIsWorldOpen := isWorldOpen
+		isWorldOpen = func(worldDir string) (bool, error) { return open, nil }
+		defer func() { isWorldOpen = origIsWorldOpen }()
+
+		var safetyName string
+		var backupErr error
+		origCreateBackup := fs.CreateBackup
+		fs.CreateBackup = func(f fs.IBackupFs, log *logrus.Entry, folderPath string, worldName string, backupDir string, backupName string, opts fs.ArchiveOptions, rules filter.Rules) error {
+			safetyName = backupName
+			return backupErr
+		}
+		defer func() { fs.CreateBackup = origCreateBackup }()
+
+		var restoredArea restore.Area
+		var restoredFrom, restoredTo string
+		var restoreErr error
+		origChunks := restore.Chunks
+		restore.Chunks = func(f restore.IRestoreFs, backup fs.ArchiveFile, worldPath string, area restore.Area) (*restore.Result, error) {
+			restoredFrom = backup.Path
+			restoredTo = worldPath
+			restoredArea = area
+			return &restore.Result{Regions: 1, Restored: 4}, restoreErr
+		}
+		defer func() { restore.Chunks = origChunks }()
+
+		newContext := func(body string) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(echo.POST, "/api/folders/jk0069/worlds/wid999/backups/bid888/chunks", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id", "wid", "bid")
+			c.SetParamValues("jk0069", "wid999", "bid888")
+			return c, rec
+		}
+
+		Convey("When restoring a block bounding box", func() {
+			c, rec := newContext(`{"dimension":"minecraft:the_nether","unit":"block","from":{"x":-20,"z":5},"to":{"x":40,"z":70}}`)
+
+			resultErr := api.restoreWorldChunks(c)
+			job := wait(rec)
+
+			Convey("It should take a safety backup first", func() {
+				So(resultErr, ShouldBeNil)
+				So(job.Kind, ShouldEqual, jobs.Restore)
+				So(safetyName, ShouldEqual, "World-wid999-before_chunk_restore-20170601T123000.zip")
+				So(len(w1.Backups), ShouldEqual, 2)
+				So(w1.Backups[1].Name, ShouldEqual, safetyName)
+				mockDb.AssertCalled(t, "Save")
+			})
+
+			Convey("It should keep the safety backup from being pruned", func() {
+				So(w1.Backups[1].Kept, ShouldBeTrue)
+
+				w1.Backups = append(w1.Backups, &data.Backup{Id: "after", CreatedAt: w1.Backups[1].CreatedAt.Add(time.Minute)})
+				So(w1.Superseded(time.Hour), ShouldBeEmpty)
+			})
+
+			Convey("It should restore the chunks the box covers", func() {
+				So(job.State, ShouldEqual, jobs.Done)
+				So(restoredFrom, ShouldEqual, "/back/up/here/before.zip")
+				So(restoredTo, ShouldEqual, "/this/be/h/World")
+				So(restoredArea, ShouldResemble, restore.Area{Dimension: "minecraft:the_nether", MinX: -2, MinZ: 0, MaxX: 2, MaxZ: 4})
+
+				So(job.Result.(*restore.Result).Restored, ShouldEqual, 4)
+			})
+		})
+
+		Convey("When no dimension is given", func() {
+			c, rec := newContext(`{"from":{"x":1,"z":1},"to":{"x":0,"z":0}}`)
+
+			api.restoreWorldChunks(c)
+			wait(rec)
+
+			Convey("It should use overworld chunk coordinates", func() {
+				So(restoredArea, ShouldResemble, restore.Area{Dimension: "minecraft:overworld", MinX: 0, MinZ: 0, MaxX: 1, MaxZ: 1})
+			})
+		})
+
+		Convey("When the unit is unknown", func() {
+			c, rec := newContext(`{"unit":"region"}`)
+
+			Convey("It should return http.StatusBadRequest", func() {
+				api.restoreWorldChunks(c)
+
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+				So(safetyName, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the area is too big", func() {
+			c, rec := newContext(`{"from":{"x":-9223372036854775808,"z":0},"to":{"x":9223372036854775807,"z":0}}`)
+
+			Convey("It should return http.StatusBadRequest", func() {
+				api.restoreWorldChunks(c)
+
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+				So(rec.Body.String(), ShouldContainSubstring, "at most 64 regions")
+				So(safetyName, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the world is open in the game", func() {
+			open = true
+			c, rec := newContext(`{}`)
+
+			Convey("The job should fail without touching the world", func() {
+				api.restoreWorldChunks(c)
+
+				job := wait(rec)
+				So(job.State, ShouldEqual, jobs.Failed)
+				So(job.Error, ShouldEqual, WorldOpenError.Error())
+				So(restoredFrom, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the world is a Bedrock world", func() {
+			w1.Edition = "bedrock"
+			c, rec := newContext(`{}`)
+
+			Convey("It should return http.StatusBadRequest", func() {
+				api.restoreWorldChunks(c)
+
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When the backup does not exist", func() {
+			c, rec := newContext(`{}`)
+			c.SetParamValues("jk0069", "wid999", "nope")
+
+			Convey("It should return http.StatusNotFound", func() {
+				api.restoreWorldChunks(c)
+
+				So(rec.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When the backup file is gone with no copy to fetch", func() {
+			w1.Backups = append(w1.Backups, &data.Backup{Id: "bid777", Name: "gone.zip"})
+			mockFs.On("Exists", "/back/up/here/gone.zip").Return(false, nil)
+			c, rec := newContext(`{}`)
+			c.SetParamValues("jk0069", "wid999", "bid777")
+
+			Convey("The job should fail before the safety backup", func() {
+				api.restoreWorldChunks(c)
+
+				job := wait(rec)
+				So(job.State, ShouldEqual, jobs.Failed)
+				So(job.Error, ShouldContainSubstring, "gone.zip")
+				So(safetyName, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the safety backup fails", func() {
+			backupErr = errors.New("disk full")
+			c, rec := newContext(`{}`)
+
+			Convey("It should not touch the world", func() {
+				api.restoreWorldChunks(c)
+
+				So(wait(rec).State, ShouldEqual, jobs.Failed)
+				So(restoredFrom, ShouldBeEmpty)
+				mockDb.AssertNotCalled(t, "Save")
+			})
+		})
+
+		Convey("When the restore fails", func() {
+			restoreErr = errors.New("corrupt region")
+			c, rec := newContext(`{}`)
+
+			Convey("It should keep the safety backup", func() {
+				api.restoreWorldChunks(c)
+
+				job := wait(rec)
+				So(job.State, ShouldEqual, jobs.Failed)
+				So(job.Error, ShouldContainSubstring, "corrupt region")
+				So(len(w1.Backups), ShouldEqual, 2)
+			})
+		})
+	})
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"world-backup/server/data"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/labstack/echo"
@@ -8,7 +10,10 @@ import (
 
 const (
 	tokenKey  = "app.token"
+	userKey   = "app.user"
 	loggerKey = "app.logger"
+	// catalogKey is what lets go of the catalog held for the request
+	catalogKey = "app.catalog"
 )
 
 func getLogger(ctx echo.Context) *logrus.Entry {
@@ -28,3 +33,12 @@ func getToken(ctx echo.Context) *jwt.Token {
 
 	return obj.(*jwt.Token)
 }
+
+func getUser(ctx echo.Context) *data.User {
+	obj := ctx.Get(userKey)
+	if obj == nil {
+		return nil
+	}
+
+	return obj.(*data.User)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+
+	"world-backup/server/diff"
+
+	"github.com/labstack/echo"
+)
+
+var BackupNotFoundResponse = ErrorResponse{Message: "Backup not found"}
+
+// diffWorldBackup compares the backup with an earlier one given by ?against=
+func (api *API) diffWorldBackup(ctx echo.Context) error {
+	folderId := ctx.Param("id")
+	worldId := ctx.Param("wid")
+	backupId := ctx.Param("bid")
+	againstId := ctx.QueryParam("against")
+
+	log := getLogger(ctx)
+
+	log.Infof("Comparing backup F: %s W: %s B: %s against: %s", folderId, worldId, backupId, againstId)
+
+	folder := api.Db.GetFolder(folderId)
+	world := folder.GetWorld(worldId)
+	backup := world.GetBackup(backupId)
+	against := world.GetBackup(againstId)
+
+	if backup == nil || against == nil {
+		return ctx.JSON(http.StatusNotFound, BackupNotFoundResponse)
+	}
+
+	from, to := api.backupFile(ctx, against), api.backupFile(ctx, backup)
+	releaseCatalog(ctx)
+
+	result, err := diff.Backups(api.Fs, from, to)
+	if err != nil {
+		log.Errorf("Failed to compare backups: %v", err)
+		return archiveError(ctx, err)
+	}
+
+	return ctx.JSON(http.StatusOK, result)
+}
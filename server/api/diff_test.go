@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"world-backup/server/conf"
+	"world-backup/server/data"
+	"world-backup/server/diff"
+	"world-backup/server/fs"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPI_DiffWorldBackup(t *testing.T) {
+	Convey("Given an api and a world with backups", t, func() {
+		mockDb := new(ApiDbMock)
+		mockFs := new(ApiFsMock)
+
+		api := &API{
+			log:    logrus.WithField("test", "TestAPI_DiffWorldBackup"),
+			config: &conf.Config{BackupDir: "/back/up/here"},
+			Db:     mockDb,
+			Fs:     mockFs,
+		}
+
+		b1 := data.Backup{Id: "bid111", Name: "first.zip"}
+		b2 := data.Backup{Id: "bid888", Name: "second.zip"}
+		w1 := data.World{Id: "wid999", Name: "World", Backups: []*data.Backup{&b1, &b2}}
+		f1 := data.Folder{Id: "jk0069", Path: "/this/be/h", Worlds: []*data.World{&w1}}
+
+		mockDb.On("GetFolder", "jk0069").Return(&f1)
+
+		newContext := func(against string) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(echo.GET, "/api/folders/jk0069/worlds/wid999/backups/bid888/diff?against="+against, strings.NewReader(""))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id", "wid", "bid")
+			c.SetParamValues("jk0069", "wid999", "bid888")
+			return c, rec
+		}
+
+		var basePath, targetPath string
+		var diffErr error
+		origBackups := diff.Backups
+		diff.Backups = func(f diff.IDiffFs, base, target fs.ArchiveFile) (*diff.Result, error) {
+			basePath = base.Path
+			targetPath = target.Path
+			return &diff.Result{Changed: []string{"level.dat"}}, diffErr
+		}
+		defer func() { diff.Backups = origBackups }()
+
+		Convey("When the other backup exists", func() {
+			c, rec := newContext("bid111")
+
+			Convey("It should return the differences", func() {
+				resultErr := api.diffWorldBackup(c)
+
+				So(resultErr, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(basePath, ShouldEqual, "/back/up/here/first.zip")
+				So(targetPath, ShouldEqual, "/back/up/here/second.zip")
+
+				var result diff.Result
+				json.Unmarshal(rec.Body.Bytes(), &result)
+				So(result.Changed, ShouldResemble, []string{"level.dat"})
+			})
+		})
+
+		Convey("When the other backup does not exist", func() {
+			c, rec := newContext("nope")
+
+			Convey("It should return http.StatusNotFound", func() {
+				resultErr := api.diffWorldBackup(c)
+
+				So(resultErr, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When the comparison fails", func() {
+			c, rec := newContext("bid111")
+			diffErr = errors.New("corrupt")
+
+			Convey("It should return http.StatusInternalServerError", func() {
+				resultErr := api.diffWorldBackup(c)
+
+				So(resultErr, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+			})
+		})
+	})
+}
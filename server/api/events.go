@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"world-backup/server/data"
+	"world-backup/server/events"
+
+	"github.com/labstack/echo"
+	"golang.org/x/net/websocket"
+)
+
+// heartbeatInterval is how often an idle event stream is sent a comment, so
+// proxies don't close it
+var heartbeatInterval = 30 * time.Second
+
+// retryMillis is how long a browser waits before reconnecting to the stream
+const retryMillis = 3000
+
+// streamEvents sends the events published from now on, or from after the
+// Last-Event-ID a listener reconnects with. It is a Server-Sent Events
+// stream, or a WebSocket of JSON events when the request asks for one.
+func (api *API) streamEvents(ctx echo.Context) error {
+	log := getLogger(ctx)
+	req := ctx.Request()
+
+	user := getUser(ctx)
+	lastId := lastEventId(req)
+	log.Debugf("Streaming events after %d", lastId)
+
+	// the stream stays open, each event checks the catalog on its own
+	releaseCatalog(ctx)
+
+	if strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		websocket.Server{Handler: func(ws *websocket.Conn) {
+			api.sendEvents(ws, user, lastId)
+		}}.ServeHTTP(ctx.Response(), req)
+		return nil
+	}
+
+	sub := api.Events.Subscribe(lastId)
+	defer sub.Close()
+
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	fmt.Fprintf(res, "retry: %d\n\n", retryMillis)
+	res.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return nil
+		case <-heartbeat.C:
+			fmt.Fprint(res, ": ping\n\n")
+		case e, ok := <-sub.Events():
+			if !ok {
+				return nil
+			}
+			if !api.canSeeEvent(user, e) {
+				continue
+			}
+
+			body, err := json.Marshal(e)
+			if err != nil {
+				log.Errorf("Failed to encode event %d: %v", e.Id, err)
+				continue
+			}
+			fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", e.Id, e.Type, body)
+		}
+		res.Flush()
+	}
+}
+
+// sendEvents writes each event to the websocket until either side is done
+func (api *API) sendEvents(ws *websocket.Conn, user *data.User, lastId int64) {
+	sub := api.Events.Subscribe(lastId)
+	defer sub.Close()
+
+	// nothing is expected from the client, reading only finds out when it
+	// went away
+	closed := make(chan bool)
+	go func() {
+		var msg string
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+		close(closed)
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				ws.Close()
+				return
+			}
+			if !api.canSeeEvent(user, e) {
+				continue
+			}
+
+			if err := websocket.JSON.Send(ws, e); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// canSeeEvent is true unless the event is about a world the user may not
+// see
+func (api *API) canSeeEvent(user *data.User, e events.Event) bool {
+	if e.WorldId == "" {
+		return true
+	}
+
+	var ok bool
+	api.withCatalog(func() error {
+		ok = api.canSeeWorldId(user, e.WorldId)
+		return nil
+	})
+	return ok
+}
+
+// lastEventId is the id of the last event a listener saw, from the header
+// a browser resends when it reconnects, or the query for a WebSocket
+func lastEventId(req *http.Request) int64 {
+	value := req.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = req.URL.Query().Get("lastEventId")
+	}
+
+	id, _ := strconv.ParseInt(value, 10, 64)
+	return id
+}
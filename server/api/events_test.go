@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"world-backup/server/auth"
+	"world-backup/server/data"
+	"world-backup/server/events"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/websocket"
+)
+
+func TestAPI_StreamEvents(t *testing.T) {
+	Convey("Given an api with events published", t, func() {
+		bus := events.NewBus(0)
+		api := &API{log: logrus.WithField("test", "TestAPI_StreamEvents"), Events: bus, Db: &ApiDbMock{}}
+
+		e := echo.New()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := e.NewContext(r, w)
+			c.Set(userKey, &data.User{Id: "u1", Role: auth.Parent})
+			api.streamEvents(c)
+		}))
+		defer server.Close()
+
+		bus.Publish(events.Event{Type: events.BackupStarted, WorldId: "w1"})
+		bus.Publish(events.Event{Type: events.BackupFinished, WorldId: "w1", BackupId: "b1"})
+
+		Convey("When a browser reconnects to the stream", func() {
+			req, _ := http.NewRequest(echo.GET, server.URL, nil)
+			req.Header.Set("Last-Event-ID", "1")
+			res, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			defer res.Body.Close()
+
+			r := bufio.NewReader(res.Body)
+			var lines []string
+			for len(lines) < 4 {
+				line, err := r.ReadString('\n')
+				So(err, ShouldBeNil)
+				if line = strings.TrimSpace(line); line != "" {
+					lines = append(lines, line)
+				}
+			}
+
+			Convey("It should send the events it missed", func() {
+				So(res.Header.Get(echo.HeaderContentType), ShouldEqual, "text/event-stream")
+				So(lines[0], ShouldEqual, "retry: 3000")
+				So(lines[1], ShouldEqual, "id: 2")
+				So(lines[2], ShouldEqual, "event: backup.finished")
+				So(lines[3], ShouldContainSubstring, `"backupId":"b1"`)
+			})
+		})
+
+		Convey("When a websocket connects", func() {
+			ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/?lastEventId=1", "", server.URL)
+			So(err, ShouldBeNil)
+			defer ws.Close()
+
+			var missed events.Event
+			So(websocket.JSON.Receive(ws, &missed), ShouldBeNil)
+
+			bus.Publish(events.Event{Type: events.BackupDeleted, WorldId: "w1", BackupId: "b1"})
+
+			var published events.Event
+			So(websocket.JSON.Receive(ws, &published), ShouldBeNil)
+
+			Convey("It should send the events as JSON", func() {
+				So(missed.Id, ShouldEqual, 2)
+				So(missed.Type, ShouldEqual, events.BackupFinished)
+				So(published.Id, ShouldEqual, 3)
+				So(published.Type, ShouldEqual, events.BackupDeleted)
+			})
+		})
+	})
+}
@@ -5,6 +5,9 @@ import (
 
 	"time"
 
+	"world-backup/server/audit"
+	"world-backup/server/auth"
+	"world-backup/server/crypt"
 	"world-backup/server/data"
 
 	"path"
@@ -12,6 +15,8 @@ import (
 	"fmt"
 
 	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/metrics"
 
 	"github.com/labstack/echo"
 )
@@ -22,34 +27,49 @@ type FolderListItem struct {
 	Path           string    `json:"path"`
 	LastRun        time.Time `json:"lastRun"`
 	NumberOfWorlds int       `json:"numberOfWorlds"`
+	DefaultOwnerId string    `json:"defaultOwnerId,omitempty"`
+	Paused         bool      `json:"paused"`
+	Untracked      bool      `json:"untracked"`
 }
 
+// getFolders lists the folders with worlds the caller may see, players
+// don't see folders without any of theirs
 func (api *API) getFolders(ctx echo.Context) error {
+	user := getUser(ctx)
 	folders := api.Db.Folders()
 
 	var listItems []FolderListItem
 
 	for i := range folders {
-		listItems = append(listItems, folderToListItem(folders[i]))
+		worlds := visibleWorlds(user, folders[i])
+		if len(worlds) == 0 && !auth.Allows(user.Role, auth.Parent) {
+			continue
+		}
+
+		listItems = append(listItems, folderToListItem(folders[i], worlds))
 	}
 
 	return ctx.JSON(http.StatusOK, listItems)
 }
 
+// getWorlds lists the worlds in the folder the caller may see
 func (api *API) getWorlds(ctx echo.Context) error {
 	folderId := ctx.Param("id")
 	folder := api.Db.GetFolder(folderId)
 
-	return ctx.JSON(http.StatusOK, folder.Worlds)
+	return ctx.JSON(http.StatusOK, visibleWorlds(getUser(ctx), folder))
 }
 
-func folderToListItem(f *data.Folder) FolderListItem {
+func folderToListItem(f *data.Folder, worlds []*data.World) FolderListItem {
 	return FolderListItem{
 		Id:             f.Id,
 		ModifiedAt:     f.ModifiedAt,
 		Path:           f.Path,
 		LastRun:        f.LastRun,
-		NumberOfWorlds: len(f.Worlds),
+		NumberOfWorlds: len(worlds),
+		DefaultOwnerId: f.DefaultOwnerId,
+		Paused:         f.Paused,
+		Untracked:      f.Untracked,
 	}
 }
 
@@ -66,25 +86,58 @@ func (api *API) deleteWorldBackup(ctx echo.Context) error {
 	world := folder.GetWorld(worldId)
 	backup := world.GetBackup(backupId)
 
-	fullBackupPath := path.Join(api.config.BackupDir, backup.Name)
+	if backup == nil {
+		return ctx.JSON(http.StatusNotFound, BackupNotFoundResponse)
+	}
+
+	entry := worldEntry(ctx, audit.BackupDeleted)
+	entry.Before = backup.Id
 
-	log.Infof("fullPath: %s", fullBackupPath)
+	return api.startJob(ctx, jobs.Prune, world, backupId, func(p *jobs.Progress) (err error) {
+		defer func() { api.audit(log, entry, err) }()
 
-	exists, _ := api.Fs.Exists(fullBackupPath)
-	if exists {
-		if err := api.Fs.Remove(fullBackupPath); err != nil {
-			return ctx.JSON(http.StatusInternalServerError, nil)
+		backup := api.currentBackup(world, backupId)
+		if backup == nil {
+			log.Infof("Backup %s was already removed", backupId)
+			return nil
 		}
-	}
 
-	world.RemoveBackup(backupId)
-	folder.ModifiedAt = getNow()
-	api.Db.Save()
+		if err := api.removeBackupFiles(log, backup); err != nil {
+			return err
+		}
+
+		return api.withCatalog(func() error {
+			api.forgetBackup(backup)
+			if !world.RemoveBackup(backupId) {
+				return nil
+			}
+			folder.ModifiedAt = getNow()
+			return api.Db.Save()
+		})
+	})
+}
+
+// restoreWorldRequest can ask for the backup to be restored next to the
+// world as a new world, instead of replacing it
+type restoreWorldRequest struct {
+	As string `json:"as"`
+}
 
-	return ctx.JSON(http.StatusOK, world)
+// RestoreResult is where a restore put the world, and where the world it
+// replaced was moved to
+type RestoreResult struct {
+	Path     string `json:"path"`
+	Previous string `json:"previous,omitempty"`
 }
 
 func (api *API) restoreWorldBackup(ctx echo.Context) error {
+	r := new(restoreWorldRequest)
+	if ctx.Request().ContentLength > 0 {
+		if err := ctx.Bind(r); err != nil {
+			return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+		}
+	}
+
 	folderId := ctx.Param("id")
 	worldId := ctx.Param("wid")
 	backupId := ctx.Param("bid")
@@ -97,27 +150,84 @@ func (api *API) restoreWorldBackup(ctx echo.Context) error {
 	world := folder.GetWorld(worldId)
 	backup := world.GetBackup(backupId)
 
-	fullBackupPath := path.Join(api.config.BackupDir, backup.Name)
+	if backup == nil {
+		return ctx.JSON(http.StatusNotFound, BackupNotFoundResponse)
+	}
+
+	fullBackupPath := path.Join(api.getConfig().BackupDir, backup.Name)
 
 	log.Infof("fullPath: %s", fullBackupPath)
 
-	exists, _ := api.Fs.Exists(fullBackupPath)
-	if exists {
-		now := getNow()
+	file := api.backupFile(ctx, backup)
+	if file.Encrypted && file.Keys == nil {
+		return archiveError(ctx, crypt.NoKeyError)
+	}
 
-		renameFolder := path.Join(folder.Path, fmt.Sprintf("%s_%d", world.Name, now.Unix()))
-		if err := api.Fs.Rename(world.FullPath, renameFolder); err != nil {
-			return ctx.JSON(http.StatusInternalServerError, nil)
+	result := RestoreResult{Path: world.FullPath}
+	if r.As != "" {
+		if !fs.IsFolderName(r.As) {
+			return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "as must be a folder name"})
 		}
 
-		if err := api.Fs.Unzip(fullBackupPath, folder.Path); err != nil {
-			return ctx.JSON(http.StatusInternalServerError, nil)
+		result.Path = path.Join(folder.Path, r.As)
+		if exists, _ := api.Fs.Exists(result.Path); exists {
+			return ctx.JSON(http.StatusConflict, ErrorResponse{Message: "There already is a world at " + result.Path})
 		}
 	}
 
-	folder.ModifiedAt = getNow()
-	api.Db.Save()
-	return ctx.JSON(http.StatusOK, world)
+	entry := worldEntry(ctx, audit.BackupRestored)
+	entry.After = backup.Id
+
+	return api.startJob(ctx, jobs.Restore, world, backupId, func(p *jobs.Progress) (err error) {
+		defer func() { api.audit(log, entry, err) }()
+
+		exists, err := api.localBackup(log, api.cloneBackup(backup))
+		if err != nil {
+			return fmt.Errorf("Failed to fetch %s: %v", backup.Name, err)
+		}
+		if !exists {
+			return fmt.Errorf("%s is gone from the backup folder", backup.Name)
+		}
+
+		file.Progress = p
+		if r.As != "" {
+			// the archive holds the world under its own folder name
+			tmp := path.Join(folder.Path, ".restore-"+backup.Id)
+			defer api.Fs.RemoveAll(tmp)
+
+			if err := api.Fs.Extract(file, tmp); err != nil {
+				return fmt.Errorf("Failed to restore %s: %v", backup.Name, err)
+			}
+			if err := api.Fs.Rename(path.Join(tmp, world.Name), result.Path); err != nil {
+				return err
+			}
+			entry.After = result.Path
+		} else {
+			if err := worldClosed(world); err != nil {
+				return err
+			}
+
+			now := getNow()
+
+			// the world being replaced is kept next to it under this name
+			renameFolder := path.Join(folder.Path, fmt.Sprintf("%s_%d", world.Name, now.Unix()))
+			if err := api.Fs.Rename(world.FullPath, renameFolder); err != nil {
+				return err
+			}
+			entry.Before = renameFolder
+			result.Previous = renameFolder
+
+			if err := api.Fs.Extract(file, folder.Path); err != nil {
+				return fmt.Errorf("Failed to restore %s: %v", backup.Name, err)
+			}
+		}
+
+		p.SetResult(result)
+		return api.withCatalog(func() error {
+			folder.ModifiedAt = getNow()
+			return api.Db.Save()
+		})
+	})
 }
 
 func (api *API) deleteWorld(ctx echo.Context) error {
@@ -131,13 +241,18 @@ func (api *API) deleteWorld(ctx echo.Context) error {
 	folder := api.Db.GetFolder(folderId)
 	world := folder.GetWorld(worldId)
 
+	entry := worldEntry(ctx, audit.WorldDeleted)
+	entry.Before = world.FullPath
+
 	if err := api.Fs.RemoveAll(world.FullPath); err != nil {
 		log.Errorf("Failed to delete: %v", err)
+		api.audit(log, entry, err)
 		return ctx.JSON(http.StatusInternalServerError, nil)
 	}
 
 	folder.RemoveWorld(worldId)
 	api.Db.Save()
+	api.audit(log, entry, nil)
 
 	return ctx.JSON(http.StatusOK, nil)
 }
@@ -164,13 +279,142 @@ func (api *API) backupWorld(ctx echo.Context) error {
 
 	t := getNow()
 
-	backupName := fmt.Sprintf("%s-%s.zip", fs.CleanName(r.Name), t.Format("20060102T150405"))
+	opts := api.getConfig().ArchiveFor(folder.Path)
+	backupName := fmt.Sprintf("%s-%s%s", fs.CleanName(r.Name), t.Format("20060102T150405"), opts.Extension())
 
-	fs.CreateBackup(api.Fs, log, folder.Path, world.Name, api.config.BackupDir, backupName)
+	rules := api.getConfig().RulesFor(folder.Path, world.Name)
 
-	folder.ModifiedAt = getNow()
-	world.AddBackup(backupName)
-	api.Db.Save()
+	entry := worldEntry(ctx, audit.BackupCreated)
+
+	return api.startJob(ctx, jobs.Backup, world, "", func(p *jobs.Progress) (err error) {
+		defer func() {
+			api.audit(log, entry, err)
+			metrics.BackupDone(folder.Id, world.Id, err)
+			api.withCatalog(func() error {
+				world.SetError(err)
+				return nil
+			})
+		}()
+
+		opts.Progress = p
+		if err := fs.CreateBackup(api.Fs, log, folder.Path, world.Name, api.getConfig().BackupDir, backupName, opts, rules); err != nil {
+			return err
+		}
+
+		return api.withCatalog(func() error {
+			folder.ModifiedAt = getNow()
+			backup := world.AddBackup(backupName).SetFormat(string(opts.Format)).SetKeyId(opts.Encryption.Id())
+			backup.SetRules(rules)
+			entry.BackupId = backup.Id
+			entry.After = backup.Id
+			p.SetResult(backup)
+			api.replicate(backup)
+			return api.Db.Save()
+		})
+	})
+}
+
+// pruneRequest can limit a prune to one world
+type pruneRequest struct {
+	DryRun  bool   `json:"dryRun"`
+	WorldId string `json:"worldId"`
+}
+
+// PrunedBackup is a backup a prune removed, or would remove
+type PrunedBackup struct {
+	FolderId string `json:"folderId"`
+	WorldId  string `json:"worldId"`
+	BackupId string `json:"backupId"`
+	Name     string `json:"name"`
+}
+
+// PruneResponse is the backups a prune removes and the job for each world
+// they are removed from
+type PruneResponse struct {
+	DryRun  bool           `json:"dryRun"`
+	Backups []PrunedBackup `json:"backups"`
+	Jobs    []jobs.Job     `json:"jobs"`
+}
+
+// pruneBackups removes the backups made within a check interval of the next
+// one, the same ones the watcher prunes, keeping the last of each session.
+// A dry run only lists them.
+func (api *API) pruneBackups(ctx echo.Context) error {
+	r := new(pruneRequest)
+	if ctx.Request().ContentLength > 0 {
+		if err := ctx.Bind(r); err != nil {
+			return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+		}
+	}
+
+	log := getLogger(ctx)
+	response := PruneResponse{DryRun: r.DryRun, Backups: []PrunedBackup{}, Jobs: []jobs.Job{}}
+	for _, folder := range api.Db.Folders() {
+		for _, world := range visibleWorlds(getUser(ctx), folder) {
+			if r.WorldId != "" && world.Id != r.WorldId {
+				continue
+			}
+
+			superseded := world.Superseded(api.getConfig().PruneWindowFor(folder.Path, world.Name))
+			for _, b := range superseded {
+				response.Backups = append(response.Backups, PrunedBackup{FolderId: folder.Id, WorldId: world.Id, BackupId: b.Id, Name: b.Name})
+			}
+			if r.DryRun || len(superseded) == 0 {
+				continue
+			}
+
+			folder, world := folder, world
+			entry := auditEntry(ctx, audit.BackupPruned)
+			entry.FolderId = folder.Id
+			entry.WorldId = world.Id
+
+			job := api.Jobs.Submit(jobs.Prune, world.Id, "", func(p *jobs.Progress) (err error) {
+				p.SetTotal(len(superseded), 0)
+				for _, b := range superseded {
+					// another job or the watcher may have removed it, or
+					// marked it to be kept, since the request
+					b = api.currentBackup(world, b.Id)
+					if b == nil || b.Kept {
+						p.Add(1, 0)
+						continue
+					}
+
+					e := entry
+					e.BackupId = b.Id
+					e.Before = b.Id
+
+					err = api.removeBackupFiles(log, b)
+					api.audit(log, e, err)
+					if err != nil {
+						break
+					}
+
+					api.withCatalog(func() error {
+						api.forgetBackup(b)
+						world.RemoveBackup(b.Id)
+						return nil
+					})
+					metrics.BackupsPruned.WithLabelValues(folder.Id, world.Id).Inc()
+					p.Add(1, 0)
+				}
+
+				saveErr := api.withCatalog(func() error {
+					folder.ModifiedAt = getNow()
+					return api.Db.Save()
+				})
+				if err == nil {
+					err = saveErr
+				}
+				return err
+			})
+			log.Infof("Started %s job %s", jobs.Prune, job.Id)
+			response.Jobs = append(response.Jobs, job)
+		}
+	}
+
+	if r.DryRun {
+		return ctx.JSON(http.StatusOK, response)
+	}
 
-	return ctx.JSON(http.StatusOK, world)
+	return ctx.JSON(http.StatusAccepted, response)
 }
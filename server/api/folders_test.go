@@ -14,13 +14,18 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/labstack/echo"
 
+	"world-backup/server/auth"
 	"world-backup/server/conf"
 
 	"fmt"
 
+	"world-backup/server/filter"
 	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/storage"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestAPI_Folders(t *testing.T) {
@@ -31,6 +36,7 @@ func TestAPI_Folders(t *testing.T) {
 
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		c.Set(userKey, &data.User{Id: "u1", Role: auth.Admin})
 
 		mockDb := new(ApiDbMock)
 
@@ -88,6 +94,7 @@ func TestAPI_Worlds(t *testing.T) {
 
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		c.Set(userKey, &data.User{Id: "u1", Role: auth.Admin})
 
 		c.SetParamNames("id")
 		c.SetParamValues("jk0069")
@@ -159,10 +166,11 @@ func TestAPI_DeleteWorldBackup(t *testing.T) {
 			Db:     mockDb,
 			Fs:     mockFs,
 		}
+		wait := withJobs(api)
 
 		Convey("And a world with backups", func() {
 			b1 := data.Backup{Id: "bid111", Name: "zebackup.zip"}
-			b2 := data.Backup{Id: "bid888", Name: "zebackup.zip"}
+			b2 := data.Backup{Id: "bid888", Name: "zebackup.tar.gz", Format: "tar.gz"}
 			b3 := data.Backup{Id: "bid999", Name: "zebackup.zip"}
 
 			w1 := data.World{Id: "w1", Name: "Something cool 1"}
@@ -196,24 +204,21 @@ func TestAPI_DeleteWorldBackup(t *testing.T) {
 					mockFs.On("Remove", fullBackupPath).Return(nil)
 					mockDb.On("Save").Return(nil)
 
-					Convey("It should return http.StatusOK", func() {
+					Convey("It should return http.StatusAccepted with a prune job", func() {
 						resultErr := api.deleteWorldBackup(c)
+						job := wait(rec)
 
 						mockDb.AssertExpectations(t)
 						mockFs.AssertExpectations(t)
 
 						So(resultErr, ShouldBeNil)
+						So(job.Kind, ShouldEqual, jobs.Prune)
+						So(job.BackupId, ShouldEqual, "bid888")
+						So(job.State, ShouldEqual, jobs.Done)
 
-						So(rec.Code, ShouldEqual, http.StatusOK)
-
-						Convey("And the updated world", func() {
-							var resultWorld data.World
-							err := json.Unmarshal(rec.Body.Bytes(), &resultWorld)
-							So(err, ShouldBeNil)
-
-							expectedString, _ := json.Marshal(expW2)
-							So(rec.Body.String(), ShouldEqual, string(expectedString))
-
+						Convey("And the job should remove the backup from the world", func() {
+							So(w2.Backups, ShouldResemble, expW2.Backups)
+							So(f1.ModifiedAt, ShouldEqual, now)
 						})
 					})
 				})
@@ -221,15 +226,17 @@ func TestAPI_DeleteWorldBackup(t *testing.T) {
 				Convey("And call to the Remove fails", func() {
 					mockFs.On("Remove", fullBackupPath).Return(errors.New("Something bad"))
 
-					Convey("It should return http.StatusOK", func() {
+					Convey("The job should fail and keep the backup", func() {
 						resultErr := api.deleteWorldBackup(c)
+						job := wait(rec)
 
 						mockDb.AssertExpectations(t)
 						mockFs.AssertExpectations(t)
 
 						So(resultErr, ShouldBeNil)
-
-						So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+						So(job.State, ShouldEqual, jobs.Failed)
+						So(job.Error, ShouldEqual, "Something bad")
+						So(len(w2.Backups), ShouldEqual, 3)
 					})
 				})
 			})
@@ -239,27 +246,73 @@ func TestAPI_DeleteWorldBackup(t *testing.T) {
 				mockFs.On("Exists", fullBackupPath).Return(false, nil)
 				mockDb.On("Save").Return(nil)
 
-				Convey("It should return http.StatusOK", func() {
+				Convey("It should still remove the backup from the world", func() {
 					resultErr := api.deleteWorldBackup(c)
+					job := wait(rec)
 
 					mockDb.AssertExpectations(t)
 					mockFs.AssertExpectations(t)
 
 					So(resultErr, ShouldBeNil)
+					So(job.State, ShouldEqual, jobs.Done)
+					So(w2.Backups, ShouldResemble, expW2.Backups)
+				})
 
-					So(rec.Code, ShouldEqual, http.StatusOK)
+			})
 
-					Convey("And the updated folder", func() {
-						var resultWorld data.World
-						err := json.Unmarshal(rec.Body.Bytes(), &resultWorld)
-						So(err, ShouldBeNil)
+			Convey("When the backup was copied to a destination", func() {
+				queueMock := new(ReplicationQueueMock)
+				api.Destinations = storage.Set{new(DestinationMock)}
+				api.Queue = queueMock
+				b2.AddCopy(data.Copy{Destination: "nas", Key: b2.Name, Size: 10})
 
-						expectedString, _ := json.Marshal(expW2)
-						So(rec.Body.String(), ShouldEqual, string(expectedString))
+				mockFs.On("Exists", fullBackupPath).Return(false, nil)
+				mockDb.On("Save").Return(nil)
+				queueMock.On("Forget", "bid888").Return()
 
-					})
+				var removed *data.Backup
+				oldRemove := storage.Remove
+				storage.Remove = func(log *logrus.Entry, dests storage.Set, backup *data.Backup) error {
+					removed = backup
+					return nil
+				}
+				defer func() { storage.Remove = oldRemove }()
+
+				Convey("It should delete the copy too and drop it from the queue", func() {
+					resultErr := api.deleteWorldBackup(c)
+					job := wait(rec)
+
+					So(resultErr, ShouldBeNil)
+					So(job.State, ShouldEqual, jobs.Done)
+					So(removed, ShouldResemble, &b2)
+					queueMock.AssertExpectations(t)
+				})
+			})
+
+			Convey("When the backup is removed before the job gets to it", func() {
+				mockDb.Lock()
+				resultErr := api.deleteWorldBackup(c)
+				w2.RemoveBackup("bid888")
+				mockDb.Unlock()
+
+				job := wait(rec)
+
+				Convey("The job should leave it be", func() {
+					So(resultErr, ShouldBeNil)
+					So(job.State, ShouldEqual, jobs.Done)
+					So(w2.Backups, ShouldResemble, expW2.Backups)
+					mockFs.AssertNotCalled(t, "Remove", fullBackupPath)
+					mockDb.AssertNotCalled(t, "Save")
 				})
+			})
+
+			Convey("When the backup does not exist", func() {
+				c.SetParamValues("jk0069", "wid999", "bid000")
+				api.deleteWorldBackup(c)
 
+				Convey("It should return http.StatusNotFound", func() {
+					So(rec.Code, ShouldEqual, http.StatusNotFound)
+				})
 			})
 		})
 
@@ -287,10 +340,11 @@ func TestAPI_RestoreWorldBackup(t *testing.T) {
 			Db:     mockDb,
 			Fs:     mockFs,
 		}
+		wait := withJobs(api)
 
 		Convey("And a world with backups", func() {
 			b1 := data.Backup{Id: "bid111", Name: "zebackup.zip"}
-			b2 := data.Backup{Id: "bid888", Name: "zebackup.zip"}
+			b2 := data.Backup{Id: "bid888", Name: "zebackup.tar.gz", Format: "tar.gz"}
 			b3 := data.Backup{Id: "bid999", Name: "zebackup.zip"}
 
 			w1 := data.World{Id: "w1", Name: "Something cool 1"}
@@ -315,6 +369,9 @@ func TestAPI_RestoreWorldBackup(t *testing.T) {
 			mockDb.On("GetFolder", "jk0069").Return(&f1)
 
 			renameFolder := path.Join(f1.Path, fmt.Sprintf("%s_%d", w2.Name, now.Unix()))
+			backupFile := mock.MatchedBy(func(f fs.ArchiveFile) bool {
+				return f.Path == fullBackupPath && f.Format == fs.TarGz && f.Progress != nil
+			})
 
 			Convey("When the backup file exists", func() {
 				mockFs.On("Exists", fullBackupPath).Return(true, nil)
@@ -323,59 +380,134 @@ func TestAPI_RestoreWorldBackup(t *testing.T) {
 					mockFs.On("Rename", w2.FullPath, renameFolder).Return(nil)
 
 					Convey("And the call to unzip succeeds", func() {
-						mockFs.On("Unzip", fullBackupPath, f1.Path).Return(nil)
+						mockFs.On("Extract", backupFile, f1.Path).Return(nil)
 						mockDb.On("Save").Return(nil)
 
-						Convey("It should return http.StatusOK", func() {
+						Convey("It should return http.StatusAccepted with a restore job", func() {
 							resultErr := api.restoreWorldBackup(c)
+							job := wait(rec)
 
 							mockDb.AssertExpectations(t)
 							mockFs.AssertExpectations(t)
 
 							So(resultErr, ShouldBeNil)
-
-							So(rec.Code, ShouldEqual, http.StatusOK)
-
-							Convey("And the updated world", func() {
-								var resultWorld data.World
-								err := json.Unmarshal(rec.Body.Bytes(), &resultWorld)
-								So(err, ShouldBeNil)
-
-								expectedString, _ := json.Marshal(w2)
-								So(rec.Body.String(), ShouldEqual, string(expectedString))
-
-							})
+							So(job.Kind, ShouldEqual, jobs.Restore)
+							So(job.WorldId, ShouldEqual, "wid999")
+							So(job.BackupId, ShouldEqual, "bid888")
+							So(job.State, ShouldEqual, jobs.Done)
+							So(f1.ModifiedAt, ShouldEqual, now)
 						})
 					})
 
 					Convey("And the unzip fails", func() {
-						mockFs.On("Unzip", fullBackupPath, f1.Path).Return(errors.New("Failed to unzip"))
+						mockFs.On("Extract", backupFile, f1.Path).Return(errors.New("Failed to unzip"))
 
-						Convey("It should return http.StatusInternalServerError", func() {
+						Convey("The job should fail", func() {
 							resultErr := api.restoreWorldBackup(c)
+							job := wait(rec)
 
 							mockDb.AssertExpectations(t)
 							mockFs.AssertExpectations(t)
 
 							So(resultErr, ShouldBeNil)
-
-							So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+							So(job.State, ShouldEqual, jobs.Failed)
+							So(job.Error, ShouldContainSubstring, "Failed to unzip")
 						})
 					})
 				})
 
+				Convey("And the world is open in the game", func() {
+					oldIsWorldOpen := isWorldOpen
+					isWorldOpen = func(worldDir string) (bool, error) { return worldDir == w2.FullPath, nil }
+					defer func() { isWorldOpen = oldIsWorldOpen }()
+
+					Convey("The job should fail and leave the world alone", func() {
+						api.restoreWorldBackup(c)
+						job := wait(rec)
+
+						So(job.State, ShouldEqual, jobs.Failed)
+						So(job.Error, ShouldEqual, WorldOpenError.Error())
+						mockFs.AssertNotCalled(t, "Rename", mock.Anything, mock.Anything)
+					})
+				})
+
 				Convey("And the call to rename fails", func() {
 					mockFs.On("Rename", w2.FullPath, renameFolder).Return(errors.New("Failed to rename"))
 
-					Convey("It should return http.StatusInternalServerError", func() {
+					Convey("The job should fail", func() {
 						resultErr := api.restoreWorldBackup(c)
+						job := wait(rec)
 
 						mockDb.AssertExpectations(t)
 						mockFs.AssertExpectations(t)
 
 						So(resultErr, ShouldBeNil)
+						So(job.State, ShouldEqual, jobs.Failed)
+						So(job.Error, ShouldEqual, "Failed to rename")
+					})
+				})
+			})
+
+			Convey("When the backup file is gone and there is no copy", func() {
+				mockFs.On("Exists", fullBackupPath).Return(false, nil)
+
+				Convey("The job should fail and leave the world alone", func() {
+					resultErr := api.restoreWorldBackup(c)
+					job := wait(rec)
+
+					mockFs.AssertNotCalled(t, "Rename", mock.Anything, mock.Anything)
+					mockDb.AssertNotCalled(t, "Save")
 
-						So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+					So(resultErr, ShouldBeNil)
+					So(job.State, ShouldEqual, jobs.Failed)
+					So(job.Error, ShouldEqual, "zebackup.tar.gz is gone from the backup folder")
+				})
+			})
+
+			Convey("When the backup file is gone but a destination keeps a copy", func() {
+				b2.Copies = []data.Copy{{Destination: "s3", Key: b2.Name, Size: 10}}
+				mockFs.On("Exists", fullBackupPath).Return(false, nil)
+
+				var fetched string
+				oldFetch := storage.Fetch
+				defer func() { storage.Fetch = oldFetch }()
+
+				Convey("And the copy is fetched", func() {
+					storage.Fetch = func(f storage.IStorageFs, log *logrus.Entry, dests storage.Set, backup *data.Backup, localPath string) error {
+						fetched = localPath
+						return nil
+					}
+					mockFs.On("Rename", w2.FullPath, renameFolder).Return(nil)
+					mockFs.On("Extract", backupFile, f1.Path).Return(nil)
+					mockDb.On("Save").Return(nil)
+
+					Convey("It should restore from the fetched copy", func() {
+						resultErr := api.restoreWorldBackup(c)
+						job := wait(rec)
+
+						mockDb.AssertExpectations(t)
+						mockFs.AssertExpectations(t)
+
+						So(resultErr, ShouldBeNil)
+						So(job.State, ShouldEqual, jobs.Done)
+						So(fetched, ShouldEqual, fullBackupPath)
+					})
+				})
+
+				Convey("And the copy can't be fetched", func() {
+					storage.Fetch = func(f storage.IStorageFs, log *logrus.Entry, dests storage.Set, backup *data.Backup, localPath string) error {
+						return errors.New("Access denied")
+					}
+
+					Convey("The job should fail and leave the world alone", func() {
+						resultErr := api.restoreWorldBackup(c)
+						job := wait(rec)
+
+						mockFs.AssertNotCalled(t, "Rename", mock.Anything, mock.Anything)
+
+						So(resultErr, ShouldBeNil)
+						So(job.State, ShouldEqual, jobs.Failed)
+						So(job.Error, ShouldContainSubstring, "Access denied")
 					})
 				})
 			})
@@ -483,10 +615,11 @@ func TestAPI_BackupWorld(t *testing.T) {
 
 			api := &API{
 				log:    logrus.WithField("test", "TestAPI_BackupWorld"),
-				config: &conf.Config{BackupDir: "/back/up/here"},
+				config: &conf.Config{BackupDir: "/back/up/here", Rules: filter.Rules{Exclude: []string{"session.lock"}}},
 				Db:     mockDb,
 				Fs:     mockFs,
 			}
+			wait := withJobs(api)
 
 			now := time.Unix(1495807405, 0)
 			oldGetNow := getNow
@@ -508,46 +641,78 @@ func TestAPI_BackupWorld(t *testing.T) {
 
 				mockDb.On("GetFolder", "jk0069").Return(&f1)
 
-				wasCalled := false
+				type createCall struct {
+					f                                            fs.IBackupFs
+					folderPath, worldName, backupDir, backupName string
+					opts                                         fs.ArchiveOptions
+					rules                                        filter.Rules
+				}
+				var calls []createCall
+				var createErr error
 
 				origCreateBackup := fs.CreateBackup
-				fs.CreateBackup = func(f fs.IBackupFs, log *logrus.Entry, folderPath string, worldName string, backupDir string, backupName string) error {
-					wasCalled = true
-
-					So(f, ShouldEqual, mockFs)
-					So(folderPath, ShouldEqual, f1.Path)
-					So(worldName, ShouldEqual, w2.Name)
-					So(backupDir, ShouldEqual, api.config.BackupDir)
-					So(backupName, ShouldEqual, "Backup_NameHere_-20170526T090325.zip")
-
-					return nil
+				fs.CreateBackup = func(f fs.IBackupFs, log *logrus.Entry, folderPath string, worldName string, backupDir string, backupName string, opts fs.ArchiveOptions, rules filter.Rules) error {
+					calls = append(calls, createCall{f, folderPath, worldName, backupDir, backupName, opts, rules})
+					return createErr
 				}
 				defer func() { fs.CreateBackup = origCreateBackup }()
 
-				Convey("It should call fs.CreateBackup", func() {
+				Convey("It should call fs.CreateBackup in a backup job", func() {
 					mockDb.On("Save").Return(nil)
 
 					resultErr := api.backupWorld(c)
+					job := wait(rec)
 
 					So(resultErr, ShouldBeNil)
-					So(wasCalled, ShouldBeTrue)
+					So(job.Kind, ShouldEqual, jobs.Backup)
+					So(job.WorldId, ShouldEqual, "wid999")
+					So(job.State, ShouldEqual, jobs.Done)
+
+					So(len(calls), ShouldEqual, 1)
+					So(calls[0].f, ShouldEqual, mockFs)
+					So(calls[0].folderPath, ShouldEqual, f1.Path)
+					So(calls[0].worldName, ShouldEqual, w2.Name)
+					So(calls[0].backupDir, ShouldEqual, api.config.BackupDir)
+					So(calls[0].backupName, ShouldEqual, "Backup_NameHere_-20170526T090325.zip")
+					So(calls[0].rules.Exclude, ShouldResemble, []string{"session.lock"})
+					So(calls[0].opts.Progress, ShouldNotBeNil)
 
 					mockDb.AssertExpectations(t)
 					mockFs.AssertExpectations(t)
 
-					Convey("And return http.StatusOK", func() {
+					Convey("And the job should add the backup to the world", func() {
+						So(len(w2.Backups), ShouldEqual, 1)
+						So(w2.Backups[0].Name, ShouldEqual, "Backup_NameHere_-20170526T090325.zip")
+						So(w2.Backups[0].Rules.Exclude, ShouldResemble, []string{"session.lock"})
+					})
+				})
 
-						So(rec.Code, ShouldEqual, http.StatusOK)
+				Convey("When the backup fails", func() {
+					createErr = errors.New("Disk full")
 
-						Convey("And the updated world", func() {
-							var resultWorld data.World
-							err := json.Unmarshal(rec.Body.Bytes(), &resultWorld)
-							So(err, ShouldBeNil)
+					api.backupWorld(c)
+					job := wait(rec)
 
-							expectedString, _ := json.Marshal(w2)
-							So(rec.Body.String(), ShouldEqual, string(expectedString))
+					Convey("The job should fail without adding the backup", func() {
+						So(job.State, ShouldEqual, jobs.Failed)
+						So(job.Error, ShouldEqual, "Disk full")
+						So(w2.Backups, ShouldBeEmpty)
+					})
+				})
 
-						})
+				Convey("When there are destinations to copy backups to", func() {
+					queueMock := new(ReplicationQueueMock)
+					api.Destinations = storage.Set{new(DestinationMock)}
+					api.Queue = queueMock
+					mockDb.On("Save").Return(nil)
+					queueMock.On("Enqueue", mock.Anything).Return()
+
+					api.backupWorld(c)
+					wait(rec)
+
+					Convey("It should queue the new backup to be copied", func() {
+						queueMock.AssertExpectations(t)
+						So(queueMock.Calls[0].Arguments.Get(0), ShouldEqual, w2.Backups[0])
 					})
 				})
 			})
@@ -587,3 +752,183 @@ func TestAPI_BackupWorld(t *testing.T) {
 		})
 	})
 }
+
+func TestAPI_RestoreWorldBackupAs(t *testing.T) {
+	Convey("Given an api and a request to restore as a new world", t, func() {
+		newContext := func(as string) (echo.Context, *httptest.ResponseRecorder) {
+			body, _ := json.Marshal(restoreWorldRequest{As: as})
+			req, _ := http.NewRequest(echo.PATCH, "/api/folders/jk0069/worlds/wid999/backups/bid888", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetParamNames("id", "wid", "bid")
+			c.SetParamValues("jk0069", "wid999", "bid888")
+			return c, rec
+		}
+
+		mockDb := new(ApiDbMock)
+		mockFs := new(ApiFsMock)
+
+		api := &API{
+			log:    logrus.WithField("test", "TestAPI_RestoreWorldBackupAs"),
+			config: &conf.Config{BackupDir: "/back/up/here"},
+			Db:     mockDb,
+			Fs:     mockFs,
+		}
+		wait := withJobs(api)
+
+		b := data.Backup{Id: "bid888", Name: "zebackup.zip"}
+		w := data.World{Id: "wid999", Name: "survival", FullPath: "/saves/survival", Backups: []*data.Backup{&b}}
+		f := data.Folder{Id: "jk0069", Path: "/saves", Worlds: []*data.World{&w}}
+		mockDb.On("GetFolder", "jk0069").Return(&f)
+
+		tmp := "/saves/.restore-bid888"
+		backupFile := mock.MatchedBy(func(file fs.ArchiveFile) bool {
+			return file.Path == "/back/up/here/zebackup.zip"
+		})
+
+		Convey("When nothing is in the way", func() {
+			c, rec := newContext("survival copy")
+			mockFs.On("Exists", "/saves/survival copy").Return(false, nil)
+			mockFs.On("Exists", "/back/up/here/zebackup.zip").Return(true, nil)
+			mockFs.On("Extract", backupFile, tmp).Return(nil)
+			mockFs.On("Rename", "/saves/.restore-bid888/survival", "/saves/survival copy").Return(nil)
+			mockFs.On("RemoveAll", tmp).Return(nil)
+			mockDb.On("Save").Return(nil)
+
+			Convey("It should restore next to the world and leave the world alone", func() {
+				api.restoreWorldBackup(c)
+				job := wait(rec)
+
+				So(job.State, ShouldEqual, jobs.Done)
+				So(job.Result, ShouldResemble, RestoreResult{Path: "/saves/survival copy"})
+				mockFs.AssertExpectations(t)
+				mockFs.AssertNotCalled(t, "Rename", w.FullPath, mock.Anything)
+			})
+		})
+
+		Convey("When there already is a world by that name", func() {
+			c, rec := newContext("survival copy")
+			mockFs.On("Exists", "/saves/survival copy").Return(true, nil)
+			api.restoreWorldBackup(c)
+
+			Convey("It should return http.StatusConflict", func() {
+				So(rec.Code, ShouldEqual, http.StatusConflict)
+			})
+		})
+
+		Convey("When the name isn't a folder name", func() {
+			c, rec := newContext("../elsewhere")
+			api.restoreWorldBackup(c)
+
+			Convey("It should return http.StatusBadRequest", func() {
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestAPI_PruneBackups(t *testing.T) {
+	Convey("Given an api and a world backed up in two sessions", t, func() {
+		mockDb := new(ApiDbMock)
+		mockFs := new(ApiFsMock)
+
+		api := &API{
+			log:    logrus.WithField("test", "TestAPI_PruneBackups"),
+			config: &conf.Config{BackupDir: "/back/up/here", CheckInterval: "1m"},
+			Db:     mockDb,
+			Fs:     mockFs,
+		}
+		withJobs(api)
+
+		start := time.Date(2020, 6, 6, 12, 0, 0, 0, time.UTC)
+		b1 := data.Backup{Id: "b1", Name: "one.zip", CreatedAt: start}
+		b2 := data.Backup{Id: "b2", Name: "two.zip", CreatedAt: start.Add(time.Minute)}
+		b3 := data.Backup{Id: "b3", Name: "three.zip", CreatedAt: start.Add(time.Hour)}
+		w := data.World{Id: "w1", Name: "survival", Backups: []*data.Backup{&b1, &b2, &b3}}
+		f := data.Folder{Id: "f1", Path: "/saves", Worlds: []*data.World{&w}}
+		mockDb.On("Folders").Return([]*data.Folder{&f})
+
+		newContext := func(dryRun bool, worldId string) (echo.Context, *httptest.ResponseRecorder) {
+			body, _ := json.Marshal(pruneRequest{DryRun: dryRun, WorldId: worldId})
+			req, _ := http.NewRequest(echo.POST, "/api/backups/prune", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.Set(userKey, &data.User{Id: "u1", Role: auth.Parent})
+			return c, rec
+		}
+
+		Convey("When it is a dry run", func() {
+			c, rec := newContext(true, "")
+			api.pruneBackups(c)
+
+			Convey("It should list the backup it would delete and keep it", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+
+				var response PruneResponse
+				json.Unmarshal(rec.Body.Bytes(), &response)
+				So(response.Backups, ShouldResemble, []PrunedBackup{{FolderId: "f1", WorldId: "w1", BackupId: "b1", Name: "one.zip"}})
+				So(response.Jobs, ShouldBeEmpty)
+				So(len(w.Backups), ShouldEqual, 3)
+			})
+		})
+
+		Convey("When it is limited to another world", func() {
+			c, rec := newContext(true, "w2")
+			api.pruneBackups(c)
+
+			Convey("It should leave the world alone", func() {
+				var response PruneResponse
+				json.Unmarshal(rec.Body.Bytes(), &response)
+				So(response.Backups, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When it is not", func() {
+			mockFs.On("Exists", "/back/up/here/one.zip").Return(true, nil)
+			mockFs.On("Remove", "/back/up/here/one.zip").Return(nil)
+			mockDb.On("Save").Return(nil)
+
+			c, rec := newContext(false, "")
+			api.pruneBackups(c)
+
+			Convey("It should delete it in a prune job for the world", func() {
+				So(rec.Code, ShouldEqual, http.StatusAccepted)
+
+				var response PruneResponse
+				json.Unmarshal(rec.Body.Bytes(), &response)
+				So(len(response.Jobs), ShouldEqual, 1)
+
+				job, _ := api.Jobs.(*jobs.Manager).Wait(response.Jobs[0].Id)
+				So(job.State, ShouldEqual, jobs.Done)
+				So(job.Kind, ShouldEqual, jobs.Prune)
+				So(w.Backups, ShouldResemble, []*data.Backup{&b2, &b3})
+				mockFs.AssertExpectations(t)
+			})
+		})
+
+		Convey("When the backup is removed before the job gets to it", func() {
+			mockDb.On("Save").Return(nil)
+
+			c, rec := newContext(false, "")
+			mockDb.Lock()
+			api.pruneBackups(c)
+			w.RemoveBackup("b1")
+			mockDb.Unlock()
+
+			Convey("The job should skip it", func() {
+				var response PruneResponse
+				json.Unmarshal(rec.Body.Bytes(), &response)
+				So(len(response.Jobs), ShouldEqual, 1)
+
+				job, _ := api.Jobs.(*jobs.Manager).Wait(response.Jobs[0].Id)
+				So(job.State, ShouldEqual, jobs.Done)
+				So(w.Backups, ShouldResemble, []*data.Backup{&b2, &b3})
+				mockFs.AssertNotCalled(t, "Remove", "/back/up/here/one.zip")
+			})
+		})
+	})
+}
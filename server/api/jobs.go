@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"world-backup/server/jobs"
+
+	"github.com/labstack/echo"
+)
+
+var JobNotFoundResponse = ErrorResponse{Message: "Job not found"}
+
+// getJobs lists the jobs that are queued, running or recently finished
+func (api *API) getJobs(ctx echo.Context) error {
+	user := getUser(ctx)
+
+	list := []jobs.Job{}
+	for _, job := range api.Jobs.List() {
+		if api.canSeeWorldId(user, job.WorldId) {
+			list = append(list, job)
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, list)
+}
+
+// getJob returns the state of a job with the files and bytes it got
+// through, and when it should be done
+func (api *API) getJob(ctx echo.Context) error {
+	job, err := api.Jobs.Get(ctx.Param("id"))
+	if err != nil || !api.canSeeWorldId(getUser(ctx), job.WorldId) {
+		return ctx.JSON(http.StatusNotFound, JobNotFoundResponse)
+	}
+
+	return ctx.JSON(http.StatusOK, job)
+}
+
+// cancelJob stops a job, a running job stops once it notices so it may
+// still be running in the answer
+func (api *API) cancelJob(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	job, err := api.Jobs.Cancel(ctx.Param("id"))
+	switch err {
+	case nil:
+		log.Infof("Canceling %s job %s", job.Kind, job.Id)
+		return ctx.JSON(http.StatusOK, job)
+	case jobs.FinishedError:
+		return ctx.JSON(http.StatusConflict, ErrorResponse{Message: err.Error()})
+	}
+
+	return ctx.JSON(http.StatusNotFound, JobNotFoundResponse)
+}
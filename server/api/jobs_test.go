@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"world-backup/server/auth"
+	"world-backup/server/data"
+	"world-backup/server/jobs"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// withJobs gives the api a job manager, and returns a func waiting for the
+// job a handler answered with
+func withJobs(api *API) func(rec *httptest.ResponseRecorder) jobs.Job {
+	m, _ := jobs.NewManager(logrus.WithField("test", "jobs"), jobs.Config{})
+	api.Jobs = m
+
+	return func(rec *httptest.ResponseRecorder) jobs.Job {
+		So(rec.Code, ShouldEqual, http.StatusAccepted)
+
+		var started jobs.Job
+		So(json.Unmarshal(rec.Body.Bytes(), &started), ShouldBeNil)
+
+		job, err := m.Wait(started.Id)
+		So(err, ShouldBeNil)
+		return job
+	}
+}
+
+func TestAPI_Jobs(t *testing.T) {
+	Convey("Given an api running jobs", t, func() {
+		manager, _ := jobs.NewManager(logrus.WithField("test", "jobs"), jobs.Config{})
+		api := &API{log: logrus.WithField("test", "TestAPI_Jobs"), Jobs: manager}
+
+		newContext := func(method, id string) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(method, "/api/jobs/"+id, strings.NewReader(""))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+			c.Set(userKey, &data.User{Id: "u1", Role: auth.Parent})
+			return c, rec
+		}
+
+		release := make(chan bool)
+		running := api.Jobs.Submit(jobs.Backup, "w1", "", func(p *jobs.Progress) error {
+			p.SetTotal(2, 100)
+			p.Add(1, 50)
+			for {
+				select {
+				case <-release:
+					return nil
+				case <-time.After(time.Millisecond):
+					if err := p.Err(); err != nil {
+						return err
+					}
+				}
+			}
+		})
+
+		Convey("When a job is asked for", func() {
+			c, rec := newContext(echo.GET, running.Id)
+			err := api.getJob(c)
+			close(release)
+
+			Convey("It should return it with its progress", func() {
+				So(err, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+
+				var job jobs.Job
+				json.Unmarshal(rec.Body.Bytes(), &job)
+				So(job.Id, ShouldEqual, running.Id)
+				So(job.Kind, ShouldEqual, jobs.Backup)
+			})
+		})
+
+		Convey("When the jobs are listed", func() {
+			c, rec := newContext(echo.GET, "")
+			api.getJobs(c)
+			close(release)
+
+			Convey("It should return them", func() {
+				var list []jobs.Job
+				json.Unmarshal(rec.Body.Bytes(), &list)
+				So(len(list), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a job is canceled", func() {
+			c, rec := newContext(echo.DELETE, running.Id)
+			api.cancelJob(c)
+
+			Convey("It should stop", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+
+				job, _ := manager.Wait(running.Id)
+				So(job.State, ShouldEqual, jobs.Canceled)
+
+				c, rec := newContext(echo.DELETE, running.Id)
+				api.cancelJob(c)
+				So(rec.Code, ShouldEqual, http.StatusConflict)
+			})
+		})
+
+		Convey("When a job doesn't exist", func() {
+			c, rec := newContext(echo.GET, "missing")
+			api.getJob(c)
+			close(release)
+
+			Convey("It should return http.StatusNotFound", func() {
+				So(rec.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"world-backup/server/fs"
+	"world-backup/server/minecraft"
+
+	"github.com/labstack/echo"
+)
+
+var NotBedrockResponse = ErrorResponse{Message: "Only Bedrock worlds can use .mcworld files"}
+
+func (api *API) exportWorldBackup(ctx echo.Context) error {
+	folderId := ctx.Param("id")
+	worldId := ctx.Param("wid")
+	backupId := ctx.Param("bid")
+
+	log := getLogger(ctx)
+
+	log.Infof("Exporting backup F: %s W: %s B: %s", folderId, worldId, backupId)
+
+	folder := api.Db.GetFolder(folderId)
+	world := folder.GetWorld(worldId)
+	backup := world.GetBackup(backupId)
+
+	if world.Edition != string(minecraft.Bedrock) {
+		return ctx.JSON(http.StatusBadRequest, NotBedrockResponse)
+	}
+
+	fullBackupPath := path.Join(api.getConfig().BackupDir, backup.Name)
+
+	if exists, _ := api.Fs.Exists(fullBackupPath); !exists {
+		return ctx.JSON(http.StatusNotFound, nil)
+	}
+
+	// the status is only sent with the first write, so errors opening the
+	// backup can still be answered
+	rsp := ctx.Response()
+	rsp.Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	rsp.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fs.CleanName(world.DisplayName())+".mcworld"))
+
+	file, worldName := api.backupFile(ctx, backup), world.Name
+	releaseCatalog(ctx)
+
+	if err := api.Fs.ExportMcworld(file, worldName, rsp); err != nil {
+		log.Errorf("Failed to export %s: %v", fullBackupPath, err)
+		if !rsp.Committed {
+			rsp.Header().Del(echo.HeaderContentDisposition)
+			return archiveError(ctx, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (api *API) importWorldBackup(ctx echo.Context) error {
+	folderId := ctx.Param("id")
+	worldId := ctx.Param("wid")
+
+	log := getLogger(ctx)
+
+	log.Infof("Importing backup F: %s W: %s", folderId, worldId)
+
+	folder := api.Db.GetFolder(folderId)
+	world := folder.GetWorld(worldId)
+
+	if world.Edition != string(minecraft.Bedrock) {
+		return ctx.JSON(http.StatusBadRequest, NotBedrockResponse)
+	}
+
+	t := getNow()
+
+	// .mcworld files are zips, only the encryption comes from the config
+	opts := fs.ArchiveOptions{Format: fs.Zip, Encryption: api.getConfig().ArchiveFor(folder.Path).Encryption}
+	backupName := fmt.Sprintf("%s-%s-%s%s", fs.CleanName(world.DisplayName()), world.Id, t.Format("20060102T150405"), opts.Extension())
+	worldName := world.Name
+
+	// the upload is read without the catalog held
+	releaseCatalog(ctx)
+
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+	defer src.Close()
+
+	if err := api.Fs.ImportMcworld(src, file.Size, worldName, path.Join(api.getConfig().BackupDir, backupName), opts.Encryption); err != nil {
+		log.Errorf("Failed to import %s: %v", file.Filename, err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+
+	return api.withCatalog(func() error {
+		folder.ModifiedAt = getNow()
+		backup := world.AddBackup(backupName).SetFormat(string(opts.Format)).SetKeyId(opts.Encryption.Id())
+		api.replicate(backup)
+		api.Db.Save()
+
+		return ctx.JSON(http.StatusOK, world)
+	})
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+	"world-backup/server/conf"
+	"world-backup/server/crypt"
+	"world-backup/server/data"
+	"world-backup/server/fs"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAPI_ExportWorldBackup(t *testing.T) {
+	Convey("Given an api and context", t, func() {
+		e := echo.New()
+		req, _ := http.NewRequest(echo.GET, "/api/folders/jk0069/worlds/wid999/backups/bid888/mcworld", strings.NewReader(""))
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		c.SetParamNames("id", "wid", "bid")
+		c.SetParamValues("jk0069", "wid999", "bid888")
+
+		mockDb := new(ApiDbMock)
+		mockFs := new(ApiFsMock)
+
+		api := &API{
+			log:    logrus.WithField("test", "TestAPI_ExportWorldBackup"),
+			config: &conf.Config{BackupDir: "/back/up/here"},
+			Db:     mockDb,
+			Fs:     mockFs,
+		}
+
+		b1 := data.Backup{Id: "bid888", Name: "zebackup.zip"}
+		w1 := data.World{Id: "wid999", Name: "AbCdEf=", LevelName: "Our Island", Backups: []*data.Backup{&b1}}
+
+		f1 := data.Folder{
+			Id:     "jk0069",
+			Path:   "/this/be/h",
+			Worlds: []*data.World{&w1},
+		}
+
+		fullBackupPath := path.Join(api.config.BackupDir, b1.Name)
+
+		mockDb.On("GetFolder", "jk0069").Return(&f1)
+
+		Convey("When the world is a Java world", func() {
+			w1.Edition = "java"
+
+			Convey("It should return http.StatusBadRequest", func() {
+				resultErr := api.exportWorldBackup(c)
+
+				So(resultErr, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When the world is a Bedrock world", func() {
+			w1.Edition = "bedrock"
+
+			Convey("And the backup file does not exist", func() {
+				mockFs.On("Exists", fullBackupPath).Return(false, nil)
+
+				Convey("It should return http.StatusNotFound", func() {
+					resultErr := api.exportWorldBackup(c)
+
+					mockFs.AssertExpectations(t)
+					So(resultErr, ShouldBeNil)
+					So(rec.Code, ShouldEqual, http.StatusNotFound)
+				})
+			})
+
+			Convey("And the backup file exists", func() {
+				mockFs.On("Exists", fullBackupPath).Return(true, nil)
+				mockFs.On("ExportMcworld", fs.ArchiveFile{Path: fullBackupPath}, w1.Name, mock.Anything).Return(nil)
+
+				Convey("It should stream the .mcworld file", func() {
+					resultErr := api.exportWorldBackup(c)
+
+					mockFs.AssertExpectations(t)
+					So(resultErr, ShouldBeNil)
+					So(rec.Code, ShouldEqual, http.StatusOK)
+					So(rec.Header().Get(echo.HeaderContentDisposition), ShouldEqual, `attachment; filename="Our_Island.mcworld"`)
+				})
+			})
+		})
+	})
+}
+
+func TestAPI_ImportWorldBackup(t *testing.T) {
+	Convey("Given an api and a Bedrock world", t, func() {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		part, _ := mw.CreateFormFile("file", "island.mcworld")
+		part.Write([]byte("not really a zip"))
+		mw.Close()
+
+		e := echo.New()
+		req, _ := http.NewRequest(echo.POST, "/api/folders/jk0069/worlds/wid999/backups/mcworld", body)
+		req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		c.SetParamNames("id", "wid")
+		c.SetParamValues("jk0069", "wid999")
+
+		mockDb := new(ApiDbMock)
+		mockFs := new(ApiFsMock)
+
+		api := &API{
+			log:    logrus.WithField("test", "TestAPI_ImportWorldBackup"),
+			config: &conf.Config{BackupDir: "/back/up/here"},
+			Db:     mockDb,
+			Fs:     mockFs,
+		}
+
+		w1 := data.World{Id: "wid999", Name: "AbCdEf=", LevelName: "Our Island", Edition: "bedrock"}
+
+		f1 := data.Folder{
+			Id:     "jk0069",
+			Path:   "/this/be/h",
+			Worlds: []*data.World{&w1},
+		}
+
+		now := time.Unix(1495807405, 0)
+		oldGetNow := getNow
+		getNow = func() time.Time { return now }
+		defer func() { getNow = oldGetNow }()
+
+		backupName := "Our_Island-wid999-" + now.Format("20060102T150405") + ".zip"
+		target := path.Join(api.config.BackupDir, backupName)
+
+		mockDb.On("GetFolder", "jk0069").Return(&f1)
+
+		Convey("When the import succeeds", func() {
+			mockFs.On("ImportMcworld", mock.Anything, int64(16), w1.Name, target, (*crypt.Config)(nil)).Return(nil)
+			mockDb.On("Save").Return(nil)
+
+			Convey("It should add the backup to the world", func() {
+				resultErr := api.importWorldBackup(c)
+
+				mockDb.AssertExpectations(t)
+				mockFs.AssertExpectations(t)
+
+				So(resultErr, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(len(w1.Backups), ShouldEqual, 1)
+				So(w1.Backups[0].Name, ShouldEqual, backupName)
+				So(w1.Backups[0].Format, ShouldEqual, "zip")
+			})
+		})
+
+		Convey("When the import fails", func() {
+			mockFs.On("ImportMcworld", mock.Anything, int64(16), w1.Name, target, (*crypt.Config)(nil)).Return(errors.New("bad zip"))
+
+			Convey("It should return http.StatusInternalServerError", func() {
+				resultErr := api.importWorldBackup(c)
+
+				mockFs.AssertExpectations(t)
+
+				So(resultErr, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+				So(len(w1.Backups), ShouldEqual, 0)
+			})
+		})
+	})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"world-backup/server/metrics"
+
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var lastBackupAge = prometheus.NewDesc(
+	"worldbackup_last_backup_age_seconds",
+	"Time since the last backup of a world that worked.",
+	[]string{"folder", "world"}, nil,
+)
+
+// catalogCollector reads the time since the last backup of each world from
+// the catalog when the metrics are scraped, so it keeps growing while no
+// backups are made
+type catalogCollector struct {
+	db IApiDb
+}
+
+func (c catalogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lastBackupAge
+}
+
+func (c catalogCollector) Collect(ch chan<- prometheus.Metric) {
+	now := getNow()
+	for _, f := range c.db.Folders() {
+		for _, w := range f.Worlds {
+			last := w.LastBackupTime()
+			if last.IsZero() {
+				continue
+			}
+
+			ch <- prometheus.MustNewConstMetric(lastBackupAge, prometheus.GaugeValue, now.Sub(last).Seconds(), f.Id, w.Id)
+		}
+	}
+}
+
+// metricsHandler serves the metrics of the server and its catalog for
+// Prometheus to scrape. The folder and world ids are only in them when the
+// config has metrics.perWorld.
+func (api *API) metricsHandler() echo.HandlerFunc {
+	catalog := prometheus.NewRegistry()
+	catalog.MustRegister(catalogCollector{db: api.Db})
+
+	gatherers := prometheus.Gatherers{metrics.Registry, catalog}
+	perWorld := echo.WrapHandler(promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}))
+	added := echo.WrapHandler(promhttp.HandlerFor(metrics.WithoutWorlds{Gatherer: gatherers}, promhttp.HandlerOpts{}))
+
+	return func(ctx echo.Context) error {
+		if api.getConfig().Metrics.PerWorld {
+			return perWorld(ctx)
+		}
+		return added(ctx)
+	}
+}
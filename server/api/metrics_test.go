@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"world-backup/server/conf"
+	"world-backup/server/data"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPI_Metrics(t *testing.T) {
+	Convey("Given an api with a world backed up an hour ago", t, func() {
+		now := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+		origGetNow := getNow
+		getNow = func() time.Time { return now }
+		defer func() { getNow = origGetNow }()
+
+		w1 := data.World{Id: "w1", Backups: []*data.Backup{{Id: "b1", CreatedAt: now.Add(-time.Hour)}}}
+		w2 := data.World{Id: "w2"}
+		mockDb := new(ApiDbMock)
+		mockDb.On("Folders").Return([]*data.Folder{{Id: "f1", Worlds: []*data.World{&w1, &w2}}})
+
+		api := &API{
+			log:    logrus.WithField("test", "TestAPI_Metrics"),
+			config: &conf.Config{Metrics: conf.MetricsConfig{PerWorld: true}},
+			Db:     mockDb,
+		}
+
+		Convey("When the metrics are scraped after a request", func() {
+			e := echo.New()
+			e.GET("/api/folders/:id", func(ctx echo.Context) error {
+				return ctx.NoContent(http.StatusNoContent)
+			}, api.setupRequest)
+			e.GET("/metrics", api.metricsHandler())
+
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(echo.GET, "/api/folders/f1", nil))
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/metrics", nil))
+
+			Convey("It should have the time since the last backup of each world backed up", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(rec.Body.String(), ShouldContainSubstring, `worldbackup_last_backup_age_seconds{folder="f1",world="w1"} 3600`)
+				So(rec.Body.String(), ShouldNotContainSubstring, `world="w2"`)
+			})
+
+			Convey("It should count the request by its route", func() {
+				So(rec.Body.String(), ShouldContainSubstring, `worldbackup_http_requests_total{code="204",method="GET",route="/api/folders/:id"}`)
+			})
+		})
+
+		Convey("When the metrics are scraped without per world metrics", func() {
+			api.config = &conf.Config{}
+			w2.Backups = []*data.Backup{{Id: "b2", CreatedAt: now.Add(-2 * time.Hour)}}
+
+			e := echo.New()
+			e.GET("/metrics", api.metricsHandler())
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/metrics", nil))
+
+			Convey("It should have the longest time since a backup and no ids", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(rec.Body.String(), ShouldContainSubstring, "worldbackup_last_backup_age_seconds 7200")
+				So(rec.Body.String(), ShouldNotContainSubstring, `world="`)
+				So(rec.Body.String(), ShouldNotContainSubstring, `folder="`)
+			})
+		})
+	})
+}
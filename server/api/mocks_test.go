@@ -1,17 +1,37 @@
 package api
 
 import (
+	"io"
 	"net/http"
+	"os"
+	"sync"
+	"time"
 
+	"world-backup/server/conf"
+	"world-backup/server/crypt"
 	"world-backup/server/data"
+	"world-backup/server/filter"
+	"world-backup/server/fs"
+	"world-backup/server/storage"
 
 	"github.com/labstack/echo"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/mock"
 )
 
 //region ApiDb Mock
 type ApiDbMock struct {
 	mock.Mock
+	// catalog is a real lock, so holding it twice deadlocks the test
+	catalog sync.Mutex
+}
+
+func (m *ApiDbMock) Lock() {
+	m.catalog.Lock()
+}
+
+func (m *ApiDbMock) Unlock() {
+	m.catalog.Unlock()
 }
 
 func (m *ApiDbMock) Folders() []*data.Folder {
@@ -24,11 +44,65 @@ func (m *ApiDbMock) GetFolder(id string) *data.Folder {
 	return args.Get(0).(*data.Folder)
 }
 
+func (m *ApiDbMock) AddFolder(path string) *data.Folder {
+	args := m.Called(path)
+	return args.Get(0).(*data.Folder)
+}
+
+func (m *ApiDbMock) InsertFolder(f *data.Folder) {
+	m.Called(f)
+}
+
+func (m *ApiDbMock) GetFolderByPath(path string) *data.Folder {
+	args := m.Called(path)
+	return args.Get(0).(*data.Folder)
+}
+
+func (m *ApiDbMock) RemoveFolder(id string) bool {
+	args := m.Called(id)
+	return args.Bool(0)
+}
+
 func (m *ApiDbMock) Save() error {
 	args := m.Called()
 	return args.Error(0)
 }
 
+func (m *ApiDbMock) SaveError() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *ApiDbMock) CheckWritable() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *ApiDbMock) Users() []*data.User {
+	args := m.Called()
+	return args.Get(0).([]*data.User)
+}
+
+func (m *ApiDbMock) AddUser(name, passwordHash, role string) *data.User {
+	args := m.Called(name, passwordHash, role)
+	return args.Get(0).(*data.User)
+}
+
+func (m *ApiDbMock) GetUser(id string) *data.User {
+	args := m.Called(id)
+	return args.Get(0).(*data.User)
+}
+
+func (m *ApiDbMock) GetUserByName(name string) *data.User {
+	args := m.Called(name)
+	return args.Get(0).(*data.User)
+}
+
+func (m *ApiDbMock) DeleteUser(id string) bool {
+	args := m.Called(id)
+	return args.Bool(0)
+}
+
 //endregion
 
 //region ApiFs Mock
@@ -41,6 +115,11 @@ func (m *ApiFsMock) Exists(path string) (bool, error) {
 	return args.Bool(0), args.Error(1)
 }
 
+func (m *ApiFsMock) DirExists(path string) (bool, error) {
+	args := m.Called(path)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *ApiFsMock) Remove(name string) error {
 	args := m.Called(name)
 	return args.Error(0)
@@ -51,8 +130,8 @@ func (m *ApiFsMock) RemoveAll(name string) error {
 	return args.Error(0)
 }
 
-func (m *ApiFsMock) Unzip(src, dest string) error {
-	args := m.Called(src, dest)
+func (m *ApiFsMock) Extract(file fs.ArchiveFile, dest string) error {
+	args := m.Called(file, dest)
 	return args.Error(0)
 }
 
@@ -61,21 +140,76 @@ func (m *ApiFsMock) Rename(oldname, newname string) error {
 	return args.Error(0)
 }
 
-func (m *ApiFsMock) Chdir(dir string) error {
-	args := m.Called(dir)
+func (m *ApiFsMock) Archive(source, target string, opts fs.ArchiveOptions, rules filter.Rules) error {
+	args := m.Called(source, target, opts, rules)
 	return args.Error(0)
 }
 
-func (m *ApiFsMock) Getwd() (dir string, err error) {
-	args := m.Called()
-	return args.String(0), args.Error(1)
+func (m *ApiFsMock) ExportMcworld(backup fs.ArchiveFile, worldDir string, w io.Writer) error {
+	args := m.Called(backup, worldDir, w)
+	return args.Error(0)
+}
+
+func (m *ApiFsMock) ImportMcworld(src io.ReaderAt, size int64, worldDir, target string, encryption *crypt.Config) error {
+	args := m.Called(src, size, worldDir, target, encryption)
+	return args.Error(0)
+}
+
+func (m *ApiFsMock) OpenArchive(file fs.ArchiveFile) (fs.ArchiveReader, error) {
+	args := m.Called(file)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(fs.ArchiveReader), args.Error(1)
+}
+
+func (m *ApiFsMock) VerifyArchive(file fs.ArchiveFile) error {
+	args := m.Called(file)
+	return args.Error(0)
+}
+
+func (m *ApiFsMock) CopyArchive(file fs.ArchiveFile, w io.Writer) error {
+	args := m.Called(file, w)
+	return args.Error(0)
+}
+
+func (m *ApiFsMock) ReadFile(filename string) ([]byte, error) {
+	args := m.Called(filename)
+	return args.Get(0).([]byte), args.Error(1)
 }
 
-func (m *ApiFsMock) Zip(source, target string) error {
-	args := m.Called(source, target)
+func (m *ApiFsMock) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	args := m.Called(filename, data, perm)
 	return args.Error(0)
 }
 
+func (m *ApiFsMock) MkdirAll(path string, perm os.FileMode) error {
+	args := m.Called(path, perm)
+	return args.Error(0)
+}
+
+func (m *ApiFsMock) Open(name string) (afero.File, error) {
+	args := m.Called(name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(afero.File), args.Error(1)
+}
+
+func (m *ApiFsMock) Create(name string) (afero.File, error) {
+	args := m.Called(name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(afero.File), args.Error(1)
+}
+
+func (m *ApiFsMock) FreeSpace(path string) (uint64, error) {
+	args := m.Called(path)
+	return args.Get(0).(uint64), args.Error(1)
+}
+
 //endregion
 
 //region Echo Mock
@@ -169,3 +303,90 @@ func (em *HandlerMock) Handler(next echo.Context) error {
 }
 
 //endregion
+
+//region Destination Mock
+type DestinationMock struct {
+	mock.Mock
+}
+
+func (m *DestinationMock) Name() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func (m *DestinationMock) Put(key string, r io.ReadSeeker, size int64) (*storage.Object, error) {
+	args := m.Called(key, r, size)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Object), args.Error(1)
+}
+
+func (m *DestinationMock) Get(key string, w io.Writer) error {
+	args := m.Called(key, w)
+	return args.Error(0)
+}
+
+func (m *DestinationMock) Stat(key string) (*storage.Object, error) {
+	args := m.Called(key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Object), args.Error(1)
+}
+
+func (m *DestinationMock) List() ([]storage.Object, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.Object), args.Error(1)
+}
+
+func (m *DestinationMock) Delete(key string) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+//endregion
+
+//region Replication Queue Mock
+type ReplicationQueueMock struct {
+	mock.Mock
+}
+
+func (m *ReplicationQueueMock) Enqueue(backup *data.Backup) {
+	m.Called(backup)
+}
+
+func (m *ReplicationQueueMock) Forget(backupId string) {
+	m.Called(backupId)
+}
+
+func (m *ReplicationQueueMock) Status(backup *data.Backup) []data.Replication {
+	args := m.Called(backup)
+	return args.Get(0).([]data.Replication)
+}
+
+//endregion
+
+//region Reloader Mock
+type ReloaderMock struct {
+	mock.Mock
+}
+
+func (m *ReloaderMock) Reload() (*conf.ReloadResult, error) {
+	args := m.Called()
+	return args.Get(0).(*conf.ReloadResult), args.Error(1)
+}
+
+type WatcherMock struct {
+	mock.Mock
+}
+
+func (m *WatcherMock) LastCheck() (time.Time, time.Duration) {
+	args := m.Called()
+	return args.Get(0).(time.Time), args.Get(1).(time.Duration)
+}
+
+//endregion
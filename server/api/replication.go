@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+
+	"world-backup/server/data"
+
+	"github.com/labstack/echo"
+)
+
+// getReplication returns how copying the backup to each destination went
+func (api *API) getReplication(ctx echo.Context) error {
+	folderId := ctx.Param("id")
+	worldId := ctx.Param("wid")
+	backupId := ctx.Param("bid")
+
+	folder := api.Db.GetFolder(folderId)
+	world := folder.GetWorld(worldId)
+	backup := world.GetBackup(backupId)
+
+	if backup == nil {
+		return ctx.JSON(http.StatusNotFound, BackupNotFoundResponse)
+	}
+
+	if len(api.getDestinations()) == 0 {
+		return ctx.JSON(http.StatusOK, []data.Replication{})
+	}
+
+	return ctx.JSON(http.StatusOK, api.Queue.Status(backup))
+}
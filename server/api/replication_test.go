@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"world-backup/server/conf"
+	"world-backup/server/data"
+	"world-backup/server/storage"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPI_GetReplication(t *testing.T) {
+	Convey("Given an api and a world with a backup", t, func() {
+		mockDb := new(ApiDbMock)
+		queueMock := new(ReplicationQueueMock)
+
+		api := &API{
+			log:    logrus.WithField("test", "TestAPI_GetReplication"),
+			config: &conf.Config{BackupDir: "/back/up/here"},
+			Db:     mockDb,
+			Queue:  queueMock,
+		}
+
+		b1 := data.Backup{Id: "bid888", Name: "backup.zip"}
+		w1 := data.World{Id: "wid999", Name: "World", Backups: []*data.Backup{&b1}}
+		f1 := data.Folder{Id: "jk0069", Path: "/this/be/h", Worlds: []*data.World{&w1}}
+
+		mockDb.On("GetFolder", "jk0069").Return(&f1)
+
+		newContext := func(backupId string) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(echo.GET, "/api/folders/jk0069/worlds/wid999/backups/"+backupId+"/replication", strings.NewReader(""))
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id", "wid", "bid")
+			c.SetParamValues("jk0069", "wid999", backupId)
+			return c, rec
+		}
+
+		Convey("When there are destinations", func() {
+			api.Destinations = storage.Set{new(DestinationMock)}
+			status := []data.Replication{
+				{BackupId: "bid888", Destination: "s3", State: data.ReplicationDone, Attempts: 1},
+				{BackupId: "bid888", Destination: "nas", State: data.ReplicationPending, Attempts: 2, LastError: "Offline"},
+			}
+			queueMock.On("Status", &b1).Return(status)
+
+			c, rec := newContext("bid888")
+			err := api.getReplication(c)
+
+			Convey("It should return the state for each destination", func() {
+				So(err, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+
+				var result []data.Replication
+				json.Unmarshal(rec.Body.Bytes(), &result)
+				So(result, ShouldResemble, status)
+			})
+		})
+
+		Convey("When there are no destinations", func() {
+			c, rec := newContext("bid888")
+			api.getReplication(c)
+
+			Convey("It should return an empty list", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(strings.TrimSpace(rec.Body.String()), ShouldEqual, "[]")
+				So(queueMock.Calls, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the backup does not exist", func() {
+			c, rec := newContext("nope")
+			api.getReplication(c)
+
+			Convey("It should return http.StatusNotFound", func() {
+				So(rec.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
@@ -1,10 +1,14 @@
 package api
 
 import (
+	"strconv"
 	"time"
 
 	"path"
 
+	"world-backup/server/auth"
+	"world-backup/server/metrics"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
@@ -14,20 +18,60 @@ import (
 func (api *API) SetUpRoutes() {
 
 	api.Server.Use(api.setupRequest)
-	api.Server.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-	}))
+	// without origins echo would allow any, only the client served here
+	// can use the api then
+	if origins := api.getConfig().Cors.AllowOrigins; len(origins) > 0 {
+		api.Server.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+			AllowOrigins: origins,
+			AllowHeaders: []string{echo.HeaderAuthorization, echo.HeaderContentType, HeaderBackupPassphrase, HeaderBackupIdentity},
+		}))
+	}
 
-	api.Server.Use(middleware.Static(api.config.StaticRoot))
+	api.Server.Use(middleware.Static(api.getConfig().StaticRoot))
 	api.Server.GET("*", api.index)
 
-	apiGroup := api.Server.Group("/api")
+	api.Server.POST("/api/auth/login", api.login, api.holdCatalog)
+	api.Server.GET("/metrics", api.metricsHandler(), api.holdCatalog)
+	api.Server.GET("/healthz", api.healthz)
+	api.Server.GET("/readyz", api.readyz, api.holdCatalog)
+
+	apiGroup := api.Server.Group("/api", api.holdCatalog, api.authenticate, api.scopeWorlds)
+	apiGroup.GET("/auth/me", api.getMe)
 	apiGroup.GET("/folders", api.getFolders)
+	apiGroup.POST("/folders", api.addFolder, allow(auth.Admin))
+	apiGroup.PATCH("/folders/:id", api.updateFolder, allow(auth.Admin))
+	apiGroup.DELETE("/folders/:id", api.removeFolder, allow(auth.Admin))
+	apiGroup.PUT("/folders/:id/access", api.setFolderAccess, allow(auth.Admin))
 	apiGroup.GET("/folders/:id/worlds", api.getWorlds)
-	apiGroup.DELETE("/folders/:id/worlds/:wid", api.deleteWorld)
+	apiGroup.DELETE("/folders/:id/worlds/:wid", api.deleteWorld, allow(auth.Parent))
+	apiGroup.PUT("/folders/:id/worlds/:wid/access", api.setWorldAccess, allow(auth.Admin))
 	apiGroup.POST("/folders/:id/worlds/:wid/backups", api.backupWorld)
-	apiGroup.DELETE("/folders/:id/worlds/:wid/backups/:bid", api.deleteWorldBackup)
-	apiGroup.PATCH("/folders/:id/worlds/:wid/backups/:bid", api.restoreWorldBackup)
+	apiGroup.DELETE("/folders/:id/worlds/:wid/backups/:bid", api.deleteWorldBackup, allow(auth.Parent))
+	apiGroup.PATCH("/folders/:id/worlds/:wid/backups/:bid", api.restoreWorldBackup, api.allowOwner)
+	apiGroup.GET("/folders/:id/worlds/:wid/backups/:bid/mcworld", api.exportWorldBackup)
+	apiGroup.POST("/folders/:id/worlds/:wid/backups/mcworld", api.importWorldBackup, allow(auth.Parent))
+	apiGroup.GET("/folders/:id/worlds/:wid/backups/:bid/diff", api.diffWorldBackup)
+	apiGroup.POST("/folders/:id/worlds/:wid/backups/:bid/chunks", api.restoreWorldChunks, api.allowOwner)
+	apiGroup.GET("/folders/:id/worlds/:wid/backups/:bid/files", api.browseWorldBackup)
+	apiGroup.GET("/folders/:id/worlds/:wid/backups/:bid/verify", api.verifyWorldBackup)
+	apiGroup.GET("/folders/:id/worlds/:wid/backups/:bid/download", api.downloadWorldBackup)
+	apiGroup.GET("/folders/:id/worlds/:wid/backups/:bid/replication", api.getReplication)
+	apiGroup.POST("/backups/prune", api.pruneBackups, allow(auth.Parent))
+	apiGroup.GET("/throttle", api.getThrottle)
+	apiGroup.PUT("/throttle", api.setThrottle, allow(auth.Parent))
+	apiGroup.GET("/jobs", api.getJobs)
+	apiGroup.GET("/jobs/:id", api.getJob)
+	apiGroup.DELETE("/jobs/:id", api.cancelJob, allow(auth.Parent))
+	apiGroup.GET("/events", api.streamEvents)
+	apiGroup.GET("/audit", api.getAudit, allow(auth.Parent))
+	apiGroup.GET("/users", api.getUsers, allow(auth.Admin))
+	apiGroup.POST("/users", api.addUser, allow(auth.Admin))
+	apiGroup.PATCH("/users/:id", api.updateUser)
+	apiGroup.DELETE("/users/:id", api.deleteUser, allow(auth.Admin))
+	apiGroup.POST("/admin/reload", api.reloadConfig, allow(auth.Admin))
+	apiGroup.GET("/admin/status", api.getStatus, allow(auth.Admin))
+	apiGroup.GET("/bundle", api.exportBundle, allow(auth.Admin))
+	apiGroup.POST("/bundle", api.importBundle, allow(auth.Admin))
 
 	routes := api.Server.Routes()
 	for i := 0; i < len(routes); i++ {
@@ -48,10 +92,16 @@ func (api *API) setupRequest(f echo.HandlerFunc) echo.HandlerFunc {
 		startTime := time.Now()
 		defer func() {
 			rsp := ctx.Response()
+			runtime := time.Since(startTime)
 			logger.WithFields(logrus.Fields{
 				"status_code":  rsp.Status,
-				"runtime_nano": time.Since(startTime).Nanoseconds(),
+				"runtime_nano": runtime.Nanoseconds(),
 			}).Info("Finished request")
+
+			// by route, so the ids in paths don't each make their own series
+			route := ctx.Path()
+			metrics.HTTPRequests.WithLabelValues(req.Method, route, strconv.Itoa(rsp.Status)).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(req.Method, route).Observe(runtime.Seconds())
 		}()
 
 		logger.WithFields(logrus.Fields{
@@ -72,6 +122,6 @@ func (api *API) setupRequest(f echo.HandlerFunc) echo.HandlerFunc {
 
 func (api *API) index(ctx echo.Context) error {
 	log := getLogger(ctx)
-	log.Infof("Returning index from: %s", api.config.StaticRoot)
-	return api.Server.File(ctx, path.Join(api.config.StaticRoot, "index.html"))
+	log.Infof("Returning index from: %s", api.getConfig().StaticRoot)
+	return api.Server.File(ctx, path.Join(api.getConfig().StaticRoot, "index.html"))
 }
@@ -19,7 +19,7 @@ func TestSetUpRoutes(t *testing.T) {
 		echoMock := new(EchoServerMock)
 
 		api := &API{
-			config: &conf.Config{Port: 7630},
+			config: &conf.Config{Port: 7630, Cors: conf.CorsConfig{AllowOrigins: []string{"http://localhost:8080"}}},
 			Server: echoMock,
 			log:    logrus.WithField("test", "TestSetUpRoutes"),
 		}
@@ -28,17 +28,51 @@ func TestSetUpRoutes(t *testing.T) {
 
 		echoMock.On("Use", mock.Anything, mock.Anything).Times(3)
 		echoMock.On("GET", "*", mock.Anything, mock.Anything).Once()
+		echoMock.On("POST", "/api/auth/login", mock.Anything, mock.Anything).Once()
+		echoMock.On("GET", "/metrics", mock.Anything, mock.Anything).Once()
+		echoMock.On("GET", "/healthz", mock.Anything, mock.Anything).Once()
+		echoMock.On("GET", "/readyz", mock.Anything, mock.Anything).Once()
 
 		echoMock.On("Group", "/api", mock.Anything, mock.Anything).Return(groupMock)
 
+		groupMock.On("GET", "/auth/me", mock.Anything, mock.Anything).Once()
 		groupMock.On("GET", "/folders", mock.Anything, mock.Anything).Once()
+		groupMock.On("POST", "/folders", mock.Anything, mock.Anything).Once()
+		groupMock.On("PATCH", "/folders/:id", mock.Anything, mock.Anything).Once()
+		groupMock.On("DELETE", "/folders/:id", mock.Anything, mock.Anything).Once()
+		groupMock.On("PUT", "/folders/:id/access", mock.Anything, mock.Anything).Once()
 		groupMock.On("GET", "/folders/:id/worlds", mock.Anything, mock.Anything).Once()
 
 		groupMock.On("DELETE", "/folders/:id/worlds/:wid", mock.Anything, mock.Anything).Once()
+		groupMock.On("PUT", "/folders/:id/worlds/:wid/access", mock.Anything, mock.Anything).Once()
 		groupMock.On("POST", "/folders/:id/worlds/:wid/backups", mock.Anything, mock.Anything).Once()
 
 		groupMock.On("DELETE", "/folders/:id/worlds/:wid/backups/:bid", mock.Anything, mock.Anything).Once()
 		groupMock.On("PATCH", "/folders/:id/worlds/:wid/backups/:bid", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/folders/:id/worlds/:wid/backups/:bid/mcworld", mock.Anything, mock.Anything).Once()
+		groupMock.On("POST", "/folders/:id/worlds/:wid/backups/mcworld", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/folders/:id/worlds/:wid/backups/:bid/diff", mock.Anything, mock.Anything).Once()
+		groupMock.On("POST", "/folders/:id/worlds/:wid/backups/:bid/chunks", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/folders/:id/worlds/:wid/backups/:bid/files", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/folders/:id/worlds/:wid/backups/:bid/verify", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/folders/:id/worlds/:wid/backups/:bid/download", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/folders/:id/worlds/:wid/backups/:bid/replication", mock.Anything, mock.Anything).Once()
+		groupMock.On("POST", "/backups/prune", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/throttle", mock.Anything, mock.Anything).Once()
+		groupMock.On("PUT", "/throttle", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/jobs", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/jobs/:id", mock.Anything, mock.Anything).Once()
+		groupMock.On("DELETE", "/jobs/:id", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/events", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/audit", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/users", mock.Anything, mock.Anything).Once()
+		groupMock.On("POST", "/users", mock.Anything, mock.Anything).Once()
+		groupMock.On("PATCH", "/users/:id", mock.Anything, mock.Anything).Once()
+		groupMock.On("DELETE", "/users/:id", mock.Anything, mock.Anything).Once()
+		groupMock.On("POST", "/admin/reload", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/admin/status", mock.Anything, mock.Anything).Once()
+		groupMock.On("GET", "/bundle", mock.Anything, mock.Anything).Once()
+		groupMock.On("POST", "/bundle", mock.Anything, mock.Anything).Once()
 
 		routes := []echo.Route{
 			{Path: "/something", Method: "put"},
@@ -53,24 +87,108 @@ func TestSetUpRoutes(t *testing.T) {
 
 			So(echoMock.Calls[3].Arguments.Get(0), ShouldEqual, "*")
 			So(echoMock.Calls[3].Arguments.Get(1), ShouldEqual, api.index)
+			So(echoMock.Calls[4].Arguments.Get(1), ShouldEqual, api.login)
+			So(echoMock.Calls[5].Arguments.Get(0), ShouldEqual, "/metrics")
+			So(echoMock.Calls[6].Arguments.Get(1), ShouldEqual, api.healthz)
+			So(echoMock.Calls[7].Arguments.Get(1), ShouldEqual, api.readyz)
 
 			var testGroupRoute = func(i int, r string, f func(ctx echo.Context) error) {
 				So(groupMock.Calls[i].Arguments.Get(0), ShouldEqual, r)
 				So(groupMock.Calls[i].Arguments.Get(1), ShouldEqual, f)
 			}
 
+			// how many middlewares guard each route
+			var testGuarded = func(i int, count int) {
+				So(len(groupMock.Calls[i].Arguments.Get(2).([]echo.MiddlewareFunc)), ShouldEqual, count)
+			}
+
 			i := 0
+			testGroupRoute(i, "/auth/me", api.getMe)
+			i++
 			testGroupRoute(i, "/folders", api.getFolders)
+			testGuarded(i, 0)
+			i++
+			testGroupRoute(i, "/folders", api.addFolder)
+			testGuarded(i, 1)
+			i++
+			testGroupRoute(i, "/folders/:id", api.updateFolder)
+			testGuarded(i, 1)
+			i++
+			testGroupRoute(i, "/folders/:id", api.removeFolder)
+			testGuarded(i, 1)
+			i++
+			testGroupRoute(i, "/folders/:id/access", api.setFolderAccess)
+			testGuarded(i, 1)
 			i++
 			testGroupRoute(i, "/folders/:id/worlds", api.getWorlds)
 			i++
 			testGroupRoute(i, "/folders/:id/worlds/:wid", api.deleteWorld)
+			testGuarded(i, 1)
+			i++
+			testGroupRoute(i, "/folders/:id/worlds/:wid/access", api.setWorldAccess)
 			i++
 			testGroupRoute(i, "/folders/:id/worlds/:wid/backups", api.backupWorld)
 			i++
 			testGroupRoute(i, "/folders/:id/worlds/:wid/backups/:bid", api.deleteWorldBackup)
 			i++
 			testGroupRoute(i, "/folders/:id/worlds/:wid/backups/:bid", api.restoreWorldBackup)
+			testGuarded(i, 1)
+			i++
+			testGroupRoute(i, "/folders/:id/worlds/:wid/backups/:bid/mcworld", api.exportWorldBackup)
+			i++
+			testGroupRoute(i, "/folders/:id/worlds/:wid/backups/mcworld", api.importWorldBackup)
+			i++
+			testGroupRoute(i, "/folders/:id/worlds/:wid/backups/:bid/diff", api.diffWorldBackup)
+			i++
+			testGroupRoute(i, "/folders/:id/worlds/:wid/backups/:bid/chunks", api.restoreWorldChunks)
+			i++
+			testGroupRoute(i, "/folders/:id/worlds/:wid/backups/:bid/files", api.browseWorldBackup)
+			i++
+			testGroupRoute(i, "/folders/:id/worlds/:wid/backups/:bid/verify", api.verifyWorldBackup)
+			i++
+			testGroupRoute(i, "/folders/:id/worlds/:wid/backups/:bid/download", api.downloadWorldBackup)
+			i++
+			testGroupRoute(i, "/folders/:id/worlds/:wid/backups/:bid/replication", api.getReplication)
+			i++
+			testGroupRoute(i, "/backups/prune", api.pruneBackups)
+			testGuarded(i, 1)
+			i++
+			testGroupRoute(i, "/throttle", api.getThrottle)
+			i++
+			testGroupRoute(i, "/throttle", api.setThrottle)
+			i++
+			testGroupRoute(i, "/jobs", api.getJobs)
+			i++
+			testGroupRoute(i, "/jobs/:id", api.getJob)
+			i++
+			testGroupRoute(i, "/jobs/:id", api.cancelJob)
+			i++
+			testGroupRoute(i, "/events", api.streamEvents)
+			i++
+			testGroupRoute(i, "/audit", api.getAudit)
+			testGuarded(i, 1)
+			i++
+			testGroupRoute(i, "/users", api.getUsers)
+			testGuarded(i, 1)
+			i++
+			testGroupRoute(i, "/users", api.addUser)
+			i++
+			testGroupRoute(i, "/users/:id", api.updateUser)
+			testGuarded(i, 0)
+			i++
+			testGroupRoute(i, "/users/:id", api.deleteUser)
+			i++
+			testGroupRoute(i, "/admin/reload", api.reloadConfig)
+			testGuarded(i, 1)
+			i++
+			testGroupRoute(i, "/admin/status", api.getStatus)
+			testGuarded(i, 1)
+			i++
+			testGroupRoute(i, "/bundle", api.exportBundle)
+			testGuarded(i, 1)
+			i++
+			testGroupRoute(i, "/bundle", api.importBundle)
+			testGuarded(i, 1)
 
 		})
 
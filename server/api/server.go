@@ -22,6 +22,7 @@ type IEchoGroup interface {
 	GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc)
 	POST(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc)
 	PATCH(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc)
+	PUT(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc)
 	DELETE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc)
 }
 
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+
+	"world-backup/server/throttle"
+
+	"github.com/labstack/echo"
+)
+
+// getThrottle returns the limits backups are made and copied with
+func (api *API) getThrottle(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, api.Throttle.Config())
+}
+
+// setThrottle changes the limits, backups being made or copied slow down or
+// speed up right away
+func (api *API) setThrottle(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	var c throttle.Config
+	if err := ctx.Bind(&c); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	if err := api.Throttle.Set(c); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	log.Infof("Throttle set to read: %d KiB/s, write: %d KiB/s, upload: %d KiB/s, workers: %d, low priority: %t",
+		c.ReadRate, c.WriteRate, c.UploadRate, c.Workers, c.LowPriority)
+
+	return ctx.JSON(http.StatusOK, api.Throttle.Config())
+}
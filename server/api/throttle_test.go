@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"world-backup/server/throttle"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPI_Throttle(t *testing.T) {
+	Convey("Given an api with a throttle", t, func() {
+		limits, _ := throttle.New(throttle.Config{ReadRate: 1024})
+
+		api := &API{
+			log:      logrus.WithField("test", "TestAPI_Throttle"),
+			Throttle: limits,
+		}
+
+		newContext := func(method, body string) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(method, "/api/throttle", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			return e.NewContext(req, rec), rec
+		}
+
+		Convey("When the limits are asked for", func() {
+			c, rec := newContext(echo.GET, "")
+			err := api.getThrottle(c)
+
+			Convey("It should return them", func() {
+				So(err, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+
+				var result throttle.Config
+				json.Unmarshal(rec.Body.Bytes(), &result)
+				So(result, ShouldResemble, throttle.Config{ReadRate: 1024})
+			})
+		})
+
+		Convey("When the limits are changed", func() {
+			c, rec := newContext(echo.PUT, `{"readRate":0,"writeRate":2048,"uploadRate":512,"workers":1,"lowPriority":true}`)
+			err := api.setThrottle(c)
+
+			Convey("It should apply them right away", func() {
+				So(err, ShouldBeNil)
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(limits.Read().Rate(), ShouldEqual, 0)
+				So(limits.Write().Rate(), ShouldEqual, 2048<<10)
+				So(limits.Upload().Rate(), ShouldEqual, 512<<10)
+				So(limits.LowPriority(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the limits are invalid", func() {
+			c, rec := newContext(echo.PUT, `{"readRate":-5}`)
+			api.setThrottle(c)
+
+			Convey("It should return http.StatusBadRequest and keep the old ones", func() {
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+				So(limits.Read().Rate(), ShouldEqual, 1024<<10)
+			})
+		})
+	})
+}
@@ -0,0 +1,332 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"world-backup/server/audit"
+	"world-backup/server/data"
+	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/storage"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+)
+
+var FolderNotFoundResponse = ErrorResponse{Message: "Folder not found"}
+var ConfigFolderResponse = ErrorResponse{Message: "The folder is in the config, change it there"}
+var RelativePathResponse = ErrorResponse{Message: "The path must be absolute"}
+
+type addFolderRequest struct {
+	Path           string `json:"path"`
+	DefaultOwnerId string `json:"defaultOwnerId"`
+}
+
+type updateFolderRequest struct {
+	Path   *string `json:"path"`
+	Paused *bool   `json:"paused"`
+}
+
+// checkFolderPath cleans up the path for a folder and makes sure it is a
+// directory that isn't the backup folder or watched already, other than by
+// the folder itself
+func (api *API) checkFolderPath(p string, self *data.Folder) (string, *ErrorResponse) {
+	if !path.IsAbs(p) {
+		return "", &RelativePathResponse
+	}
+	p = path.Clean(p)
+
+	if exists, _ := api.Fs.DirExists(p); !exists {
+		return "", &ErrorResponse{Message: "There is no directory at " + p}
+	}
+
+	backupDir := path.Clean(api.getConfig().BackupDir)
+	if fs.Within(p, backupDir) || fs.Within(backupDir, p) {
+		return "", &ErrorResponse{Message: "The path can't hold the backups"}
+	}
+
+	for _, f := range api.Db.Folders() {
+		if f == self || f.Untracked {
+			continue
+		}
+		if fs.Within(p, f.Path) || fs.Within(f.Path, p) {
+			return "", &ErrorResponse{Message: "The path is already watched as part of " + f.Path}
+		}
+	}
+
+	return p, nil
+}
+
+// isConfigFolder is true for folders from the config, those come back on
+// the next start so they can't be moved or removed here. The config cleans
+// up its paths the way folder paths are.
+func (api *API) isConfigFolder(f *data.Folder) bool {
+	for _, d := range api.getConfig().WatchDirs {
+		if d == f.Path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addFolder starts watching a folder of worlds, the watcher picks it up on
+// its next check. Adding a folder that was untracked tracks it again.
+func (api *API) addFolder(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	r := new(addFolderRequest)
+	if err := ctx.Bind(r); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	if r.DefaultOwnerId != "" && api.Db.GetUser(r.DefaultOwnerId) == nil {
+		return ctx.JSON(http.StatusBadRequest, UserNotFoundResponse)
+	}
+
+	if !path.IsAbs(r.Path) {
+		return ctx.JSON(http.StatusBadRequest, RelativePathResponse)
+	}
+
+	status := http.StatusCreated
+	folder := api.Db.GetFolderByPath(path.Clean(r.Path))
+	switch {
+	case folder != nil && !folder.Untracked:
+		return ctx.JSON(http.StatusConflict, ErrorResponse{Message: "The folder is already watched"})
+	case folder != nil:
+		if _, problem := api.checkFolderPath(r.Path, folder); problem != nil {
+			return ctx.JSON(http.StatusBadRequest, problem)
+		}
+		folder.Untracked = false
+		status = http.StatusOK
+	default:
+		p, problem := api.checkFolderPath(r.Path, nil)
+		if problem != nil {
+			return ctx.JSON(http.StatusBadRequest, problem)
+		}
+		folder = api.Db.AddFolder(p)
+	}
+
+	if r.DefaultOwnerId != "" {
+		folder.DefaultOwnerId = r.DefaultOwnerId
+	}
+
+	entry := auditEntry(ctx, audit.FolderAdded)
+	entry.FolderId = folder.Id
+	entry.After = folder.Path
+
+	err := api.Db.Save()
+	api.audit(log, entry, err)
+	if err != nil {
+		log.Errorf("Failed to save folder %s: %v", folder.Path, err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+
+	log.Infof("Watching folder %s: %s", folder.Id, folder.Path)
+	return ctx.JSON(status, folderToListItem(folder, folder.Worlds))
+}
+
+// updateFolder pauses or resumes watching a folder, or moves it to where
+// its worlds are now
+func (api *API) updateFolder(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	r := new(updateFolderRequest)
+	if err := ctx.Bind(r); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	folder := api.Db.GetFolder(ctx.Param("id"))
+	if folder == nil {
+		return ctx.JSON(http.StatusNotFound, FolderNotFoundResponse)
+	}
+
+	entry := auditEntry(ctx, audit.FolderUpdated)
+	entry.FolderId = folder.Id
+	entry.Before = folder.Path
+	entry.After = folder.Path
+
+	if r.Path != nil && path.Clean(*r.Path) != folder.Path {
+		if api.isConfigFolder(folder) {
+			return ctx.JSON(http.StatusConflict, ConfigFolderResponse)
+		}
+
+		p, problem := api.checkFolderPath(*r.Path, folder)
+		if problem != nil {
+			return ctx.JSON(http.StatusBadRequest, problem)
+		}
+
+		folder.SetPath(p)
+		entry.After = p
+	}
+
+	if r.Paused != nil {
+		folder.Paused = *r.Paused
+	}
+
+	folder.ModifiedAt = getNow()
+
+	err := api.Db.Save()
+	api.audit(log, entry, err)
+	if err != nil {
+		log.Errorf("Failed to save folder %s: %v", folder.Id, err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+
+	log.Infof("Folder %s is at %s, paused: %t", folder.Id, folder.Path, folder.Paused)
+	return ctx.JSON(http.StatusOK, folderToListItem(folder, folder.Worlds))
+}
+
+// RemoveFolderResponse has the jobs deleting the backups of each world of
+// the folder, when they are deleted
+type RemoveFolderResponse struct {
+	Jobs []jobs.Job `json:"jobs"`
+}
+
+// removeFolder stops watching a folder. It stays in the catalog as untracked
+// so its backups can still be restored. With deleteBackups its backups are
+// deleted along with any copies, in a job for each world, and the folder is
+// forgotten once they all are.
+func (api *API) removeFolder(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	folder := api.Db.GetFolder(ctx.Param("id"))
+	if folder == nil {
+		return ctx.JSON(http.StatusNotFound, FolderNotFoundResponse)
+	}
+
+	if api.isConfigFolder(folder) {
+		return ctx.JSON(http.StatusConflict, ConfigFolderResponse)
+	}
+
+	deleteBackups := ctx.QueryParam("deleteBackups") == "true"
+
+	entry := auditEntry(ctx, audit.FolderRemoved)
+	entry.FolderId = folder.Id
+	entry.Before = folder.Path
+
+	folder.Untracked = true
+	folder.ModifiedAt = getNow()
+	if deleteBackups && len(folder.Worlds) == 0 {
+		api.Db.RemoveFolder(folder.Id)
+	}
+
+	err := api.Db.Save()
+	api.audit(log, entry, err)
+	if err != nil {
+		log.Errorf("Failed to save after removing folder %s: %v", folder.Id, err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+
+	log.Infof("Stopped watching folder %s: %s, deleting backups: %t", folder.Id, folder.Path, deleteBackups)
+	if !deleteBackups {
+		return ctx.JSON(http.StatusOK, nil)
+	}
+
+	response := RemoveFolderResponse{Jobs: []jobs.Job{}}
+	for _, world := range folder.Worlds {
+		entry := auditEntry(ctx, audit.BackupDeleted)
+		entry.FolderId = folder.Id
+		entry.WorldId = world.Id
+
+		job := api.Jobs.Submit(jobs.Prune, world.Id, "", api.deleteFolderBackups(log, entry, folder, world))
+		log.Infof("Started %s job %s", jobs.Prune, job.Id)
+		response.Jobs = append(response.Jobs, job)
+	}
+
+	return ctx.JSON(http.StatusAccepted, response)
+}
+
+// deleteFolderBackups deletes the backups of a world of a removed folder.
+// The last job to finish forgets the folder, unless a backup is left because
+// it couldn't be deleted or the folder is watched again.
+func (api *API) deleteFolderBackups(log *logrus.Entry, entry audit.Entry, folder *data.Folder, world *data.World) jobs.Func {
+	return func(p *jobs.Progress) (err error) {
+		var ids []string
+		api.withCatalog(func() error {
+			for _, b := range world.Backups {
+				ids = append(ids, b.Id)
+			}
+			return nil
+		})
+
+		p.SetTotal(len(ids), 0)
+		for _, id := range ids {
+			backup := api.currentBackup(world, id)
+			if backup == nil {
+				p.Add(1, 0)
+				continue
+			}
+
+			e := entry
+			e.BackupId = backup.Id
+			e.Before = backup.Id
+
+			deleteErr := api.removeBackupFiles(log, backup)
+			api.audit(log, e, deleteErr)
+			if deleteErr != nil {
+				log.Errorf("Failed to delete %s: %v", backup.Name, deleteErr)
+				if err == nil {
+					err = fmt.Errorf("Failed to delete %s: %v", backup.Name, deleteErr)
+				}
+				continue
+			}
+
+			api.withCatalog(func() error {
+				api.forgetBackup(backup)
+				world.RemoveBackup(backup.Id)
+				return nil
+			})
+			p.Add(1, 0)
+		}
+
+		saveErr := api.withCatalog(func() error {
+			if folder.Untracked && !hasBackups(folder) {
+				api.Db.RemoveFolder(folder.Id)
+			}
+			return api.Db.Save()
+		})
+		if err == nil {
+			err = saveErr
+		}
+		return err
+	}
+}
+
+func hasBackups(folder *data.Folder) bool {
+	for _, w := range folder.Worlds {
+		if len(w.Backups) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeBackupFiles deletes the backup file and its copies. The copies are
+// kept when the file can't be deleted. Jobs call it with a clone of the
+// backup without the catalog held, forgetBackup is called after.
+func (api *API) removeBackupFiles(log *logrus.Entry, backup *data.Backup) error {
+	fullBackupPath := path.Join(api.getConfig().BackupDir, backup.Name)
+	if exists, _ := api.Fs.Exists(fullBackupPath); exists {
+		if err := api.Fs.Remove(fullBackupPath); err != nil {
+			return err
+		}
+	}
+
+	if len(backup.Copies) > 0 {
+		storage.Remove(log, api.getDestinations(), backup)
+	}
+
+	return nil
+}
+
+// forgetBackup drops the copies still queued for a removed backup, the
+// caller holds the catalog
+func (api *API) forgetBackup(backup *data.Backup) {
+	if len(api.getDestinations()) > 0 {
+		api.Queue.Forget(backup.Id)
+	}
+}
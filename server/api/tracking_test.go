@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"world-backup/server/auth"
+	"world-backup/server/conf"
+	"world-backup/server/data"
+	"world-backup/server/jobs"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAPI_Tracking(t *testing.T) {
+	Convey("Given an api watching a couple of folders", t, func() {
+		admin := &data.User{Id: "u1", Name: "dad", Role: auth.Admin}
+
+		world := &data.World{Id: "w1", Name: "Island", FullPath: "/saves/extra/Island", Backups: []*data.Backup{{Id: "b1", Name: "Island-b1.zip"}}}
+		fromConfig := &data.Folder{Id: "f1", Path: "/saves/main"}
+		extra := &data.Folder{Id: "f2", Path: "/saves/extra", Worlds: []*data.World{world}}
+		old := &data.Folder{Id: "f3", Path: "/saves/old", Untracked: true}
+
+		dbMock := new(ApiDbMock)
+		dbMock.On("Folders").Return([]*data.Folder{fromConfig, extra, old})
+		dbMock.On("GetFolder", "f1").Return(fromConfig)
+		dbMock.On("GetFolder", "f2").Return(extra)
+		dbMock.On("GetFolderByPath", "/saves/old").Return(old)
+		dbMock.On("GetFolderByPath", "/saves/new").Return((*data.Folder)(nil))
+		dbMock.On("GetFolderByPath", "/saves/main/nested").Return((*data.Folder)(nil))
+		dbMock.On("GetFolderByPath", "/backups/saves").Return((*data.Folder)(nil))
+		dbMock.On("Save").Return(nil)
+
+		fsMock := new(ApiFsMock)
+		fsMock.On("DirExists", "/saves/new").Return(true, nil)
+		fsMock.On("DirExists", "/saves/old").Return(true, nil)
+		fsMock.On("DirExists", "/saves/main/nested").Return(true, nil)
+		fsMock.On("DirExists", "/backups/saves").Return(true, nil)
+		fsMock.On("DirExists", "/saves/moved").Return(true, nil)
+
+		api := &API{
+			log:    logrus.WithField("test", "TestAPI_Tracking"),
+			config: &conf.Config{WatchDirs: []string{"/saves/main"}, BackupDir: "/backups"},
+			Db:     dbMock,
+			Fs:     fsMock,
+		}
+		withJobs(api)
+
+		newContext := func(method, target, folderId, body string) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(method, target, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(folderId)
+			c.Set(userKey, admin)
+			return c, rec
+		}
+
+		Convey("When a new folder is added", func() {
+			added := &data.Folder{Id: "f4", Path: "/saves/new"}
+			dbMock.On("AddFolder", "/saves/new").Return(added)
+
+			c, rec := newContext(echo.POST, "/api/folders", "", `{"path":"/saves/new/","defaultOwnerId":""}`)
+			api.addFolder(c)
+
+			Convey("It should be added to the catalog", func() {
+				So(rec.Code, ShouldEqual, http.StatusCreated)
+				dbMock.AssertCalled(t, "AddFolder", "/saves/new")
+				dbMock.AssertCalled(t, "Save")
+			})
+		})
+
+		Convey("When an untracked folder is added again", func() {
+			c, rec := newContext(echo.POST, "/api/folders", "", `{"path":"/saves/old"}`)
+			api.addFolder(c)
+
+			Convey("It should be watched again with its backups", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(old.Untracked, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the path can't be watched", func() {
+			for _, p := range []string{"saves/new", "/saves/main/nested", "/backups/saves"} {
+				c, rec := newContext(echo.POST, "/api/folders", "", `{"path":"`+p+`"}`)
+				api.addFolder(c)
+				So(rec.Code, ShouldEqual, http.StatusBadRequest)
+			}
+
+			Convey("It should not add anything", func() {
+				dbMock.AssertNotCalled(t, "AddFolder", "/saves/main/nested")
+				dbMock.AssertNotCalled(t, "Save")
+			})
+		})
+
+		Convey("When a folder is paused and moved", func() {
+			c, rec := newContext(echo.PATCH, "/api/folders/f2", "f2", `{"path":"/saves/moved","paused":true}`)
+			api.updateFolder(c)
+
+			Convey("It should move the worlds and stop checking it", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(extra.Path, ShouldEqual, "/saves/moved")
+				So(world.FullPath, ShouldEqual, "/saves/moved/Island")
+				So(extra.Paused, ShouldBeTrue)
+				So(extra.Watched(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When a folder from the config is moved or removed", func() {
+			c, rec := newContext(echo.PATCH, "/api/folders/f1", "f1", `{"path":"/saves/moved"}`)
+			api.updateFolder(c)
+			c2, rec2 := newContext(echo.DELETE, "/api/folders/f1", "f1", "")
+			api.removeFolder(c2)
+
+			Convey("It should be refused", func() {
+				So(rec.Code, ShouldEqual, http.StatusConflict)
+				So(rec2.Code, ShouldEqual, http.StatusConflict)
+				So(fromConfig.Path, ShouldEqual, "/saves/main")
+			})
+		})
+
+		Convey("When a folder is removed", func() {
+			c, rec := newContext(echo.DELETE, "/api/folders/f2", "f2", "")
+			api.removeFolder(c)
+
+			Convey("It should stay in the catalog untracked with its backups", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(extra.Untracked, ShouldBeTrue)
+				So(len(world.Backups), ShouldEqual, 1)
+				dbMock.AssertNotCalled(t, "RemoveFolder", "f2")
+				fsMock.AssertNotCalled(t, "Remove", "/backups/Island-b1.zip")
+			})
+		})
+
+		Convey("When a folder is removed with its backups", func() {
+			dbMock.On("RemoveFolder", "f2").Return(true)
+			fsMock.On("Exists", "/backups/Island-b1.zip").Return(true, nil)
+
+			removeFolder := func() jobs.Job {
+				c, rec := newContext(echo.DELETE, "/api/folders/f2?deleteBackups=true", "f2", "")
+				api.removeFolder(c)
+				So(rec.Code, ShouldEqual, http.StatusAccepted)
+
+				var response RemoveFolderResponse
+				json.Unmarshal(rec.Body.Bytes(), &response)
+				So(len(response.Jobs), ShouldEqual, 1)
+
+				job, _ := api.Jobs.(*jobs.Manager).Wait(response.Jobs[0].Id)
+				return job
+			}
+
+			Convey("When the backups are deleted", func() {
+				fsMock.On("Remove", "/backups/Island-b1.zip").Return(nil)
+				job := removeFolder()
+
+				Convey("It should delete them in a job and forget the folder", func() {
+					So(job.State, ShouldEqual, jobs.Done)
+					So(job.WorldId, ShouldEqual, "w1")
+					So(world.Backups, ShouldBeEmpty)
+					fsMock.AssertCalled(t, "Remove", "/backups/Island-b1.zip")
+					dbMock.AssertCalled(t, "RemoveFolder", "f2")
+				})
+			})
+
+			Convey("When a backup can't be deleted", func() {
+				fsMock.On("Remove", "/backups/Island-b1.zip").Return(errors.New("busy"))
+				job := removeFolder()
+
+				Convey("It should keep the folder untracked with the backup", func() {
+					So(job.State, ShouldEqual, jobs.Failed)
+					So(job.Error, ShouldContainSubstring, "busy")
+					So(extra.Untracked, ShouldBeTrue)
+					So(len(world.Backups), ShouldEqual, 1)
+					dbMock.AssertNotCalled(t, "RemoveFolder", "f2")
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"net/http"
+
+	"world-backup/server/audit"
+	"world-backup/server/auth"
+
+	"github.com/labstack/echo"
+)
+
+var UserNotFoundResponse = ErrorResponse{Message: "User not found"}
+var InvalidRoleResponse = ErrorResponse{Message: "Role must be admin, parent or player"}
+var OldPasswordResponse = ErrorResponse{Message: "The old password is wrong"}
+
+type userRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+	// OldPassword is needed for users who aren't admins to change their own
+	OldPassword string `json:"oldPassword"`
+}
+
+// getUsers lists everyone who can log in
+func (api *API) getUsers(ctx echo.Context) error {
+	users := []userResponse{}
+	for _, u := range api.Db.Users() {
+		users = append(users, newUserResponse(u))
+	}
+
+	return ctx.JSON(http.StatusOK, users)
+}
+
+// addUser adds someone who can log in
+func (api *API) addUser(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	r := new(userRequest)
+	if err := ctx.Bind(r); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	if r.Name == "" {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: "The name can't be empty"})
+	}
+	if !auth.ValidRole(r.Role) {
+		return ctx.JSON(http.StatusBadRequest, InvalidRoleResponse)
+	}
+	if api.Db.GetUserByName(r.Name) != nil {
+		return ctx.JSON(http.StatusConflict, ErrorResponse{Message: "There already is a user with that name"})
+	}
+
+	hash, err := auth.HashPassword(r.Password)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	user := api.Db.AddUser(r.Name, hash, r.Role)
+
+	entry := auditEntry(ctx, audit.UserAdded)
+	entry.After = user.Id
+
+	err = api.Db.Save()
+	api.audit(log, entry, err)
+	if err != nil {
+		log.Errorf("Failed to save user %s: %v", r.Name, err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+
+	log.Infof("Added %s user %s", user.Role, user.Name)
+	return ctx.JSON(http.StatusCreated, newUserResponse(user))
+}
+
+// updateUser changes the password or role of a user. Anyone can change
+// their own password, only admins can change someone else or a role.
+func (api *API) updateUser(ctx echo.Context) error {
+	log := getLogger(ctx)
+	me := getUser(ctx)
+
+	r := new(userRequest)
+	if err := ctx.Bind(r); err != nil {
+		return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+	}
+
+	user := api.Db.GetUser(ctx.Param("id"))
+	if user == nil {
+		return ctx.JSON(http.StatusNotFound, UserNotFoundResponse)
+	}
+
+	isAdmin := auth.Allows(me.Role, auth.Admin)
+	if (user.Id != me.Id || r.Role != "") && !isAdmin {
+		return ctx.JSON(http.StatusForbidden, ForbiddenResponse)
+	}
+
+	if r.Role != "" {
+		if !auth.ValidRole(r.Role) {
+			return ctx.JSON(http.StatusBadRequest, InvalidRoleResponse)
+		}
+		if user.Id == me.Id && r.Role != auth.Admin {
+			return ctx.JSON(http.StatusConflict, ErrorResponse{Message: "You can't take away your own admin role"})
+		}
+	}
+
+	// bcrypt is slow on purpose, passwords are checked and hashed without
+	// holding the catalog
+	current := *user
+	releaseCatalog(ctx)
+
+	var hash string
+	if r.Password != "" {
+		// someone else may have got hold of the token, only admins can
+		// change a password without knowing it
+		if !isAdmin && !auth.CheckPassword(&current, r.OldPassword) {
+			return ctx.JSON(http.StatusForbidden, OldPasswordResponse)
+		}
+
+		var err error
+		if hash, err = auth.HashPassword(r.Password); err != nil {
+			return ctx.JSON(http.StatusBadRequest, ErrorResponse{Message: err.Error()})
+		}
+	}
+
+	entry := auditEntry(ctx, audit.UserUpdated)
+
+	var response userResponse
+	err := api.withCatalog(func() error {
+		entry.Before = user.Role
+		entry.After = user.Role
+
+		if r.Role != "" {
+			user.Role = r.Role
+			entry.After = r.Role
+		}
+		if hash != "" {
+			user.PasswordHash = hash
+		}
+
+		err := api.Db.Save()
+		api.audit(log, entry, err)
+		response = newUserResponse(user)
+		return err
+	})
+	if err != nil {
+		log.Errorf("Failed to save user %s: %v", current.Name, err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+
+	log.Infof("Updated user %s", current.Name)
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// deleteUser removes someone, admins can't remove themselves so there is
+// always someone left to manage users
+func (api *API) deleteUser(ctx echo.Context) error {
+	log := getLogger(ctx)
+
+	id := ctx.Param("id")
+	if id == getUser(ctx).Id {
+		return ctx.JSON(http.StatusConflict, ErrorResponse{Message: "You can't delete yourself"})
+	}
+
+	user := api.Db.GetUser(id)
+	if user == nil || !api.Db.DeleteUser(id) {
+		return ctx.JSON(http.StatusNotFound, UserNotFoundResponse)
+	}
+
+	entry := auditEntry(ctx, audit.UserDeleted)
+	entry.Before = user.Id
+
+	err := api.Db.Save()
+	api.audit(log, entry, err)
+	if err != nil {
+		log.Errorf("Failed to save after deleting user %s: %v", user.Name, err)
+		return ctx.JSON(http.StatusInternalServerError, nil)
+	}
+
+	log.Infof("Deleted user %s", user.Name)
+	return ctx.JSON(http.StatusOK, nil)
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"world-backup/server/auth"
+	"world-backup/server/data"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/labstack/echo"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAPI_Users(t *testing.T) {
+	Convey("Given an api with an admin and a player", t, func() {
+		admin := &data.User{Id: "u1", Name: "admin", Role: auth.Admin}
+		hash, _ := auth.HashPassword("creeper")
+		player := &data.User{Id: "u2", Name: "steve", PasswordHash: hash, Role: auth.Player}
+
+		dbMock := new(ApiDbMock)
+		dbMock.On("Users").Return([]*data.User{admin, player})
+		dbMock.On("GetUser", "u1").Return(admin)
+		dbMock.On("GetUser", "u2").Return(player)
+		dbMock.On("GetUser", "missing").Return((*data.User)(nil))
+		dbMock.On("Save").Return(nil)
+
+		api := &API{log: logrus.WithField("test", "TestAPI_Users"), Db: dbMock}
+
+		newContext := func(method, id, body string, as *data.User) (echo.Context, *httptest.ResponseRecorder) {
+			e := echo.New()
+			req, _ := http.NewRequest(method, "/api/users/"+id, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+			c.Set(userKey, as)
+			return c, rec
+		}
+
+		Convey("When the users are listed", func() {
+			c, rec := newContext(echo.GET, "", "", admin)
+			api.getUsers(c)
+
+			var result []userResponse
+			json.Unmarshal(rec.Body.Bytes(), &result)
+
+			Convey("It should return them without their passwords", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(len(result), ShouldEqual, 2)
+				So(result[1].Name, ShouldEqual, "steve")
+				So(rec.Body.String(), ShouldNotContainSubstring, "passwordHash")
+			})
+		})
+
+		Convey("When a user is added", func() {
+			dbMock.On("GetUserByName", "alex").Return((*data.User)(nil))
+			dbMock.On("AddUser", "alex", mock.Anything, auth.Parent).Return(&data.User{Id: "u3", Name: "alex", Role: auth.Parent})
+
+			c, rec := newContext(echo.POST, "", `{"name":"alex","password":"creeper","role":"parent"}`, admin)
+			api.addUser(c)
+
+			Convey("It should be added with a hashed password", func() {
+				So(rec.Code, ShouldEqual, http.StatusCreated)
+
+				hash := dbMock.Calls[1].Arguments.String(1)
+				So(hash, ShouldNotEqual, "creeper")
+				So(auth.CheckPassword(&data.User{PasswordHash: hash}, "creeper"), ShouldBeTrue)
+				dbMock.AssertCalled(t, "Save")
+			})
+		})
+
+		Convey("When a user is added that already exists or with a bad role", func() {
+			dbMock.On("GetUserByName", "steve").Return(player)
+
+			c, rec := newContext(echo.POST, "", `{"name":"steve","password":"creeper","role":"player"}`, admin)
+			api.addUser(c)
+			c2, rec2 := newContext(echo.POST, "", `{"name":"alex","password":"creeper","role":"god"}`, admin)
+			api.addUser(c2)
+
+			Convey("It should be refused", func() {
+				So(rec.Code, ShouldEqual, http.StatusConflict)
+				So(rec2.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When a player changes their own password", func() {
+			c, rec := newContext(echo.PATCH, "u2", `{"password":"zombie","oldPassword":"creeper"}`, player)
+			api.updateUser(c)
+
+			Convey("It should be changed", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(auth.CheckPassword(player, "zombie"), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a player changes their own password without the old one", func() {
+			c, rec := newContext(echo.PATCH, "u2", `{"password":"zombie"}`, player)
+			api.updateUser(c)
+			c2, rec2 := newContext(echo.PATCH, "u2", `{"password":"zombie","oldPassword":"skeleton"}`, player)
+			api.updateUser(c2)
+
+			Convey("It should be forbidden", func() {
+				So(rec.Code, ShouldEqual, http.StatusForbidden)
+				So(rec2.Code, ShouldEqual, http.StatusForbidden)
+				So(auth.CheckPassword(player, "creeper"), ShouldBeTrue)
+				dbMock.AssertNotCalled(t, "Save")
+			})
+		})
+
+		Convey("When an admin changes someone's password", func() {
+			c, rec := newContext(echo.PATCH, "u2", `{"password":"zombie"}`, admin)
+			api.updateUser(c)
+
+			Convey("It should be changed without the old one", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(auth.CheckPassword(player, "zombie"), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a player changes their role or someone else", func() {
+			c, rec := newContext(echo.PATCH, "u2", `{"role":"admin"}`, player)
+			api.updateUser(c)
+			c2, rec2 := newContext(echo.PATCH, "u1", `{"password":"zombie"}`, player)
+			api.updateUser(c2)
+
+			Convey("It should be forbidden", func() {
+				So(rec.Code, ShouldEqual, http.StatusForbidden)
+				So(rec2.Code, ShouldEqual, http.StatusForbidden)
+				So(player.Role, ShouldEqual, auth.Player)
+			})
+		})
+
+		Convey("When an admin changes a role", func() {
+			c, rec := newContext(echo.PATCH, "u2", `{"role":"parent"}`, admin)
+			api.updateUser(c)
+			c2, rec2 := newContext(echo.PATCH, "u1", `{"role":"player"}`, admin)
+			api.updateUser(c2)
+
+			Convey("It should be changed, but not their own", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(player.Role, ShouldEqual, auth.Parent)
+				So(rec2.Code, ShouldEqual, http.StatusConflict)
+				So(admin.Role, ShouldEqual, auth.Admin)
+			})
+		})
+
+		Convey("When a user is deleted", func() {
+			dbMock.On("DeleteUser", "u2").Return(true)
+
+			c, rec := newContext(echo.DELETE, "u2", "", admin)
+			api.deleteUser(c)
+
+			Convey("It should be gone", func() {
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				dbMock.AssertCalled(t, "DeleteUser", "u2")
+			})
+		})
+
+		Convey("When admins delete themselves or someone missing", func() {
+			c, rec := newContext(echo.DELETE, "u1", "", admin)
+			api.deleteUser(c)
+			c2, rec2 := newContext(echo.DELETE, "missing", "", admin)
+			api.deleteUser(c2)
+
+			Convey("It should be refused", func() {
+				So(rec.Code, ShouldEqual, http.StatusConflict)
+				So(rec2.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
@@ -0,0 +1,196 @@
+// Package audit keeps an append-only record of everything that removes,
+// replaces or restores worlds and backups, and who did it
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var getNow = time.Now
+
+// Actions that are recorded
+const (
+	FolderAdded     = "folder.add"
+	FolderUpdated   = "folder.update"
+	FolderRemoved   = "folder.remove"
+	WorldDeleted    = "world.delete"
+	WorldAccess     = "world.access"
+	BackupCreated   = "backup.create"
+	BackupDeleted   = "backup.delete"
+	BackupPruned    = "backup.prune"
+	BackupRestored  = "backup.restore"
+	ChunksRestored  = "chunks.restore"
+	UserAdded       = "user.add"
+	UserUpdated     = "user.update"
+	UserDeleted     = "user.delete"
+	ConfigReloaded  = "config.reload"
+	CatalogExported = "catalog.export"
+	CatalogImported = "catalog.import"
+)
+
+// Actors that aren't users
+const (
+	Watcher = "watcher"
+	Cli     = "cli"
+)
+
+// Config holds where the audit log is kept
+type Config struct {
+	File string `json:"file"`
+}
+
+const defaultFile = "audit.log"
+
+// Entry is one thing that was done. Before and After are the ids of what
+// was there before and after it, like the backup a world was restored from
+// and the folder the replaced world was moved to. Error is empty when it
+// worked.
+type Entry struct {
+	Id       int64     `json:"id"`
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor"`
+	ActorId  string    `json:"actorId,omitempty"`
+	IP       string    `json:"ip,omitempty"`
+	Action   string    `json:"action"`
+	FolderId string    `json:"folderId,omitempty"`
+	WorldId  string    `json:"worldId,omitempty"`
+	BackupId string    `json:"backupId,omitempty"`
+	Before   string    `json:"before,omitempty"`
+	After    string    `json:"after,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Filter picks entries, empty fields match everything. Limit keeps the
+// newest entries.
+type Filter struct {
+	FolderId string
+	WorldId  string
+	Action   string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+func (f Filter) matches(e Entry) bool {
+	switch {
+	case f.FolderId != "" && e.FolderId != f.FolderId,
+		f.WorldId != "" && e.WorldId != f.WorldId,
+		f.Action != "" && e.Action != f.Action,
+		!f.Since.IsZero() && e.Time.Before(f.Since),
+		!f.Until.IsZero() && e.Time.After(f.Until):
+		return false
+	}
+
+	return true
+}
+
+// Log appends entries to a file of one JSON entry per line
+type Log struct {
+	fs   afero.Fs
+	path string
+
+	mu     sync.Mutex
+	lastId int64
+}
+
+// Open opens the audit log in the file from the config, carrying on the
+// numbering of the entries already in it
+func Open(fs afero.Fs, c Config) (*Log, error) {
+	l := Log{fs: fs, path: c.File}
+	if l.path == "" {
+		l.path = defaultFile
+	}
+
+	err := l.each(func(e Entry) {
+		l.lastId = e.Id
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// Record numbers the entry, stamps it with the time and appends it
+func (l *Log) Record(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastId++
+	e.Id = l.lastId
+	if e.Time.IsZero() {
+		e.Time = getNow()
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := l.fs.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Query returns the entries matching the filter, newest first
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := []Entry{}
+	err := l.each(func(e Entry) {
+		if f.matches(e) {
+			entries = append(entries, e)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	if f.Limit > 0 && len(entries) > f.Limit {
+		entries = entries[:f.Limit]
+	}
+
+	return entries, nil
+}
+
+// each reads every entry in the file, a missing file has none
+func (l *Log) each(fn func(e Entry)) error {
+	f, err := l.fs.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return err
+		}
+		fn(e)
+	}
+
+	return scanner.Err()
+}
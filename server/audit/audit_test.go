@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+func TestLog(t *testing.T) {
+	Convey("Given an audit log with a few entries", t, func() {
+		fs := afero.NewMemMapFs()
+		start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+		l, err := Open(fs, Config{File: "/data/audit.log"})
+		So(err, ShouldBeNil)
+
+		l.Record(Entry{Time: start, Actor: Watcher, Action: BackupCreated, FolderId: "f1", WorldId: "w1", After: "b1"})
+		l.Record(Entry{Time: start.Add(time.Hour), Actor: "mum", IP: "10.0.0.2", Action: BackupRestored, FolderId: "f1", WorldId: "w1", Before: "World_1577883600", After: "b1"})
+		l.Record(Entry{Time: start.Add(2 * time.Hour), Actor: "mum", Action: WorldDeleted, FolderId: "f2", WorldId: "w2", Before: "w2"})
+
+		Convey("It should return them newest first", func() {
+			entries, err := l.Query(Filter{})
+			So(err, ShouldBeNil)
+			So(len(entries), ShouldEqual, 3)
+			So(entries[0].Id, ShouldEqual, 3)
+			So(entries[2].Action, ShouldEqual, BackupCreated)
+		})
+
+		Convey("It should filter them", func() {
+			byWorld, _ := l.Query(Filter{WorldId: "w1"})
+			So(len(byWorld), ShouldEqual, 2)
+
+			byAction, _ := l.Query(Filter{Action: BackupRestored})
+			So(len(byAction), ShouldEqual, 1)
+			So(byAction[0].IP, ShouldEqual, "10.0.0.2")
+
+			byFolder, _ := l.Query(Filter{FolderId: "f2"})
+			So(len(byFolder), ShouldEqual, 1)
+
+			byTime, _ := l.Query(Filter{Since: start.Add(30 * time.Minute), Until: start.Add(90 * time.Minute)})
+			So(len(byTime), ShouldEqual, 1)
+			So(byTime[0].Id, ShouldEqual, 2)
+
+			limited, _ := l.Query(Filter{Limit: 1})
+			So(len(limited), ShouldEqual, 1)
+			So(limited[0].Id, ShouldEqual, 3)
+		})
+
+		Convey("When it is opened again", func() {
+			reopened, err := Open(fs, Config{File: "/data/audit.log"})
+			So(err, ShouldBeNil)
+			reopened.Record(Entry{Actor: Cli, Action: BackupPruned})
+
+			Convey("It should carry on numbering and keep what was there", func() {
+				entries, _ := reopened.Query(Filter{})
+				So(len(entries), ShouldEqual, 4)
+				So(entries[0].Id, ShouldEqual, 4)
+				So(entries[0].Time.IsZero(), ShouldBeFalse)
+			})
+		})
+	})
+
+	Convey("Given no audit log yet", t, func() {
+		l, err := Open(afero.NewMemMapFs(), Config{})
+
+		Convey("It should have no entries", func() {
+			So(err, ShouldBeNil)
+
+			entries, err := l.Query(Filter{})
+			So(err, ShouldBeNil)
+			So(entries, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,199 @@
+// Package auth keeps who may use the api and what they may do. Users log in
+// with a password and are handed a signed token to send with each request.
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"world-backup/server/data"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var getNow = time.Now
+
+// Roles a user can have, each may do everything the ones below it may
+const (
+	Admin  = "admin"
+	Parent = "parent"
+	Player = "player"
+)
+
+var ranks = map[string]int{Player: 1, Parent: 2, Admin: 3}
+
+var InvalidLoginError = errors.New("Invalid name or password")
+var InvalidTokenError = errors.New("Invalid or expired token")
+var EmptyPasswordError = errors.New("The password can't be empty")
+
+// Config holds the settings for logging in. Tokens are signed with Secret
+// and last for TokenTTL. Admin is created when there are no users yet.
+type Config struct {
+	Secret   string      `json:"secret"`
+	TokenTTL string      `json:"tokenTtl"`
+	Admin    AdminConfig `json:"admin"`
+}
+
+// AdminConfig is the first user, who can add everyone else
+type AdminConfig struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+const (
+	defaultTokenTTL  = 24 * time.Hour
+	defaultAdminName = "admin"
+)
+
+// Claims is what a token says about who sent it, the user id is the subject
+type Claims struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	jwt.StandardClaims
+}
+
+// ValidRole is true for the roles a user can have
+func ValidRole(role string) bool {
+	return ranks[role] > 0
+}
+
+// Allows is true when the role may do what needs at least min
+func Allows(role, min string) bool {
+	return ValidRole(role) && ranks[role] >= ranks[min]
+}
+
+// HashPassword hashes a password to keep with the user
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", EmptyPasswordError
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword is true when the password is the user's
+func CheckPassword(user *data.User, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+// Auth hands out tokens and checks the ones sent back
+type Auth struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// New creates an Auth with the settings. Without a secret a random one is
+// used, so tokens don't outlive the server.
+func New(c Config) (*Auth, error) {
+	a := Auth{secret: []byte(c.Secret), ttl: defaultTokenTTL}
+
+	if c.TokenTTL != "" {
+		var err error
+		if a.ttl, err = time.ParseDuration(c.TokenTTL); err != nil || a.ttl <= 0 {
+			return nil, fmt.Errorf("Invalid token ttl [%s]", c.TokenTTL)
+		}
+	}
+
+	if len(a.secret) == 0 {
+		a.secret = make([]byte, 32)
+		if _, err := rand.Read(a.secret); err != nil {
+			return nil, err
+		}
+	}
+
+	return &a, nil
+}
+
+// Issue signs a token for the user, it returns when the token expires
+func (a *Auth) Issue(user *data.User) (string, time.Time, error) {
+	now := getNow()
+	expiresAt := now.Add(a.ttl)
+
+	claims := Claims{
+		Name: user.Name,
+		Role: user.Role,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   user.Id,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.secret)
+	return signed, expiresAt, err
+}
+
+// Parse checks the token was signed by us and hasn't expired
+func (a *Auth) Parse(token string) (*jwt.Token, *Claims, error) {
+	claims := new(Claims)
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, InvalidTokenError
+		}
+		return a.secret, nil
+	})
+	if err != nil || !parsed.Valid {
+		return nil, nil, InvalidTokenError
+	}
+
+	return parsed, claims, nil
+}
+
+// IUserDb is where the users are kept
+type IUserDb interface {
+	Users() []*data.User
+	AddUser(name, passwordHash, role string) *data.User
+	Save() error
+}
+
+var generatePassword = func() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// passwordOut is where the password of a generated admin is shown, once. It
+// is kept out of the logs, which may be kept or sent anywhere.
+var passwordOut io.Writer = os.Stderr
+
+// Bootstrap makes sure someone can log in. With no users yet the admin from
+// the config is added, or one with a random password that is shown once.
+func Bootstrap(log *logrus.Entry, db IUserDb, c Config) error {
+	if len(db.Users()) > 0 {
+		return nil
+	}
+
+	name := c.Admin.Name
+	if name == "" {
+		name = defaultAdminName
+	}
+
+	password := c.Admin.Password
+	if password == "" {
+		var err error
+		if password, err = generatePassword(); err != nil {
+			return err
+		}
+		fmt.Fprintf(passwordOut, "Created user %s with password %s, change it once you have logged in\n", name, password)
+		log.Warnf("Created user %s with a random password, it was printed to stderr", name)
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	db.AddUser(name, hash, Admin)
+	return db.Save()
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"world-backup/server/data"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/dgrijalva/jwt-go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type userDb struct {
+	users []*data.User
+	saved int
+}
+
+func (db *userDb) Users() []*data.User {
+	return db.users
+}
+
+func (db *userDb) AddUser(name, passwordHash, role string) *data.User {
+	u := &data.User{Id: "u1", Name: name, PasswordHash: passwordHash, Role: role}
+	db.users = append(db.users, u)
+	return u
+}
+
+func (db *userDb) Save() error {
+	db.saved++
+	return nil
+}
+
+func TestRoles(t *testing.T) {
+	Convey("Given the roles", t, func() {
+		Convey("It should let each do what the ones below it may", func() {
+			So(Allows(Admin, Parent), ShouldBeTrue)
+			So(Allows(Parent, Parent), ShouldBeTrue)
+			So(Allows(Player, Parent), ShouldBeFalse)
+			So(Allows("guest", Player), ShouldBeFalse)
+			So(ValidRole(Player), ShouldBeTrue)
+			So(ValidRole(""), ShouldBeFalse)
+		})
+	})
+}
+
+func TestAuth(t *testing.T) {
+	Convey("Given an auth with a secret", t, func() {
+		a, err := New(Config{Secret: "shh", TokenTTL: "1h"})
+		So(err, ShouldBeNil)
+
+		hash, err := HashPassword("creeper")
+		So(err, ShouldBeNil)
+		user := &data.User{Id: "u1", Name: "steve", PasswordHash: hash, Role: Parent}
+
+		Convey("It should check passwords", func() {
+			So(CheckPassword(user, "creeper"), ShouldBeTrue)
+			So(CheckPassword(user, "zombie"), ShouldBeFalse)
+
+			_, err := HashPassword("")
+			So(err, ShouldEqual, EmptyPasswordError)
+		})
+
+		Convey("When a token is issued", func() {
+			token, expiresAt, err := a.Issue(user)
+			So(err, ShouldBeNil)
+
+			Convey("It should parse back to the user", func() {
+				_, claims, err := a.Parse(token)
+				So(err, ShouldBeNil)
+				So(claims.Subject, ShouldEqual, "u1")
+				So(claims.Name, ShouldEqual, "steve")
+				So(claims.Role, ShouldEqual, Parent)
+				So(claims.ExpiresAt, ShouldEqual, expiresAt.Unix())
+			})
+
+			Convey("It should be refused by a server with another secret", func() {
+				other, _ := New(Config{Secret: "other"})
+				_, _, err := other.Parse(token)
+				So(err, ShouldEqual, InvalidTokenError)
+			})
+
+			Convey("It should be refused once it expired", func() {
+				defer func() { getNow = time.Now }()
+				getNow = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+
+				expired, _, _ := a.Issue(user)
+				_, _, err := a.Parse(expired)
+				So(err, ShouldEqual, InvalidTokenError)
+			})
+		})
+
+		Convey("When a token isn't signed", func() {
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodNone, Claims{Role: Admin}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+			Convey("It should be refused", func() {
+				_, _, err := a.Parse(token)
+				So(err, ShouldEqual, InvalidTokenError)
+			})
+		})
+	})
+
+	Convey("Given an invalid token ttl", t, func() {
+		_, err := New(Config{TokenTTL: "forever"})
+
+		Convey("It should be refused", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestBootstrap(t *testing.T) {
+	var logged bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &logged
+	log := logrus.NewEntry(logger)
+
+	Convey("Given no users", t, func() {
+		db := &userDb{}
+
+		Convey("When an admin is configured", func() {
+			err := Bootstrap(log, db, Config{Admin: AdminConfig{Name: "root", Password: "secret"}})
+
+			Convey("It should be added", func() {
+				So(err, ShouldBeNil)
+				So(len(db.users), ShouldEqual, 1)
+				So(db.users[0].Name, ShouldEqual, "root")
+				So(db.users[0].Role, ShouldEqual, Admin)
+				So(CheckPassword(db.users[0], "secret"), ShouldBeTrue)
+				So(db.saved, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When no admin is configured", func() {
+			defer func(g func() (string, error)) { generatePassword = g }(generatePassword)
+			generatePassword = func() (string, error) { return "Qz7kV2pa", nil }
+
+			var shown bytes.Buffer
+			defer func(w io.Writer) { passwordOut = w }(passwordOut)
+			passwordOut = &shown
+
+			err := Bootstrap(log, db, Config{})
+
+			Convey("It should add one with a random password", func() {
+				So(err, ShouldBeNil)
+				So(db.users[0].Name, ShouldEqual, "admin")
+				So(CheckPassword(db.users[0], "Qz7kV2pa"), ShouldBeTrue)
+			})
+
+			Convey("It should show the password once and keep it out of the logs", func() {
+				So(shown.String(), ShouldContainSubstring, "password Qz7kV2pa")
+				So(logged.String(), ShouldNotContainSubstring, "Qz7kV2pa")
+			})
+		})
+	})
+
+	Convey("Given users", t, func() {
+		db := &userDb{users: []*data.User{{Id: "u1", Name: "steve", Role: Player}}}
+
+		Convey("It should leave them be", func() {
+			So(Bootstrap(log, db, Config{}), ShouldBeNil)
+			So(len(db.users), ShouldEqual, 1)
+			So(db.saved, ShouldEqual, 0)
+		})
+	})
+}
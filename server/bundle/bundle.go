@@ -0,0 +1,252 @@
+// Package bundle moves the catalog and the backup archives to another
+// machine as one tar file. The catalog in a bundle has no paths, the folders
+// are given their paths again when it is imported.
+package bundle
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"world-backup/server/data"
+
+	"github.com/spf13/afero"
+)
+
+// Version is the layout of the bundles made, bundles of a newer one can't
+// be imported
+const Version = 1
+
+// The files in a bundle. The manifest comes last so it can hold the
+// checksums of the archives before it.
+const (
+	catalogName  = "catalog.json"
+	archivesDir  = "archives/"
+	manifestName = "manifest.json"
+)
+
+var getNow = time.Now
+
+// NotBundleError is returned for files that aren't bundles
+var NotBundleError = errors.New("The file is not a world-backup bundle")
+
+// Manifest describes what is in a bundle
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Folders   []Folder  `json:"folders"`
+	Archives  []Archive `json:"archives"`
+}
+
+// Folder is a folder in the bundle and where it was kept on the machine the
+// bundle was made on
+type Folder struct {
+	Id      string `json:"id"`
+	Path    string `json:"path"`
+	Worlds  int    `json:"worlds"`
+	Backups int    `json:"backups"`
+}
+
+// Archive is the file of a backup in the bundle
+type Archive struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+}
+
+// FileSystem is where the archives are read from and copied to
+type FileSystem interface {
+	Exists(path string) (bool, error)
+	DirExists(path string) (bool, error)
+	Open(name string) (afero.File, error)
+	Create(name string) (afero.File, error)
+	Rename(oldname, newname string) error
+	Remove(name string) error
+}
+
+// Catalog is what bundles are imported into
+type Catalog interface {
+	Folders() []*data.Folder
+	InsertFolder(f *data.Folder)
+}
+
+// Export writes the folders, with their worlds and backups, to w along with
+// the archives of the backups in backupDir. Backups whose file is gone are
+// in the catalog without one, their copies at the destinations are kept.
+func Export(w io.Writer, f FileSystem, folders []*data.Folder, backupDir string) (Manifest, error) {
+	m := Manifest{Version: Version, CreatedAt: getNow(), Folders: []Folder{}, Archives: []Archive{}}
+
+	// a copy to take the paths out of, it doesn't change while the
+	// archives are written either
+	copied, err := data.CopyFolders(folders)
+	if err != nil {
+		return m, err
+	}
+
+	for _, folder := range copied {
+		entry := Folder{Id: folder.Id, Path: folder.Path, Worlds: len(folder.Worlds)}
+		folder.Path = ""
+		for _, world := range folder.Worlds {
+			world.FullPath = ""
+			entry.Backups += len(world.Backups)
+		}
+		m.Folders = append(m.Folders, entry)
+	}
+
+	catalog, err := json.Marshal(copied)
+	if err != nil {
+		return m, err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeFile(tw, catalogName, catalog, m.CreatedAt); err != nil {
+		return m, err
+	}
+
+	for _, folder := range copied {
+		for _, world := range folder.Worlds {
+			for _, backup := range world.Backups {
+				a, err := addArchive(tw, f, backupDir, backup.Name)
+				if err != nil {
+					return m, fmt.Errorf("Failed to add %s: %v", backup.Name, err)
+				}
+				if a != nil {
+					m.Archives = append(m.Archives, *a)
+				}
+			}
+		}
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	if err := writeFile(tw, manifestName, manifest, m.CreatedAt); err != nil {
+		return m, err
+	}
+
+	return m, tw.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, b []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := tw.Write(b)
+	return err
+}
+
+// addArchive writes the backup file to the bundle, it is nil when the file
+// is gone
+func addArchive(tw *tar.Writer, f FileSystem, backupDir, name string) (*Archive, error) {
+	p := path.Join(backupDir, name)
+	if exists, _ := f.Exists(p); !exists {
+		return nil, nil
+	}
+
+	file, err := f.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	header := &tar.Header{Name: archivesDir + name, Mode: 0600, Size: info.Size(), ModTime: info.ModTime(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tw, hash), file); err != nil {
+		return nil, err
+	}
+
+	return &Archive{Name: name, Size: info.Size(), Checksum: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Bundle is a bundle being imported, the archives are read from it when
+// they are copied
+type Bundle struct {
+	Manifest Manifest
+	Folders  []*data.Folder
+	r        io.ReadSeeker
+}
+
+// Read reads the manifest and catalog of the bundle in r
+func Read(r io.ReadSeeker) (*Bundle, error) {
+	b := &Bundle{r: r}
+
+	var hasManifest, hasCatalog bool
+	err := b.walk(func(header *tar.Header, r io.Reader) error {
+		switch header.Name {
+		case manifestName:
+			hasManifest = true
+			return json.NewDecoder(r).Decode(&b.Manifest)
+		case catalogName:
+			hasCatalog = true
+			return json.NewDecoder(r).Decode(&b.Folders)
+		}
+		return nil
+	})
+	if err == tar.ErrHeader || err == io.ErrUnexpectedEOF || (err == nil && !(hasManifest && hasCatalog)) {
+		return nil, NotBundleError
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the bundle: %v", err)
+	}
+
+	if b.Manifest.Version > Version {
+		return nil, errors.New("The bundle was made by a newer world-backup, update this one to import it")
+	}
+
+	return b, nil
+}
+
+func (b *Bundle) walk(fn func(header *tar.Header, r io.Reader) error) error {
+	if _, err := b.r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(b.r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// ParsePaths reads folder paths to import to, given as from=to where from
+// is the path of a folder in the bundle or its id
+func ParsePaths(mappings []string) (map[string]string, error) {
+	paths := map[string]string{}
+	for _, m := range mappings {
+		parts := strings.SplitN(m, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("%s is not a path to import to, give it as from=to", m)
+		}
+		paths[parts[0]] = parts[1]
+	}
+
+	return paths, nil
+}
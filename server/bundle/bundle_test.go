@@ -0,0 +1,159 @@
+package bundle
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"world-backup/server/data"
+	"world-backup/server/fs"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+func TestBundle(t *testing.T) {
+	Convey("Given a catalog with a backup on disk and one only kept at a destination", t, func() {
+		af := afero.Afero{Fs: afero.NewMemMapFs()}
+		f := fs.NewFs(af)
+		af.WriteFile("/old/backups/one.zip", []byte("the first backup"), 0600)
+
+		start := time.Date(2020, 6, 6, 12, 0, 0, 0, time.UTC)
+		b1 := &data.Backup{Id: "b1", Name: "one.zip", CreatedAt: start}
+		b2 := &data.Backup{Id: "b2", Name: "two.zip", CreatedAt: start.Add(time.Hour), Copies: []data.Copy{{Destination: "nas", Key: "two.zip"}}}
+		world := &data.World{Id: "w1", Name: "survival", FullPath: "/old/saves/survival", Backups: []*data.Backup{b1, b2}}
+		folders := []*data.Folder{{Id: "f1", Path: "/old/saves", Worlds: []*data.World{world}}}
+
+		var buf bytes.Buffer
+		m, err := Export(&buf, f, folders, "/old/backups")
+		So(err, ShouldBeNil)
+
+		Convey("It should bundle the catalog without paths and the archive", func() {
+			So(m.Folders, ShouldResemble, []Folder{{Id: "f1", Path: "/old/saves", Worlds: 1, Backups: 2}})
+			So(len(m.Archives), ShouldEqual, 1)
+			So(m.Archives[0].Name, ShouldEqual, "one.zip")
+			So(m.Archives[0].Size, ShouldEqual, 16)
+
+			b, err := Read(bytes.NewReader(buf.Bytes()))
+			So(err, ShouldBeNil)
+			So(b.Manifest.Archives, ShouldResemble, m.Archives)
+			So(b.Folders[0].Path, ShouldEqual, "")
+			So(b.Folders[0].Worlds[0].FullPath, ShouldEqual, "")
+			So(b.Folders[0].Worlds[0].Backups[1].Copies, ShouldResemble, b2.Copies)
+			So(world.FullPath, ShouldEqual, "/old/saves/survival")
+		})
+
+		Convey("When it is imported to another path", func() {
+			catalog := &data.Db{}
+			af.MkdirAll("/new/saves", 0755)
+			b, _ := Read(bytes.NewReader(buf.Bytes()))
+
+			result, err := b.Import(catalog, f, "/new/backups", Options{Paths: map[string]string{"/old/saves": "/new/saves/"}})
+
+			Convey("It should add the folder there with the archive", func() {
+				So(err, ShouldBeNil)
+				So(result, ShouldResemble, Result{Folders: 1, Worlds: 1, Backups: 2, Conflicts: []Conflict{}})
+
+				folder := catalog.GetFolder("f1")
+				So(folder.Path, ShouldEqual, "/new/saves")
+				So(folder.Untracked, ShouldBeFalse)
+				So(folder.Worlds[0].FullPath, ShouldEqual, "/new/saves/survival")
+				So(len(folder.Worlds[0].Backups), ShouldEqual, 2)
+
+				content, _ := af.ReadFile("/new/backups/one.zip")
+				So(string(content), ShouldEqual, "the first backup")
+			})
+
+			Convey("And again", func() {
+				b, _ := Read(bytes.NewReader(buf.Bytes()))
+				result, err := b.Import(catalog, f, "/new/backups", Options{Paths: map[string]string{"f1": "/new/saves"}})
+
+				Convey("It should find everything there already", func() {
+					So(err, ShouldBeNil)
+					So(result, ShouldResemble, Result{Present: 2, Conflicts: []Conflict{}})
+					So(len(catalog.Folders()), ShouldEqual, 1)
+				})
+			})
+		})
+
+		Convey("When it is imported where the folder isn't", func() {
+			catalog := &data.Db{}
+			b, _ := Read(bytes.NewReader(buf.Bytes()))
+			b.Import(catalog, f, "/new/backups", Options{})
+
+			Convey("It should keep the folder without watching it", func() {
+				So(catalog.GetFolder("f1").Path, ShouldEqual, "/old/saves")
+				So(catalog.GetFolder("f1").Untracked, ShouldBeTrue)
+			})
+		})
+
+		Convey("When it is imported into a catalog with one of its backup ids", func() {
+			catalog := &data.Db{}
+			other := catalog.AddFolder("/new/saves").AddWorld("creative")
+			other.Backups = []*data.Backup{{Id: "b2", Name: "creative.zip"}}
+			b, _ := Read(bytes.NewReader(buf.Bytes()))
+
+			result, err := b.Import(catalog, f, "/new/backups", Options{Paths: map[string]string{"f1": "/new/saves"}})
+
+			Convey("It should import nothing and tell what conflicts", func() {
+				So(err, ShouldHaveSameTypeAs, &ConflictError{})
+				So(result.Conflicts, ShouldResemble, []Conflict{{WorldId: "w1", BackupId: "b2", Message: "Backup b2 is creative.zip of world " + other.Id + " already"}})
+				So(catalog.Folders()[0].GetWorld("w1"), ShouldBeNil)
+
+				exists, _ := af.Exists("/new/backups/one.zip")
+				So(exists, ShouldBeFalse)
+			})
+
+			Convey("It should import the rest when conflicts are skipped", func() {
+				b, _ := Read(bytes.NewReader(buf.Bytes()))
+				result, err := b.Import(catalog, f, "/new/backups", Options{Paths: map[string]string{"f1": "/new/saves"}, SkipConflicts: true})
+
+				So(err, ShouldBeNil)
+				So(result.Worlds, ShouldEqual, 1)
+				So(result.Backups, ShouldEqual, 1)
+				So(catalog.Folders()[0].GetWorld("w1").Backups, ShouldResemble, []*data.Backup{b1})
+			})
+		})
+
+		Convey("When an archive in it is damaged", func() {
+			catalog := &data.Db{}
+			b, _ := Read(bytes.NewReader(buf.Bytes()))
+			b.Manifest.Archives[0].Checksum = "0000"
+
+			_, err := b.Import(catalog, f, "/new/backups", Options{})
+
+			Convey("It should import nothing", func() {
+				So(err, ShouldNotBeNil)
+				So(catalog.Folders(), ShouldBeEmpty)
+
+				files, _ := af.ReadDir("/new/backups")
+				So(files, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a file that isn't a bundle", t, func() {
+		_, err := Read(bytes.NewReader([]byte("not a tar file")))
+
+		Convey("It should say so", func() {
+			So(err, ShouldEqual, NotBundleError)
+		})
+	})
+}
+
+func TestParsePaths(t *testing.T) {
+	Convey("It should read paths given as from=to", t, func() {
+		paths, err := ParsePaths([]string{"/old/saves=/new/saves", "f2=/games/saves"})
+
+		So(err, ShouldBeNil)
+		So(paths, ShouldResemble, map[string]string{"/old/saves": "/new/saves", "f2": "/games/saves"})
+	})
+
+	Convey("It should not read paths without both sides", t, func() {
+		_, err := ParsePaths([]string{"/old/saves"})
+		So(err, ShouldNotBeNil)
+
+		_, err = ParsePaths([]string{"=/new/saves"})
+		So(err, ShouldNotBeNil)
+	})
+}
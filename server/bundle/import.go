@@ -0,0 +1,335 @@
+package bundle
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"world-backup/server/data"
+	"world-backup/server/fs"
+)
+
+// Options say how a bundle is imported
+type Options struct {
+	// Paths maps the paths folders had on the machine the bundle was made
+	// on, or their ids, to where they are on this one. Other folders keep
+	// their paths.
+	Paths map[string]string
+
+	// SkipConflicts imports everything that doesn't conflict with the
+	// catalog, otherwise nothing is imported when anything does
+	SkipConflicts bool
+
+	// DryRun only works out what would be imported
+	DryRun bool
+}
+
+// Conflict is something in the bundle that clashes with the catalog
+type Conflict struct {
+	FolderId string `json:"folderId,omitempty"`
+	WorldId  string `json:"worldId,omitempty"`
+	BackupId string `json:"backupId,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Result is what was imported, or would be on a dry run
+type Result struct {
+	Folders int `json:"folders"`
+	Worlds  int `json:"worlds"`
+	Backups int `json:"backups"`
+
+	// Present backups were in the catalog already, a bundle can be
+	// imported again after a failed import
+	Present   int        `json:"present"`
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+// ConflictError stops an import when the bundle clashes with the catalog
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	msg := fmt.Sprintf("Nothing was imported, the bundle has %d conflict(s) with the catalog:", len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		msg += "\n  " + c.Message
+	}
+
+	return msg
+}
+
+// Import adds what is in the bundle to the catalog, and copies the archives
+// of the backups it adds to backupDir. Folders and worlds are matched by
+// path and id, backups by id. Nothing is changed when copying an archive
+// fails, or when anything conflicts unless the options say to skip those.
+// The caller saves the catalog.
+func (b *Bundle) Import(catalog Catalog, f FileSystem, backupDir string, opts Options) (Result, error) {
+	p := b.plan(catalog.Folders(), f, backupDir, opts)
+	if len(p.result.Conflicts) > 0 && !opts.SkipConflicts {
+		return p.result, &ConflictError{Conflicts: p.result.Conflicts}
+	}
+
+	if opts.DryRun {
+		return p.result, nil
+	}
+
+	if err := b.copyArchives(f, backupDir, p.archives); err != nil {
+		return p.result, err
+	}
+
+	for _, change := range p.changes {
+		change(catalog)
+	}
+
+	return p.result, nil
+}
+
+// planner works out what importing a bundle changes, and what conflicts
+type planner struct {
+	f         FileSystem
+	backupDir string
+	existing  []*data.Folder
+	checksums map[string]string
+
+	result   Result
+	archives map[string]string
+	changes  []func(c Catalog)
+}
+
+func (b *Bundle) plan(existing []*data.Folder, f FileSystem, backupDir string, opts Options) *planner {
+	p := &planner{
+		f:         f,
+		backupDir: backupDir,
+		existing:  existing,
+		checksums: map[string]string{},
+		result:    Result{Conflicts: []Conflict{}},
+		archives:  map[string]string{},
+	}
+	for _, a := range b.Manifest.Archives {
+		p.checksums[a.Name] = a.Checksum
+	}
+
+	paths := map[string]string{}
+	for _, folder := range b.Manifest.Folders {
+		paths[folder.Id] = folder.Path
+	}
+
+	for _, folder := range b.Folders {
+		target, ok := opts.Paths[folder.Id]
+		if !ok {
+			target, ok = opts.Paths[paths[folder.Id]]
+		}
+		if !ok {
+			target = paths[folder.Id]
+		}
+
+		if target == "" {
+			p.conflict(Conflict{FolderId: folder.Id, Message: fmt.Sprintf("Folder %s has no path, give it one to import it", folder.Id)})
+			continue
+		}
+		p.folder(folder, path.Clean(target))
+	}
+
+	return p
+}
+
+func (p *planner) conflict(c Conflict) {
+	p.result.Conflicts = append(p.result.Conflicts, c)
+}
+
+// folder merges the folder into the one at the target path, or adds it
+func (p *planner) folder(folder *data.Folder, target string) {
+	for _, existing := range p.existing {
+		if existing.Path == target {
+			for _, world := range folder.Worlds {
+				p.world(existing, world, false)
+			}
+			return
+		}
+	}
+
+	for _, existing := range p.existing {
+		switch {
+		case existing.Id == folder.Id:
+			p.conflict(Conflict{FolderId: folder.Id, Message: fmt.Sprintf("Folder %s is kept at %s already, import it there to merge them", folder.Id, existing.Path)})
+			return
+		case !existing.Untracked && (fs.Within(target, existing.Path) || fs.Within(existing.Path, target)):
+			p.conflict(Conflict{FolderId: folder.Id, Message: fmt.Sprintf("Folder %s can't go to %s, it overlaps %s", folder.Id, target, existing.Path)})
+			return
+		}
+	}
+	if fs.Within(target, p.backupDir) || fs.Within(p.backupDir, target) {
+		p.conflict(Conflict{FolderId: folder.Id, Message: fmt.Sprintf("Folder %s can't go to %s, it overlaps the backups", folder.Id, target)})
+		return
+	}
+
+	added := *folder
+	added.Path = target
+	added.Worlds = nil
+
+	// folders that aren't on this machine keep their backups, they
+	// aren't watched until they are tracked again
+	if exists, _ := p.f.DirExists(target); !exists {
+		added.Untracked = true
+	}
+
+	for _, world := range folder.Worlds {
+		p.world(&added, world, true)
+	}
+
+	p.result.Folders++
+	p.changes = append(p.changes, func(c Catalog) {
+		c.InsertFolder(&added)
+	})
+}
+
+// world merges the backups of the world into the world with its id, or
+// adds it to the folder
+func (p *planner) world(folder *data.Folder, world *data.World, newFolder bool) {
+	if f, existing := data.LocateWorld(p.existing, world.Id); existing != nil {
+		if f != folder {
+			p.conflict(Conflict{WorldId: world.Id, Message: fmt.Sprintf("World %s is in %s already", world.Id, f.Path)})
+			return
+		}
+
+		for _, backup := range world.Backups {
+			backup := backup
+			if p.backup(existing, backup) {
+				p.changes = append(p.changes, func(c Catalog) {
+					existing.InsertBackup(backup)
+					folder.ModifiedAt = getNow()
+				})
+			}
+		}
+		return
+	}
+
+	if !fs.IsFolderName(world.Name) {
+		p.conflict(Conflict{WorldId: world.Id, Message: fmt.Sprintf("World %s has a name that can't be a folder", world.Id)})
+		return
+	}
+	if existing := folder.GetWorldByName(world.Name); existing != nil {
+		p.conflict(Conflict{WorldId: world.Id, Message: fmt.Sprintf("World %s is %s, which is world %s already", world.Id, path.Join(folder.Path, world.Name), existing.Id)})
+		return
+	}
+
+	added := *world
+	added.FullPath = path.Join(folder.Path, world.Name)
+	added.Backups = nil
+	for _, backup := range world.Backups {
+		if p.backup(&added, backup) {
+			added.Backups = append(added.Backups, backup)
+		}
+	}
+
+	p.result.Worlds++
+	if newFolder {
+		folder.Worlds = append(folder.Worlds, &added)
+		return
+	}
+	p.changes = append(p.changes, func(c Catalog) {
+		folder.Worlds = append(folder.Worlds, &added)
+		folder.ModifiedAt = getNow()
+	})
+}
+
+// backup is true when the backup is added to the world
+func (p *planner) backup(world *data.World, backup *data.Backup) bool {
+	if _, w, existing := data.LocateBackup(p.existing, backup.Id); existing != nil {
+		if w.Id == world.Id && existing.Name == backup.Name {
+			p.result.Present++
+		} else {
+			p.conflict(Conflict{WorldId: world.Id, BackupId: backup.Id, Message: fmt.Sprintf("Backup %s is %s of world %s already", backup.Id, existing.Name, w.Id)})
+		}
+		return false
+	}
+
+	if !fs.IsFolderName(backup.Name) {
+		p.conflict(Conflict{WorldId: world.Id, BackupId: backup.Id, Message: fmt.Sprintf("Backup %s has a name that can't be a file", backup.Id)})
+		return false
+	}
+	if exists, _ := p.f.Exists(path.Join(p.backupDir, backup.Name)); exists {
+		p.conflict(Conflict{WorldId: world.Id, BackupId: backup.Id, Message: fmt.Sprintf("Backup %s is %s, which is in the backup folder already", backup.Id, backup.Name)})
+		return false
+	}
+
+	if checksum, ok := p.checksums[backup.Name]; ok {
+		p.archives[backup.Name] = checksum
+	}
+	p.result.Backups++
+	return true
+}
+
+// copyArchives copies the archives next to where they go, and only moves
+// them there once every one of them was copied whole
+func (b *Bundle) copyArchives(f FileSystem, backupDir string, archives map[string]string) error {
+	left := map[string]string{}
+	for name, checksum := range archives {
+		left[name] = checksum
+	}
+
+	var copied []string
+	temp := func(name string) string {
+		return path.Join(backupDir, ".import-"+name)
+	}
+
+	err := b.walk(func(header *tar.Header, r io.Reader) error {
+		name := strings.TrimPrefix(header.Name, archivesDir)
+		checksum, ok := left[name]
+		if !ok || !strings.HasPrefix(header.Name, archivesDir) {
+			return nil
+		}
+		delete(left, name)
+
+		copied = append(copied, name)
+		if err := copyArchive(f, r, temp(name), checksum); err != nil {
+			return fmt.Errorf("Failed to copy %s: %v", name, err)
+		}
+		return nil
+	})
+	if err == nil && len(left) > 0 {
+		err = fmt.Errorf("The bundle is missing %d of the archives in its manifest", len(left))
+	}
+
+	if err != nil {
+		for _, name := range copied {
+			f.Remove(temp(name))
+		}
+		return err
+	}
+
+	for _, name := range copied {
+		if err := f.Rename(temp(name), path.Join(backupDir, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyArchive(f FileSystem, r io.Reader, target, checksum string) error {
+	file, err := f.Create(target)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), r)
+	if cErr := file.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != checksum {
+		return errors.New("it is damaged in the bundle")
+	}
+
+	return nil
+}
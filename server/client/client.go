@@ -0,0 +1,325 @@
+// Package client talks to a running server over its api, so the commands
+// can manage a server on another machine
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"world-backup/server/api"
+	"world-backup/server/bundle"
+	"world-backup/server/data"
+	"world-backup/server/jobs"
+)
+
+// pollInterval is how often a job is looked at while waiting for it
+var pollInterval = 500 * time.Millisecond
+
+// Client makes calls to the api of one server
+type Client struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+// Error is an error response from the server
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("The server answered %d %s", e.Status, http.StatusText(e.Status))
+	}
+
+	return e.Message
+}
+
+// New creates a client for the server at the url, calls are made with the
+// token from logging in
+func New(server, token string) *Client {
+	return &Client{
+		server: strings.TrimSuffix(server, "/"),
+		token:  token,
+		http:   &http.Client{Timeout: time.Minute},
+	}
+}
+
+// do sends body as JSON and decodes the answer into result, when given
+func (c *Client) do(method, path string, body, result interface{}) error {
+	var r io.Reader
+	contentType := ""
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+		contentType = "application/json"
+	}
+
+	res, err := c.send(c.http, method, path, contentType, r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// send makes the call and turns error statuses into errors, the caller
+// closes the body of the response
+func (c *Client) send(h *http.Client, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.server+"/api"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := h.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 300 {
+		defer res.Body.Close()
+
+		var e api.ErrorResponse
+		json.NewDecoder(res.Body).Decode(&e)
+		return nil, &Error{Status: res.StatusCode, Message: e.Message}
+	}
+
+	return res, nil
+}
+
+// untimed is for calls that move whole bundles, they take as long as the
+// archives take to send
+func (c *Client) untimed() *http.Client {
+	h := *c.http
+	h.Timeout = 0
+	return &h
+}
+
+// Login logs in as the user and returns the token to make calls with
+func (c *Client) Login(name, password string) (string, time.Time, error) {
+	var r struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	if err := c.do(http.MethodPost, "/auth/login", map[string]string{"name": name, "password": password}, &r); err != nil {
+		return "", time.Time{}, err
+	}
+
+	c.token = r.Token
+	return r.Token, r.ExpiresAt, nil
+}
+
+// Folders lists the watched folders
+func (c *Client) Folders() ([]api.FolderListItem, error) {
+	var folders []api.FolderListItem
+	err := c.do(http.MethodGet, "/folders", nil, &folders)
+	return folders, err
+}
+
+// Worlds lists the worlds in the folder, with their backups
+func (c *Client) Worlds(folderId string) ([]*data.World, error) {
+	var worlds []*data.World
+	err := c.do(http.MethodGet, "/folders/"+url.PathEscape(folderId)+"/worlds", nil, &worlds)
+	return worlds, err
+}
+
+// Catalog is every folder with its worlds and their backups, as far as the
+// user may see them
+func (c *Client) Catalog() ([]*data.Folder, error) {
+	items, err := c.Folders()
+	if err != nil {
+		return nil, err
+	}
+
+	folders := []*data.Folder{}
+	for _, item := range items {
+		worlds, err := c.Worlds(item.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		folders = append(folders, &data.Folder{
+			Id:         item.Id,
+			ModifiedAt: item.ModifiedAt,
+			Path:       item.Path,
+			LastRun:    item.LastRun,
+			Worlds:     worlds,
+			Paused:     item.Paused,
+			Untracked:  item.Untracked,
+		})
+	}
+
+	return folders, nil
+}
+
+func backupPath(folderId, worldId, backupId string) string {
+	p := "/folders/" + url.PathEscape(folderId) + "/worlds/" + url.PathEscape(worldId) + "/backups"
+	if backupId != "" {
+		p += "/" + url.PathEscape(backupId)
+	}
+
+	return p
+}
+
+// Backup starts backing up the world
+func (c *Client) Backup(folderId, worldId, name string) (jobs.Job, error) {
+	var job jobs.Job
+	err := c.do(http.MethodPost, backupPath(folderId, worldId, ""), map[string]string{"name": name}, &job)
+	return job, err
+}
+
+// Restore starts restoring the backup over the world, or next to it as a
+// new world when as is given
+func (c *Client) Restore(folderId, worldId, backupId, as string) (jobs.Job, error) {
+	var body interface{}
+	if as != "" {
+		body = map[string]string{"as": as}
+	}
+
+	var job jobs.Job
+	err := c.do(http.MethodPatch, backupPath(folderId, worldId, backupId), body, &job)
+	return job, err
+}
+
+// DeleteBackup starts deleting the backup and its copies
+func (c *Client) DeleteBackup(folderId, worldId, backupId string) (jobs.Job, error) {
+	var job jobs.Job
+	err := c.do(http.MethodDelete, backupPath(folderId, worldId, backupId), nil, &job)
+	return job, err
+}
+
+// Verify starts reading back every file in the backup
+func (c *Client) Verify(folderId, worldId, backupId string) (jobs.Job, error) {
+	var job jobs.Job
+	err := c.do(http.MethodGet, backupPath(folderId, worldId, backupId)+"/verify", nil, &job)
+	return job, err
+}
+
+// Prune starts deleting the backups superseded by one made soon after, of
+// every world or the one given, or only lists them on a dry run
+func (c *Client) Prune(dryRun bool, worldId string) (api.PruneResponse, error) {
+	body := map[string]interface{}{"dryRun": dryRun, "worldId": worldId}
+
+	var r api.PruneResponse
+	err := c.do(http.MethodPost, "/backups/prune", body, &r)
+	return r, err
+}
+
+// ExportBundle writes the catalog of the server and every backup on it to
+// w as a bundle
+func (c *Client) ExportBundle(w io.Writer) error {
+	res, err := c.send(c.untimed(), http.MethodGet, "/bundle", "", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// ImportBundle sends the bundle in r to the server to import. The paths to
+// import to are paths on the server.
+func (c *Client) ImportBundle(r io.Reader, opts bundle.Options) (bundle.Result, error) {
+	var result bundle.Result
+
+	// streamed, bundles can be much bigger than memory
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeBundleForm(form, r, opts))
+	}()
+
+	res, err := c.send(c.untimed(), http.MethodPost, "/bundle", form.FormDataContentType(), pr)
+	if err != nil {
+		return result, err
+	}
+	defer res.Body.Close()
+
+	err = json.NewDecoder(res.Body).Decode(&result)
+	return result, err
+}
+
+func writeBundleForm(form *multipart.Writer, r io.Reader, opts bundle.Options) error {
+	for from, to := range opts.Paths {
+		if err := form.WriteField("map", from+"="+to); err != nil {
+			return err
+		}
+	}
+	if err := form.WriteField("skipConflicts", strconv.FormatBool(opts.SkipConflicts)); err != nil {
+		return err
+	}
+	if err := form.WriteField("dryRun", strconv.FormatBool(opts.DryRun)); err != nil {
+		return err
+	}
+
+	part, err := form.CreateFormFile("file", "bundle.tar")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return err
+	}
+
+	return form.Close()
+}
+
+// Job returns how the job is doing
+func (c *Client) Job(id string) (jobs.Job, error) {
+	var job jobs.Job
+	err := c.do(http.MethodGet, "/jobs/"+url.PathEscape(id), nil, &job)
+	return job, err
+}
+
+// Wait follows the job until it is finished, calling progress each time it
+// is looked at
+func (c *Client) Wait(id string, progress func(job jobs.Job)) (jobs.Job, error) {
+	for {
+		job, err := c.Job(id)
+		if err != nil {
+			return job, err
+		}
+
+		if progress != nil {
+			progress(job)
+		}
+		if job.Finished() {
+			return job, nil
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// Result decodes the result of a finished job into v
+func Result(job jobs.Job, v interface{}) error {
+	b, err := json.Marshal(job.Result)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"world-backup/server/api"
+	"world-backup/server/bundle"
+	"world-backup/server/data"
+	"world-backup/server/jobs"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClient(t *testing.T) {
+	Convey("Given a server", t, func() {
+		oldPollInterval := pollInterval
+		pollInterval = time.Millisecond
+		defer func() { pollInterval = oldPollInterval }()
+
+		polls := 0
+		var auths []string
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["password"] != "hunter2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(api.ErrorResponse{Message: "Wrong name or password"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": "t0k3n"})
+		})
+		mux.HandleFunc("/api/folders", func(w http.ResponseWriter, r *http.Request) {
+			auths = append(auths, r.Header.Get("Authorization"))
+			json.NewEncoder(w).Encode([]api.FolderListItem{{Id: "f1", Path: "/saves", Paused: true}})
+		})
+		mux.HandleFunc("/api/folders/f1/worlds", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]*data.World{{Id: "w1", Name: "survival", Backups: []*data.Backup{{Id: "b1"}}}})
+		})
+		var restoreMethod string
+		var restoreBody map[string]string
+		mux.HandleFunc("/api/folders/f1/worlds/w1/backups/b1", func(w http.ResponseWriter, r *http.Request) {
+			restoreMethod = r.Method
+			json.NewDecoder(r.Body).Decode(&restoreBody)
+
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(jobs.Job{Id: "j1", State: jobs.Queued})
+		})
+		mux.HandleFunc("/api/jobs/j1", func(w http.ResponseWriter, r *http.Request) {
+			polls++
+			job := jobs.Job{Id: "j1", State: jobs.Running}
+			if polls == 3 {
+				job.State = jobs.Done
+				job.Result = api.RestoreResult{Path: "/saves/copy"}
+			}
+			json.NewEncoder(w).Encode(job)
+		})
+		var importForm map[string][]string
+		var importFile string
+		mux.HandleFunc("/api/bundle", func(w http.ResponseWriter, r *http.Request) {
+			r.ParseMultipartForm(1 << 20)
+			importForm = r.MultipartForm.Value
+			if file, _, err := r.FormFile("file"); err == nil {
+				b, _ := ioutil.ReadAll(file)
+				importFile = string(b)
+			}
+
+			json.NewEncoder(w).Encode(bundle.Result{Folders: 1})
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		c := New(server.URL+"/", "")
+
+		Convey("It should log in and make calls with the token", func() {
+			token, _, err := c.Login("admin", "hunter2")
+			So(err, ShouldBeNil)
+			So(token, ShouldEqual, "t0k3n")
+
+			folders, err := c.Catalog()
+			So(err, ShouldBeNil)
+			So(auths, ShouldResemble, []string{"Bearer t0k3n"})
+			So(len(folders), ShouldEqual, 1)
+			So(folders[0].Paused, ShouldBeTrue)
+			So(folders[0].Worlds[0].Backups[0].Id, ShouldEqual, "b1")
+		})
+
+		Convey("It should return what the server says went wrong", func() {
+			_, _, err := c.Login("admin", "guess")
+
+			So(err, ShouldResemble, &Error{Status: http.StatusUnauthorized, Message: "Wrong name or password"})
+		})
+
+		Convey("It should follow a job until it is finished", func() {
+			job, err := c.Restore("f1", "w1", "b1", "copy")
+			So(err, ShouldBeNil)
+			So(restoreMethod, ShouldEqual, http.MethodPatch)
+			So(restoreBody, ShouldResemble, map[string]string{"as": "copy"})
+
+			var seen []string
+			job, err = c.Wait(job.Id, func(j jobs.Job) { seen = append(seen, j.State) })
+			So(err, ShouldBeNil)
+			So(seen, ShouldResemble, []string{jobs.Running, jobs.Running, jobs.Done})
+
+			var result api.RestoreResult
+			So(Result(job, &result), ShouldBeNil)
+			So(result.Path, ShouldEqual, "/saves/copy")
+		})
+
+		Convey("It should stream a bundle with how to import it", func() {
+			opts := bundle.Options{Paths: map[string]string{"f1": "/games/saves"}, DryRun: true}
+			result, err := c.ImportBundle(strings.NewReader("the bundle"), opts)
+
+			So(err, ShouldBeNil)
+			So(result.Folders, ShouldEqual, 1)
+			So(importFile, ShouldEqual, "the bundle")
+			So(importForm["map"], ShouldResemble, []string{"f1=/games/saves"})
+			So(importForm["dryRun"], ShouldResemble, []string{"true"})
+			So(importForm["skipConflicts"], ShouldResemble, []string{"false"})
+		})
+	})
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"world-backup/server/api"
+	"world-backup/server/audit"
+	"world-backup/server/client"
+	"world-backup/server/crypt"
+	"world-backup/server/data"
+	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/minecraft"
+	"world-backup/server/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = cobra.Command{
+	Use:   "backup <world>",
+	Short: "Back up a world now, by its id, folder name or in-game name",
+	Run:   backup,
+}
+
+var restoreCmd = cobra.Command{
+	Use:   "restore <backup-id>",
+	Short: "Restore a world from a backup, keeping the world it replaces next to it",
+	Run:   restore,
+}
+
+func init() {
+	backupCmd.Flags().String("name", "", "what to call the backup")
+	restoreCmd.Flags().String("as", "", "restore next to the world as a new world with this folder name")
+}
+
+func backup(cmd *cobra.Command, args []string) {
+	usage(cmd, args, 1)
+
+	s := openSession(cmd, true)
+	defer s.close()
+
+	fw := s.findWorld(args[0])
+	folder, world := fw.Folder, fw.World
+	name, _ := cmd.Flags().GetString("name")
+
+	if s.client != nil {
+		if name == "" {
+			name = world.DisplayName()
+		}
+
+		job, err := s.client.Backup(folder.Id, world.Id, name)
+		if err != nil {
+			s.failRemote(err)
+		}
+		job = s.follow(job)
+		if job.State != jobs.Done {
+			s.fail(exitFailed, fmt.Errorf("Failed to back up %s: %s", world.DisplayName(), job.Error))
+		}
+
+		var backup data.Backup
+		client.Result(job, &backup)
+		printBackup(s, toBackupItem(world, &backup))
+		return
+	}
+
+	opts := s.config.ArchiveFor(folder.Path)
+	rules := s.config.RulesFor(folder.Path, world.Name)
+
+	t := time.Now()
+	backupName := fmt.Sprintf("%s-%s-%s%s", fs.CleanName(world.DisplayName()), world.Id, t.Format("20060102T150405"), opts.Extension())
+	if name != "" {
+		backupName = fmt.Sprintf("%s-%s%s", fs.CleanName(name), t.Format("20060102T150405"), opts.Extension())
+	}
+
+	entry := audit.Entry{Action: audit.BackupCreated, FolderId: folder.Id, WorldId: world.Id}
+	if err := fs.CreateBackup(s.fs, s.log, folder.Path, world.Name, s.config.BackupDir, backupName, opts, rules); err != nil {
+		s.record(entry, err)
+		s.fail(exitFailed, fmt.Errorf("Failed to back up %s: %v", world.DisplayName(), err))
+	}
+
+	backup := world.AddBackup(backupName).SetFormat(string(opts.Format)).SetKeyId(opts.Encryption.Id())
+	backup.SetRules(rules)
+	folder.ModifiedAt = time.Now()
+
+	// the server copies it to the destinations when it next runs
+	if len(s.destinations) > 0 {
+		queue, err := storage.NewQueue(s.log, s.config.Replication, s.fs, s.db, s.destinations, s.config.BackupDir, nil)
+		if err == nil {
+			queue.Enqueue(backup)
+		}
+	}
+
+	s.save()
+
+	entry.BackupId = backup.Id
+	entry.After = backup.Id
+	s.record(entry, nil)
+
+	printBackup(s, toBackupItem(world, backup))
+}
+
+func printBackup(s *session, item backupItem) {
+	s.print(item, func() {
+		fmt.Printf("Backed up %s to %s (%s)\n", item.World, item.Name, item.Id)
+	})
+}
+
+type restoreResult struct {
+	Backup backupItem `json:"backup"`
+	Path   string     `json:"path"`
+
+	// Previous is where the world that was replaced was moved to
+	Previous string `json:"previous,omitempty"`
+}
+
+func restore(cmd *cobra.Command, args []string) {
+	usage(cmd, args, 1)
+
+	s := openSession(cmd, true)
+	defer s.close()
+
+	folder, world, backup := s.findBackup(args[0])
+	as, _ := cmd.Flags().GetString("as")
+	if as != "" && !fs.IsFolderName(as) {
+		s.fail(exitUsage, fmt.Errorf("%s is not a folder name", as))
+	}
+
+	result := restoreResult{Backup: toBackupItem(world, backup), Path: world.FullPath}
+
+	if s.client != nil {
+		job, err := s.client.Restore(folder.Id, world.Id, backup.Id, as)
+		if err != nil {
+			s.failRemote(err)
+		}
+		job = s.follow(job)
+		if job.State != jobs.Done {
+			s.fail(exitFailed, fmt.Errorf("Failed to restore %s: %s", backup.Name, job.Error))
+		}
+
+		var restored api.RestoreResult
+		client.Result(job, &restored)
+		result.Path, result.Previous = restored.Path, restored.Previous
+		printRestore(s, result)
+		return
+	}
+
+	file := s.archiveFile(backup)
+	if file.Encrypted && file.Keys == nil {
+		s.fail(exitFailed, crypt.NoKeyError)
+	}
+
+	if exists, _ := s.fs.Exists(file.Path); !exists {
+		if len(backup.Copies) == 0 {
+			s.fail(exitNotFound, fmt.Errorf("The file of backup %s is gone and there are no copies of it", backup.Id))
+		}
+		if err := storage.Fetch(s.fs, s.log, s.destinations, backup, file.Path); err != nil {
+			s.fail(exitFailed, fmt.Errorf("Failed to fetch %s: %v", backup.Name, err))
+		}
+	}
+
+	entry := audit.Entry{Action: audit.BackupRestored, FolderId: folder.Id, WorldId: world.Id, BackupId: backup.Id, After: backup.Id}
+
+	if as != "" {
+		result.Path = filepath.Join(folder.Path, as)
+		if exists, _ := s.fs.Exists(result.Path); exists {
+			s.fail(exitUsage, fmt.Errorf("There already is a world at %s", result.Path))
+		}
+
+		// the archive holds the world under its own folder name
+		tmp := filepath.Join(folder.Path, ".restore-"+backup.Id)
+		err := s.fs.Extract(file, tmp)
+		if err == nil {
+			err = s.fs.Rename(filepath.Join(tmp, world.Name), result.Path)
+		}
+		s.fs.RemoveAll(tmp)
+
+		entry.After = result.Path
+		s.record(entry, err)
+		if err != nil {
+			s.fail(exitFailed, fmt.Errorf("Failed to restore %s: %v", backup.Name, err))
+		}
+	} else {
+		if open, _ := minecraft.IsOpen(world.FullPath); open {
+			s.fail(exitFailed, fmt.Errorf("%s is open in the game, close it first", world.DisplayName()))
+		}
+
+		result.Previous = filepath.Join(folder.Path, fmt.Sprintf("%s_%d", world.Name, time.Now().Unix()))
+		if err := s.fs.Rename(world.FullPath, result.Previous); err != nil {
+			s.record(entry, err)
+			s.fail(exitFailed, fmt.Errorf("Failed to move %s out of the way: %v", world.FullPath, err))
+		}
+		entry.Before = result.Previous
+
+		err := s.fs.Extract(file, folder.Path)
+		s.record(entry, err)
+		if err != nil {
+			s.fail(exitFailed, fmt.Errorf("Failed to restore %s: %v", backup.Name, err))
+		}
+	}
+
+	folder.ModifiedAt = time.Now()
+	s.save()
+
+	printRestore(s, result)
+}
+
+func printRestore(s *session, result restoreResult) {
+	s.print(result, func() {
+		fmt.Printf("Restored %s from %s to %s\n", result.Backup.World, result.Backup.Name, result.Path)
+		if result.Previous != "" {
+			fmt.Printf("The world it replaced was kept at %s\n", result.Previous)
+		}
+	})
+}
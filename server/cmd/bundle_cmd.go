@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"world-backup/server/audit"
+	"world-backup/server/bundle"
+
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = cobra.Command{
+	Use:   "export <file>",
+	Short: "Write the catalog and every backup to one bundle file, to import on another machine",
+	Run:   exportBundle,
+}
+
+var importCmd = cobra.Command{
+	Use:   "import <file>",
+	Short: "Add the catalog and backups in a bundle, merging them with the ones here",
+	Run:   importBundle,
+}
+
+func init() {
+	importCmd.Flags().StringArray("map", nil, "import the folder with this path or id to another path, given as from=to")
+	importCmd.Flags().Bool("skip-conflicts", false, "import what doesn't conflict with the catalog, instead of nothing")
+	importCmd.Flags().Bool("dry-run", false, "only tell what would be imported")
+}
+
+func exportBundle(cmd *cobra.Command, args []string) {
+	usage(cmd, args, 1)
+
+	s := openSession(cmd, false)
+	defer s.close()
+
+	file, err := os.Create(args[0])
+	if err != nil {
+		s.fail(exitFailed, err)
+	}
+
+	if s.client != nil {
+		err = s.client.ExportBundle(file)
+	} else {
+		_, err = bundle.Export(file, s.fs, s.folders(), s.config.BackupDir)
+	}
+	if cErr := file.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(args[0])
+		if s.client != nil {
+			s.failRemote(err)
+		}
+		s.fail(exitFailed, fmt.Errorf("Failed to export the catalog: %v", err))
+	}
+
+	// read back, which checks the bundle is whole too
+	file, err = os.Open(args[0])
+	if err != nil {
+		s.fail(exitFailed, err)
+	}
+	defer file.Close()
+
+	b, err := bundle.Read(file)
+	if err != nil {
+		s.fail(exitFailed, err)
+	}
+
+	m := b.Manifest
+	s.print(m, func() {
+		worlds, backups := 0, 0
+		for _, f := range m.Folders {
+			worlds += f.Worlds
+			backups += f.Backups
+		}
+		fmt.Printf("Exported %d folder(s) with %d world(s) and %d backup(s) to %s\n", len(m.Folders), worlds, backups, args[0])
+		if missing := backups - len(m.Archives); missing > 0 {
+			fmt.Printf("%d backup(s) had no file, only their copies at the destinations are left\n", missing)
+		}
+	})
+}
+
+func importBundle(cmd *cobra.Command, args []string) {
+	usage(cmd, args, 1)
+
+	mappings, _ := cmd.Flags().GetStringArray("map")
+	skipConflicts, _ := cmd.Flags().GetBool("skip-conflicts")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	paths, err := bundle.ParsePaths(mappings)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		exit(exitUsage)
+	}
+
+	s := openSession(cmd, !dryRun)
+	defer s.close()
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		s.fail(exitNotFound, err)
+	}
+	defer file.Close()
+
+	opts := bundle.Options{Paths: paths, SkipConflicts: skipConflicts, DryRun: dryRun}
+
+	var result bundle.Result
+	if s.client != nil {
+		if result, err = s.client.ImportBundle(file, opts); err != nil {
+			s.failRemote(err)
+		}
+		printImport(s, result, dryRun)
+		return
+	}
+
+	// the paths to import to are on this machine
+	for from, to := range paths {
+		if paths[from], err = filepath.Abs(to); err != nil {
+			s.fail(exitUsage, err)
+		}
+	}
+
+	b, err := bundle.Read(file)
+	if err != nil {
+		s.fail(exitFailed, err)
+	}
+
+	result, err = b.Import(s.db, s.fs, s.config.BackupDir, opts)
+	if _, ok := err.(*bundle.ConflictError); ok {
+		s.fail(exitFailed, err)
+	}
+
+	if !dryRun {
+		if err == nil {
+			err = s.db.Save()
+		}
+		s.record(audit.Entry{Action: audit.CatalogImported}, err)
+		if err != nil {
+			s.fail(exitFailed, fmt.Errorf("Failed to import %s: %v", args[0], err))
+		}
+	}
+
+	printImport(s, result, dryRun)
+}
+
+func printImport(s *session, result bundle.Result, dryRun bool) {
+	s.print(result, func() {
+		verb := "Imported"
+		if dryRun {
+			verb = "Would import"
+		}
+
+		fmt.Printf("%s %d folder(s), %d world(s) and %d backup(s)\n", verb, result.Folders, result.Worlds, result.Backups)
+		if result.Present > 0 {
+			fmt.Printf("%d backup(s) were here already\n", result.Present)
+		}
+		if len(result.Conflicts) > 0 {
+			fmt.Printf("Skipped %d conflict(s):\n", len(result.Conflicts))
+			for _, c := range result.Conflicts {
+				fmt.Printf("  %s\n", c.Message)
+			}
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"world-backup/server/bundle"
+	"world-backup/server/data"
+	"world-backup/server/fs"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+func TestImportBundle(t *testing.T) {
+	Convey("Given a bundle exported on another machine", t, func() {
+		dir, _ := testCatalog()
+		defer os.RemoveAll(dir)
+		os.Mkdir(filepath.Join(dir, "saves"), 0755)
+
+		af := afero.Afero{Fs: afero.NewMemMapFs()}
+		af.WriteFile("/old/backups/one.zip", []byte("the first backup"), 0600)
+		backup := &data.Backup{Id: "b1", Name: "one.zip", CreatedAt: time.Date(2020, 6, 6, 12, 0, 0, 0, time.UTC)}
+		world := &data.World{Id: "w1", Name: "survival", FullPath: "/old/saves/survival", Backups: []*data.Backup{backup}}
+		folders := []*data.Folder{{Id: "f1", Path: "/old/saves", Worlds: []*data.World{world}}}
+
+		var buf bytes.Buffer
+		_, err := bundle.Export(&buf, fs.NewFs(af), folders, "/old/backups")
+		So(err, ShouldBeNil)
+		ioutil.WriteFile(filepath.Join(dir, "old.bundle"), buf.Bytes(), 0644)
+
+		Convey("When it is imported with a folder mapped to a path here", func() {
+			out, code := runCommand(dir, "import", "old.bundle", "--map", "/old/saves=saves", "--json")
+
+			Convey("It should import the folder to the path, from where the command ran", func() {
+				So(code, ShouldEqual, 0)
+
+				var result bundle.Result
+				So(json.Unmarshal([]byte(out), &result), ShouldBeNil)
+				So(result.Folders, ShouldEqual, 1)
+				So(result.Backups, ShouldEqual, 1)
+
+				db, _ := data.Open(filepath.Join(dir, catalogName), afero.Afero{Fs: afero.NewOsFs()})
+				folder := db.GetFolder("f1")
+				So(folder.Path, ShouldEqual, filepath.Join(dir, "saves"))
+				So(folder.Worlds[0].FullPath, ShouldEqual, filepath.Join(dir, "saves", "survival"))
+
+				b, _ := ioutil.ReadFile(filepath.Join(dir, "backups", "one.zip"))
+				So(string(b), ShouldEqual, "the first backup")
+			})
+		})
+
+		Convey("When a mapping isn't given as from=to", func() {
+			out, code := runCommand(dir, "import", "old.bundle", "--map", "/old/saves", "--json")
+
+			Convey("It should exit without importing", func() {
+				So(code, ShouldEqual, exitUsage)
+				So(out, ShouldContainSubstring, "give it as from=to")
+
+				_, err := os.Stat(filepath.Join(dir, catalogName))
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+	})
+}
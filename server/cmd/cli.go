@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"world-backup/server/audit"
+	"world-backup/server/client"
+	"world-backup/server/conf"
+	"world-backup/server/data"
+	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/storage"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+// The exit codes of the commands, for scripts to tell failures apart
+const (
+	exitFailed   = 1
+	exitUsage    = 2
+	exitLocked   = 3
+	exitNotFound = 4
+	exitDenied   = 5
+)
+
+const catalogName = "data.json"
+
+// exit ends the command with the code
+var exit = os.Exit
+
+// session is what a command works on. Commands that change the catalog
+// hold its lock so they don't write over a running server or each other.
+// With --server they work through the server's api instead.
+type session struct {
+	cmd          *cobra.Command
+	client       *client.Client
+	catalog      []*data.Folder
+	log          *logrus.Entry
+	config       *conf.Config
+	fs           *fs.FileSystem
+	db           *data.Db
+	lock         *data.Lock
+	audit        *audit.Log
+	destinations storage.Set
+}
+
+// openSession loads the config and catalog for a command, exiting when it
+// can't. write locks the catalog and opens the audit log.
+func openSession(cmd *cobra.Command, write bool) *session {
+	s := &session{cmd: cmd}
+
+	// results go to stdout, only warnings are logged
+	logger := logrus.New()
+	logger.Out = os.Stderr
+	logger.Level = logrus.WarnLevel
+	s.log = logrus.NewEntry(logger)
+
+	if server, _ := cmd.Flags().GetString("server"); server != "" {
+		token, _ := cmd.Flags().GetString("token")
+		s.client = client.New(server, token)
+		return s
+	}
+
+	config, err := conf.LoadConfig(cmd)
+	if err != nil {
+		s.fail(exitFailed, fmt.Errorf("Failed to load config: %v", err))
+	}
+	if err := config.Validate(); err != nil {
+		s.fail(exitFailed, fmt.Errorf("The config has problems:\n%v", err))
+	}
+	s.config = config
+
+	if write {
+		if s.lock, err = data.LockCatalog(catalogName); err != nil {
+			if err == data.LockedError {
+				s.fail(exitLocked, err)
+			}
+			s.fail(exitFailed, fmt.Errorf("Failed to lock the catalog: %v", err))
+		}
+	}
+
+	aferoFs := afero.Afero{Fs: afero.NewOsFs()}
+	s.fs = fs.NewFs(aferoFs)
+
+	if s.db, err = data.Open(catalogName, aferoFs); err != nil {
+		s.fail(exitFailed, fmt.Errorf("Failed to open the db: %v", err))
+	}
+
+	if s.destinations, err = storage.Open(config.Destinations); err != nil {
+		s.fail(exitFailed, fmt.Errorf("Failed to set up the backup destinations: %v", err))
+	}
+
+	if write {
+		if s.audit, err = audit.Open(aferoFs, config.Audit); err != nil {
+			s.fail(exitFailed, fmt.Errorf("Failed to open the audit log: %v", err))
+		}
+	}
+
+	return s
+}
+
+func (s *session) close() {
+	s.lock.Unlock()
+}
+
+// record adds what the command did to the audit log
+func (s *session) record(e audit.Entry, err error) {
+	e.Actor = audit.Cli
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	if rErr := s.audit.Record(e); rErr != nil {
+		s.log.Errorf("Failed to record %s in the audit log: %v", e.Action, rErr)
+	}
+}
+
+func (s *session) save() {
+	if err := s.db.Save(); err != nil {
+		s.fail(exitFailed, fmt.Errorf("Failed to save the db: %v", err))
+	}
+}
+
+// folders is every folder with its worlds, from the catalog or the server
+func (s *session) folders() []*data.Folder {
+	if s.client == nil {
+		return s.db.Folders()
+	}
+
+	if s.catalog == nil {
+		catalog, err := s.client.Catalog()
+		if err != nil {
+			s.failRemote(err)
+		}
+		s.catalog = catalog
+	}
+
+	return s.catalog
+}
+
+// findWorld is the one world the argument names, by id, folder name or
+// in-game name
+func (s *session) findWorld(ref string) data.FolderWorld {
+	found := data.FindWorlds(s.folders(), ref)
+
+	switch len(found) {
+	case 0:
+		s.fail(exitNotFound, fmt.Errorf("There is no world %s", ref))
+	case 1:
+		return found[0]
+	}
+
+	msg := fmt.Sprintf("%s could be any of these worlds, use its id:", ref)
+	for _, fw := range found {
+		msg += fmt.Sprintf("\n  %s  %s", fw.World.Id, fw.World.FullPath)
+	}
+	s.fail(exitUsage, errors.New(msg))
+
+	return data.FolderWorld{}
+}
+
+func (s *session) findBackup(id string) (*data.Folder, *data.World, *data.Backup) {
+	f, w, b := data.LocateBackup(s.folders(), id)
+	if b == nil {
+		s.fail(exitNotFound, fmt.Errorf("There is no backup %s", id))
+	}
+
+	return f, w, b
+}
+
+// archiveFile is where the backup is kept and how to read it, with the
+// configured keys
+func (s *session) archiveFile(b *data.Backup) fs.ArchiveFile {
+	return fs.ArchiveFile{
+		Path:      backupPath(s.config, b),
+		Format:    fs.Format(b.Format),
+		Encrypted: b.KeyId != "",
+		Keys:      s.config.Keys(b.KeyId),
+	}
+}
+
+func backupPath(c *conf.Config, b *data.Backup) string {
+	return c.BackupDir + afero.FilePathSeparator + b.Name
+}
+
+func jsonOutput(cmd *cobra.Command) bool {
+	j, _ := cmd.Flags().GetBool("json")
+	return j
+}
+
+// print writes the result as JSON, or as text when text is given and JSON
+// wasn't asked for
+func (s *session) print(result interface{}, text func()) {
+	if jsonOutput(s.cmd) || text == nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+		return
+	}
+
+	text()
+}
+
+type errorOutput struct {
+	Error string `json:"error"`
+}
+
+// fail reports the error and exits with the code, releasing the lock
+func (s *session) fail(code int, err error) {
+	if jsonOutput(s.cmd) {
+		json.NewEncoder(os.Stdout).Encode(errorOutput{Error: err.Error()})
+	} else {
+		fmt.Fprintln(os.Stderr, err.Error())
+	}
+
+	s.close()
+	exit(code)
+}
+
+// failRemote reports an error from the server, telling a refused call and
+// something that isn't there apart by the exit code
+func (s *session) failRemote(err error) {
+	if e, ok := err.(*client.Error); ok {
+		switch e.Status {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			s.fail(exitDenied, err)
+		case http.StatusNotFound:
+			s.fail(exitNotFound, err)
+		}
+	}
+
+	s.fail(exitFailed, err)
+}
+
+// follow waits for a job on the server to finish, showing how far it got
+// unless the output is JSON
+func (s *session) follow(job jobs.Job) jobs.Job {
+	show, shown := !jsonOutput(s.cmd), false
+
+	job, err := s.client.Wait(job.Id, func(j jobs.Job) {
+		if show && j.Progress.FilesTotal > 0 {
+			fmt.Fprintf(os.Stderr, "\r%s: %d/%d files", j.Kind, j.Progress.Files, j.Progress.FilesTotal)
+			shown = true
+		}
+	})
+	if shown {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		s.failRemote(err)
+	}
+
+	return job
+}
+
+// usage exits when the command wasn't given the arguments it needs
+func usage(cmd *cobra.Command, args []string, n int) {
+	if len(args) != n {
+		fmt.Fprintf(os.Stderr, "%s takes %d argument(s)\n\n", cmd.Name(), n)
+		cmd.Usage()
+		exit(exitUsage)
+	}
+}
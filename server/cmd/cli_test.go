@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"world-backup/server/data"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var setupRoot sync.Once
+
+// exitCode is what exit panics with in the tests, to stop the command
+// without ending the test binary
+type exitCode int
+
+// runCommand runs the command line in dir, the way it would be run there,
+// returning what it printed to stdout and the code it exited with
+func runCommand(dir string, args ...string) (out string, code int) {
+	setupRoot.Do(func() { RootCommand() })
+	defer resetFlags(&rootCmd)
+
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	oldExit := exit
+	exit = func(c int) { panic(exitCode(c)) }
+	defer func() { exit = oldExit }()
+
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stdout, os.Stderr = w, w
+	read := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		read <- string(b)
+	}()
+
+	defer func() {
+		if c, ok := recover().(exitCode); ok {
+			code = int(c)
+		}
+
+		w.Close()
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+		out = <-read
+	}()
+
+	rootCmd.SetArgs(append(args, "--config", filepath.Join(dir, "config.json")))
+	rootCmd.Execute()
+
+	return
+}
+
+// resetFlags puts the flags back to their defaults for the next command
+func resetFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if v, ok := f.Value.(pflag.SliceValue); ok {
+			v.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+
+	for _, c := range cmd.Commands() {
+		resetFlags(c)
+	}
+}
+
+// testCatalog sets up a config and an empty catalog to run commands on
+func testCatalog() (dir string, db *data.Db) {
+	dir, _ = ioutil.TempDir("", "cli")
+	os.Mkdir(filepath.Join(dir, "backups"), 0755)
+
+	config := map[string]interface{}{
+		"backupDir":     filepath.Join(dir, "backups"),
+		"port":          3000,
+		"checkInterval": "1m",
+		"watchDirs":     []string{},
+	}
+	b, _ := json.Marshal(config)
+	ioutil.WriteFile(filepath.Join(dir, "config.json"), b, 0644)
+
+	db, _ = data.Open(filepath.Join(dir, catalogName), afero.Afero{Fs: afero.NewOsFs()})
+	return dir, db
+}
+
+func TestLockedCatalog(t *testing.T) {
+	Convey("Given a catalog another world-backup has locked", t, func() {
+		dir, db := testCatalog()
+		defer os.RemoveAll(dir)
+		db.Save()
+
+		lock, err := data.LockCatalog(filepath.Join(dir, catalogName))
+		So(err, ShouldBeNil)
+		defer lock.Unlock()
+
+		Convey("A command that changes it should refuse to run", func() {
+			out, code := runCommand(dir, "prune", "--json")
+
+			So(code, ShouldEqual, exitLocked)
+			So(strings.TrimSpace(out), ShouldEqual, `{"error":"`+data.LockedError.Error()+`"}`)
+		})
+
+		Convey("A command that only reads it should still run", func() {
+			out, code := runCommand(dir, "prune", "--dry-run", "--json")
+
+			So(code, ShouldEqual, 0)
+			So(out, ShouldContainSubstring, `"dryRun": true`)
+		})
+	})
+}
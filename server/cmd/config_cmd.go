@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"world-backup/server/conf"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = cobra.Command{
+	Use:   "config",
+	Short: "Work with the config file",
+}
+
+var validateCmd = cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file and list everything wrong with it",
+	Run:   validateConfig,
+}
+
+func init() {
+	configCmd.AddCommand(&validateCmd)
+}
+
+func validateConfig(cmd *cobra.Command, args []string) {
+	config, err := conf.LoadConfig(cmd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load config: "+err.Error())
+		exit(1)
+	}
+
+	problems := config.Check(afero.NewOsFs())
+	if len(problems) == 0 {
+		fmt.Println("The config is valid")
+		return
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	exit(1)
+}
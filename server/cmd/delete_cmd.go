@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"world-backup/server/audit"
+	"world-backup/server/data"
+	"world-backup/server/jobs"
+	"world-backup/server/storage"
+
+	"github.com/spf13/cobra"
+)
+
+var deleteCmd = cobra.Command{
+	Use:   "delete <backup-id>",
+	Short: "Delete a backup, along with its copies at the destinations",
+	Run:   deleteBackup,
+}
+
+var pruneCmd = cobra.Command{
+	Use:   "prune",
+	Short: "Delete the backups made within a check interval of the next one, keeping the last of each session",
+	Run:   prune,
+}
+
+func init() {
+	pruneCmd.Flags().Bool("dry-run", false, "only list the backups that would be deleted")
+	pruneCmd.Flags().String("world", "", "only prune the backups of this world")
+}
+
+// removeBackup deletes the backup file and its copies, and drops it from the
+// catalog. The caller saves the db.
+func (s *session) removeBackup(folder *data.Folder, world *data.World, backup *data.Backup) error {
+	p := backupPath(s.config, backup)
+	if exists, _ := s.fs.Exists(p); exists {
+		if err := s.fs.Remove(p); err != nil {
+			return err
+		}
+	}
+
+	if len(backup.Copies) > 0 {
+		storage.Remove(s.log, s.destinations, backup)
+	}
+	s.db.RemoveReplications(backup.Id)
+
+	world.RemoveBackup(backup.Id)
+	folder.ModifiedAt = time.Now()
+	return nil
+}
+
+func deleteBackup(cmd *cobra.Command, args []string) {
+	usage(cmd, args, 1)
+
+	s := openSession(cmd, true)
+	defer s.close()
+
+	folder, world, backup := s.findBackup(args[0])
+	item := toBackupItem(world, backup)
+
+	if s.client != nil {
+		job, err := s.client.DeleteBackup(folder.Id, world.Id, backup.Id)
+		if err != nil {
+			s.failRemote(err)
+		}
+		if job = s.follow(job); job.State != jobs.Done {
+			s.fail(exitFailed, fmt.Errorf("Failed to delete %s: %s", backup.Name, job.Error))
+		}
+
+		printDeleted(s, item)
+		return
+	}
+
+	err := s.removeBackup(folder, world, backup)
+	s.record(audit.Entry{Action: audit.BackupDeleted, FolderId: folder.Id, WorldId: world.Id, BackupId: backup.Id, Before: backup.Id}, err)
+	if err != nil {
+		s.fail(exitFailed, fmt.Errorf("Failed to delete %s: %v", backup.Name, err))
+	}
+
+	s.save()
+
+	printDeleted(s, item)
+}
+
+func printDeleted(s *session, item backupItem) {
+	s.print(item, func() {
+		fmt.Printf("Deleted %s (%s)\n", item.Name, item.Id)
+	})
+}
+
+type pruneResult struct {
+	DryRun  bool         `json:"dryRun"`
+	Deleted []backupItem `json:"deleted"`
+	Failed  []backupItem `json:"failed"`
+}
+
+func prune(cmd *cobra.Command, args []string) {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	s := openSession(cmd, !dryRun)
+	defer s.close()
+
+	var worlds []data.FolderWorld
+	if ref, _ := cmd.Flags().GetString("world"); ref != "" {
+		worlds = []data.FolderWorld{s.findWorld(ref)}
+	} else {
+		for _, f := range s.folders() {
+			for _, w := range f.Worlds {
+				worlds = append(worlds, data.FolderWorld{Folder: f, World: w})
+			}
+		}
+	}
+
+	result := pruneResult{DryRun: dryRun, Deleted: []backupItem{}, Failed: []backupItem{}}
+	if s.client != nil {
+		pruneOnServer(s, worlds, &result)
+		printPruned(s, result)
+		return
+	}
+
+	for _, fw := range worlds {
+		for _, backup := range fw.World.Superseded(s.config.PruneWindowFor(fw.Folder.Path, fw.World.Name)) {
+			item := toBackupItem(fw.World, backup)
+			if dryRun {
+				result.Deleted = append(result.Deleted, item)
+				continue
+			}
+
+			err := s.removeBackup(fw.Folder, fw.World, backup)
+			s.record(audit.Entry{Action: audit.BackupPruned, FolderId: fw.Folder.Id, WorldId: fw.World.Id, BackupId: backup.Id, Before: backup.Id}, err)
+			if err != nil {
+				s.log.Errorf("Failed to delete %s: %v", backup.Name, err)
+				result.Failed = append(result.Failed, item)
+				continue
+			}
+			result.Deleted = append(result.Deleted, item)
+		}
+	}
+
+	if !dryRun {
+		s.save()
+	}
+
+	printPruned(s, result)
+}
+
+// pruneOnServer has the server prune the worlds, and waits for it
+func pruneOnServer(s *session, worlds []data.FolderWorld, result *pruneResult) {
+	worldId := ""
+	if ref, _ := s.cmd.Flags().GetString("world"); ref != "" {
+		worldId = worlds[0].World.Id
+	}
+
+	r, err := s.client.Prune(result.DryRun, worldId)
+	if err != nil {
+		s.failRemote(err)
+	}
+
+	failed := map[string]bool{}
+	for _, job := range r.Jobs {
+		if job = s.follow(job); job.State != jobs.Done {
+			s.log.Errorf("Failed to prune world %s: %s", job.WorldId, job.Error)
+			failed[job.WorldId] = true
+		}
+	}
+
+	// the catalog was read before the prune, it still has the backups
+	for _, pruned := range r.Backups {
+		_, world, backup := data.LocateBackup(s.folders(), pruned.BackupId)
+		if backup == nil {
+			continue
+		}
+
+		if failed[pruned.WorldId] {
+			result.Failed = append(result.Failed, toBackupItem(world, backup))
+		} else {
+			result.Deleted = append(result.Deleted, toBackupItem(world, backup))
+		}
+	}
+}
+
+func printPruned(s *session, result pruneResult) {
+	dryRun := result.DryRun
+	s.print(result, func() {
+		verb := "Deleted"
+		if dryRun {
+			verb = "Would delete"
+		}
+
+		table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, b := range result.Deleted {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", verb, b.Id, b.World, b.Name)
+		}
+		for _, b := range result.Failed {
+			fmt.Fprintf(table, "Failed to delete\t%s\t%s\t%s\n", b.Id, b.World, b.Name)
+		}
+		table.Flush()
+		fmt.Printf("%s %d backup(s)\n", verb, len(result.Deleted))
+	})
+
+	if len(result.Failed) > 0 {
+		s.close()
+		exit(exitFailed)
+	}
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"world-backup/server/data"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+func TestDeleteAndPrune(t *testing.T) {
+	Convey("Given a world with two backups made a check apart and a later one", t, func() {
+		dir, db := testCatalog()
+		defer os.RemoveAll(dir)
+
+		start := time.Date(2020, 6, 6, 12, 0, 0, 0, time.UTC)
+		world := db.AddFolder("/saves").AddWorld("survival")
+		for i, at := range []time.Duration{0, 30 * time.Second, time.Hour} {
+			b := world.AddBackup(string(rune('a'+i)) + ".zip")
+			b.CreatedAt = start.Add(at)
+			ioutil.WriteFile(filepath.Join(dir, "backups", b.Name), []byte("a backup"), 0644)
+		}
+		first, second, last := world.Backups[0], world.Backups[1], world.Backups[2]
+		db.Save()
+
+		catalog := func() *data.World {
+			db, _ := data.Open(filepath.Join(dir, catalogName), afero.Afero{Fs: afero.NewOsFs()})
+			return db.Folders()[0].Worlds[0]
+		}
+		exists := func(b *data.Backup) bool {
+			_, err := os.Stat(filepath.Join(dir, "backups", b.Name))
+			return err == nil
+		}
+
+		Convey("When one is deleted", func() {
+			out, code := runCommand(dir, "delete", last.Id, "--json")
+
+			Convey("It should remove its file and drop it from the catalog", func() {
+				So(code, ShouldEqual, 0)
+
+				var item backupItem
+				So(json.Unmarshal([]byte(out), &item), ShouldBeNil)
+				So(item.Id, ShouldEqual, last.Id)
+
+				So(exists(last), ShouldBeFalse)
+				So(exists(first), ShouldBeTrue)
+				So(len(catalog().Backups), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When one that isn't there is deleted", func() {
+			_, code := runCommand(dir, "delete", "nope", "--json")
+
+			Convey("It should say so by the exit code", func() {
+				So(code, ShouldEqual, exitNotFound)
+				So(len(catalog().Backups), ShouldEqual, 3)
+			})
+		})
+
+		Convey("When it is pruned", func() {
+			out, code := runCommand(dir, "prune", "--json")
+
+			Convey("It should only delete the backup followed by one within the check interval", func() {
+				So(code, ShouldEqual, 0)
+
+				var result pruneResult
+				So(json.Unmarshal([]byte(out), &result), ShouldBeNil)
+				So(len(result.Deleted), ShouldEqual, 1)
+				So(result.Deleted[0].Id, ShouldEqual, first.Id)
+
+				So(exists(first), ShouldBeFalse)
+				So(exists(second), ShouldBeTrue)
+				backups := catalog().Backups
+				So(len(backups), ShouldEqual, 2)
+				So(backups[0].Id, ShouldEqual, second.Id)
+			})
+		})
+
+		Convey("When the prune is a dry run", func() {
+			out, code := runCommand(dir, "prune", "--dry-run", "--json")
+
+			Convey("It should list the backup without deleting it", func() {
+				So(code, ShouldEqual, 0)
+
+				var result pruneResult
+				So(json.Unmarshal([]byte(out), &result), ShouldBeNil)
+				So(result.DryRun, ShouldBeTrue)
+				So(len(result.Deleted), ShouldEqual, 1)
+
+				So(exists(first), ShouldBeTrue)
+				So(len(catalog().Backups), ShouldEqual, 3)
+			})
+		})
+	})
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"world-backup/server/data"
+
+	"github.com/spf13/cobra"
+)
+
+var listCmd = cobra.Command{
+	Use:   "list folders|worlds|backups",
+	Short: "List the watched folders, their worlds or the backups of the worlds",
+	Run:   list,
+}
+
+func init() {
+	listCmd.Flags().String("folder", "", "only list the worlds in the folder with this id")
+	listCmd.Flags().String("world", "", "only list the backups of this world")
+}
+
+type folderItem struct {
+	Id        string `json:"id"`
+	Path      string `json:"path"`
+	Worlds    int    `json:"worlds"`
+	Paused    bool   `json:"paused"`
+	Untracked bool   `json:"untracked"`
+}
+
+type worldItem struct {
+	Id         string    `json:"id"`
+	FolderId   string    `json:"folderId"`
+	Name       string    `json:"name"`
+	LevelName  string    `json:"levelName"`
+	Path       string    `json:"path"`
+	Backups    int       `json:"backups"`
+	LastBackup time.Time `json:"lastBackup"`
+}
+
+type backupItem struct {
+	Id        string    `json:"id"`
+	WorldId   string    `json:"worldId"`
+	World     string    `json:"world"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Encrypted bool      `json:"encrypted"`
+	Copies    []string  `json:"copies"`
+}
+
+func toBackupItem(w *data.World, b *data.Backup) backupItem {
+	item := backupItem{
+		Id:        b.Id,
+		WorldId:   w.Id,
+		World:     w.DisplayName(),
+		Name:      b.Name,
+		CreatedAt: b.CreatedAt,
+		Encrypted: b.KeyId != "",
+		Copies:    []string{},
+	}
+	for _, c := range b.Copies {
+		item.Copies = append(item.Copies, c.Destination)
+	}
+
+	return item
+}
+
+func list(cmd *cobra.Command, args []string) {
+	usage(cmd, args, 1)
+
+	s := openSession(cmd, false)
+	defer s.close()
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer table.Flush()
+
+	switch args[0] {
+	case "folders":
+		items := []folderItem{}
+		for _, f := range s.folders() {
+			items = append(items, folderItem{Id: f.Id, Path: f.Path, Worlds: len(f.Worlds), Paused: f.Paused, Untracked: f.Untracked})
+		}
+
+		s.print(items, func() {
+			fmt.Fprintln(table, "ID\tPATH\tWORLDS\tWATCHED")
+			for _, f := range items {
+				fmt.Fprintf(table, "%s\t%s\t%d\t%t\n", f.Id, f.Path, f.Worlds, !f.Paused && !f.Untracked)
+			}
+		})
+
+	case "worlds":
+		folderId, _ := cmd.Flags().GetString("folder")
+
+		items := []worldItem{}
+		for _, f := range s.folders() {
+			if folderId != "" && f.Id != folderId {
+				continue
+			}
+			for _, w := range f.Worlds {
+				items = append(items, worldItem{Id: w.Id, FolderId: f.Id, Name: w.Name, LevelName: w.LevelName, Path: w.FullPath, Backups: len(w.Backups), LastBackup: w.LastBackupTime()})
+			}
+		}
+
+		s.print(items, func() {
+			fmt.Fprintln(table, "ID\tNAME\tPATH\tBACKUPS\tLAST BACKUP")
+			for _, w := range items {
+				name := w.Name
+				if w.LevelName != "" {
+					name = w.LevelName
+				}
+				fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%s\n", w.Id, name, w.Path, w.Backups, formatTime(w.LastBackup))
+			}
+		})
+
+	case "backups":
+		var worlds []*data.World
+		if ref, _ := cmd.Flags().GetString("world"); ref != "" {
+			worlds = []*data.World{s.findWorld(ref).World}
+		} else {
+			for _, f := range s.folders() {
+				worlds = append(worlds, f.Worlds...)
+			}
+		}
+
+		items := []backupItem{}
+		for _, w := range worlds {
+			for _, b := range w.Backups {
+				items = append(items, toBackupItem(w, b))
+			}
+		}
+
+		s.print(items, func() {
+			fmt.Fprintln(table, "ID\tWORLD\tCREATED\tNAME\tCOPIES")
+			for _, b := range items {
+				fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d\n", b.Id, b.World, formatTime(b.CreatedAt), b.Name, len(b.Copies))
+			}
+		})
+
+	default:
+		s.fail(exitUsage, fmt.Errorf("Can't list %s, only folders, worlds or backups", args[0]))
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	return t.Local().Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"world-backup/server/api"
+	"world-backup/server/data"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestListOnServer(t *testing.T) {
+	Convey("Given a running server", t, func() {
+		dir, _ := ioutil.TempDir("", "cli")
+		defer os.RemoveAll(dir)
+
+		var auths []string
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/folders", func(w http.ResponseWriter, r *http.Request) {
+			auths = append(auths, r.Header.Get("Authorization"))
+			if r.Header.Get("Authorization") != "Bearer t0k3n" {
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(api.ErrorResponse{Message: "Log in first"})
+				return
+			}
+			json.NewEncoder(w).Encode([]api.FolderListItem{{Id: "f1", Path: "/saves"}})
+		})
+		mux.HandleFunc("/api/folders/f1/worlds", func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode([]*data.World{{Id: "w1", Name: "survival", Backups: []*data.Backup{{Id: "b1", Name: "one.zip"}}}})
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+
+		Convey("When the backups are listed with its token", func() {
+			out, code := runCommand(dir, "list", "backups", "--server", server.URL, "--token", "t0k3n", "--json")
+
+			Convey("It should list the backups from its api", func() {
+				So(code, ShouldEqual, 0)
+				So(auths, ShouldResemble, []string{"Bearer t0k3n"})
+
+				var items []backupItem
+				So(json.Unmarshal([]byte(out), &items), ShouldBeNil)
+				So(len(items), ShouldEqual, 1)
+				So(items[0].Id, ShouldEqual, "b1")
+				So(items[0].World, ShouldEqual, "survival")
+			})
+		})
+
+		Convey("When they are listed without a token", func() {
+			out, code := runCommand(dir, "list", "backups", "--server", server.URL, "--json")
+
+			Convey("It should exit with the refused call's error", func() {
+				So(code, ShouldEqual, exitDenied)
+				So(out, ShouldContainSubstring, "Log in first")
+			})
+		})
+	})
+}
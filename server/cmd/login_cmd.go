@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var loginCmd = cobra.Command{
+	Use:   "login",
+	Short: "Log in to the server given by --server and print a token for the other commands",
+	Run:   login,
+}
+
+func init() {
+	loginCmd.Flags().String("name", "", "the user to log in as")
+	loginCmd.Flags().String("password", "", "the password of the user, read from stdin when not given")
+}
+
+type loginResult struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func login(cmd *cobra.Command, args []string) {
+	usage(cmd, args, 0)
+
+	s := openSession(cmd, false)
+	defer s.close()
+
+	if s.client == nil {
+		s.fail(exitUsage, errors.New("login needs the server to log in to, give it with --server"))
+	}
+
+	name, _ := cmd.Flags().GetString("name")
+	password, _ := cmd.Flags().GetString("password")
+	if password == "" {
+		if !jsonOutput(cmd) {
+			fmt.Fprint(os.Stderr, "Password: ")
+		}
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			s.fail(exitUsage, fmt.Errorf("Failed to read the password: %v", err))
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	token, expiresAt, err := s.client.Login(name, password)
+	if err != nil {
+		s.failRemote(err)
+	}
+
+	// the bare token, so it can go straight into WORLD_BACKUP_TOKEN
+	s.print(loginResult{Token: token, ExpiresAt: expiresAt}, func() {
+		fmt.Println(token)
+	})
+}
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"log"
+	"world-backup/server/audit"
+	"world-backup/server/auth"
 	"world-backup/server/conf"
 	"world-backup/server/data"
 
@@ -12,7 +14,11 @@ import (
 
 	"world-backup/server/watcher"
 
+	"world-backup/server/events"
 	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/storage"
+	"world-backup/server/throttle"
 
 	"github.com/spf13/afero"
 )
@@ -26,6 +32,10 @@ var rootCmd = cobra.Command{
 func RootCommand() *cobra.Command {
 	rootCmd.PersistentFlags().StringP("config", "c", "", "the config file to use")
 	rootCmd.Flags().IntP("port", "p", 0, "the port to use")
+	rootCmd.PersistentFlags().Bool("json", false, "print results as JSON")
+	rootCmd.PersistentFlags().String("server", "", "manage the server running at this url instead of the local catalog")
+	rootCmd.PersistentFlags().String("token", os.Getenv("WORLD_BACKUP_TOKEN"), "the token from login to call the server with")
+	rootCmd.AddCommand(&configCmd, &listCmd, &backupCmd, &restoreCmd, &deleteCmd, &pruneCmd, &verifyCmd, &exportCmd, &importCmd, &loginCmd)
 
 	return &rootCmd
 }
@@ -36,27 +46,100 @@ func run(cmd *cobra.Command, args []string) {
 		log.Fatal("Failed to load config: " + err.Error())
 	}
 
+	aferoFs := afero.Afero{Fs: afero.NewOsFs()}
+
+	if problems := config.Check(aferoFs); len(problems) > 0 {
+		log.Fatal("The config has problems:\n" + problems.Error())
+	}
+
 	logger, err := conf.ConfigureLogging(&config.LogConfig)
 	if err != nil {
 		log.Fatal("Failed to configure logging: " + err.Error())
 	}
 
-	aferoFs := afero.Afero{Fs: afero.NewOsFs()}
+	// held while the server runs, commands that change the catalog refuse
+	// to run until it stops
+	lock, err := data.LockCatalog(catalogName)
+	if err != nil {
+		log.Fatal("Failed to lock the catalog: " + err.Error())
+	}
+	defer lock.Unlock()
 
-	db, dbErr := data.Open("data.json", aferoFs)
+	db, dbErr := data.Open(catalogName, aferoFs)
 	if dbErr != nil {
 		log.Fatal("Failed to open the db: " + dbErr.Error())
 	}
 	db.Save()
 
+	limits, err := throttle.New(config.Throttle)
+	if err != nil {
+		log.Fatal("Failed to set up the throttle: " + err.Error())
+	}
+
 	fileSystem := fs.NewFs(aferoFs)
+	fileSystem.SetThrottle(limits)
+
+	destinations, err := storage.Open(config.Destinations)
+	if err != nil {
+		log.Fatal("Failed to set up the backup destinations: " + err.Error())
+	}
+
+	queue, err := storage.NewQueue(logger, config.Replication, fileSystem, db, destinations, config.BackupDir, limits.Upload())
+	if err != nil {
+		log.Fatal("Failed to set up copying backups: " + err.Error())
+	}
+
+	manager, err := jobs.NewManager(logger, config.Jobs)
+	if err != nil {
+		log.Fatal("Failed to set up jobs: " + err.Error())
+	}
 
-	w := watcher.NewWatcher(logger, config, fileSystem, db)
-	w.Start()
+	authenticator, err := auth.New(config.Auth)
+	if err != nil {
+		log.Fatal("Failed to set up logging in: " + err.Error())
+	}
+	if err := auth.Bootstrap(logger, db, config.Auth); err != nil {
+		log.Fatal("Failed to add the admin user: " + err.Error())
+	}
 
-	server := api.NewAPI(logger, config, db, fileSystem)
+	auditLog, err := audit.Open(aferoFs, config.Audit)
+	if err != nil {
+		log.Fatal("Failed to open the audit log: " + err.Error())
+	}
+
+	bus := events.NewBus(0)
+	manager.SetListener(bus)
+
+	w := watcher.NewWatcher(logger, config, fileSystem, db, destinations, queue, manager, bus, auditLog)
+	if err := w.Start(); err != nil {
+		log.Fatal("Failed to start watching: " + err.Error())
+	}
+	queue.Start()
+
+	reloader := conf.NewReloader(logger, config)
+
+	server := api.NewAPI(logger, config, db, fileSystem, destinations, queue, limits, manager, bus, authenticator, auditLog, reloader, w)
 	server.SetUpRoutes()
 
+	reloader.OnChange(conf.ReloadLogging)
+	reloader.OnChange(func(c *conf.Config) (func(), error) {
+		if err := w.CheckConfig(c); err != nil {
+			return nil, err
+		}
+
+		dests, err := storage.Open(c.Destinations)
+		if err != nil {
+			return nil, err
+		}
+
+		return func() {
+			queue.SetDestinations(dests)
+			w.Reload(c, dests)
+			server.Reload(c, dests)
+		}, nil
+	})
+	reloader.Watch()
+
 	logger.Infof("Starting up server on port %d", config.Port)
 	if err := server.Start(); err != nil {
 		logger.WithError(err).Error("Error while running server")
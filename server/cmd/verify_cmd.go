@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"world-backup/server/client"
+	"world-backup/server/crypt"
+	"world-backup/server/data"
+	"world-backup/server/jobs"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = cobra.Command{
+	Use:   "verify [backup-id]",
+	Short: "Read back every file in the backups to check they can be restored",
+	Run:   verify,
+}
+
+func init() {
+	verifyCmd.Flags().String("world", "", "only verify the backups of this world")
+}
+
+// The outcome of verifying a backup
+const (
+	verifyOk = "ok"
+
+	// verifyFailed backups are damaged, or have no file and no copies
+	verifyFailed = "failed"
+
+	// verifyRemote backups are only kept at destinations
+	verifyRemote = "remote"
+
+	// verifyNoKey backups are encrypted with keys that aren't configured
+	verifyNoKey = "no key"
+)
+
+type verifyItem struct {
+	backupItem
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+func verify(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		usage(cmd, args, 1)
+	}
+
+	s := openSession(cmd, false)
+	defer s.close()
+
+	type worldBackup struct {
+		folder *data.Folder
+		world  *data.World
+		backup *data.Backup
+	}
+
+	var backups []worldBackup
+	switch ref, _ := cmd.Flags().GetString("world"); {
+	case len(args) == 1:
+		f, w, b := s.findBackup(args[0])
+		backups = append(backups, worldBackup{f, w, b})
+	case ref != "":
+		fw := s.findWorld(ref)
+		for _, b := range fw.World.Backups {
+			backups = append(backups, worldBackup{fw.Folder, fw.World, b})
+		}
+	default:
+		for _, f := range s.folders() {
+			for _, w := range f.Worlds {
+				for _, b := range w.Backups {
+					backups = append(backups, worldBackup{f, w, b})
+				}
+			}
+		}
+	}
+
+	items := []verifyItem{}
+	failed := false
+	for _, wb := range backups {
+		item := verifyItem{backupItem: toBackupItem(wb.world, wb.backup), Result: verifyOk}
+		if s.client != nil {
+			verifyOnServer(s, wb.folder, wb.world, wb.backup, &item)
+			failed = failed || item.Result == verifyFailed
+			items = append(items, item)
+			continue
+		}
+
+		file := s.archiveFile(wb.backup)
+
+		exists, _ := s.fs.Exists(file.Path)
+		switch {
+		case !exists && len(wb.backup.Copies) > 0:
+			item.Result = verifyRemote
+		case !exists:
+			item.Result = verifyFailed
+			item.Error = "the file is gone and there are no copies of it"
+		case file.Encrypted && file.Keys == nil:
+			item.Result = verifyNoKey
+		default:
+			if err := s.fs.VerifyArchive(file); err != nil {
+				item.Result = verifyFailed
+				item.Error = err.Error()
+			}
+		}
+
+		failed = failed || item.Result == verifyFailed
+		items = append(items, item)
+	}
+
+	s.print(items, func() {
+		table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "ID\tWORLD\tNAME\tRESULT")
+		for _, b := range items {
+			result := b.Result
+			if b.Error != "" {
+				result += ": " + b.Error
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", b.Id, b.World, b.Name, result)
+		}
+		table.Flush()
+	})
+
+	if failed {
+		exit(exitFailed)
+	}
+}
+
+// verifyOnServer has the server verify the backup, and waits for it
+func verifyOnServer(s *session, folder *data.Folder, world *data.World, backup *data.Backup, item *verifyItem) {
+	job, err := s.client.Verify(folder.Id, world.Id, backup.Id)
+	if e, ok := err.(*client.Error); ok && e.Status == http.StatusForbidden && e.Message == crypt.NoKeyError.Error() {
+		item.Result = verifyNoKey
+		return
+	}
+	if err != nil {
+		s.failRemote(err)
+	}
+
+	if job = s.follow(job); job.State != jobs.Done {
+		item.Result = verifyFailed
+		item.Error = job.Error
+	}
+}
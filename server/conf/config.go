@@ -2,6 +2,17 @@ package conf
 
 import (
 	"os"
+	"path/filepath"
+	"time"
+
+	"world-backup/server/audit"
+	"world-backup/server/auth"
+	"world-backup/server/crypt"
+	"world-backup/server/filter"
+	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/storage"
+	"world-backup/server/throttle"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -9,12 +20,206 @@ import (
 
 // Config the application's configuration
 type Config struct {
-	Port          int64         `json:"port"`
-	WatchDirs     []string      `json:"watchDirs"`
-	BackupDir     string        `json:"backupDir"`
-	CheckInterval string        `json:"checkInterval"`
-	LogConfig     LoggingConfig `json:"log"`
-	StaticRoot    string        `json:"staticRoot"`
+	Port          int64               `json:"port"`
+	WatchDirs     []string            `json:"watchDirs"`
+	BackupDir     string              `json:"backupDir"`
+	CheckInterval string              `json:"checkInterval"`
+	LogConfig     LoggingConfig       `json:"log" mapstructure:"log"`
+	StaticRoot    string              `json:"staticRoot"`
+	Rules         filter.Rules        `json:"rules"`
+	Folders       []FolderConfig      `json:"folders"`
+	Archive       fs.ArchiveOptions   `json:"archive"`
+	Destinations  []storage.Config    `json:"destinations"`
+	Replication   storage.QueueConfig `json:"replication"`
+	Throttle      throttle.Config     `json:"throttle"`
+	Jobs          jobs.Config         `json:"jobs"`
+	Auth          auth.Config         `json:"auth"`
+	Cors          CorsConfig          `json:"cors"`
+	Audit         audit.Config        `json:"audit"`
+	Health        HealthConfig        `json:"health"`
+	Metrics       MetricsConfig       `json:"metrics"`
+}
+
+// CorsConfig holds the other sites allowed to use the api, like the client
+// while it is being worked on. Without any only the client served by the
+// server can.
+type CorsConfig struct {
+	AllowOrigins []string `json:"allowOrigins"`
+}
+
+// HealthConfig is what the server needs to be ready to back worlds up
+type HealthConfig struct {
+	// MinFreeSpace in megabytes where backups are written
+	MinFreeSpace int `json:"minFreeSpace"`
+}
+
+const defaultMinFreeSpace = 512
+
+// MinFreeBytes is the space that has to be left for the server to be ready
+func (h HealthConfig) MinFreeBytes() uint64 {
+	if h.MinFreeSpace == 0 {
+		return defaultMinFreeSpace * 1024 * 1024
+	}
+
+	return uint64(h.MinFreeSpace) * 1024 * 1024
+}
+
+// MetricsConfig is what /metrics shows. It needs no login, so the backup
+// metrics are added up over every world unless PerWorld is set.
+type MetricsConfig struct {
+	// PerWorld labels the backup metrics with the folder and world ids
+	PerWorld bool `json:"perWorld"`
+}
+
+// FolderConfig holds the settings for one of the WatchDirs
+type FolderConfig struct {
+	Path       string        `json:"path"`
+	Rules      filter.Rules  `json:"rules"`
+	Worlds     []WorldConfig `json:"worlds"`
+	Encryption *crypt.Config `json:"encryption"`
+	Schedules  []Schedule    `json:"schedules"`
+}
+
+// WorldConfig holds the settings for a single world, by folder name
+type WorldConfig struct {
+	Name      string       `json:"name"`
+	Rules     filter.Rules `json:"rules"`
+	Schedules []Schedule   `json:"schedules"`
+}
+
+// Schedule is when a world is backed up, either every interval like "10m"
+// or by a cron expression like "0 3 * * 0". Worlds are only backed up when
+// they changed unless OnlyIfChanged is false, and not during quiet hours.
+type Schedule struct {
+	Every         string      `json:"every"`
+	Cron          string      `json:"cron"`
+	OnlyIfChanged *bool       `json:"onlyIfChanged"`
+	QuietHours    *QuietHours `json:"quietHours"`
+}
+
+// QuietHours is a time of day, in "15:04" form, when no backups are made.
+// It wraps around midnight when From is after To.
+type QuietHours struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Forced is true when the world is backed up even if it didn't change
+func (s Schedule) Forced() bool {
+	return s.OnlyIfChanged != nil && !*s.OnlyIfChanged
+}
+
+// Folder returns the settings for a watched folder, or nil if there are none
+func (c *Config) Folder(path string) *FolderConfig {
+	for i := range c.Folders {
+		if c.Folders[i].Path == path {
+			return &c.Folders[i]
+		}
+	}
+
+	return nil
+}
+
+// World returns the settings for a world in the folder, or nil if there are none
+func (f *FolderConfig) World(name string) *WorldConfig {
+	if f == nil {
+		return nil
+	}
+
+	for i := range f.Worlds {
+		if f.Worlds[i].Name == name {
+			return &f.Worlds[i]
+		}
+	}
+
+	return nil
+}
+
+// RulesFor merges the global, folder and world backup rules for a world
+func (c *Config) RulesFor(folderPath, worldName string) filter.Rules {
+	sets := []filter.Rules{c.Rules}
+
+	if f := c.Folder(folderPath); f != nil {
+		sets = append(sets, f.Rules)
+
+		if w := f.World(worldName); w != nil {
+			sets = append(sets, w.Rules)
+		}
+	}
+
+	return filter.Merge(sets...)
+}
+
+// SchedulesFor is when a world is backed up. The world's schedules replace
+// the folder's, which replace checking for changes every CheckInterval.
+func (c *Config) SchedulesFor(folderPath, worldName string) []Schedule {
+	f := c.Folder(folderPath)
+	if w := f.World(worldName); w != nil && len(w.Schedules) > 0 {
+		return w.Schedules
+	}
+	if f != nil && len(f.Schedules) > 0 {
+		return f.Schedules
+	}
+
+	return []Schedule{{Every: c.CheckInterval}}
+}
+
+// PruneWindowFor is how close together a world that keeps changing is
+// backed up, the shortest of its intervals that only back up if it changed.
+// Of backups made within it only the last is kept. Cron and forced schedules
+// don't make backups to prune, without others it is zero.
+func (c *Config) PruneWindowFor(folderPath, worldName string) time.Duration {
+	var window time.Duration
+	for _, s := range c.SchedulesFor(folderPath, worldName) {
+		every, err := time.ParseDuration(s.Every)
+		if s.Forced() || err != nil || every <= 0 {
+			continue
+		}
+		if window == 0 || every < window {
+			window = every
+		}
+	}
+	if window == 0 {
+		return 0
+	}
+
+	return window + 2*time.Second
+}
+
+// ArchiveFor is how backups of worlds in the folder are written, the folder
+// encryption replaces the global one
+func (c *Config) ArchiveFor(folderPath string) fs.ArchiveOptions {
+	opts := c.Archive
+
+	if f := c.Folder(folderPath); f != nil && f.Encryption != nil {
+		opts.Encryption = f.Encryption
+	}
+
+	if !opts.Encryption.Enabled() {
+		opts.Encryption = nil
+	}
+
+	return opts
+}
+
+// Keys returns the configured encryption with the given id, nil when the
+// key is not known here
+func (c *Config) Keys(keyId string) *crypt.Config {
+	if keyId == "" {
+		return nil
+	}
+
+	if c.Archive.Encryption.Id() == keyId {
+		return c.Archive.Encryption
+	}
+
+	for i := range c.Folders {
+		if c.Folders[i].Encryption.Id() == keyId {
+			return c.Folders[i].Encryption
+		}
+	}
+
+	return nil
 }
 
 // LoadConfig loads the config from a file if specified, otherwise from the environment
@@ -32,6 +237,11 @@ func LoadConfig(cmd *cobra.Command) (*Config, error) {
 		viper.AddConfigPath("./")
 	}
 
+	return readConfig()
+}
+
+// readConfig reads the config file viper was set up with
+var readConfig = func() (*Config, error) {
 	if err := viper.ReadInConfig(); err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
@@ -45,14 +255,44 @@ func LoadConfig(cmd *cobra.Command) (*Config, error) {
 }
 
 func cleanConfig(c *Config) *Config {
-	c.BackupDir = os.ExpandEnv(c.BackupDir)
+	c.BackupDir = expand(c.BackupDir)
 
 	var paths []string
 	for i := range c.WatchDirs {
-		paths = append(paths, os.ExpandEnv(c.WatchDirs[i]))
+		paths = append(paths, cleanPath(expand(c.WatchDirs[i])))
 	}
 
 	c.WatchDirs = paths
 
+	for i := range c.Folders {
+		c.Folders[i].Path = cleanPath(expand(c.Folders[i].Path))
+	}
+
+	if c.Archive.Format == "" {
+		c.Archive.Format = fs.Zip
+	}
+
 	return c
 }
+
+// cleanPath cleans up a folder path the way the catalog keeps it, so the
+// folders of the config can be compared with it as they are
+func cleanPath(p string) string {
+	if p == "" {
+		return ""
+	}
+
+	return filepath.Clean(p)
+}
+
+// expand replaces the environment variables in a path. Variables that
+// aren't set are left as ${NAME} so Validate can point them out.
+func expand(s string) string {
+	return os.Expand(s, func(name string) string {
+		if v, ok := os.LookupEnv(name); ok {
+			return v
+		}
+
+		return "${" + name + "}"
+	})
+}
@@ -0,0 +1,211 @@
+package conf
+
+import (
+	"testing"
+	"time"
+
+	"world-backup/server/crypt"
+	"world-backup/server/filter"
+	"world-backup/server/fs"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfig_RulesFor(t *testing.T) {
+	Convey("Given a config with global, folder and world rules", t, func() {
+		c := Config{
+			Rules: filter.Rules{Exclude: []string{"session.lock"}},
+			Folders: []FolderConfig{
+				{
+					Path:  "/saves",
+					Rules: filter.Rules{Exclude: []string{"logs/"}},
+					Worlds: []WorldConfig{
+						{Name: "Big Server", Rules: filter.Rules{Include: []string{"region/"}}},
+					},
+				},
+			},
+		}
+
+		Convey("It should merge all three for a configured world", func() {
+			r := c.RulesFor("/saves", "Big Server")
+
+			So(r.Include, ShouldResemble, []string{"region/"})
+			So(r.Exclude, ShouldResemble, []string{"session.lock", "logs/"})
+		})
+
+		Convey("It should use the folder rules for other worlds", func() {
+			r := c.RulesFor("/saves", "Other")
+
+			So(r.Include, ShouldBeEmpty)
+			So(r.Exclude, ShouldResemble, []string{"session.lock", "logs/"})
+		})
+
+		Convey("It should only use the global rules for other folders", func() {
+			r := c.RulesFor("/elsewhere", "Big Server")
+
+			So(r.Exclude, ShouldResemble, []string{"session.lock"})
+		})
+	})
+}
+
+func TestCleanConfig(t *testing.T) {
+	Convey("Given a config without an archive format", t, func() {
+		c := cleanConfig(&Config{Archive: fs.ArchiveOptions{Level: 5}})
+
+		Convey("It should default to zip and keep the level", func() {
+			So(c.Archive.Format, ShouldEqual, fs.Zip)
+			So(c.Archive.Level, ShouldEqual, 5)
+		})
+	})
+
+	Convey("Given a config with untidy folder paths", t, func() {
+		c := cleanConfig(&Config{WatchDirs: []string{"/saves/main/", "/saves//extra", ""}, Folders: []FolderConfig{{Path: "/saves/main/"}}})
+
+		Convey("It should clean them up like the catalog does", func() {
+			So(c.WatchDirs, ShouldResemble, []string{"/saves/main", "/saves/extra", ""})
+			So(c.Folders[0].Path, ShouldEqual, "/saves/main")
+		})
+	})
+}
+
+func TestConfig_ArchiveFor(t *testing.T) {
+	Convey("Given a config with global and folder encryption", t, func() {
+		nas := &crypt.Config{KeyId: "nas", Recipients: []string{"age1nas"}}
+		c := Config{
+			Archive: fs.ArchiveOptions{Format: fs.TarZst, Level: 3, Encryption: &crypt.Config{Passphrase: "global"}},
+			Folders: []FolderConfig{
+				{Path: "/servers", Encryption: nas},
+				{Path: "/plain", Encryption: &crypt.Config{}},
+			},
+		}
+
+		Convey("It should use the folder key for its worlds", func() {
+			opts := c.ArchiveFor("/servers")
+
+			So(opts.Format, ShouldEqual, fs.TarZst)
+			So(opts.Encryption, ShouldEqual, nas)
+			So(opts.Extension(), ShouldEqual, ".tar.zst.age")
+		})
+
+		Convey("It should use the global key for other folders", func() {
+			So(c.ArchiveFor("/saves").Encryption.Passphrase, ShouldEqual, "global")
+		})
+
+		Convey("It should let a folder turn encryption off", func() {
+			opts := c.ArchiveFor("/plain")
+
+			So(opts.Encryption, ShouldBeNil)
+			So(opts.Extension(), ShouldEqual, ".tar.zst")
+		})
+
+		Convey("It should find keys by id", func() {
+			So(c.Keys("nas"), ShouldEqual, nas)
+			So(c.Keys("passphrase").Passphrase, ShouldEqual, "global")
+			So(c.Keys("other"), ShouldBeNil)
+			So(c.Keys(""), ShouldBeNil)
+		})
+	})
+}
+
+func TestConfig_Keys(t *testing.T) {
+	Convey("Given two folders with different passphrases", t, func() {
+		c := Config{
+			Port:          3030,
+			BackupDir:     "/backups",
+			CheckInterval: "1m",
+			Archive:       fs.ArchiveOptions{Encryption: &crypt.Config{Passphrase: "global"}},
+			Folders: []FolderConfig{
+				{Path: "/survival", Encryption: &crypt.Config{Passphrase: "first"}},
+				{Path: "/creative", Encryption: &crypt.Config{Passphrase: "second"}},
+			},
+		}
+
+		Convey("When they don't have key ids", func() {
+			Convey("It should be refused, their backups couldn't be told apart", func() {
+				problems := c.Validate().(Problems)
+
+				So(len(problems), ShouldEqual, 2)
+				So(problems[0].Field, ShouldEqual, "folders[0].encryption.keyId")
+				So(problems[1].Field, ShouldEqual, "folders[1].encryption.keyId")
+			})
+		})
+
+		Convey("When each has its own key id", func() {
+			c.Folders[0].Encryption.KeyId = "survival"
+			c.Folders[1].Encryption.KeyId = "creative"
+
+			Convey("It should decrypt the backups of each folder with its own passphrase", func() {
+				So(c.Validate(), ShouldBeNil)
+
+				So(c.Keys(c.ArchiveFor("/survival").Encryption.Id()).Passphrase, ShouldEqual, "first")
+				So(c.Keys(c.ArchiveFor("/creative").Encryption.Id()).Passphrase, ShouldEqual, "second")
+				So(c.Keys(c.ArchiveFor("/saves").Encryption.Id()).Passphrase, ShouldEqual, "global")
+			})
+		})
+
+		Convey("When they share the global passphrase", func() {
+			c.Folders[0].Encryption.Passphrase = "global"
+			c.Folders[1].Encryption = nil
+
+			Convey("It should be fine, it is the same key", func() {
+				So(c.Validate(), ShouldBeNil)
+			})
+		})
+
+		Convey("When a folder has recipients along with its passphrase", func() {
+			c.Archive.Encryption = nil
+			c.Folders[1].Encryption = nil
+			c.Folders[0].Encryption.Recipients = []string{testRecipient}
+
+			Convey("It should be refused", func() {
+				problems := c.Validate().(Problems)
+
+				So(len(problems), ShouldEqual, 1)
+				So(problems[0].Field, ShouldEqual, "folders[0].encryption")
+			})
+		})
+	})
+}
+
+func TestConfig_SchedulesFor(t *testing.T) {
+	Convey("Given a config with folder and world schedules", t, func() {
+		c := Config{
+			CheckInterval: "1m",
+			Folders: []FolderConfig{
+				{
+					Path:      "/saves",
+					Schedules: []Schedule{{Every: "1h"}},
+					Worlds: []WorldConfig{
+						{Name: "Server", Schedules: []Schedule{{Every: "10m"}, {Cron: "0 3 * * 0"}}},
+						{Name: "Creative"},
+					},
+				},
+			},
+		}
+
+		Convey("It should use the world's schedules first", func() {
+			So(c.SchedulesFor("/saves", "Server"), ShouldResemble, []Schedule{{Every: "10m"}, {Cron: "0 3 * * 0"}})
+		})
+
+		Convey("It should use the folder's for other worlds", func() {
+			So(c.SchedulesFor("/saves", "Creative"), ShouldResemble, []Schedule{{Every: "1h"}})
+		})
+
+		Convey("It should check every interval in other folders", func() {
+			So(c.SchedulesFor("/elsewhere", "Server"), ShouldResemble, []Schedule{{Every: "1m"}})
+		})
+
+		Convey("It should prune backups made within the world's own interval", func() {
+			So(c.PruneWindowFor("/saves", "Server"), ShouldEqual, 10*time.Minute+2*time.Second)
+			So(c.PruneWindowFor("/saves", "Creative"), ShouldEqual, time.Hour+2*time.Second)
+			So(c.PruneWindowFor("/elsewhere", "Server"), ShouldEqual, time.Minute+2*time.Second)
+		})
+
+		Convey("It should not prune backups of worlds only backed up on cron or forced schedules", func() {
+			no := false
+			c.Folders[0].Schedules = []Schedule{{Cron: "0 3 * * 0"}, {Every: "1h", OnlyIfChanged: &no}}
+
+			So(c.PruneWindowFor("/saves", "Creative"), ShouldEqual, 0)
+		})
+	})
+}
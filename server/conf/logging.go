@@ -1,17 +1,32 @@
 package conf
 
 import (
-	"bufio"
+	"fmt"
 	"os"
 	"strings"
 
 	"github.com/Sirupsen/logrus"
 )
 
+// Log formats
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
 // LoggingConfig specifies all the parameters needed for logging
 type LoggingConfig struct {
 	Level string `json:"level"`
 	File  string `json:"file"`
+
+	// Format is text, the default, or json for one JSON object per line
+	Format string `json:"format"`
+
+	// Components sets the level of parts of the server by the component
+	// they log with, like {"watcher": "debug"}. Level is used for the rest.
+	Components map[string]string `json:"components"`
+
+	Rotate RotateConfig `json:"rotate"`
 }
 
 // ConfigureLogging will take the logging configuration and also adds
@@ -22,28 +37,111 @@ func ConfigureLogging(config *LoggingConfig) (*logrus.Entry, error) {
 		return nil, err
 	}
 
-	// use a file if you want
-	if config.File != "" {
-		f, errOpen := os.OpenFile(config.File, os.O_RDWR|os.O_APPEND, 0660)
-		if errOpen != nil {
-			return nil, errOpen
-		}
-		logrus.SetOutput(bufio.NewWriter(f))
+	formatter, level, err := config.formatter()
+	if err != nil {
+		return nil, err
 	}
 
-	if config.Level != "" {
-		level, err := logrus.ParseLevel(strings.ToUpper(config.Level))
+	// use a file if you want, lines are written as they are logged
+	if config.File != "" {
+		f, err := openRotatingFile(config.File, config.Rotate)
 		if err != nil {
 			return nil, err
 		}
-		logrus.SetLevel(level)
+		logrus.SetOutput(f)
 	}
 
-	// always use the fulltimestamp
-	logrus.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp:    true,
-		DisableTimestamp: false,
-	})
+	logrus.SetLevel(level)
+	logrus.SetFormatter(formatter)
 
 	return logrus.StandardLogger().WithField("hostname", hostname), nil
 }
+
+// ReloadLogging changes the levels and format to the ones in a reloaded
+// config
+func ReloadLogging(c *Config) (func(), error) {
+	formatter, level, err := c.LogConfig.formatter()
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		logrus.SetLevel(level)
+		logrus.SetFormatter(formatter)
+	}, nil
+}
+
+// formatter builds the formatter for the config, along with the level the
+// logger has to be at for the lines of the most detailed component to
+// reach it
+func (c *LoggingConfig) formatter() (logrus.Formatter, logrus.Level, error) {
+	var formatter logrus.Formatter
+	switch c.Format {
+	case "", TextFormat:
+		// always use the fulltimestamp
+		formatter = &logrus.TextFormatter{
+			FullTimestamp:    true,
+			DisableTimestamp: false,
+		}
+	case JSONFormat:
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return nil, 0, fmt.Errorf("%q is not a log format, use text or json", c.Format)
+	}
+
+	filter := &levelFilter{formatter: formatter, level: logrus.InfoLevel, components: map[string]logrus.Level{}}
+	if c.Level != "" {
+		level, err := parseLevel(c.Level)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter.level = level
+	}
+
+	max := filter.level
+	for component, l := range c.Components {
+		level, err := parseLevel(l)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter.components[component] = level
+
+		if level > max {
+			max = level
+		}
+	}
+
+	if len(filter.components) == 0 {
+		return formatter, max, nil
+	}
+
+	return filter, max, nil
+}
+
+func parseLevel(level string) (logrus.Level, error) {
+	return logrus.ParseLevel(strings.ToUpper(level))
+}
+
+// levelFilter drops the lines that are more detailed than the level of
+// their component
+type levelFilter struct {
+	formatter  logrus.Formatter
+	level      logrus.Level
+	components map[string]logrus.Level
+}
+
+func (f *levelFilter) Format(e *logrus.Entry) ([]byte, error) {
+	level := f.level
+	if component, ok := e.Data["component"].(string); ok {
+		if l, ok := f.components[component]; ok {
+			level = l
+		}
+	}
+
+	// nothing is written for lines that are empty
+	if e.Level > level {
+		return nil, nil
+	}
+
+	return f.formatter.Format(e)
+}
@@ -0,0 +1,138 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogging_File(t *testing.T) {
+	Convey("Given a log file that isn't there", t, func() {
+		dir, _ := ioutil.TempDir("", "logging")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "server.log")
+
+		Convey("When it is opened and written to", func() {
+			f, err := openRotatingFile(path, RotateConfig{})
+			So(err, ShouldBeNil)
+			defer f.file.Close()
+
+			f.Write([]byte("started\n"))
+
+			Convey("It should be created with the line in it", func() {
+				content, err := ioutil.ReadFile(path)
+				So(err, ShouldBeNil)
+				So(string(content), ShouldEqual, "started\n")
+			})
+		})
+
+		Convey("When it grows past its size", func() {
+			oldGetNow := getNow
+			defer func() { getNow = oldGetNow }()
+			now := time.Date(2017, 5, 1, 10, 0, 0, 0, time.Local)
+			getNow = func() time.Time {
+				now = now.Add(time.Minute)
+				return now
+			}
+
+			f, err := openRotatingFile(path, RotateConfig{MaxSize: 1, MaxFiles: 2})
+			So(err, ShouldBeNil)
+			defer f.file.Close()
+
+			line := bytes.Repeat([]byte("x"), 600*1024)
+			for i := 0; i < 4; i++ {
+				f.Write(line)
+			}
+
+			Convey("It should be rotated, keeping only the newest files", func() {
+				rotated := f.rotated()
+				So(len(rotated), ShouldEqual, 2)
+				So(filepath.Base(rotated[0].path), ShouldEqual, "server-20170501T100400.000.log")
+				So(filepath.Base(rotated[1].path), ShouldEqual, "server-20170501T100600.000.log")
+
+				info, _ := os.Stat(path)
+				So(info.Size(), ShouldEqual, len(line))
+			})
+		})
+
+		Convey("When it is older than its age", func() {
+			oldGetNow := getNow
+			defer func() { getNow = oldGetNow }()
+			now := time.Date(2017, 5, 1, 10, 0, 0, 0, time.Local)
+			getNow = func() time.Time { return now }
+
+			f, _ := openRotatingFile(path, RotateConfig{MaxAge: "1h", KeepFor: "2h"})
+			defer f.file.Close()
+
+			f.Write([]byte("first\n"))
+			now = now.Add(time.Hour)
+			f.Write([]byte("second\n"))
+			now = now.Add(3 * time.Hour)
+			f.Write([]byte("third\n"))
+
+			Convey("It should be rotated, removing the ones kept long enough", func() {
+				rotated := f.rotated()
+				So(len(rotated), ShouldEqual, 1)
+				So(filepath.Base(rotated[0].path), ShouldEqual, "server-20170501T140000.000.log")
+
+				content, _ := ioutil.ReadFile(path)
+				So(string(content), ShouldEqual, "third\n")
+			})
+		})
+	})
+}
+
+func TestLogging_Formatter(t *testing.T) {
+	Convey("Given a logger", t, func() {
+		var out bytes.Buffer
+		logger := logrus.New()
+		logger.Out = &out
+
+		use := func(c LoggingConfig) {
+			formatter, level, err := c.formatter()
+			So(err, ShouldBeNil)
+			logger.Formatter = formatter
+			logger.Level = level
+		}
+
+		Convey("When the format is json", func() {
+			use(LoggingConfig{Format: JSONFormat})
+			logger.WithField("component", "watcher").Info("changed")
+
+			Convey("It should write a JSON object per line", func() {
+				var line map[string]interface{}
+				So(json.Unmarshal(out.Bytes(), &line), ShouldBeNil)
+				So(line["msg"], ShouldEqual, "changed")
+				So(line["component"], ShouldEqual, "watcher")
+			})
+		})
+
+		Convey("When a component has its own level", func() {
+			use(LoggingConfig{Level: "warning", Components: map[string]string{"watcher": "debug"}})
+			logger.WithField("component", "watcher").Debug("from the watcher")
+			logger.WithField("component", "scheduler").Info("from the scheduler")
+			logger.Warn("from the rest")
+
+			Convey("It should only write the lines at their component's level", func() {
+				So(out.String(), ShouldContainSubstring, "from the watcher")
+				So(out.String(), ShouldNotContainSubstring, "from the scheduler")
+				So(out.String(), ShouldContainSubstring, "from the rest")
+			})
+		})
+
+		Convey("When the format is unknown", func() {
+			_, _, err := (&LoggingConfig{Format: "xml"}).formatter()
+
+			Convey("It should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,146 @@
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// Change checks a new config and returns how to apply it. Every change is
+// checked before any is applied, so a config one of them rejects changes
+// nothing.
+type Change func(c *Config) (apply func(), err error)
+
+// ReloadResult is what a reload changed. The settings in RestartNeeded
+// were changed in the file but keep their old values until a restart.
+type ReloadResult struct {
+	Applied       bool     `json:"applied"`
+	RestartNeeded []string `json:"restartNeeded"`
+}
+
+// restartOnly are the settings the running server can't change
+var restartOnly = []string{"Port", "BackupDir", "StaticRoot", "Auth", "Cors", "Jobs", "Throttle", "Replication", "Audit"}
+
+// Reloader swaps in a new config when the file changes or when asked,
+// handing it to the parts of the server that can change while running
+type Reloader struct {
+	log *logrus.Entry
+
+	mu      sync.Mutex
+	current *Config
+	changes []Change
+}
+
+// NewReloader starts from the config the server was started with
+func NewReloader(log *logrus.Entry, c *Config) *Reloader {
+	return &Reloader{
+		log:     log.WithField("component", "config"),
+		current: c,
+	}
+}
+
+// OnChange adds a part of the server to hand new configs to
+func (r *Reloader) OnChange(fn Change) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.changes = append(r.changes, fn)
+}
+
+// Current is the config in use
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.current
+}
+
+// Reload reads the config file again and applies it
+func (r *Reloader) Reload() (*ReloadResult, error) {
+	next, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.Apply(next)
+}
+
+// Apply validates the config and swaps it in. Settings that need a restart
+// keep their running values and are listed in the result.
+func (r *Reloader) Apply(next *Config) (*ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+
+	result := ReloadResult{Applied: true, RestartNeeded: keepRunning(r.current, next)}
+
+	var applies []func()
+	for _, change := range r.changes {
+		apply, err := change(next)
+		if err != nil {
+			return nil, err
+		}
+		if apply != nil {
+			applies = append(applies, apply)
+		}
+	}
+
+	for _, apply := range applies {
+		apply()
+	}
+
+	r.current = next
+	return &result, nil
+}
+
+// Watch reloads the config whenever the file is saved, a config that can't
+// be used is logged and the running one kept
+func (r *Reloader) Watch() {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		result, err := r.Reload()
+		if err != nil {
+			r.log.Errorf("Kept the running config, %s can't be used: %v", e.Name, err)
+			return
+		}
+
+		r.log.Infof("Reloaded the config from %s", e.Name)
+		if len(result.RestartNeeded) > 0 {
+			r.log.Warnf("Restart to change %s", strings.Join(result.RestartNeeded, ", "))
+		}
+	})
+	viper.WatchConfig()
+}
+
+// keepRunning copies the settings that need a restart from the running
+// config to the next, returning the names of the ones that were changed
+func keepRunning(running, next *Config) []string {
+	changed := []string{}
+
+	from := reflect.ValueOf(running).Elem()
+	to := reflect.ValueOf(next).Elem()
+	for _, name := range restartOnly {
+		field, _ := from.Type().FieldByName(name)
+		if !reflect.DeepEqual(from.FieldByName(name).Interface(), to.FieldByName(name).Interface()) {
+			changed = append(changed, field.Tag.Get("json"))
+			to.FieldByName(name).Set(from.FieldByName(name))
+		}
+	}
+
+	if next.LogConfig.File != running.LogConfig.File {
+		changed = append(changed, "log.file")
+		next.LogConfig.File = running.LogConfig.File
+	}
+	if !reflect.DeepEqual(next.LogConfig.Rotate, running.LogConfig.Rotate) {
+		changed = append(changed, "log.rotate")
+		next.LogConfig.Rotate = running.LogConfig.Rotate
+	}
+
+	return changed
+}
@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReloader(t *testing.T) {
+	Convey("Given a reloader for a running config", t, func() {
+		running := &Config{Port: 3030, BackupDir: "/backups", CheckInterval: "1m", WatchDirs: []string{"/saves"}}
+		r := NewReloader(logrus.WithField("test", "TestReloader"), running)
+
+		var applied []*Config
+		r.OnChange(func(c *Config) (func(), error) {
+			return func() { applied = append(applied, c) }, nil
+		})
+
+		Convey("When the file has a new config", func() {
+			oldReadConfig := readConfig
+			defer func() { readConfig = oldReadConfig }()
+			readConfig = func() (*Config, error) {
+				return &Config{Port: 8080, BackupDir: "/backups", CheckInterval: "5m", WatchDirs: []string{"/saves", "/server"}}, nil
+			}
+
+			result, err := r.Reload()
+
+			Convey("It should apply it, keeping what needs a restart", func() {
+				So(err, ShouldBeNil)
+				So(result.Applied, ShouldBeTrue)
+				So(result.RestartNeeded, ShouldResemble, []string{"port"})
+
+				So(len(applied), ShouldEqual, 1)
+				So(r.Current(), ShouldEqual, applied[0])
+				So(r.Current().CheckInterval, ShouldEqual, "5m")
+				So(r.Current().WatchDirs, ShouldResemble, []string{"/saves", "/server"})
+				So(r.Current().Port, ShouldEqual, 3030)
+			})
+		})
+
+		Convey("When the new config is not valid", func() {
+			_, err := r.Apply(&Config{BackupDir: "/backups", CheckInterval: "often"})
+
+			Convey("It should keep the running one", func() {
+				So(err, ShouldNotBeNil)
+				So(applied, ShouldBeEmpty)
+				So(r.Current(), ShouldEqual, running)
+			})
+		})
+
+		Convey("When a part of the server can't use it", func() {
+			r.OnChange(func(c *Config) (func(), error) {
+				return nil, errors.New("Unknown destination type [ftp]")
+			})
+
+			_, err := r.Apply(&Config{Port: 3030, BackupDir: "/backups", CheckInterval: "5m"})
+
+			Convey("It should not apply it anywhere", func() {
+				So(err, ShouldNotBeNil)
+				So(applied, ShouldBeEmpty)
+				So(r.Current(), ShouldEqual, running)
+			})
+		})
+	})
+}
@@ -0,0 +1,184 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var getNow = time.Now
+
+// rotatedTime is how rotated log files are told apart, it is put between
+// the name and the extension of the log file
+const rotatedTime = "20060102T150405.000"
+
+// RotateConfig is when the log file is started over. Rotated files are kept
+// next to it with the time they were rotated in their name, until there are
+// more than MaxFiles of them or they are older than KeepFor.
+type RotateConfig struct {
+	// MaxSize in megabytes, MaxAge like "24h"
+	MaxSize int    `json:"maxSize"`
+	MaxAge  string `json:"maxAge"`
+
+	MaxFiles int    `json:"maxFiles"`
+	KeepFor  string `json:"keepFor"`
+}
+
+// rotatingFile is a log file that is rotated as it is written
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	maxKeep int
+	keepFor time.Duration
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time
+}
+
+// openRotatingFile opens the log file, creating it when it isn't there
+func openRotatingFile(path string, c RotateConfig) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:    path,
+		maxSize: int64(c.MaxSize) * 1024 * 1024,
+		maxKeep: c.MaxFiles,
+	}
+
+	// checked when the config was validated
+	r.maxAge, _ = parseOptionalDuration(c.MaxAge)
+	r.keepFor, _ = parseOptionalDuration(c.KeepFor)
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func parseOptionalDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file = f
+	r.size = info.Size()
+
+	// the file was started when the one before it was rotated
+	r.started = getNow()
+	if rotated := r.rotated(); len(rotated) > 0 && r.size > 0 {
+		r.started = rotated[len(rotated)-1].at
+	}
+
+	return nil
+}
+
+// Write writes the line to the log file, rotating it first when it is due.
+// When rotating fails the line still goes to the file it has.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	// lines filtered out by their component's level come through empty
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.due(len(p)) {
+		r.rotate()
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) due(n int) bool {
+	if r.size == 0 {
+		return false
+	}
+
+	return (r.maxSize > 0 && r.size+int64(n) > r.maxSize) ||
+		(r.maxAge > 0 && getNow().Sub(r.started) >= r.maxAge)
+}
+
+func (r *rotatingFile) rotate() error {
+	now := getNow()
+	ext := filepath.Ext(r.path)
+	name := strings.TrimSuffix(r.path, ext) + "-" + now.Format(rotatedTime) + ext
+
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	err := os.Rename(r.path, name)
+
+	// reopened whether it was moved or not, so logging goes on
+	if oErr := r.open(); oErr != nil {
+		return oErr
+	}
+	if err != nil {
+		return err
+	}
+	r.started = now
+
+	r.prune()
+	return nil
+}
+
+type rotatedFile struct {
+	path string
+	at   time.Time
+}
+
+// rotated are the rotated log files, oldest first
+func (r *rotatingFile) rotated() []rotatedFile {
+	ext := filepath.Ext(r.path)
+	prefix := strings.TrimSuffix(r.path, ext) + "-"
+
+	matches, _ := filepath.Glob(prefix + "*" + ext)
+
+	var files []rotatedFile
+	for _, m := range matches {
+		at, err := time.ParseInLocation(rotatedTime, strings.TrimSuffix(strings.TrimPrefix(m, prefix), ext), time.Local)
+		if err == nil {
+			files = append(files, rotatedFile{path: m, at: at})
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].at.Before(files[j].at)
+	})
+	return files
+}
+
+// prune removes the rotated files there are too many of, or that are too
+// old
+func (r *rotatingFile) prune() {
+	files := r.rotated()
+	for i, f := range files {
+		tooMany := r.maxKeep > 0 && len(files)-i > r.maxKeep
+		tooOld := r.keepFor > 0 && getNow().Sub(f.at) > r.keepFor
+		if tooMany || tooOld {
+			os.Remove(f.path)
+		}
+	}
+}
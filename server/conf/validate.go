@@ -0,0 +1,416 @@
+package conf
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"world-backup/server/crypt"
+	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/storage"
+
+	"github.com/robfig/cron"
+	"github.com/spf13/afero"
+)
+
+// Problem is something wrong with the config, Field is where it is in the
+// config file like "folders[0].schedules[1].every"
+type Problem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return p.Field + ": " + p.Message
+}
+
+// Problems is everything wrong with a config
+type Problems []Problem
+
+func (p Problems) Error() string {
+	lines := make([]string, len(p))
+	for i := range p {
+		lines[i] = p[i].String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (p *Problems) add(field, format string, args ...interface{}) {
+	*p = append(*p, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+var unexpanded = regexp.MustCompile(`\$\{[^}]*\}`)
+
+// Validate makes sure the config can be used, the error lists all of its
+// Problems
+func (c *Config) Validate() error {
+	if p := c.problems(); len(p) > 0 {
+		return p
+	}
+
+	return nil
+}
+
+// Check finds all of the config's problems, including watched folders that
+// don't exist and a backup folder that can't be written to
+func (c *Config) Check(fs afero.Fs) Problems {
+	p := c.problems()
+
+	if c.BackupDir != "" && !unexpanded.MatchString(c.BackupDir) {
+		if exists, _ := afero.DirExists(fs, c.BackupDir); !exists {
+			p.add("backupDir", "there is no directory at %s", c.BackupDir)
+		} else if err := checkWritable(fs, c.BackupDir); err != nil {
+			p.add("backupDir", "can't write to %s: %v", c.BackupDir, err)
+		}
+	}
+
+	for i, d := range c.WatchDirs {
+		if d == "" || unexpanded.MatchString(d) {
+			continue
+		}
+		if exists, _ := afero.DirExists(fs, d); !exists {
+			p.add(fmt.Sprintf("watchDirs[%d]", i), "there is no directory at %s", d)
+		}
+	}
+
+	return p
+}
+
+func checkWritable(fs afero.Fs, dir string) error {
+	f, err := afero.TempFile(fs, dir, ".write-check")
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	return fs.Remove(f.Name())
+}
+
+// problems are the mistakes that can be found without looking at the disk
+func (c *Config) problems() Problems {
+	var p Problems
+
+	if c.Port < 1 || c.Port > 65535 {
+		p.add("port", "%d is not a port between 1 and 65535", c.Port)
+	}
+
+	if c.BackupDir == "" {
+		p.add("backupDir", "is required")
+	}
+	checkPath(&p, "backupDir", c.BackupDir)
+
+	checkDuration(&p, "checkInterval", c.CheckInterval, true)
+
+	checkLog(&p, c.LogConfig)
+
+	if c.Health.MinFreeSpace < 0 {
+		p.add("health.minFreeSpace", "can't be negative")
+	}
+
+	for i, d := range c.WatchDirs {
+		field := fmt.Sprintf("watchDirs[%d]", i)
+		if d == "" {
+			p.add(field, "is empty")
+			continue
+		}
+		checkPath(&p, field, d)
+
+		if c.BackupDir != "" && overlaps(d, c.BackupDir) {
+			p.add(field, "%s overlaps backupDir %s, backups would be backed up", d, c.BackupDir)
+		}
+		for j := 0; j < i; j++ {
+			if c.WatchDirs[j] != "" && overlaps(d, c.WatchDirs[j]) {
+				p.add(field, "%s overlaps watchDirs[%d] %s", d, j, c.WatchDirs[j])
+			}
+		}
+	}
+
+	checkArchive(&p, "archive", c.Archive)
+	checkEncryption(&p, c)
+
+	for i, f := range c.Folders {
+		checkPath(&p, fmt.Sprintf("folders[%d].path", i), f.Path)
+	}
+	p = append(p, c.ScheduleProblems()...)
+
+	if c.Replication.MaxAttempts < 0 {
+		p.add("replication.maxAttempts", "can't be negative")
+	}
+	checkDuration(&p, "replication.retryDelay", c.Replication.RetryDelay, false)
+	checkDuration(&p, "replication.maxRetryDelay", c.Replication.MaxRetryDelay, false)
+
+	if err := c.Throttle.Validate(); err != nil {
+		p.add("throttle", "%v", err)
+	}
+
+	if c.Jobs.Workers < 0 {
+		p.add("jobs.workers", "can't be negative")
+	}
+	checkDuration(&p, "jobs.keepFor", c.Jobs.KeepFor, false)
+	if d, err := time.ParseDuration(c.Jobs.KeepFor); err == nil && d > 0 && d < jobs.MinKeepFor {
+		p.add("jobs.keepFor", "has to be at least %s", jobs.MinKeepFor)
+	}
+	checkDuration(&p, "auth.tokenTtl", c.Auth.TokenTTL, false)
+
+	for i, d := range c.Destinations {
+		field := fmt.Sprintf("destinations[%d]", i)
+		if d.Name == "" {
+			p.add(field+".name", "is required")
+		}
+		for j := 0; j < i; j++ {
+			if d.Name != "" && c.Destinations[j].Name == d.Name {
+				p.add(field+".name", "%q is the name of destinations[%d] too", d.Name, j)
+			}
+		}
+		checkDestination(&p, field, d)
+	}
+
+	for i, o := range c.Cors.AllowOrigins {
+		checkOrigin(&p, fmt.Sprintf("cors.allowOrigins[%d]", i), o)
+	}
+
+	return p
+}
+
+func checkArchive(p *Problems, field string, a fs.ArchiveOptions) {
+	min, max, ok := a.Format.Levels()
+	if !ok {
+		p.add(field+".format", "%q is not a format, use %s, %s or %s", a.Format, fs.Zip, fs.TarGz, fs.TarZst)
+		return
+	}
+
+	if a.Level < min || a.Level > max {
+		p.add(field+".level", "%d is not a level of %s, use %d to %d", a.Level, a.Format.Extension()[1:], min, max)
+	}
+}
+
+// checkDestination makes sure the destination has the settings its type
+// needs to be opened
+func checkDestination(p *Problems, field string, d storage.Config) {
+	switch d.Type {
+	case storage.S3:
+		if d.S3 == nil {
+			p.add(field+".s3", "is required for an s3 destination")
+			return
+		}
+		if d.S3.Endpoint == "" {
+			p.add(field+".s3.endpoint", "is required")
+		}
+		if d.S3.Bucket == "" {
+			p.add(field+".s3.bucket", "is required")
+		}
+	case storage.SFTP:
+		if d.Sftp == nil {
+			p.add(field+".sftp", "is required for an sftp destination")
+			return
+		}
+		if d.Sftp.Host == "" {
+			p.add(field+".sftp.host", "is required")
+		}
+		if d.Sftp.User == "" {
+			p.add(field+".sftp.user", "is required")
+		}
+		checkPath(p, field+".sftp.privateKey", d.Sftp.PrivateKey)
+	case storage.WebDAV:
+		if d.WebDav == nil {
+			p.add(field+".webdav", "is required for a webdav destination")
+			return
+		}
+		if u, err := url.Parse(d.WebDav.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.add(field+".webdav.url", "%q is not an http or https url", d.WebDav.Url)
+		}
+	default:
+		p.add(field+".type", "%q is not a destination type, use %s, %s or %s", d.Type, storage.S3, storage.SFTP, storage.WebDAV)
+	}
+}
+
+// checkOrigin makes sure a CORS origin is a site like http://localhost:8080,
+// or * for any
+func checkOrigin(p *Problems, field, origin string) {
+	if origin == "*" {
+		return
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" {
+		p.add(field, "%q is not an origin like http://localhost:8080", origin)
+	}
+}
+
+// checkDuration adds a problem when the value isn't an interval like 10m.
+// Optional values can be left empty to use the default.
+func checkDuration(p *Problems, field, value string, required bool) {
+	if value == "" && !required {
+		return
+	}
+
+	if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+		p.add(field, "%q is not an interval like 10m", value)
+	}
+}
+
+func checkLog(p *Problems, c LoggingConfig) {
+	if c.Level != "" {
+		if _, err := parseLevel(c.Level); err != nil {
+			p.add("log.level", "%q is not a level like info", c.Level)
+		}
+	}
+	components := make([]string, 0, len(c.Components))
+	for component := range c.Components {
+		components = append(components, component)
+	}
+	sort.Strings(components)
+	for _, component := range components {
+		if _, err := parseLevel(c.Components[component]); err != nil {
+			p.add("log.components."+component, "%q is not a level like info", c.Components[component])
+		}
+	}
+
+	if c.Format != "" && c.Format != TextFormat && c.Format != JSONFormat {
+		p.add("log.format", "%q is not a format, use %s or %s", c.Format, TextFormat, JSONFormat)
+	}
+	checkPath(p, "log.file", c.File)
+
+	if c.Rotate.MaxSize < 0 {
+		p.add("log.rotate.maxSize", "can't be negative")
+	}
+	if c.Rotate.MaxFiles < 0 {
+		p.add("log.rotate.maxFiles", "can't be negative")
+	}
+	checkDuration(p, "log.rotate.maxAge", c.Rotate.MaxAge, false)
+	checkDuration(p, "log.rotate.keepFor", c.Rotate.KeepFor, false)
+}
+
+// checkEncryption makes sure every key can be used and has an id of its
+// own, backups only record the id of the key they were encrypted with
+func checkEncryption(p *Problems, c *Config) {
+	type key struct {
+		field  string
+		config *crypt.Config
+	}
+	var keys []key
+
+	add := func(field string, e *crypt.Config) {
+		if e == nil {
+			return
+		}
+		if e.Passphrase != "" && strings.TrimSpace(e.Passphrase) == "" {
+			p.add(field+".passphrase", "is only spaces")
+		}
+		for i, r := range e.Recipients {
+			if err := crypt.CheckRecipient(r); err != nil {
+				p.add(fmt.Sprintf("%s.recipients[%d]", field, i), "is not an age public key: %v", err)
+			}
+		}
+		for i, id := range e.Identities {
+			if err := crypt.CheckIdentity(id); err != nil {
+				p.add(fmt.Sprintf("%s.identities[%d]", field, i), "is not an age secret key")
+			}
+		}
+		if !e.Enabled() {
+			if len(e.Identities) == 0 {
+				p.add(field, "needs a passphrase or recipients to encrypt backups")
+			}
+			return
+		}
+		if e.Passphrase != "" && len(e.Recipients) > 0 {
+			p.add(field, "can have a passphrase or recipients, not both")
+		}
+
+		for _, other := range keys {
+			if other.config.Id() == e.Id() && !sameKey(other.config, e) {
+				p.add(field+".keyId", "%q is the id of %s too, give each key its own keyId", e.Id(), other.field)
+				break
+			}
+		}
+		keys = append(keys, key{field, e})
+	}
+
+	add("archive.encryption", c.Archive.Encryption)
+	for i, f := range c.Folders {
+		add(fmt.Sprintf("folders[%d].encryption", i), f.Encryption)
+	}
+}
+
+// sameKey is true when both configs encrypt to the same key
+func sameKey(a, b *crypt.Config) bool {
+	if a.Passphrase != b.Passphrase || len(a.Recipients) != len(b.Recipients) {
+		return false
+	}
+
+	ra := append([]string{}, a.Recipients...)
+	rb := append([]string{}, b.Recipients...)
+	sort.Strings(ra)
+	sort.Strings(rb)
+	for i := range ra {
+		if ra[i] != rb[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkPath adds a problem for each environment variable in the path that
+// wasn't set
+func checkPath(p *Problems, field, path string) {
+	for _, v := range unexpanded.FindAllString(path, -1) {
+		p.add(field, "the environment variable %s is not set", v)
+	}
+}
+
+// ScheduleProblems is what is wrong with the schedules of the folders and
+// worlds, the watcher can't run with any
+func (c *Config) ScheduleProblems() Problems {
+	var p Problems
+	for i, f := range c.Folders {
+		field := fmt.Sprintf("folders[%d]", i)
+		checkSchedules(&p, field, f.Schedules)
+
+		for j, w := range f.Worlds {
+			checkSchedules(&p, fmt.Sprintf("%s.worlds[%d]", field, j), w.Schedules)
+		}
+	}
+
+	return p
+}
+
+func checkSchedules(p *Problems, field string, schedules []Schedule) {
+	for i, s := range schedules {
+		field := fmt.Sprintf("%s.schedules[%d]", field, i)
+
+		switch {
+		case s.Every != "" && s.Cron != "":
+			p.add(field, "can have every or cron, not both")
+		case s.Every != "":
+			checkDuration(p, field+".every", s.Every, true)
+		case s.Cron != "":
+			if _, err := cron.ParseStandard(s.Cron); err != nil {
+				p.add(field+".cron", "%q is not a cron expression: %v", s.Cron, err)
+			}
+		default:
+			p.add(field, "needs every or cron")
+		}
+
+		if s.QuietHours != nil {
+			checkTimeOfDay(p, field+".quietHours.from", s.QuietHours.From)
+			checkTimeOfDay(p, field+".quietHours.to", s.QuietHours.To)
+		}
+	}
+}
+
+func checkTimeOfDay(p *Problems, field, value string) {
+	if _, err := time.Parse("15:04", value); err != nil {
+		p.add(field, "%q is not a time like 22:30", value)
+	}
+}
+
+// overlaps is true when one of the folders is inside the other
+func overlaps(a, b string) bool {
+	return fs.Within(a, b) || fs.Within(b, a)
+}
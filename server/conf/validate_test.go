@@ -0,0 +1,207 @@
+package conf
+
+import (
+	"os"
+	"testing"
+
+	"world-backup/server/crypt"
+	"world-backup/server/fs"
+	"world-backup/server/storage"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+// testRecipient is an age public key, its secret key is not kept anywhere
+const testRecipient = "age1gp483376tj3chuarh7s646yk6v65qam5w840cf5qwls6s0srqaesdtpvh7"
+
+func TestConfig_Check(t *testing.T) {
+	Convey("Given a filesystem with saves and a backup folder", t, func() {
+		fs := afero.NewMemMapFs()
+		fs.MkdirAll("/saves", 0755)
+		fs.MkdirAll("/backups", 0755)
+
+		Convey("When the config is fine", func() {
+			c := Config{Port: 3030, BackupDir: "/backups", CheckInterval: "1m", WatchDirs: []string{"/saves"}}
+
+			Convey("It should not find any problems", func() {
+				So(c.Check(fs), ShouldBeEmpty)
+				So(c.Validate(), ShouldBeNil)
+			})
+		})
+
+		Convey("When everything is wrong", func() {
+			no := false
+			c := Config{
+				Port:          70000,
+				BackupDir:     "/saves/backups",
+				CheckInterval: "often",
+				LogConfig: LoggingConfig{
+					Level:      "loud",
+					Format:     "xml",
+					Components: map[string]string{"watcher": "debug", "api": "chatty"},
+					Rotate:     RotateConfig{MaxFiles: -1, KeepFor: "a week"},
+				},
+				WatchDirs: []string{"/saves", "/saves/world", "/missing", "${NOT_SET_FOR_TEST}/saves"},
+				Folders: []FolderConfig{{
+					Path:      "/saves",
+					Schedules: []Schedule{{Every: "10m", Cron: "* * * * *"}},
+					Worlds: []WorldConfig{{
+						Name:      "w",
+						Schedules: []Schedule{{Cron: "sundays", OnlyIfChanged: &no, QuietHours: &QuietHours{From: "10pm", To: "07:00"}}},
+					}},
+				}},
+			}
+
+			Convey("It should list all of them by field", func() {
+				var fields []string
+				for _, p := range c.Check(fs) {
+					fields = append(fields, p.Field)
+				}
+
+				So(fields, ShouldResemble, []string{
+					"port",
+					"checkInterval",
+					"log.level",
+					"log.components.api",
+					"log.format",
+					"log.rotate.maxFiles",
+					"log.rotate.keepFor",
+					"watchDirs[0]",
+					"watchDirs[1]",
+					"watchDirs[3]",
+					"folders[0].schedules[0]",
+					"folders[0].worlds[0].schedules[0].cron",
+					"folders[0].worlds[0].schedules[0].quietHours.from",
+					"backupDir",
+					"watchDirs[1]",
+					"watchDirs[2]",
+				})
+			})
+		})
+
+		Convey("When the backup folder can't be written to", func() {
+			c := Config{Port: 3030, BackupDir: "/backups", CheckInterval: "1m"}
+			problems := c.Check(afero.NewReadOnlyFs(fs))
+
+			Convey("It should say so", func() {
+				So(len(problems), ShouldEqual, 1)
+				So(problems[0].Field, ShouldEqual, "backupDir")
+			})
+		})
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	cases := []struct {
+		name    string
+		change  func(c *Config)
+		field   string
+		message string
+	}{
+		{"an unknown archive format", func(c *Config) {
+			c.Archive.Format = "rar"
+		}, "archive.format", `"rar" is not a format, use zip, tar.gz or tar.zst`},
+		{"a gzip level that is too high", func(c *Config) {
+			c.Archive = fs.ArchiveOptions{Format: fs.TarGz, Level: 12}
+		}, "archive.level", "12 is not a level of tar.gz, use -2 to 9"},
+		{"a zstd level below zero", func(c *Config) {
+			c.Archive = fs.ArchiveOptions{Format: fs.TarZst, Level: -1}
+		}, "archive.level", "-1 is not a level of tar.zst, use 0 to 22"},
+		{"encryption without a key", func(c *Config) {
+			c.Archive.Encryption = &crypt.Config{KeyId: "home"}
+		}, "archive.encryption", "needs a passphrase or recipients to encrypt backups"},
+		{"a passphrase of spaces", func(c *Config) {
+			c.Archive.Encryption = &crypt.Config{Passphrase: "   "}
+		}, "archive.encryption.passphrase", "is only spaces"},
+		{"a recipient that isn't a key", func(c *Config) {
+			c.Folders = []FolderConfig{{Path: "/saves", Encryption: &crypt.Config{Recipients: []string{testRecipient, "age1nas"}}}}
+		}, "folders[0].encryption.recipients[1]", "is not an age public key"},
+		{"an identity that isn't a key", func(c *Config) {
+			c.Archive.Encryption = &crypt.Config{Recipients: []string{testRecipient}, Identities: []string{"AGE-SECRET-KEY-1"}}
+		}, "archive.encryption.identities[0]", "is not an age secret key"},
+		{"a passphrase with recipients", func(c *Config) {
+			c.Archive.Encryption = &crypt.Config{Passphrase: "secret", Recipients: []string{testRecipient}}
+		}, "archive.encryption", "can have a passphrase or recipients, not both"},
+		{"two passphrases with the same key id", func(c *Config) {
+			c.Archive.Encryption = &crypt.Config{Passphrase: "first"}
+			c.Folders = []FolderConfig{{Path: "/saves", Encryption: &crypt.Config{Passphrase: "second"}}}
+		}, "folders[0].encryption.keyId", `"passphrase" is the id of archive.encryption too`},
+		{"an unknown destination type", func(c *Config) {
+			c.Destinations = []storage.Config{{Name: "nas", Type: "ftp"}}
+		}, "destinations[0].type", `"ftp" is not a destination type, use s3, sftp or webdav`},
+		{"an s3 destination without settings", func(c *Config) {
+			c.Destinations = []storage.Config{{Name: "cloud", Type: storage.S3}}
+		}, "destinations[0].s3", "is required for an s3 destination"},
+		{"an s3 destination without a bucket", func(c *Config) {
+			c.Destinations = []storage.Config{{Name: "cloud", Type: storage.S3, S3: &storage.S3Config{Endpoint: "s3.example.com"}}}
+		}, "destinations[0].s3.bucket", "is required"},
+		{"an sftp destination without a host", func(c *Config) {
+			c.Destinations = []storage.Config{{Name: "nas", Type: storage.SFTP, Sftp: &storage.SftpConfig{User: "steve"}}}
+		}, "destinations[0].sftp.host", "is required"},
+		{"a webdav destination without a url", func(c *Config) {
+			c.Destinations = []storage.Config{{Name: "box", Type: storage.WebDAV, WebDav: &storage.WebDavConfig{Url: "box.example.com/backups"}}}
+		}, "destinations[0].webdav.url", `"box.example.com/backups" is not an http or https url`},
+		{"two destinations with the same name", func(c *Config) {
+			box := storage.Config{Name: "box", Type: storage.WebDAV, WebDav: &storage.WebDavConfig{Url: "https://box.example.com/"}}
+			c.Destinations = []storage.Config{box, box}
+		}, "destinations[1].name", `"box" is the name of destinations[0] too`},
+		{"a cors origin with a path", func(c *Config) {
+			c.Cors.AllowOrigins = []string{"*", "http://localhost:8080", "http://localhost:8080/client"}
+		}, "cors.allowOrigins[2]", `"http://localhost:8080/client" is not an origin like http://localhost:8080`},
+		{"jobs kept for too short a time", func(c *Config) {
+			c.Jobs.KeepFor = "1s"
+		}, "jobs.keepFor", "has to be at least 1m0s"},
+		{"a cors origin without a scheme", func(c *Config) {
+			c.Cors.AllowOrigins = []string{"localhost:8080"}
+		}, "cors.allowOrigins[0]", `"localhost:8080" is not an origin like http://localhost:8080`},
+	}
+
+	for _, tc := range cases {
+		Convey("Given a config with "+tc.name, t, func() {
+			c := Config{Port: 3030, BackupDir: "/backups", CheckInterval: "1m"}
+			tc.change(&c)
+			problems, _ := c.Validate().(Problems)
+
+			Convey("It should be the only problem", func() {
+				So(len(problems), ShouldEqual, 1)
+				So(problems[0].Field, ShouldEqual, tc.field)
+				So(problems[0].Message, ShouldStartWith, tc.message)
+			})
+		})
+	}
+
+	Convey("Given a config with good settings for all of them", t, func() {
+		c := Config{
+			Port:          3030,
+			BackupDir:     "/backups",
+			CheckInterval: "1m",
+			Archive:       fs.ArchiveOptions{Format: fs.TarZst, Level: 19, Encryption: &crypt.Config{Recipients: []string{testRecipient}}},
+			Destinations: []storage.Config{
+				{Name: "cloud", Type: storage.S3, S3: &storage.S3Config{Endpoint: "s3.example.com", Bucket: "worlds"}},
+				{Name: "nas", Type: storage.SFTP, Sftp: &storage.SftpConfig{Host: "nas:22", User: "steve"}},
+				{Name: "box", Type: storage.WebDAV, WebDav: &storage.WebDavConfig{Url: "https://box.example.com/backups"}},
+			},
+			Cors: CorsConfig{AllowOrigins: []string{"http://localhost:8080", "https://backups.example.com/"}},
+		}
+
+		Convey("It should not find any problems", func() {
+			So(c.Validate(), ShouldBeNil)
+		})
+	})
+}
+
+func TestCleanConfig_Expand(t *testing.T) {
+	Convey("Given paths with environment variables", t, func() {
+		os.Setenv("WB_TEST_HOME", "/home/steve")
+		defer os.Unsetenv("WB_TEST_HOME")
+
+		c := cleanConfig(&Config{BackupDir: "${WB_TEST_HOME}/backups", WatchDirs: []string{"${WB_TEST_MISSING}/saves"}})
+
+		Convey("It should expand the ones that are set and keep the others", func() {
+			So(c.BackupDir, ShouldEqual, "/home/steve/backups")
+			So(c.WatchDirs, ShouldResemble, []string{"${WB_TEST_MISSING}/saves"})
+			So(c.Validate().Error(), ShouldContainSubstring, "watchDirs[0]: the environment variable ${WB_TEST_MISSING} is not set")
+		})
+	})
+}
@@ -0,0 +1,164 @@
+package crypt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// Extension is added to the name of encrypted backups
+const Extension = ".age"
+
+// scryptWorkFactor is the log2 of the scrypt cost, age's own default
+var scryptWorkFactor = 18
+
+var NoKeyError = errors.New("The backup is encrypted and no key was given to decrypt it")
+var WrongKeyError = errors.New("None of the keys given can decrypt the backup")
+
+// Config holds the keys backups are encrypted with, either a Passphrase the
+// key is derived from with scrypt or age X25519 public keys as Recipients.
+// With recipients the backup host never holds the key that decrypts, the
+// matching Identities are only needed where backups are restored.
+type Config struct {
+	KeyId      string   `json:"keyId"`
+	Passphrase string   `json:"passphrase"`
+	Recipients []string `json:"recipients"`
+	Identities []string `json:"identities"`
+}
+
+// Enabled is true when backups should be encrypted
+func (c *Config) Enabled() bool {
+	return c != nil && (c.Passphrase != "" || len(c.Recipients) > 0)
+}
+
+// Id names the key so a backup records what it was encrypted with. Public
+// key setups are named after the recipients, a passphrase can't be hashed
+// into an id without making it easier to guess, so those use KeyId or
+// "passphrase". The config makes sure different passphrases get their own
+// KeyId.
+func (c *Config) Id() string {
+	switch {
+	case c == nil:
+		return ""
+	case c.KeyId != "":
+		return c.KeyId
+	case len(c.Recipients) > 0:
+		recipients := append([]string{}, c.Recipients...)
+		sort.Strings(recipients)
+		sum := sha256.Sum256([]byte(strings.Join(recipients, "\n")))
+		return "age:" + hex.EncodeToString(sum[:8])
+	case c.Passphrase != "":
+		return "passphrase"
+	}
+
+	return ""
+}
+
+// Encrypt wraps w so everything written to it is encrypted, Close must be
+// called to finish the last chunk
+func Encrypt(w io.Writer, c *Config) (io.WriteCloser, error) {
+	var recipients []age.Recipient
+
+	if c.Passphrase != "" {
+		r, err := age.NewScryptRecipient(c.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		r.SetWorkFactor(scryptWorkFactor)
+		recipients = append(recipients, r)
+	}
+
+	for _, key := range c.Recipients {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(key))
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+
+	return age.Encrypt(w, recipients...)
+}
+
+// Decrypt reads and authenticates what Encrypt wrote. Reads fail if the data
+// was changed since.
+func Decrypt(r io.Reader, c *Config) (io.Reader, error) {
+	var identities []age.Identity
+
+	if c != nil && c.Passphrase != "" {
+		i, err := age.NewScryptIdentity(c.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+
+	if c != nil {
+		for _, key := range c.Identities {
+			i, err := age.ParseX25519Identity(strings.TrimSpace(key))
+			if err != nil {
+				return nil, err
+			}
+			identities = append(identities, i)
+		}
+	}
+
+	if len(identities) == 0 {
+		return nil, NoKeyError
+	}
+
+	plain, err := age.Decrypt(r, identities...)
+	if _, ok := err.(*age.NoIdentityMatchError); ok {
+		return nil, WrongKeyError
+	}
+
+	return plain, err
+}
+
+// DecryptTo decrypts all of r into w
+func DecryptTo(w io.Writer, r io.Reader, c *Config) error {
+	plain, err := Decrypt(r, c)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, plain)
+	return err
+}
+
+// CheckRecipient is nil when key is an age public key backups can be
+// encrypted to
+func CheckRecipient(key string) error {
+	_, err := age.ParseX25519Recipient(strings.TrimSpace(key))
+	return err
+}
+
+// CheckIdentity is nil when key is an age secret key backups can be
+// decrypted with
+func CheckIdentity(key string) error {
+	_, err := age.ParseX25519Identity(strings.TrimSpace(key))
+	return err
+}
+
+// Merge adds the keys in other to c, used to combine configured keys with
+// the ones given with a request
+func Merge(c, other *Config) *Config {
+	if c == nil {
+		return other
+	}
+	if other == nil {
+		return c
+	}
+
+	merged := *c
+	if other.Passphrase != "" {
+		merged.Passphrase = other.Passphrase
+	}
+	merged.Identities = append(append([]string{}, c.Identities...), other.Identities...)
+
+	return &merged
+}
@@ -0,0 +1,104 @@
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"filippo.io/age"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func encrypt(c *Config, plain string) []byte {
+	var b bytes.Buffer
+	w, err := Encrypt(&b, c)
+	So(err, ShouldBeNil)
+	w.Write([]byte(plain))
+	So(w.Close(), ShouldBeNil)
+
+	return b.Bytes()
+}
+
+func decrypt(c *Config, b []byte) (string, error) {
+	r, err := Decrypt(bytes.NewReader(b), c)
+	if err != nil {
+		return "", err
+	}
+
+	plain, err := ioutil.ReadAll(r)
+	return string(plain), err
+}
+
+func TestEncrypt(t *testing.T) {
+	oldWorkFactor := scryptWorkFactor
+	scryptWorkFactor = 10
+	defer func() { scryptWorkFactor = oldWorkFactor }()
+
+	Convey("Given a passphrase", t, func() {
+		c := &Config{Passphrase: "correct horse battery staple"}
+		b := encrypt(c, "level.dat")
+
+		Convey("It should decrypt with the same passphrase", func() {
+			plain, err := decrypt(c, b)
+
+			So(err, ShouldBeNil)
+			So(plain, ShouldEqual, "level.dat")
+			So(bytes.Contains(b, []byte("level.dat")), ShouldBeFalse)
+		})
+
+		Convey("It should not decrypt with another passphrase", func() {
+			_, err := decrypt(&Config{Passphrase: "nope"}, b)
+
+			So(err, ShouldEqual, WrongKeyError)
+		})
+
+		Convey("It should notice when the backup was changed", func() {
+			b[len(b)-1] ^= 1
+			_, err := decrypt(c, b)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an age key pair", t, func() {
+		id, _ := age.GenerateX25519Identity()
+		c := &Config{Recipients: []string{id.Recipient().String()}}
+		b := encrypt(c, "region")
+
+		Convey("It should need the identity to decrypt", func() {
+			_, err := decrypt(c, b)
+			So(err, ShouldEqual, NoKeyError)
+
+			plain, err := decrypt(Merge(c, &Config{Identities: []string{id.String()}}), b)
+			So(err, ShouldBeNil)
+			So(plain, ShouldEqual, "region")
+		})
+	})
+}
+
+func TestConfig_Id(t *testing.T) {
+	Convey("Given encryption configs", t, func() {
+		Convey("It should use the configured key id", func() {
+			So((&Config{KeyId: "nas", Passphrase: "x"}).Id(), ShouldEqual, "nas")
+		})
+
+		Convey("It should name recipients after their keys, in any order", func() {
+			a := (&Config{Recipients: []string{"age1a", "age1b"}}).Id()
+			b := (&Config{Recipients: []string{"age1b", "age1a"}}).Id()
+
+			So(a, ShouldStartWith, "age:")
+			So(a, ShouldEqual, b)
+		})
+
+		Convey("It should not derive the id from a passphrase", func() {
+			So((&Config{Passphrase: "secret"}).Id(), ShouldEqual, "passphrase")
+		})
+
+		Convey("It should be disabled without keys", func() {
+			var c *Config
+			So(c.Enabled(), ShouldBeFalse)
+			So(c.Id(), ShouldEqual, "")
+			So((&Config{Identities: []string{"x"}}).Enabled(), ShouldBeFalse)
+		})
+	})
+}
@@ -6,29 +6,42 @@ import (
 	"encoding/json"
 
 	"os"
+	"sync"
 
-	"github.com/ventu-io/go-shortid"
+	"world-backup/server/metrics"
+
+	"github.com/teris-io/shortid"
 )
 
 var getNow = time.Now
 var getId = shortid.MustGenerate
 
 type dbData struct {
-	CreatedAt time.Time `json:"createdAt"`
-	LastSave  time.Time `json:"lastSave"`
-	Folders   []*Folder `json:"folders"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	LastSave     time.Time      `json:"lastSave"`
+	Folders      []*Folder      `json:"folders"`
+	Replications []*Replication `json:"replications,omitempty"`
+	Users        []*User        `json:"users,omitempty"`
 }
 
 type Db struct {
 	fs   IDbFileSystem
 	name string
 	data dbData
+
+	// catalog is held while what the db holds is read, changed or saved
+	catalog sync.Mutex
+
+	mu      sync.Mutex
+	saveErr error
 }
 
 type IDbFileSystem interface {
 	Exists(path string) (bool, error)
 	ReadFile(filename string) ([]byte, error)
 	WriteFile(filename string, data []byte, perm os.FileMode) error
+	Rename(oldname, newname string) error
+	Remove(name string) error
 }
 
 func Open(name string, af IDbFileSystem) (*Db, error) {
@@ -75,7 +88,24 @@ func getDataFromFile(name string, af IDbFileSystem) (*dbData, error) {
 	return &jsonData, nil
 }
 
-func (db *Db) Save() error {
+// Lock holds the catalog. The api, its jobs, the watcher and the replication
+// queue each hold it while they read or change the folders, worlds, backups,
+// replications and users, and while they Save.
+func (db *Db) Lock() {
+	db.catalog.Lock()
+}
+
+func (db *Db) Unlock() {
+	db.catalog.Unlock()
+}
+
+// Save writes the catalog next to the file and renames it into place, so a
+// crash while saving leaves the last catalog whole. It is called holding
+// Lock.
+func (db *Db) Save() (err error) {
+	defer metrics.Since(metrics.CatalogSaveDuration, time.Now())
+	defer func() { db.saved(err) }()
+
 	db.data.LastSave = getNow()
 
 	jsonData, err := json.Marshal(db.data)
@@ -83,13 +113,44 @@ func (db *Db) Save() error {
 		return err
 	}
 
-	if wErr := db.fs.WriteFile(db.name, jsonData, 0600); wErr != nil {
+	tmp := db.name + ".tmp"
+	if wErr := db.fs.WriteFile(tmp, jsonData, 0600); wErr != nil {
 		return wErr
 	}
 
-	return nil
+	return db.fs.Rename(tmp, db.name)
+}
+
+func (db *Db) saved(err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.saveErr = err
+}
+
+// SaveError is why the catalog couldn't be written the last time it was
+// saved, nil when it was
+func (db *Db) SaveError() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.saveErr
+}
+
+// CheckWritable writes and removes a file next to the catalog, to find out
+// before the next Save that it would fail
+func (db *Db) CheckWritable() error {
+	check := db.name + ".check"
+	if err := db.fs.WriteFile(check, []byte{}, 0644); err != nil {
+		return err
+	}
+
+	return db.fs.Remove(check)
 }
 
 func (db *Db) Close() {
+	db.Lock()
+	defer db.Unlock()
+
 	db.Save()
 }
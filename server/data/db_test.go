@@ -1,6 +1,7 @@
 package data
 
 import (
+	"fmt"
 	"testing"
 
 	"time"
@@ -12,7 +13,7 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/mock"
-	"github.com/ventu-io/go-shortid"
+	"github.com/teris-io/shortid"
 )
 
 var db *Db
@@ -123,18 +124,89 @@ func TestOpenAndSave(t *testing.T) {
 		})
 
 		Convey("When we fail to write the file", func() {
-			fsMock.On("WriteFile", "Wow fake", mock.Anything, mock.Anything).Return(errors.New("NOOO!"))
+			fsMock.On("WriteFile", "Wow fake.tmp", mock.Anything, mock.Anything).Return(errors.New("NOOO!"))
 			db := Db{
 				fs:   fsMock,
 				name: "Wow fake",
 			}
 			err := db.Save()
 
-			Convey("It should return the error", func() {
+			Convey("It should return the error and keep it until the next save", func() {
 				So(err, ShouldNotBeNil)
 				So(err.Error(), ShouldEqual, "NOOO!")
+				So(db.SaveError(), ShouldEqual, err)
+				fsMock.AssertNotCalled(t, "Rename", mock.Anything, mock.Anything)
+			})
+		})
+
+		Convey("When we fail to rename the file into place", func() {
+			fsMock.On("WriteFile", "Wow fake.tmp", mock.Anything, mock.Anything).Return(nil)
+			fsMock.On("Rename", "Wow fake.tmp", "Wow fake").Return(errors.New("busy"))
+			db := Db{
+				fs:   fsMock,
+				name: "Wow fake",
+			}
+
+			Convey("It should return the error", func() {
+				So(db.Save(), ShouldNotBeNil)
+				So(db.SaveError().Error(), ShouldEqual, "busy")
 			})
 		})
 	})
+}
+
+func TestDb_Lock(t *testing.T) {
+	Convey("Given a db changed from many goroutines at once", t, func() {
+		fs := afero.Afero{Fs: afero.NewMemMapFs()}
+		localDb, _ := Open("/data.json", fs)
+
+		done := make(chan bool)
+		for i := 0; i < 20; i++ {
+			go func(i int) {
+				localDb.Lock()
+				defer localDb.Unlock()
+
+				localDb.AddFolder(fmt.Sprintf("/saves/%d", i))
+				localDb.Save()
+				done <- true
+			}(i)
+		}
+		for i := 0; i < 20; i++ {
+			<-done
+		}
+
+		Convey("It should save every change", func() {
+			reopened, err := Open("/data.json", fs)
+			So(err, ShouldBeNil)
+			So(len(reopened.Folders()), ShouldEqual, 20)
+
+			exists, _ := fs.Exists("/data.json.tmp")
+			So(exists, ShouldBeFalse)
+		})
+	})
+}
+
+func TestDb_CheckWritable(t *testing.T) {
+	Convey("Given a db", t, func() {
+		mem := afero.NewMemMapFs()
+		localDb, _ := Open("/data.json", afero.Afero{Fs: mem})
+
+		Convey("When its folder can be written to", func() {
+			err := localDb.CheckWritable()
+
+			Convey("It should be fine and leave nothing behind", func() {
+				So(err, ShouldBeNil)
+				exists, _ := afero.Exists(mem, "/data.json.check")
+				So(exists, ShouldBeFalse)
+			})
+		})
+
+		Convey("When its folder is read only", func() {
+			localDb.fs = afero.Afero{Fs: afero.NewReadOnlyFs(mem)}
 
+			Convey("It should say so", func() {
+				So(localDb.CheckWritable(), ShouldNotBeNil)
+			})
+		})
+	})
 }
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"encoding/json"
 	"path"
 	"time"
 )
@@ -12,6 +13,35 @@ type Folder struct {
 	Path       string    `json:"path"`
 	LastRun    time.Time `json:"lastRun"`
 	Worlds     []*World  `json:"worlds"`
+
+	// DefaultOwnerId is who worlds found in the folder belong to
+	DefaultOwnerId string `json:"defaultOwnerId,omitempty"`
+
+	// Paused folders aren't checked for changes until they are resumed.
+	// Untracked folders aren't watched any more but keep their backups.
+	Paused    bool `json:"paused,omitempty"`
+	Untracked bool `json:"untracked,omitempty"`
+
+	// LastError is why checking the folder for worlds last failed
+	LastError *Failure `json:"lastError,omitempty"`
+}
+
+// SetError keeps the error as the folder's last, or clears it when nil
+func (f *Folder) SetError(err error) {
+	f.LastError = newFailure(err)
+}
+
+// Watched is true when the watcher should check the folder for changes
+func (f *Folder) Watched() bool {
+	return !f.Paused && !f.Untracked
+}
+
+// SetPath moves the folder, and the worlds in it, to a new path
+func (f *Folder) SetPath(p string) {
+	f.Path = p
+	for _, world := range f.Worlds {
+		world.FullPath = path.Join(p, world.Name)
+	}
 }
 
 func (f *Folder) AddWorld(name string) *World {
@@ -73,10 +103,30 @@ func (db *Db) AddFolder(path string) *Folder {
 	return &f
 }
 
+// InsertFolder adds a folder made elsewhere, keeping its id
+func (db *Db) InsertFolder(f *Folder) {
+	db.data.Folders = append(db.data.Folders, f)
+}
+
 func (db *Db) Folders() []*Folder {
 	return db.data.Folders
 }
 
+// CopyFolders is a deep copy of the folders, to read from once the catalog
+// isn't held
+func CopyFolders(folders []*Folder) ([]*Folder, error) {
+	b, err := json.Marshal(folders)
+	if err != nil {
+		return nil, err
+	}
+
+	var copied []*Folder
+	if err := json.Unmarshal(b, &copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
 func (db *Db) GetFolderByPath(path string) *Folder {
 	for i := range db.data.Folders {
 		if db.data.Folders[i].Path == path {
@@ -96,3 +146,61 @@ func (db *Db) GetFolder(id string) *Folder {
 
 	return nil
 }
+
+// FolderWorld is a world along with the folder it is in
+type FolderWorld struct {
+	Folder *Folder
+	World  *World
+}
+
+// FindWorlds returns the worlds with the id, folder name or in-game name
+// given, from every folder
+func (db *Db) FindWorlds(ref string) []FolderWorld {
+	return FindWorlds(db.data.Folders, ref)
+}
+
+// FindWorlds returns the worlds in the folders with the id, folder name or
+// in-game name given
+func FindWorlds(folders []*Folder, ref string) []FolderWorld {
+	var found []FolderWorld
+	for _, f := range folders {
+		for _, w := range f.Worlds {
+			if w.Id == ref || w.Name == ref || w.LevelName == ref {
+				found = append(found, FolderWorld{Folder: f, World: w})
+			}
+		}
+	}
+
+	return found
+}
+
+// LocateWorld returns the world with the given id from the folders along
+// with its folder, or nils
+func LocateWorld(folders []*Folder, id string) (*Folder, *World) {
+	for _, f := range folders {
+		if w := f.GetWorld(id); w != nil {
+			return f, w
+		}
+	}
+
+	return nil, nil
+}
+
+// RemoveFolder stops keeping the folder, and the worlds and backups in it,
+// in the catalog. It is false when there is no such folder.
+func (db *Db) RemoveFolder(id string) bool {
+	// a new slice, the watcher may be going through the old one
+	folders := make([]*Folder, 0, len(db.data.Folders))
+	for _, f := range db.data.Folders {
+		if f.Id != id {
+			folders = append(folders, f)
+		}
+	}
+
+	if len(folders) == len(db.data.Folders) {
+		return false
+	}
+
+	db.data.Folders = folders
+	return true
+}
@@ -223,3 +223,74 @@ func TestFolder_RemoveWorld(t *testing.T) {
 		})
 	})
 }
+
+func TestFolder_RemoveFolder(t *testing.T) {
+	Convey("Given a list of folders", t, func() {
+		f1 := db.AddFolder("/some/gone1/place")
+		f2 := db.AddFolder("/some/gone2/place")
+
+		Convey("When a folder is removed", func() {
+			removed := db.RemoveFolder(f1.Id)
+
+			Convey("It should no longer be there", func() {
+				So(removed, ShouldBeTrue)
+				So(db.GetFolder(f1.Id), ShouldBeNil)
+				So(db.GetFolder(f2.Id), ShouldNotBeNil)
+				So(db.RemoveFolder(f1.Id), ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestFolder_SetPath(t *testing.T) {
+	Convey("Given a folder with a world", t, func() {
+		folder := Folder{Path: "/old/saves"}
+		world := folder.AddWorld("Island")
+
+		Convey("When it is moved", func() {
+			folder.SetPath("/new/saves")
+
+			Convey("It should move the world too", func() {
+				So(folder.Path, ShouldEqual, "/new/saves")
+				So(world.FullPath, ShouldEqual, "/new/saves/Island")
+			})
+		})
+
+		Convey("When it is paused or untracked", func() {
+			So(folder.Watched(), ShouldBeTrue)
+			folder.Paused = true
+			So(folder.Watched(), ShouldBeFalse)
+			folder.Paused, folder.Untracked = false, true
+			So(folder.Watched(), ShouldBeFalse)
+		})
+	})
+}
+
+func TestDb_FindWorlds(t *testing.T) {
+	Convey("Given worlds in two folders", t, func() {
+		db := Db{}
+		saves := db.AddFolder("/saves")
+		survival := saves.AddWorld("survival")
+		bedrock := saves.AddWorld("Ab3dE=")
+		bedrock.LevelName = "Island"
+		server := db.AddFolder("/server").AddWorld("survival")
+
+		Convey("It should find them by id, folder name or in-game name", func() {
+			So(db.FindWorlds(survival.Id), ShouldResemble, []FolderWorld{{Folder: saves, World: survival}})
+			So(db.FindWorlds("Island"), ShouldResemble, []FolderWorld{{Folder: saves, World: bedrock}})
+			So(len(db.FindWorlds("survival")), ShouldEqual, 2)
+			So(db.FindWorlds("survival")[1].World, ShouldEqual, server)
+			So(db.FindWorlds("creative"), ShouldBeEmpty)
+		})
+
+		Convey("It should locate a world by id along with its folder", func() {
+			f, w := LocateWorld(db.Folders(), bedrock.Id)
+			So(f, ShouldEqual, saves)
+			So(w, ShouldEqual, bedrock)
+
+			f, w = LocateWorld(db.Folders(), "nope")
+			So(f, ShouldBeNil)
+			So(w, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,42 @@
+package data
+
+import (
+	"errors"
+	"os"
+)
+
+// LockedError is returned when another process has the catalog locked
+var LockedError = errors.New("The catalog is in use by another world-backup, stop it or use --server")
+
+// Lock keeps other processes from writing the catalog. It is released when
+// the process ends, even if it never unlocks.
+type Lock struct {
+	f *os.File
+}
+
+// LockName is the lock file kept next to the catalog
+func LockName(name string) string {
+	return name + ".lock"
+}
+
+// LockCatalog takes the lock on the catalog, failing with LockedError
+// straight away when another process holds it
+func LockCatalog(name string) (*Lock, error) {
+	f, err := lockFile(LockName(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Lock{f: f}, nil
+}
+
+// Unlock releases the lock. The lock file is left behind, removing it could
+// let a process waiting on the old file and one creating a new file both
+// take the lock.
+func (l *Lock) Unlock() error {
+	if l == nil {
+		return nil
+	}
+
+	return l.f.Close()
+}
@@ -0,0 +1,34 @@
+package data
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLockCatalog(t *testing.T) {
+	Convey("Given a catalog", t, func() {
+		dir, _ := ioutil.TempDir("", "catalog")
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "data.json")
+
+		Convey("When it is locked", func() {
+			lock, err := LockCatalog(name)
+			So(err, ShouldBeNil)
+
+			Convey("It should not be locked again until it is unlocked", func() {
+				_, err := LockCatalog(name)
+				So(err, ShouldEqual, LockedError)
+
+				So(lock.Unlock(), ShouldBeNil)
+
+				again, err := LockCatalog(name)
+				So(err, ShouldBeNil)
+				again.Unlock()
+			})
+		})
+	})
+}
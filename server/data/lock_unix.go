@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package data
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes a flock on the file. flocks belong to the open file, so
+// they also keep out a second open in the same process.
+func lockFile(name string) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, LockedError
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,30 @@
+//go:build windows
+// +build windows
+
+package data
+
+import (
+	"os"
+	"syscall"
+)
+
+const errorSharingViolation syscall.Errno = 32
+
+// lockFile opens the file without sharing it, Windows refuses any other
+// open until it is closed
+func lockFile(name string) (*os.File, error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errorSharingViolation {
+			return nil, LockedError
+		}
+		return nil, &os.PathError{Op: "lock", Path: name, Err: err}
+	}
+
+	return os.NewFile(uintptr(h), name), nil
+}
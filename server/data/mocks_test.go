@@ -31,4 +31,14 @@ func (m *IDbFileSystemMock) WriteFile(filename string, data []byte, perm os.File
 	return args.Error(0)
 }
 
+func (m *IDbFileSystemMock) Rename(oldname, newname string) error {
+	args := m.Called(oldname, newname)
+	return args.Error(0)
+}
+
+func (m *IDbFileSystemMock) Remove(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
 //endregion
@@ -0,0 +1,111 @@
+package data
+
+import "time"
+
+// States of a replication
+const (
+	ReplicationPending    = "pending"
+	ReplicationInProgress = "in-progress"
+	ReplicationDone       = "done"
+	ReplicationFailed     = "failed"
+)
+
+// Replication is the state of copying a backup to one of the destinations,
+// kept with the folders so copying picks up again after a restart
+type Replication struct {
+	BackupId    string    `json:"backupId"`
+	Destination string    `json:"destination"`
+	State       string    `json:"state"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError,omitempty"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Replications is every backup copy that is queued, running or finished
+func (db *Db) Replications() []*Replication {
+	return db.data.Replications
+}
+
+// QueueReplication queues copying the backup to the destination from the
+// given time, starting over when it was queued before
+func (db *Db) QueueReplication(backupId, destination string, at time.Time) *Replication {
+	r := db.GetReplication(backupId, destination)
+	if r == nil {
+		r = &Replication{BackupId: backupId, Destination: destination}
+		db.data.Replications = append(db.data.Replications, r)
+	}
+
+	r.State = ReplicationPending
+	r.Attempts = 0
+	r.LastError = ""
+	r.NextAttempt = at
+	r.UpdatedAt = at
+
+	return r
+}
+
+// GetReplication returns the copying of the backup to the destination, or
+// nil when it was never queued
+func (db *Db) GetReplication(backupId, destination string) *Replication {
+	for _, r := range db.data.Replications {
+		if r.BackupId == backupId && r.Destination == destination {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// GetReplications returns the copying of the backup to each destination
+func (db *Db) GetReplications(backupId string) []*Replication {
+	var found []*Replication
+	for _, r := range db.data.Replications {
+		if r.BackupId == backupId {
+			found = append(found, r)
+		}
+	}
+
+	return found
+}
+
+// RemoveReplications forgets the copying of a backup that was removed
+func (db *Db) RemoveReplications(backupId string) {
+	kept := db.data.Replications[:0]
+	for _, r := range db.data.Replications {
+		if r.BackupId != backupId {
+			kept = append(kept, r)
+		}
+	}
+
+	for i := len(kept); i < len(db.data.Replications); i++ {
+		db.data.Replications[i] = nil
+	}
+	db.data.Replications = kept
+}
+
+// FindBackup returns the backup with the given id from any world, or nil
+func (db *Db) FindBackup(id string) *Backup {
+	_, _, b := db.LocateBackup(id)
+	return b
+}
+
+// LocateBackup returns the backup with the given id along with its folder
+// and world, or nils
+func (db *Db) LocateBackup(id string) (*Folder, *World, *Backup) {
+	return LocateBackup(db.data.Folders, id)
+}
+
+// LocateBackup returns the backup with the given id from the folders along
+// with its folder and world, or nils
+func LocateBackup(folders []*Folder, id string) (*Folder, *World, *Backup) {
+	for _, f := range folders {
+		for _, w := range f.Worlds {
+			if b := w.GetBackup(id); b != nil {
+				return f, w, b
+			}
+		}
+	}
+
+	return nil, nil, nil
+}
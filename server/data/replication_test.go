@@ -0,0 +1,73 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDb_Replications(t *testing.T) {
+	Convey("Given a db", t, func() {
+		db := Db{}
+		at := time.Unix(1495807405, 0)
+
+		Convey("When backups are queued", func() {
+			r1 := db.QueueReplication("b1", "s3", at)
+			db.QueueReplication("b1", "nas", at)
+			db.QueueReplication("b2", "s3", at)
+
+			Convey("It should queue each backup and destination once", func() {
+				So(len(db.Replications()), ShouldEqual, 3)
+				So(r1, ShouldResemble, &Replication{BackupId: "b1", Destination: "s3", State: ReplicationPending, NextAttempt: at, UpdatedAt: at})
+				So(db.GetReplication("b1", "s3"), ShouldEqual, r1)
+				So(db.GetReplication("b3", "s3"), ShouldBeNil)
+				So(len(db.GetReplications("b1")), ShouldEqual, 2)
+			})
+
+			Convey("It should start over when a failed one is queued again", func() {
+				r1.State = ReplicationFailed
+				r1.Attempts = 5
+				r1.LastError = "Offline"
+
+				later := at.Add(time.Hour)
+				r := db.QueueReplication("b1", "s3", later)
+
+				So(r, ShouldEqual, r1)
+				So(len(db.Replications()), ShouldEqual, 3)
+				So(r, ShouldResemble, &Replication{BackupId: "b1", Destination: "s3", State: ReplicationPending, NextAttempt: later, UpdatedAt: later})
+			})
+
+			Convey("It should forget them when the backup is removed", func() {
+				db.RemoveReplications("b1")
+
+				So(len(db.Replications()), ShouldEqual, 1)
+				So(db.Replications()[0].BackupId, ShouldEqual, "b2")
+			})
+		})
+	})
+}
+
+func TestDb_FindBackup(t *testing.T) {
+	Convey("Given a db with backups in several worlds", t, func() {
+		db := Db{}
+		db.AddFolder("/saves").AddWorld("w1").AddBackup("b1.zip")
+		b2 := db.AddFolder("/other").AddWorld("w2").AddBackup("b2.zip")
+
+		Convey("It should find a backup by id", func() {
+			So(db.FindBackup(b2.Id), ShouldEqual, b2)
+		})
+
+		Convey("It should return nil for an unknown id", func() {
+			So(db.FindBackup("nope"), ShouldBeNil)
+		})
+
+		Convey("It should locate the world and folder of a backup", func() {
+			f, w, b := db.LocateBackup(b2.Id)
+
+			So(f.Path, ShouldEqual, "/other")
+			So(w.Name, ShouldEqual, "w2")
+			So(b, ShouldEqual, b2)
+		})
+	})
+}
@@ -0,0 +1,70 @@
+package data
+
+import (
+	"strings"
+	"time"
+)
+
+// User is someone who can log in to the api. Role is one of the auth roles,
+// the password is only kept hashed.
+type User struct {
+	Id           string    `json:"id"`
+	Name         string    `json:"name"`
+	PasswordHash string    `json:"passwordHash"`
+	Role         string    `json:"role"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Users is everyone who can log in
+func (db *Db) Users() []*User {
+	return db.data.Users
+}
+
+// AddUser adds someone who can log in with the hashed password
+func (db *Db) AddUser(name, passwordHash, role string) *User {
+	user := User{
+		Id:           getId(),
+		Name:         name,
+		PasswordHash: passwordHash,
+		Role:         role,
+		CreatedAt:    getNow(),
+	}
+
+	db.data.Users = append(db.data.Users, &user)
+
+	return &user
+}
+
+// GetUser returns the user with the id, or nil
+func (db *Db) GetUser(id string) *User {
+	for _, u := range db.data.Users {
+		if u.Id == id {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// GetUserByName returns the user with the name, ignoring case, or nil
+func (db *Db) GetUserByName(name string) *User {
+	for _, u := range db.data.Users {
+		if strings.EqualFold(u.Name, name) {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// DeleteUser removes the user with the id, it is false when there is none
+func (db *Db) DeleteUser(id string) bool {
+	for i, u := range db.data.Users {
+		if u.Id == id {
+			db.data.Users = append(db.data.Users[:i], db.data.Users[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,35 @@
+package data
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDb_Users(t *testing.T) {
+	Convey("Given a db with users", t, func() {
+		db := Db{}
+		admin := db.AddUser("Admin", "hash1", "admin")
+		player := db.AddUser("steve", "hash2", "player")
+
+		Convey("It should find them by id and name", func() {
+			So(len(db.Users()), ShouldEqual, 2)
+			So(admin.Id, ShouldNotBeEmpty)
+			So(admin.CreatedAt.IsZero(), ShouldBeFalse)
+			So(db.GetUser(player.Id), ShouldEqual, player)
+			So(db.GetUser("missing"), ShouldBeNil)
+			So(db.GetUserByName("admin"), ShouldEqual, admin)
+			So(db.GetUserByName("alex"), ShouldBeNil)
+		})
+
+		Convey("When one is deleted", func() {
+			deleted := db.DeleteUser(admin.Id)
+
+			Convey("It should be gone", func() {
+				So(deleted, ShouldBeTrue)
+				So(db.Users(), ShouldResemble, []*User{player})
+				So(db.DeleteUser(admin.Id), ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -1,19 +1,106 @@
 package data
 
-import "time"
+import (
+	"time"
+
+	"world-backup/server/filter"
+)
 
 type Backup struct {
-	Id        string    `json:"id"`
-	CreatedAt time.Time `json:"createdAt"`
-	Name      string    `json:"name"`
+	Id        string        `json:"id"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Name      string        `json:"name"`
+	Format    string        `json:"format,omitempty"`
+	KeyId     string        `json:"keyId,omitempty"`
+	Rules     *filter.Rules `json:"rules,omitempty"`
+	Copies    []Copy        `json:"copies,omitempty"`
+	// Checksum is the sha256 of the file, taken when it is first copied to
+	// a destination, a copy fetched back has to match it
+	Checksum string `json:"checksum,omitempty"`
+	// Kept backups were made on a cron or forced schedule, pruning leaves
+	// them alone
+	Kept bool `json:"kept,omitempty"`
+}
+
+// Copy is a copy of a backup kept at one of the storage destinations
+type Copy struct {
+	Destination string    `json:"destination"`
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum,omitempty"`
+	StoredAt    time.Time `json:"storedAt"`
+}
+
+// Failure is the last thing that went wrong with a folder or world, kept
+// until it works again
+type Failure struct {
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+// newFailure is nil when there is no error
+func newFailure(err error) *Failure {
+	if err == nil {
+		return nil
+	}
+
+	return &Failure{Message: err.Error(), At: getNow()}
 }
 
 type World struct {
-	Id        string    `json:"id"`
-	CreatedAt time.Time `json:"createdAt"`
-	Name      string    `json:"name"`
-	FullPath  string    `json:"fullPath"`
-	Backups   []*Backup `json:"backups"`
+	Id         string    `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Name       string    `json:"name"`
+	FullPath   string    `json:"fullPath"`
+	Edition    string    `json:"edition"`
+	LevelName  string    `json:"levelName"`
+	LastPlayed time.Time `json:"lastPlayed"`
+	GameType   int       `json:"gameType"`
+	Version    string    `json:"version"`
+	Backups    []*Backup `json:"backups"`
+
+	// OwnerId is the user the world belongs to, SharedWith the users it
+	// was shared with
+	OwnerId    string   `json:"ownerId,omitempty"`
+	SharedWith []string `json:"sharedWith,omitempty"`
+
+	// LastCheckedAt is when the world was last due on its schedule,
+	// NextBackupAt when it is due next
+	LastCheckedAt time.Time `json:"lastCheckedAt"`
+	NextBackupAt  time.Time `json:"nextBackupAt"`
+
+	// LastError is why backing the world up last failed
+	LastError *Failure `json:"lastError,omitempty"`
+}
+
+// SetError keeps the error as the world's last, or clears it when nil
+func (world *World) SetError(err error) {
+	world.LastError = newFailure(err)
+}
+
+// HasAccess is true when the user owns the world or it was shared with them
+func (world *World) HasAccess(userId string) bool {
+	if world.OwnerId != "" && world.OwnerId == userId {
+		return true
+	}
+
+	for _, id := range world.SharedWith {
+		if id == userId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DisplayName is the in-game name of the world when we know it. Bedrock world
+// folders have random names so the folder name is only a fallback.
+func (world *World) DisplayName() string {
+	if world.LevelName != "" {
+		return world.LevelName
+	}
+
+	return world.Name
 }
 
 func (world *World) AddBackup(name string) *Backup {
@@ -28,6 +115,85 @@ func (world *World) AddBackup(name string) *Backup {
 	return &bu
 }
 
+// InsertBackup adds a backup made elsewhere, keeping the backups in the
+// order they were made
+func (world *World) InsertBackup(b *Backup) {
+	i := len(world.Backups)
+	for i > 0 && world.Backups[i-1].CreatedAt.After(b.CreatedAt) {
+		i--
+	}
+
+	world.Backups = append(world.Backups, nil)
+	copy(world.Backups[i+1:], world.Backups[i:])
+	world.Backups[i] = b
+}
+
+// SetFormat records the archive format of the backup, backups without one
+// are zip files
+func (bu *Backup) SetFormat(format string) *Backup {
+	bu.Format = format
+	return bu
+}
+
+// SetKeyId records the id of the key the backup was encrypted with, backups
+// without one are not encrypted
+func (bu *Backup) SetKeyId(keyId string) *Backup {
+	bu.KeyId = keyId
+	return bu
+}
+
+// SetRules records the include/exclude rules the backup was made with
+func (bu *Backup) SetRules(rules filter.Rules) {
+	if rules.IsEmpty() {
+		bu.Rules = nil
+		return
+	}
+
+	bu.Rules = &rules
+}
+
+// AddCopy records that the backup is stored at a destination, replacing what
+// was known about that destination before
+func (bu *Backup) AddCopy(c Copy) {
+	for i := range bu.Copies {
+		if bu.Copies[i].Destination == c.Destination {
+			bu.Copies[i] = c
+			return
+		}
+	}
+
+	bu.Copies = append(bu.Copies, c)
+}
+
+// GetCopy returns the copy kept at the destination, or nil if there is none
+func (bu *Backup) GetCopy(destination string) *Copy {
+	for i := range bu.Copies {
+		if bu.Copies[i].Destination == destination {
+			return &bu.Copies[i]
+		}
+	}
+
+	return nil
+}
+
+// Clone is the backup as it is now, for work done without the catalog held
+func (bu *Backup) Clone() *Backup {
+	c := *bu
+	c.Copies = append([]Copy(nil), bu.Copies...)
+
+	return &c
+}
+
+// RemoveCopy forgets the copy kept at the destination
+func (bu *Backup) RemoveCopy(destination string) {
+	for i := range bu.Copies {
+		if bu.Copies[i].Destination == destination {
+			bu.Copies = append(bu.Copies[:i], bu.Copies[i+1:]...)
+			return
+		}
+	}
+}
+
 func (world *World) LastBackupTime() time.Time {
 	l := len(world.Backups)
 	if l == 0 {
@@ -37,6 +203,23 @@ func (world *World) LastBackupTime() time.Time {
 	return world.Backups[l-1].CreatedAt
 }
 
+// Superseded are the backups followed by another one made within the
+// interval of it. Of backups made that close together only the last is kept,
+// along with the Kept ones.
+func (world *World) Superseded(within time.Duration) []*Backup {
+	var superseded []*Backup
+	for i := 0; i < len(world.Backups)-1; i++ {
+		if world.Backups[i].Kept {
+			continue
+		}
+		if world.Backups[i+1].CreatedAt.Sub(world.Backups[i].CreatedAt) < within {
+			superseded = append(superseded, world.Backups[i])
+		}
+	}
+
+	return superseded
+}
+
 func (world *World) GetBackup(id string) *Backup {
 	for i := range world.Backups {
 		if world.Backups[i].Id == id {
@@ -46,10 +229,17 @@ func (world *World) GetBackup(id string) *Backup {
 	return nil
 }
 
-func (world *World) RemoveBackup(id string) {
+// RemoveBackup drops the backup from the world. It is false when the world
+// has no such backup, a job or the watcher may have removed it already.
+func (world *World) RemoveBackup(id string) bool {
 	i := world.findBackupIndex(id)
+	if i < 0 {
+		return false
+	}
+
 	world.Backups[i] = nil
 	world.Backups = append(world.Backups[:i], world.Backups[i+1:]...)
+	return true
 }
 
 func (world *World) findBackupIndex(id string) int {
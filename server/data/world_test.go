@@ -4,6 +4,9 @@ import (
 	"testing"
 
 	"fmt"
+	"time"
+
+	"world-backup/server/filter"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -37,6 +40,17 @@ func TestWorld_AddBackup(t *testing.T) {
 
 		})
 
+		Convey("When we add a backup with its format, key and rules", func() {
+			world.AddBackup("Backup004.tar.zst.age").SetFormat("tar.zst").SetKeyId("nas").SetRules(filter.Rules{Exclude: []string{"logs/"}})
+
+			Convey("It should record them on the backup", func() {
+				b := world.Backups[len(world.Backups)-1]
+				So(b.Format, ShouldEqual, "tar.zst")
+				So(b.KeyId, ShouldEqual, "nas")
+				So(b.Rules.Exclude, ShouldResemble, []string{"logs/"})
+			})
+		})
+
 	})
 
 }
@@ -84,6 +98,11 @@ func TestWorld_RemoveBackup(t *testing.T) {
 				So(len(world.Backups), ShouldEqual, 4)
 				So(world.findBackupIndex(idToRemove), ShouldEqual, -1)
 			})
+
+			Convey("It should do nothing when it is removed again", func() {
+				So(world.RemoveBackup(idToRemove), ShouldBeFalse)
+				So(len(world.Backups), ShouldEqual, 4)
+			})
 		})
 	})
 }
@@ -116,3 +135,125 @@ func TestWorld_GetBackup(t *testing.T) {
 		})
 	})
 }
+
+func TestWorld_DisplayName(t *testing.T) {
+	Convey("Given a world", t, func() {
+		world := World{Name: "AbCdEf="}
+
+		Convey("When the level name is not known", func() {
+			Convey("It should use the folder name", func() {
+				So(world.DisplayName(), ShouldEqual, "AbCdEf=")
+			})
+		})
+
+		Convey("When the level name is known", func() {
+			world.LevelName = "Our Island"
+
+			Convey("It should use the level name", func() {
+				So(world.DisplayName(), ShouldEqual, "Our Island")
+			})
+		})
+	})
+}
+
+func TestWorld_HasAccess(t *testing.T) {
+	Convey("Given a world owned by one user and shared with another", t, func() {
+		world := World{OwnerId: "u1", SharedWith: []string{"u2"}}
+
+		Convey("It should let only them in", func() {
+			So(world.HasAccess("u1"), ShouldBeTrue)
+			So(world.HasAccess("u2"), ShouldBeTrue)
+			So(world.HasAccess("u3"), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a world without an owner", t, func() {
+		world := World{}
+
+		Convey("It should not let anyone in", func() {
+			So(world.HasAccess(""), ShouldBeFalse)
+		})
+	})
+}
+
+func TestBackup_Copies(t *testing.T) {
+	Convey("Given a backup with a copy", t, func() {
+		world := World{}
+		b := world.AddBackup("Backup 001")
+		b.AddCopy(Copy{Destination: "s3", Key: "Backup 001", Size: 10})
+
+		Convey("When a copy at the same destination is added", func() {
+			b.AddCopy(Copy{Destination: "s3", Key: "Backup 001", Size: 12})
+
+			Convey("It should replace the copy", func() {
+				So(len(b.Copies), ShouldEqual, 1)
+				So(b.GetCopy("s3").Size, ShouldEqual, 12)
+			})
+		})
+
+		Convey("When a copy at another destination is added", func() {
+			b.AddCopy(Copy{Destination: "nas", Key: "Backup 001"})
+
+			Convey("It should keep both", func() {
+				So(len(b.Copies), ShouldEqual, 2)
+				So(b.GetCopy("nas"), ShouldNotBeNil)
+				So(b.GetCopy("s3"), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the copy is removed", func() {
+			b.RemoveCopy("s3")
+
+			Convey("It should be gone", func() {
+				So(len(b.Copies), ShouldEqual, 0)
+				So(b.GetCopy("s3"), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestWorld_Superseded(t *testing.T) {
+	Convey("Given a world backed up in two sessions", t, func() {
+		start := time.Date(2020, 6, 6, 12, 0, 0, 0, time.UTC)
+		world := World{Backups: []*Backup{
+			{Id: "1", CreatedAt: start},
+			{Id: "2", CreatedAt: start.Add(time.Minute)},
+			{Id: "3", CreatedAt: start.Add(2 * time.Minute)},
+			{Id: "4", CreatedAt: start.Add(3 * time.Hour)},
+			{Id: "5", CreatedAt: start.Add(3*time.Hour + time.Minute)},
+		}}
+
+		Convey("It should keep the last backup of each session", func() {
+			superseded := world.Superseded(time.Minute + 2*time.Second)
+
+			So(superseded, ShouldResemble, []*Backup{world.Backups[0], world.Backups[1], world.Backups[3]})
+		})
+
+		Convey("It should leave kept backups alone", func() {
+			world.Backups[1].Kept = true
+			superseded := world.Superseded(time.Minute + 2*time.Second)
+
+			So(superseded, ShouldResemble, []*Backup{world.Backups[0], world.Backups[3]})
+		})
+	})
+}
+
+func TestWorld_InsertBackup(t *testing.T) {
+	Convey("Given a world with two backups", t, func() {
+		start := time.Date(2020, 6, 6, 12, 0, 0, 0, time.UTC)
+		b1 := &Backup{Id: "1", CreatedAt: start}
+		b3 := &Backup{Id: "3", CreatedAt: start.Add(2 * time.Hour)}
+		world := World{Backups: []*Backup{b1, b3}}
+
+		Convey("It should put backups made elsewhere in order", func() {
+			b0 := &Backup{Id: "0", CreatedAt: start.Add(-time.Hour)}
+			b2 := &Backup{Id: "2", CreatedAt: start.Add(time.Hour)}
+			b4 := &Backup{Id: "4", CreatedAt: start.Add(3 * time.Hour)}
+			world.InsertBackup(b2)
+			world.InsertBackup(b4)
+			world.InsertBackup(b0)
+
+			So(world.Backups, ShouldResemble, []*Backup{b0, b1, b2, b3, b4})
+		})
+	})
+}
@@ -0,0 +1,258 @@
+package diff
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"world-backup/server/fs"
+	"world-backup/server/region"
+)
+
+// Change describes what happened to a file or chunk between two backups
+type Change string
+
+const (
+	Added    Change = "added"
+	Removed  Change = "removed"
+	Modified Change = "changed"
+)
+
+// Result is the difference between two backups of the same world
+type Result struct {
+	Added      []string    `json:"added"`
+	Removed    []string    `json:"removed"`
+	Changed    []string    `json:"changed"`
+	Dimensions []Dimension `json:"dimensions"`
+}
+
+// Dimension groups the changed regions of one dimension
+type Dimension struct {
+	Name    string   `json:"name"`
+	Regions []Region `json:"regions"`
+}
+
+// Region lists the chunks that changed inside a region file
+type Region struct {
+	X      int     `json:"x"`
+	Z      int     `json:"z"`
+	File   string  `json:"file"`
+	Change Change  `json:"change"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+// Chunk is a changed chunk, in chunk coordinates
+type Chunk struct {
+	X      int    `json:"x"`
+	Z      int    `json:"z"`
+	Change Change `json:"change"`
+}
+
+type IDiffFs interface {
+	OpenArchive(file fs.ArchiveFile) (fs.ArchiveReader, error)
+}
+
+// Backups compares the backup in base with the later one in target
+var Backups = func(f IDiffFs, baseFile, targetFile fs.ArchiveFile) (*Result, error) {
+	base, err := f.OpenArchive(baseFile)
+	if err != nil {
+		return nil, err
+	}
+	defer base.Close()
+
+	target, err := f.OpenArchive(targetFile)
+	if err != nil {
+		return nil, err
+	}
+	defer target.Close()
+
+	return Compare(base, target)
+}
+
+// Compare reports what changed going from base to target. Files are compared
+// by size and checksum, Anvil region files are also compared chunk by chunk.
+func Compare(base, target fs.ArchiveReader) (*Result, error) {
+	baseEntries := entriesByName(base)
+	targetEntries := entriesByName(target)
+
+	result := Result{}
+	dimensions := map[string]*Dimension{}
+
+	for _, name := range sortedNames(baseEntries, targetEntries) {
+		b, inBase := baseEntries[name]
+		t, inTarget := targetEntries[name]
+
+		var change Change
+		switch {
+		case !inBase:
+			change = Added
+			result.Added = append(result.Added, name)
+		case !inTarget:
+			change = Removed
+			result.Removed = append(result.Removed, name)
+		case b.Size != t.Size || b.CRC32 != t.CRC32:
+			change = Modified
+			result.Changed = append(result.Changed, name)
+		default:
+			continue
+		}
+
+		dimName, rx, rz, ok := regionFile(name)
+		if !ok {
+			continue
+		}
+
+		r, err := compareRegion(base, b, target, t, rx, rz)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(r.Chunks) == 0 {
+			continue
+		}
+
+		r.File = name
+		r.Change = change
+
+		dim, found := dimensions[dimName]
+		if !found {
+			dim = &Dimension{Name: dimName}
+			dimensions[dimName] = dim
+		}
+		dim.Regions = append(dim.Regions, *r)
+	}
+
+	for _, d := range dimensions {
+		result.Dimensions = append(result.Dimensions, *d)
+	}
+	sort.Slice(result.Dimensions, func(i, j int) bool { return result.Dimensions[i].Name < result.Dimensions[j].Name })
+
+	return &result, nil
+}
+
+func compareRegion(base fs.ArchiveReader, b fs.ArchiveEntry, target fs.ArchiveReader, t fs.ArchiveEntry, rx, rz int) (*Region, error) {
+	baseRegion, err := readRegion(base, b)
+	if err != nil {
+		return nil, err
+	}
+
+	targetRegion, err := readRegion(target, t)
+	if err != nil {
+		return nil, err
+	}
+
+	r := Region{X: rx, Z: rz}
+
+	for i := 0; i < region.ChunkCount; i++ {
+		inBase := baseRegion.HasChunk(i)
+		inTarget := targetRegion.HasChunk(i)
+
+		var change Change
+		switch {
+		case !inBase && !inTarget:
+			continue
+		case !inBase:
+			change = Added
+		case !inTarget:
+			change = Removed
+		case baseRegion.Timestamp(i) == targetRegion.Timestamp(i):
+			// minecraft stamps every chunk it saves, so we only hash the
+			// chunks it has written since the base backup
+			continue
+		default:
+			same, err := sameChunk(baseRegion, targetRegion, i)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				continue
+			}
+			change = Modified
+		}
+
+		x, z := region.ChunkCoords(rx, rz, i)
+		r.Chunks = append(r.Chunks, Chunk{X: x, Z: z, Change: change})
+	}
+
+	return &r, nil
+}
+
+func sameChunk(base, target *region.Region, i int) (bool, error) {
+	b, err := base.Chunk(i)
+	if err != nil {
+		return false, err
+	}
+
+	t, err := target.Chunk(i)
+	if err != nil {
+		return false, err
+	}
+
+	return b.Hash() == t.Hash(), nil
+}
+
+// readRegion parses a region from the archive, a missing entry is an empty region
+func readRegion(a fs.ArchiveReader, e fs.ArchiveEntry) (*region.Region, error) {
+	if e.Name == "" {
+		return region.Parse(nil)
+	}
+
+	b, err := a.ReadFile(e.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return region.Parse(b)
+}
+
+// entriesByName indexes the archive by path relative to the world folder,
+// keeping the original entry name so it can be read back
+func entriesByName(a fs.ArchiveReader) map[string]fs.ArchiveEntry {
+	entries := map[string]fs.ArchiveEntry{}
+	for _, e := range a.Entries() {
+		entries[worldRelative(e.Name)] = e
+	}
+
+	return entries
+}
+
+func sortedNames(a, b map[string]fs.ArchiveEntry) []string {
+	var names []string
+	for n := range a {
+		names = append(names, n)
+	}
+	for n := range b {
+		if _, ok := a[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// worldRelative drops the world folder every backup nests its files under
+func worldRelative(name string) string {
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+
+	return name
+}
+
+// regionFile works out the dimension and region coordinates of a region file
+// path such as DIM-1/region/r.0.-1.mca
+func regionFile(name string) (string, int, int, bool) {
+	dir, file := path.Split(name)
+	rx, rz, ok := region.ParseName(file)
+	if !ok {
+		return "", 0, 0, false
+	}
+
+	dir = strings.TrimSuffix(dir, "/")
+	if path.Base(dir) != "region" {
+		return "", 0, 0, false
+	}
+
+	return region.DimensionName(path.Dir(dir)), rx, rz, true
+}
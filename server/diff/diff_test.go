@@ -0,0 +1,160 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"world-backup/server/fs"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeArchive struct {
+	files map[string][]byte
+}
+
+func (a *fakeArchive) Entries() []fs.ArchiveEntry {
+	var entries []fs.ArchiveEntry
+	for name, b := range a.files {
+		entries = append(entries, fs.ArchiveEntry{Name: name, Size: int64(len(b)), CRC32: crc32.ChecksumIEEE(b)})
+	}
+	return entries
+}
+
+func (a *fakeArchive) ReadFile(name string) ([]byte, error) {
+	b, ok := a.files[name]
+	if !ok {
+		return nil, errors.New("missing")
+	}
+	return b, nil
+}
+
+func (a *fakeArchive) Walk(fn func(e fs.ArchiveEntry, r io.Reader) error) error {
+	for _, e := range a.Entries() {
+		if err := fn(e, bytes.NewReader(a.files[e.Name])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *fakeArchive) Close() error { return nil }
+
+type fakeFs struct {
+	archives map[string]*fakeArchive
+}
+
+func (f *fakeFs) OpenArchive(file fs.ArchiveFile) (fs.ArchiveReader, error) {
+	a, ok := f.archives[file.Path]
+	if !ok {
+		return nil, errors.New("no such archive")
+	}
+	return a, nil
+}
+
+type chunk struct {
+	payload   []byte
+	timestamp uint32
+}
+
+// buildRegion lays out the chunks one sector each after the two header sectors
+func buildRegion(chunks map[int]chunk) []byte {
+	b := make([]byte, 8192)
+	sector := 2
+
+	for i := 0; i < 1024; i++ {
+		c, ok := chunks[i]
+		if !ok {
+			continue
+		}
+
+		binary.BigEndian.PutUint32(b[i*4:], uint32(sector<<8|1))
+		binary.BigEndian.PutUint32(b[4096+i*4:], c.timestamp)
+
+		s := make([]byte, 4096)
+		binary.BigEndian.PutUint32(s, uint32(len(c.payload)))
+		copy(s[4:], c.payload)
+		b = append(b, s...)
+		sector++
+	}
+
+	return b
+}
+
+func TestCompare(t *testing.T) {
+	Convey("Given two backups of the same world", t, func() {
+		base := &fakeArchive{files: map[string][]byte{
+			"World/level.dat":               []byte("level 1"),
+			"World/stats/paul.json":         []byte("{}"),
+			"World/region/r.0.0.mca":        buildRegion(map[int]chunk{0: {[]byte{2, 1}, 10}, 1: {[]byte{2, 2}, 10}, 2: {[]byte{2, 3}, 10}, 3: {[]byte{2, 4}, 10}}),
+			"World/DIM-1/region/r.-1.0.mca": buildRegion(map[int]chunk{5: {[]byte{2, 5}, 10}}),
+		}}
+
+		target := &fakeArchive{files: map[string][]byte{
+			"World/level.dat":                             []byte("level 2"),
+			"World/stats/logan.json":                      []byte("{}"),
+			"World/region/r.0.0.mca":                      buildRegion(map[int]chunk{0: {[]byte{2, 1}, 10}, 1: {[]byte{2, 9}, 20}, 2: {[]byte{2, 3}, 20}, 40: {[]byte{2, 7}, 20}}),
+			"World/DIM-1/region/r.-1.0.mca":               buildRegion(map[int]chunk{5: {[]byte{2, 5}, 10}}),
+			"World/dimensions/mymod/sky/region/r.1.1.mca": buildRegion(map[int]chunk{0: {[]byte{2, 5}, 10}}),
+		}}
+
+		result, err := Compare(base, target)
+		So(err, ShouldBeNil)
+
+		Convey("It should list the files that changed", func() {
+			So(result.Added, ShouldResemble, []string{"dimensions/mymod/sky/region/r.1.1.mca", "stats/logan.json"})
+			So(result.Removed, ShouldResemble, []string{"stats/paul.json"})
+			So(result.Changed, ShouldResemble, []string{"level.dat", "region/r.0.0.mca"})
+		})
+
+		Convey("It should list the chunks that changed per dimension", func() {
+			So(len(result.Dimensions), ShouldEqual, 2)
+
+			modded := result.Dimensions[1]
+			So(modded.Name, ShouldEqual, "mymod:sky")
+			So(modded.Regions[0].Change, ShouldEqual, Added)
+			So(modded.Regions[0].Chunks, ShouldResemble, []Chunk{{X: 32, Z: 32, Change: Added}})
+
+			overworld := result.Dimensions[0]
+			So(overworld.Name, ShouldEqual, "minecraft:overworld")
+			So(len(overworld.Regions), ShouldEqual, 1)
+			So(overworld.Regions[0].File, ShouldEqual, "region/r.0.0.mca")
+			So(overworld.Regions[0].Change, ShouldEqual, Modified)
+			So(overworld.Regions[0].Chunks, ShouldResemble, []Chunk{
+				{X: 1, Z: 0, Change: Modified},
+				{X: 3, Z: 0, Change: Removed},
+				{X: 8, Z: 1, Change: Added},
+			})
+		})
+	})
+}
+
+func TestBackups(t *testing.T) {
+	Convey("Given a file system with backups", t, func() {
+		f := &fakeFs{archives: map[string]*fakeArchive{
+			"/backups/a.zip":     {files: map[string][]byte{"W/level.dat": []byte("1")}},
+			"/backups/b.tar.zst": {files: map[string][]byte{"W/level.dat": []byte("2")}},
+		}}
+
+		Convey("When both backups can be opened", func() {
+			result, err := Backups(f, fs.ArchiveFile{Path: "/backups/a.zip"}, fs.ArchiveFile{Path: "/backups/b.tar.zst", Format: fs.TarZst})
+
+			Convey("It should compare them", func() {
+				So(err, ShouldBeNil)
+				So(result.Changed, ShouldResemble, []string{"level.dat"})
+			})
+		})
+
+		Convey("When a backup is missing", func() {
+			_, err := Backups(f, fs.ArchiveFile{Path: "/backups/a.zip"}, fs.ArchiveFile{Path: "/backups/c.zip"})
+
+			Convey("It should return the error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,143 @@
+// Package events passes what happens to worlds and backups on to anyone
+// listening, so the client doesn't have to keep asking
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+var getNow = time.Now
+
+// Types of event
+const (
+	WorldDiscovered = "world.discovered"
+	BackupStarted   = "backup.started"
+	BackupProgress  = "backup.progress"
+	BackupFinished  = "backup.finished"
+	BackupFailed    = "backup.failed"
+	BackupDeleted   = "backup.deleted"
+	RestoreStarted  = "restore.started"
+	RestoreProgress = "restore.progress"
+	RestoreFinished = "restore.finished"
+	RestoreFailed   = "restore.failed"
+)
+
+// Event is something that happened to a world or backup. Ids go up by one
+// for each event, so a listener can tell what it missed.
+type Event struct {
+	Id       int64       `json:"id"`
+	Type     string      `json:"type"`
+	Time     time.Time   `json:"time"`
+	FolderId string      `json:"folderId,omitempty"`
+	WorldId  string      `json:"worldId,omitempty"`
+	BackupId string      `json:"backupId,omitempty"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+// defaultHistory is how many events are kept for listeners resuming
+const defaultHistory = 256
+
+// subscriberBuffer is how many events can wait for a slow listener before
+// it is dropped, it resumes from the last event it saw when it comes back
+const subscriberBuffer = 64
+
+// Bus hands every event published to all subscribers, and keeps the last
+// few so listeners that reconnect can catch up
+type Bus struct {
+	mu          sync.Mutex
+	lastId      int64
+	history     []Event
+	size        int
+	subscribers map[*Subscription]bool
+}
+
+// NewBus creates a bus keeping the last history events, or a default
+// number when it is 0
+func NewBus(history int) *Bus {
+	if history <= 0 {
+		history = defaultHistory
+	}
+
+	return &Bus{size: history, subscribers: map[*Subscription]bool{}}
+}
+
+// Publish numbers the event and sends it to the subscribers
+func (b *Bus) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastId++
+	e.Id = b.lastId
+	if e.Time.IsZero() {
+		e.Time = getNow()
+	}
+
+	b.history = append(b.history, e)
+	if len(b.history) > b.size {
+		b.history = append([]Event(nil), b.history[len(b.history)-b.size:]...)
+	}
+
+	for s := range b.subscribers {
+		select {
+		case s.c <- e:
+		default:
+			b.drop(s)
+		}
+	}
+
+	return e
+}
+
+// Subscribe starts listening for events. Events after lastId that are still
+// kept are sent first, so a listener picks up where it left off; 0 only
+// listens for new ones.
+func (b *Bus) Subscribe(lastId int64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var missed []Event
+	if lastId > 0 {
+		for _, e := range b.history {
+			if e.Id > lastId {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	s := &Subscription{bus: b, c: make(chan Event, len(missed)+subscriberBuffer)}
+	for _, e := range missed {
+		s.c <- e
+	}
+	b.subscribers[s] = true
+
+	return s
+}
+
+// drop stops sending to a subscriber, the lock must be held
+func (b *Bus) drop(s *Subscription) {
+	if b.subscribers[s] {
+		delete(b.subscribers, s)
+		close(s.c)
+	}
+}
+
+// Subscription receives the events published on a bus
+type Subscription struct {
+	bus *Bus
+	c   chan Event
+}
+
+// Events is closed once the subscription is closed, or was dropped for not
+// keeping up
+func (s *Subscription) Events() <-chan Event {
+	return s.c
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.bus.drop(s)
+}
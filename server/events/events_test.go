@@ -0,0 +1,131 @@
+package events
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"world-backup/server/data"
+	"world-backup/server/jobs"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBus(t *testing.T) {
+	Convey("Given a bus keeping the last two events", t, func() {
+		b := NewBus(2)
+		sub := b.Subscribe(0)
+		defer sub.Close()
+
+		first := b.Publish(Event{Type: WorldDiscovered, WorldId: "w1"})
+		b.Publish(Event{Type: BackupStarted, WorldId: "w1"})
+		b.Publish(Event{Type: BackupFinished, WorldId: "w1", BackupId: "b1"})
+
+		Convey("It should number the events and send them to subscribers", func() {
+			So(first.Id, ShouldEqual, 1)
+			So(first.Time.IsZero(), ShouldBeFalse)
+
+			So((<-sub.Events()).Type, ShouldEqual, WorldDiscovered)
+			So((<-sub.Events()).Type, ShouldEqual, BackupStarted)
+			So((<-sub.Events()).Id, ShouldEqual, 3)
+		})
+
+		Convey("When a listener resumes", func() {
+			resumed := b.Subscribe(1)
+			defer resumed.Close()
+
+			Convey("It should be sent the kept events it missed", func() {
+				So(len(resumed.Events()), ShouldEqual, 2)
+				So((<-resumed.Events()).Id, ShouldEqual, 2)
+				So((<-resumed.Events()).Id, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When a listener doesn't keep up", func() {
+			for i := 0; i < subscriberBuffer; i++ {
+				b.Publish(Event{Type: BackupProgress})
+			}
+
+			Convey("It should be dropped", func() {
+				for range sub.Events() {
+				}
+				So(b.subscribers, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a subscription is closed", func() {
+			sub.Close()
+			sub.Close()
+
+			Convey("Its events should be closed", func() {
+				for range sub.Events() {
+				}
+				So(b.subscribers, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestBus_Jobs(t *testing.T) {
+	Convey("Given a bus listening to jobs", t, func() {
+		logger := logrus.New()
+		logger.Out = ioutil.Discard
+
+		m, _ := jobs.NewManager(logrus.NewEntry(logger), jobs.Config{})
+		b := NewBus(0)
+		m.SetListener(b)
+
+		sub := b.Subscribe(0)
+		defer sub.Close()
+
+		run := func(kind, backupId string, fn jobs.Func) {
+			m.Wait(m.Submit(kind, "w1", backupId, fn).Id)
+		}
+
+		Convey("When a backup is made", func() {
+			run(jobs.Backup, "", func(p *jobs.Progress) error {
+				p.SetResult(&data.Backup{Id: "b1"})
+				return nil
+			})
+
+			Convey("It should publish that it started and finished", func() {
+				started := <-sub.Events()
+				So(started.Type, ShouldEqual, BackupStarted)
+				So(started.WorldId, ShouldEqual, "w1")
+
+				finished := <-sub.Events()
+				So(finished.Type, ShouldEqual, BackupFinished)
+				So(finished.BackupId, ShouldEqual, "b1")
+				So(finished.Data.(jobs.Job).State, ShouldEqual, jobs.Done)
+			})
+		})
+
+		Convey("When a restore fails", func() {
+			run(jobs.Restore, "b1", func(p *jobs.Progress) error {
+				return errors.New("bad checksum")
+			})
+
+			Convey("It should publish that it failed", func() {
+				So((<-sub.Events()).Type, ShouldEqual, RestoreStarted)
+
+				failed := <-sub.Events()
+				So(failed.Type, ShouldEqual, RestoreFailed)
+				So(failed.BackupId, ShouldEqual, "b1")
+			})
+		})
+
+		Convey("When a backup is pruned and verified", func() {
+			run(jobs.Prune, "b1", func(p *jobs.Progress) error { return nil })
+			run(jobs.Verify, "b2", func(p *jobs.Progress) error { return nil })
+
+			Convey("It should only publish that the backup was deleted", func() {
+				So(len(sub.Events()), ShouldEqual, 1)
+
+				deleted := <-sub.Events()
+				So(deleted.Type, ShouldEqual, BackupDeleted)
+				So(deleted.BackupId, ShouldEqual, "b1")
+			})
+		})
+	})
+}
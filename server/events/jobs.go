@@ -0,0 +1,61 @@
+package events
+
+import (
+	"world-backup/server/data"
+	"world-backup/server/jobs"
+)
+
+// JobStarted publishes that a backup or restore started
+func (b *Bus) JobStarted(job jobs.Job) {
+	switch job.Kind {
+	case jobs.Backup:
+		b.publishJob(BackupStarted, job)
+	case jobs.Restore:
+		b.publishJob(RestoreStarted, job)
+	}
+}
+
+// JobProgress publishes how far a backup or restore got
+func (b *Bus) JobProgress(job jobs.Job) {
+	switch job.Kind {
+	case jobs.Backup:
+		b.publishJob(BackupProgress, job)
+	case jobs.Restore:
+		b.publishJob(RestoreProgress, job)
+	}
+}
+
+// JobFinished publishes how a backup or restore ended, and that a backup
+// was deleted once a prune is done
+func (b *Bus) JobFinished(job jobs.Job) {
+	done := job.State == jobs.Done
+
+	switch {
+	case job.Kind == jobs.Backup && done:
+		b.publishJob(BackupFinished, job)
+	case job.Kind == jobs.Backup:
+		b.publishJob(BackupFailed, job)
+	case job.Kind == jobs.Restore && done:
+		b.publishJob(RestoreFinished, job)
+	case job.Kind == jobs.Restore:
+		b.publishJob(RestoreFailed, job)
+	case job.Kind == jobs.Prune && done:
+		b.publishJob(BackupDeleted, job)
+	}
+}
+
+// publishJob publishes an event about the job, a backup job only knows its
+// backup once it is done
+func (b *Bus) publishJob(t string, job jobs.Job) {
+	backupId := job.BackupId
+	if backup, ok := job.Result.(*data.Backup); ok && backupId == "" {
+		backupId = backup.Id
+	}
+
+	b.Publish(Event{
+		Type:     t,
+		WorldId:  job.WorldId,
+		BackupId: backupId,
+		Data:     job,
+	})
+}
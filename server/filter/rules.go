@@ -0,0 +1,188 @@
+package filter
+
+import (
+	"path"
+	"strings"
+)
+
+// Rules are gitignore style patterns that decide which files of a world end
+// up in a backup. When Include is empty every file is included.
+type Rules struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+}
+
+// IsEmpty is true when the rules would not filter anything
+func (r Rules) IsEmpty() bool {
+	return len(r.Include) == 0 && len(r.Exclude) == 0
+}
+
+// Merge concatenates rule sets, most general first, so that the patterns of
+// the later (more specific) sets win in the same way later lines of a
+// .gitignore do.
+func Merge(sets ...Rules) Rules {
+	var merged Rules
+	for i := range sets {
+		merged.Include = append(merged.Include, sets[i].Include...)
+		merged.Exclude = append(merged.Exclude, sets[i].Exclude...)
+	}
+
+	return merged
+}
+
+// Matcher is a compiled set of Rules
+type Matcher struct {
+	include []pattern
+	exclude []pattern
+}
+
+// Compile parses the patterns of the rules. A nil *Matcher excludes nothing.
+func Compile(r Rules) *Matcher {
+	if r.IsEmpty() {
+		return nil
+	}
+
+	return &Matcher{
+		include: parseAll(r.Include),
+		exclude: parseAll(r.Exclude),
+	}
+}
+
+// Excluded reports whether the slash separated path, relative to the world
+// folder, should be left out. Excluding a directory excludes everything in it.
+func (m *Matcher) Excluded(rel string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+
+	segments := split(rel)
+	if len(segments) == 0 {
+		return false
+	}
+
+	for i := 1; i < len(segments); i++ {
+		if lastMatch(m.exclude, segments[:i], true) {
+			return true
+		}
+	}
+
+	if lastMatch(m.exclude, segments, isDir) {
+		return true
+	}
+
+	if isDir || len(m.include) == 0 {
+		return false
+	}
+
+	for i := 1; i <= len(segments); i++ {
+		if lastMatch(m.include, segments[:i], i < len(segments)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type pattern struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+func parseAll(lines []string) []pattern {
+	var patterns []pattern
+	for i := range lines {
+		if p, ok := parse(lines[i]); ok {
+			patterns = append(patterns, p)
+		}
+	}
+
+	return patterns
+}
+
+func parse(line string) (pattern, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+
+	p := pattern{}
+
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	// like git, a slash anywhere but the end ties the pattern to the root
+	p.anchored = strings.Contains(line, "/")
+	p.segments = split(line)
+
+	return p, len(p.segments) > 0
+}
+
+func split(rel string) []string {
+	var segments []string
+	for _, s := range strings.Split(strings.Replace(rel, "\\", "/", -1), "/") {
+		if s != "" && s != "." {
+			segments = append(segments, s)
+		}
+	}
+
+	return segments
+}
+
+// lastMatch returns true when the last pattern to match the path is not a
+// negation, mirroring gitignore's "last line wins".
+func lastMatch(patterns []pattern, segments []string, isDir bool) bool {
+	matched := false
+	for i := range patterns {
+		if patterns[i].matches(segments, isDir) {
+			matched = !patterns[i].negate
+		}
+	}
+
+	return matched
+}
+
+func (p pattern) matches(segments []string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if !p.anchored {
+		return matchSegments(p.segments, segments[len(segments)-1:])
+	}
+
+	return matchSegments(p.segments, segments)
+}
+
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+		return false
+	}
+
+	return matchSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,105 @@
+package filter
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRules_Merge(t *testing.T) {
+	Convey("Given global, folder and world rules", t, func() {
+		global := Rules{Exclude: []string{"logs/"}}
+		folder := Rules{Exclude: []string{"session.lock"}}
+		world := Rules{Include: []string{"region/"}, Exclude: []string{"!logs/"}}
+
+		Convey("It should concatenate them in order", func() {
+			merged := Merge(global, folder, world)
+
+			So(merged.Include, ShouldResemble, []string{"region/"})
+			So(merged.Exclude, ShouldResemble, []string{"logs/", "session.lock", "!logs/"})
+		})
+
+		Convey("It should be empty when nothing is set", func() {
+			So(Merge(Rules{}, Rules{}).IsEmpty(), ShouldBeTrue)
+			So(Compile(Rules{}), ShouldBeNil)
+		})
+	})
+}
+
+func TestMatcher_Excluded(t *testing.T) {
+	Convey("Given no rules", t, func() {
+		var m *Matcher
+
+		Convey("It should not exclude anything", func() {
+			So(m.Excluded("region/r.0.0.mca", false), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given exclude patterns", t, func() {
+		m := Compile(Rules{Exclude: []string{
+			"# generated map renders",
+			"bluemap/",
+			"session.lock",
+			"*.log",
+			"/data/cache",
+			"**/tmp/**",
+			"!keep.log",
+		}})
+
+		Convey("It should exclude a directory and everything in it", func() {
+			So(m.Excluded("bluemap", true), ShouldBeTrue)
+			So(m.Excluded("bluemap/web/index.html", false), ShouldBeTrue)
+		})
+
+		Convey("It should only apply directory patterns to directories", func() {
+			So(m.Excluded("bluemap", false), ShouldBeFalse)
+		})
+
+		Convey("It should match unanchored patterns at any depth", func() {
+			So(m.Excluded("session.lock", false), ShouldBeTrue)
+			So(m.Excluded("DIM1/session.lock", false), ShouldBeTrue)
+			So(m.Excluded("logs/latest.log", false), ShouldBeTrue)
+		})
+
+		Convey("It should anchor patterns with a slash to the world folder", func() {
+			So(m.Excluded("data/cache", true), ShouldBeTrue)
+			So(m.Excluded("DIM1/data/cache", true), ShouldBeFalse)
+		})
+
+		Convey("It should support ** across directories", func() {
+			So(m.Excluded("a/b/tmp/c.dat", false), ShouldBeTrue)
+		})
+
+		Convey("It should let a later negation re-include a file", func() {
+			So(m.Excluded("keep.log", false), ShouldBeFalse)
+		})
+
+		Convey("It should keep everything else", func() {
+			So(m.Excluded("level.dat", false), ShouldBeFalse)
+			So(m.Excluded("region/r.0.0.mca", false), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given include patterns", t, func() {
+		m := Compile(Rules{
+			Include: []string{"level.dat", "region/", "playerdata/*.dat"},
+			Exclude: []string{"region/r.9.9.mca"},
+		})
+
+		Convey("It should keep only files that are included", func() {
+			So(m.Excluded("level.dat", false), ShouldBeFalse)
+			So(m.Excluded("region/r.0.0.mca", false), ShouldBeFalse)
+			So(m.Excluded("playerdata/abc.dat", false), ShouldBeFalse)
+			So(m.Excluded("playerdata/abc.dat_old", false), ShouldBeTrue)
+			So(m.Excluded("stats/abc.json", false), ShouldBeTrue)
+		})
+
+		Convey("It should still walk into directories", func() {
+			So(m.Excluded("stats", true), ShouldBeFalse)
+		})
+
+		Convey("It should apply excludes after includes", func() {
+			So(m.Excluded("region/r.9.9.mca", false), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,29 @@
+package fs
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// ArchiveEntry is a file stored in a backup archive
+type ArchiveEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	CRC32   uint32    `json:"crc32"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// ArchiveReader gives access to the files in a backup archive
+type ArchiveReader interface {
+	Entries() []ArchiveEntry
+	ReadFile(name string) ([]byte, error)
+	// Walk streams every file in the archive in the order it is stored
+	Walk(fn func(e ArchiveEntry, r io.Reader) error) error
+	Close() error
+}
+
+// entryName normalizes the separators of archives written on Windows
+func entryName(name string) string {
+	return strings.Replace(name, "\\", "/", -1)
+}
@@ -0,0 +1,239 @@
+package fs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"world-backup/server/filter"
+	"world-backup/server/jobs"
+	"world-backup/server/throttle"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+func TestFileSystem_OpenArchive(t *testing.T) {
+	for _, format := range []Format{Zip, TarGz, TarZst} {
+		Convey("Given a "+string(format)+" backup", t, func() {
+			dir, _ := ioutil.TempDir("", "archive")
+			defer os.RemoveAll(dir)
+
+			world := filepath.Join(dir, "MyWorld")
+			os.MkdirAll(filepath.Join(world, "region"), 0755)
+			ioutil.WriteFile(filepath.Join(world, "level.dat"), []byte("level"), 0644)
+			ioutil.WriteFile(filepath.Join(world, "region", "r.0.0.mca"), []byte("region"), 0644)
+
+			f := NewFs(afero.NewOsFs())
+			file := ArchiveFile{Path: filepath.Join(dir, "backup"+format.Extension()), Format: format}
+			So(f.Archive(world, file.Path, ArchiveOptions{Format: format}, filter.Rules{}), ShouldBeNil)
+
+			a, err := f.OpenArchive(file)
+			So(err, ShouldBeNil)
+			defer a.Close()
+
+			Convey("It should list the files without directories", func() {
+				entries := a.Entries()
+
+				So(len(entries), ShouldEqual, 2)
+				So(entries[0].Name, ShouldEqual, "MyWorld/level.dat")
+				So(entries[0].Size, ShouldEqual, 5)
+				So(entries[0].CRC32, ShouldEqual, 0x9aeacc13)
+				So(entries[1].Name, ShouldEqual, "MyWorld/region/r.0.0.mca")
+			})
+
+			Convey("It should read a file", func() {
+				b, err := a.ReadFile("MyWorld/region/r.0.0.mca")
+
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "region")
+			})
+
+			Convey("It should fail to read a missing file", func() {
+				_, err := a.ReadFile("MyWorld/nope")
+
+				So(err, ShouldNotBeNil)
+			})
+
+			Convey("It should walk the files in order", func() {
+				var names, contents []string
+				err := a.Walk(func(e ArchiveEntry, r io.Reader) error {
+					b, _ := ioutil.ReadAll(r)
+					names = append(names, e.Name)
+					contents = append(contents, string(b))
+					return nil
+				})
+
+				So(err, ShouldBeNil)
+				So(names, ShouldResemble, []string{"MyWorld/level.dat", "MyWorld/region/r.0.0.mca"})
+				So(contents, ShouldResemble, []string{"level", "region"})
+			})
+
+			Convey("It should extract it", func() {
+				out := filepath.Join(dir, "restore")
+				So(f.Extract(file, out), ShouldBeNil)
+
+				b, _ := ioutil.ReadFile(filepath.Join(out, "MyWorld", "region", "r.0.0.mca"))
+				So(string(b), ShouldEqual, "region")
+			})
+
+			Convey("It should verify", func() {
+				So(f.VerifyArchive(file), ShouldBeNil)
+			})
+
+			Convey("When the archive is damaged", func() {
+				b, _ := ioutil.ReadFile(file.Path)
+				ioutil.WriteFile(file.Path, b[:len(b)-20], 0644)
+
+				Convey("It should fail to verify", func() {
+					So(f.VerifyArchive(file), ShouldNotBeNil)
+				})
+			})
+		})
+	}
+}
+
+func TestNewArchiver(t *testing.T) {
+	Convey("Given archive options", t, func() {
+		Convey("When no format is set", func() {
+			a, err := NewArchiver(ArchiveOptions{})
+
+			Convey("It should default to zip", func() {
+				So(err, ShouldBeNil)
+				So(a, ShouldHaveSameTypeAs, &zipArchiver{})
+				So(Format("").Extension(), ShouldEqual, ".zip")
+			})
+		})
+
+		Convey("When the format is unknown", func() {
+			_, err := NewArchiver(ArchiveOptions{Format: "rar"})
+
+			Convey("It should return UnknownFormatError", func() {
+				So(err, ShouldEqual, UnknownFormatError)
+			})
+		})
+
+		Convey("When the level is out of range", func() {
+			_, gzErr := NewArchiver(ArchiveOptions{Format: TarGz, Level: 12})
+			_, zstErr := NewArchiver(ArchiveOptions{Format: TarZst, Level: 19})
+
+			Convey("It should return an error for formats that don't support it", func() {
+				So(gzErr, ShouldNotBeNil)
+				So(zstErr, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestFileSystem_ArchiveThrottled(t *testing.T) {
+	for _, format := range []Format{Zip, TarZst} {
+		Convey("Given a "+string(format)+" backup made with a throttle", t, func() {
+			dir, _ := ioutil.TempDir("", "archive")
+			defer os.RemoveAll(dir)
+
+			world := filepath.Join(dir, "MyWorld")
+			os.MkdirAll(world, 0755)
+			ioutil.WriteFile(filepath.Join(world, "level.dat"), make([]byte, 24<<10), 0644)
+
+			limits, _ := throttle.New(throttle.Config{ReadRate: 16, Workers: 2})
+			f := NewFs(afero.NewOsFs())
+			f.SetThrottle(limits)
+			file := ArchiveFile{Path: filepath.Join(dir, "backup"+format.Extension()), Format: format}
+
+			Convey("It should read the world no faster than the limit", func() {
+				start := time.Now()
+				So(f.Archive(world, file.Path, ArchiveOptions{Format: format}, filter.Rules{}), ShouldBeNil)
+				// the first second is allowed at once
+				So(time.Since(start), ShouldBeGreaterThan, 400*time.Millisecond)
+				So(f.VerifyArchive(file), ShouldBeNil)
+			})
+
+			Convey("It should still make the backup at low priority", func() {
+				limits.Set(throttle.Config{LowPriority: true})
+
+				So(f.Archive(world, file.Path, ArchiveOptions{Format: format}, filter.Rules{}), ShouldBeNil)
+				So(f.VerifyArchive(file), ShouldBeNil)
+			})
+		})
+	}
+}
+
+func TestFileSystem_ArchiveJobs(t *testing.T) {
+	for _, format := range []Format{Zip, TarGz} {
+		Convey("Given a "+string(format)+" backup made in a job", t, func() {
+			dir, _ := ioutil.TempDir("", "archive")
+			defer os.RemoveAll(dir)
+
+			world := filepath.Join(dir, "MyWorld")
+			os.MkdirAll(filepath.Join(world, "region"), 0755)
+			ioutil.WriteFile(filepath.Join(world, "level.dat"), make([]byte, 100), 0644)
+			ioutil.WriteFile(filepath.Join(world, "region", "r.0.0.mca"), make([]byte, 24<<10), 0644)
+
+			manager, _ := jobs.NewManager(logrus.WithField("test", "fs"), jobs.Config{})
+			f := NewFs(afero.NewOsFs())
+			file := ArchiveFile{Path: filepath.Join(dir, "backup"+format.Extension()), Format: format}
+
+			run := func(fn jobs.Func) jobs.Job {
+				job, _ := manager.Wait(manager.Submit(jobs.Backup, "w1", "", fn).Id)
+				return job
+			}
+
+			job := run(func(p *jobs.Progress) error {
+				return f.Archive(world, file.Path, ArchiveOptions{Format: format, Progress: p}, filter.Rules{})
+			})
+
+			Convey("It should count the files and bytes archived", func() {
+				So(job.State, ShouldEqual, jobs.Done)
+				So(job.Progress.Files, ShouldEqual, 2)
+				So(job.Progress.FilesTotal, ShouldEqual, 2)
+				So(job.Progress.Bytes, ShouldEqual, 100+24<<10)
+				So(job.Progress.BytesTotal, ShouldEqual, 100+24<<10)
+			})
+
+			Convey("It should count verifying and restoring it", func() {
+				file.Progress = nil
+				job := run(func(p *jobs.Progress) error {
+					file.Progress = p
+					return f.VerifyArchive(file)
+				})
+				So(job.State, ShouldEqual, jobs.Done)
+				So(job.Progress.Files, ShouldEqual, 2)
+				So(job.Progress.FilesTotal, ShouldEqual, 2)
+
+				job = run(func(p *jobs.Progress) error {
+					file.Progress = p
+					return f.Extract(file, filepath.Join(dir, "restored"))
+				})
+				So(job.State, ShouldEqual, jobs.Done)
+				So(job.Progress.Files, ShouldEqual, 2)
+				So(job.Progress.Bytes, ShouldEqual, 100+24<<10)
+			})
+
+			Convey("When a slow backup is canceled", func() {
+				limits, _ := throttle.New(throttle.Config{ReadRate: 8})
+				f.SetThrottle(limits)
+				target := filepath.Join(dir, "canceled"+format.Extension())
+
+				started := make(chan bool)
+				submitted := manager.Submit(jobs.Backup, "w1", "", func(p *jobs.Progress) error {
+					close(started)
+					return f.Archive(world, target, ArchiveOptions{Format: format, Progress: p}, filter.Rules{})
+				})
+				<-started
+				manager.Cancel(submitted.Id)
+				job, _ := manager.Wait(submitted.Id)
+
+				Convey("It should stop and remove the unfinished archive", func() {
+					So(job.State, ShouldEqual, jobs.Canceled)
+
+					_, err := os.Stat(target)
+					So(os.IsNotExist(err), ShouldBeTrue)
+				})
+			})
+		})
+	}
+}
@@ -0,0 +1,443 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"world-backup/server/crypt"
+	"world-backup/server/filter"
+	"world-backup/server/jobs"
+	"world-backup/server/metrics"
+	"world-backup/server/throttle"
+)
+
+// Format is the kind of archive a backup is stored in
+type Format string
+
+const (
+	Zip    Format = "zip"
+	TarGz  Format = "tar.gz"
+	TarZst Format = "tar.zst"
+)
+
+var UnknownFormatError = errors.New("Unknown archive format")
+
+// Extension is the file extension, with the dot, for archives of the format.
+// Backups from before the format was recorded are all zip.
+func (f Format) Extension() string {
+	if f == "" {
+		return "." + string(Zip)
+	}
+
+	return "." + string(f)
+}
+
+// Levels is the lowest and highest compression level of the format, ok is
+// false when there is no archiver for it
+func (f Format) Levels() (min, max int, ok bool) {
+	switch f {
+	case "", Zip, TarGz:
+		return -2, 9, true
+	case TarZst:
+		return 0, 22, true
+	}
+
+	return 0, 0, false
+}
+
+// ArchiveOptions are the settings new backups are written with. A Level of 0
+// uses the default compression of the format.
+type ArchiveOptions struct {
+	Format     Format        `json:"format"`
+	Level      int           `json:"level"`
+	Encryption *crypt.Config `json:"encryption"`
+
+	// Progress counts the files and bytes archived for the job doing it
+	Progress *jobs.Progress `json:"-"`
+
+	// limits are the throttle of the file system writing the backup
+	limits *throttle.Throttle
+}
+
+// Extension is the file extension for backups written with the options
+func (o ArchiveOptions) Extension() string {
+	if o.Encryption.Enabled() {
+		return o.Format.Extension() + crypt.Extension
+	}
+
+	return o.Format.Extension()
+}
+
+// ArchiveFile is a backup archive on disk. Keys are only used when the
+// archive is Encrypted. Progress counts what is read for the job doing it.
+type ArchiveFile struct {
+	Path      string
+	Format    Format
+	Encrypted bool
+	Keys      *crypt.Config
+	Progress  *jobs.Progress
+}
+
+// Archiver writes and reads back one archive format
+type Archiver interface {
+	// Create archives source, a file or folder, into w
+	Create(source string, w io.Writer, rules filter.Rules) error
+	Open(path string) (ArchiveReader, error)
+	Extract(src, dest string) error
+}
+
+// NewArchiver returns the archiver for the format and compression level
+func NewArchiver(opts ArchiveOptions) (Archiver, error) {
+	min, max, ok := opts.Format.Levels()
+	if !ok {
+		return nil, UnknownFormatError
+	}
+	if opts.Level < min || opts.Level > max {
+		return nil, levelError(opts)
+	}
+
+	switch opts.Format {
+	case "", Zip:
+		return &zipArchiver{level: opts.Level, reads: opts.limits.Read(), progress: opts.Progress}, nil
+	case TarGz:
+		return &tarArchiver{compression: gzipCompression{level: opts.Level}, reads: opts.limits.Read(), progress: opts.Progress}, nil
+	case TarZst:
+		return &tarArchiver{compression: zstdCompression{level: opts.Level, workers: opts.limits.Workers()}, reads: opts.limits.Read(), progress: opts.Progress}, nil
+	}
+
+	return nil, UnknownFormatError
+}
+
+func levelError(opts ArchiveOptions) error {
+	return fmt.Errorf("Compression level %d is out of range for %s", opts.Level, opts.Format)
+}
+
+// Archive backs up source into target using the given format and level,
+// encrypting it when the options have a key. Reading and writing are held
+// to the limits of the file system's throttle. When archiving fails, or the
+// job is canceled, the unfinished target is removed.
+func (f *FileSystem) Archive(source, target string, opts ArchiveOptions, rules filter.Rules) error {
+	if f.throttle.LowPriority() {
+		return throttle.RunLowPriority(func() error {
+			return f.archive(source, target, opts, rules)
+		})
+	}
+
+	return f.archive(source, target, opts, rules)
+}
+
+func (f *FileSystem) archive(source, target string, opts ArchiveOptions, rules filter.Rules) error {
+	opts.limits = f.throttle
+
+	a, err := NewArchiver(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Progress != nil {
+		if err := countSource(source, rules, opts.Progress); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := f.create(a, source, file, opts, rules); err != nil {
+		file.Close()
+		os.Remove(target)
+		return err
+	}
+
+	if info, err := os.Stat(target); err == nil {
+		metrics.ArchiveSize.Observe(float64(info.Size()))
+	}
+
+	return nil
+}
+
+// create writes the archive to file, through the write limit and encryption
+func (f *FileSystem) create(a Archiver, source string, file *os.File, opts ArchiveOptions, rules filter.Rules) error {
+	out := throttle.NewWriter(file, f.throttle.Write())
+
+	if !opts.Encryption.Enabled() {
+		if err := a.Create(source, out, rules); err != nil {
+			return err
+		}
+
+		return file.Close()
+	}
+
+	w, err := crypt.Encrypt(out, opts.Encryption)
+	if err != nil {
+		return err
+	}
+
+	if err := a.Create(source, w, rules); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// Extract restores the archive src into the folder dest
+func (f *FileSystem) Extract(file ArchiveFile, dest string) error {
+	a, err := NewArchiver(ArchiveOptions{Format: file.Format, Progress: file.Progress})
+	if err != nil {
+		return err
+	}
+
+	path, cleanup, err := plainArchive(file)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return a.Extract(path, dest)
+}
+
+// OpenArchive opens a backup archive for reading
+func (f *FileSystem) OpenArchive(file ArchiveFile) (ArchiveReader, error) {
+	a, err := NewArchiver(ArchiveOptions{Format: file.Format})
+	if err != nil {
+		return nil, err
+	}
+
+	path, cleanup, err := plainArchive(file)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := a.Open(path)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	return &plainArchiveReader{ArchiveReader: r, cleanup: cleanup}, nil
+}
+
+// CopyArchive writes the archive, decrypted, to w
+func (f *FileSystem) CopyArchive(file ArchiveFile, w io.Writer) error {
+	src, err := os.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if file.Encrypted {
+		return crypt.DecryptTo(w, src, file.Keys)
+	}
+
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// plainArchive returns the path of an unencrypted copy of the archive. Zip
+// needs to seek, so encrypted archives are decrypted to a temporary file
+// outside of the backup folder, which cleanup removes.
+func plainArchive(file ArchiveFile) (string, func(), error) {
+	if !file.Encrypted {
+		return file.Path, func() {}, nil
+	}
+
+	tmp, err := ioutil.TempFile("", "world-backup-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	src, err := os.Open(file.Path)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	defer src.Close()
+
+	if err := crypt.DecryptTo(tmp, src, file.Keys); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return tmp.Name(), cleanup, nil
+}
+
+type plainArchiveReader struct {
+	ArchiveReader
+	cleanup func()
+}
+
+func (r *plainArchiveReader) Close() error {
+	defer r.cleanup()
+	return r.ArchiveReader.Close()
+}
+
+// VerifyArchive reads every file in the archive, which checks the checksums
+// the format keeps
+func (f *FileSystem) VerifyArchive(file ArchiveFile) error {
+	r, err := f.OpenArchive(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if file.Progress != nil {
+		var size int64
+		entries := r.Entries()
+		for _, e := range entries {
+			size += e.Size
+		}
+		file.Progress.SetTotal(len(entries), size)
+	}
+
+	return r.Walk(func(e ArchiveEntry, rc io.Reader) error {
+		if _, err := io.Copy(ioutil.Discard, file.Progress.Reader(rc)); err != nil {
+			if err == jobs.CanceledError {
+				return err
+			}
+			return fmt.Errorf("%s: %v", e.Name, err)
+		}
+		file.Progress.Add(1, 0)
+		return nil
+	})
+}
+
+// walkSource calls fn for every file and folder under source that the rules
+// do not exclude. name is the path to store in the archive, nested under
+// the folder name when source is a folder.
+func walkSource(source string, rules filter.Rules, fn func(path, name string, info os.FileInfo) error) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	var baseDir string
+	if info.IsDir() {
+		baseDir = filepath.Base(source)
+	}
+
+	matcher := filter.Compile(rules)
+
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel := filepath.ToSlash(strings.TrimPrefix(path, source))
+		if matcher.Excluded(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := info.Name()
+		if baseDir != "" {
+			name = filepath.ToSlash(filepath.Join(baseDir, strings.TrimPrefix(path, source)))
+		}
+
+		return fn(path, name, info)
+	})
+}
+
+// countSource sets the total files and bytes to archive on the progress
+func countSource(source string, rules filter.Rules, p *jobs.Progress) error {
+	var files int
+	var size int64
+
+	err := walkSource(source, rules, func(path, name string, info os.FileInfo) error {
+		if info.Mode().IsRegular() {
+			files++
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	p.SetTotal(files, size)
+	return nil
+}
+
+// extractPath joins an archive entry name to dest, refusing names that would
+// end up outside of it
+func extractPath(dest, name string) (string, error) {
+	p := filepath.Join(dest, filepath.FromSlash(entryName(name)))
+
+	if !Within(p, dest) {
+		return "", fmt.Errorf("%s is outside of the restore folder", name)
+	}
+
+	return p, nil
+}
+
+// checkNoSymlinks refuses to extract to path when a folder on the way to it
+// from dest is a symlink, which could point anywhere. A symlink at path itself
+// is removed so the entry replaces it instead of writing through it.
+func checkNoSymlinks(dest, path string) error {
+	rel, err := filepath.Rel(filepath.Clean(dest), path)
+	if err != nil {
+		return err
+	}
+
+	p := filepath.Clean(dest)
+	parts := strings.Split(rel, string(os.PathSeparator))
+	for i, part := range parts {
+		p = filepath.Join(p, part)
+
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		if i < len(parts)-1 {
+			return fmt.Errorf("%s would be written through the symlink %s", rel, p)
+		}
+		return os.Remove(p)
+	}
+
+	return nil
+}
+
+// openSource opens a file of the world being backed up, reading it no
+// faster than reads allows and counting it on the progress once closed
+func openSource(path string, reads *throttle.Limiter, p *jobs.Progress) (io.Reader, func() error, error) {
+	if err := p.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	closeFile := func() error {
+		p.Add(1, 0)
+		return f.Close()
+	}
+
+	return p.Reader(throttle.NewReader(f, reads)), closeFile, nil
+}
@@ -2,35 +2,34 @@ package fs
 
 import (
 	"fmt"
-
+	"path/filepath"
 	"regexp"
+	"strings"
+	"time"
+
+	"world-backup/server/filter"
+	"world-backup/server/metrics"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/spf13/afero"
 )
 
 type IBackupFs interface {
-	Getwd() (dir string, err error)
-	Chdir(dir string) error
-	Zip(source, target string) error
+	Archive(source, target string, opts ArchiveOptions, rules filter.Rules) error
 }
 
-var CreateBackup = func(f IBackupFs, log *logrus.Entry, folderPath string, worldName string, backupDir string, backupName string) error {
-	currentDir, dErr := f.Getwd()
-	if dErr != nil {
-		log.Errorf("Failed to get working dir: %v", dErr)
-		return dErr
-	}
-	defer func() { f.Chdir(currentDir) }()
-	f.Chdir(folderPath)
+// CreateBackup archives the world in folderPath to backupName in backupDir.
+// The archive holds the world folder by its name, whatever the full path.
+var CreateBackup = func(f IBackupFs, log *logrus.Entry, folderPath string, worldName string, backupDir string, backupName string, opts ArchiveOptions, rules filter.Rules) error {
+	archiveFullPath := fmt.Sprintf("%s%s%s", backupDir, afero.FilePathSeparator, backupName)
 
-	zipFullPath := fmt.Sprintf("%s%s%s", backupDir, afero.FilePathSeparator, backupName)
-
-	log.Infof("Creating backup file %s", zipFullPath)
-	if err := f.Zip(worldName, zipFullPath); err != nil {
-		log.Errorf("Failed to  create zip: %s, %v", zipFullPath, err)
+	log.Infof("Creating backup file %s", archiveFullPath)
+	start := time.Now()
+	if err := f.Archive(filepath.Join(folderPath, worldName), archiveFullPath, opts, rules); err != nil {
+		log.Errorf("Failed to create %s archive: %s, %v", opts.Format.Extension(), archiveFullPath, err)
 		return err
 	}
+	metrics.Since(metrics.BackupDuration, start)
 
 	return nil
 }
@@ -39,3 +38,16 @@ func CleanName(name string) string {
 	reg := regexp.MustCompile("[^a-zA-Z0-9_]+")
 	return reg.ReplaceAllString(name, "_")
 }
+
+// IsFolderName is true for a name that can be used for a folder without
+// leaving the folder it is made in
+func IsFolderName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// Within is true when the path p is dir or inside of it
+func Within(p, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(p))
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -7,6 +7,8 @@ import (
 
 	"path"
 
+	"world-backup/server/filter"
+
 	"github.com/Sirupsen/logrus"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -17,32 +19,18 @@ func TestFileSystem_CreateBackup(t *testing.T) {
 		worldName := "backup-world-001"
 		backupDir := "/path/to/backups"
 		backupName := "ThisBeTheBackup.zip"
+		rules := filter.Rules{Exclude: []string{"session.lock"}}
+		opts := ArchiveOptions{Format: TarZst, Level: 3}
 
 		fsMock := new(IBackupFsMock)
 
 		log := logrus.WithField("test", "fs")
 
-		Convey("When we fail to get current working directory", func() {
-			fsMock.On("Getwd").Return("", errors.New("No!"))
-
-			err := CreateBackup(fsMock, log, folderPath, worldName, backupDir, backupName)
-
-			Convey("Then it should return an error", func() {
-				fsMock.AssertExpectations(t)
-
-				So(err, ShouldNotBeNil)
-				So(err.Error(), ShouldEqual, "No!")
-			})
-		})
-
 		Convey("When the backup succeeds", func() {
 
-			fsMock.On("Getwd").Return("/app/dir", nil)
-			fsMock.On("Chdir", folderPath).Return(nil)
-			fsMock.On("Chdir", "/app/dir").Return(nil)
-			fsMock.On("Zip", worldName, path.Join(backupDir, backupName)).Return(nil)
+			fsMock.On("Archive", path.Join(folderPath, worldName), path.Join(backupDir, backupName), opts, rules).Return(nil)
 
-			err := CreateBackup(fsMock, log, folderPath, worldName, backupDir, backupName)
+			err := CreateBackup(fsMock, log, folderPath, worldName, backupDir, backupName, opts, rules)
 
 			fsMock.AssertExpectations(t)
 
@@ -52,12 +40,9 @@ func TestFileSystem_CreateBackup(t *testing.T) {
 		})
 
 		Convey("When the backup fails", func() {
-			fsMock.On("Getwd").Return("/app/dir", nil)
-			fsMock.On("Chdir", folderPath).Return(nil)
-			fsMock.On("Chdir", "/app/dir").Return(nil)
-			fsMock.On("Zip", worldName, path.Join(backupDir, backupName)).Return(errors.New("Didn't work!"))
+			fsMock.On("Archive", path.Join(folderPath, worldName), path.Join(backupDir, backupName), opts, rules).Return(errors.New("Didn't work!"))
 
-			err := CreateBackup(fsMock, log, folderPath, worldName, backupDir, backupName)
+			err := CreateBackup(fsMock, log, folderPath, worldName, backupDir, backupName, opts, rules)
 
 			fsMock.AssertExpectations(t)
 
@@ -78,3 +63,19 @@ func TestFileSystem_CleanName(t *testing.T) {
 		})
 	})
 }
+
+func TestWithin(t *testing.T) {
+	Convey("Given a folder", t, func() {
+		Convey("It should hold itself and the paths inside of it", func() {
+			So(Within("/saves", "/saves"), ShouldBeTrue)
+			So(Within("/saves/", "/saves"), ShouldBeTrue)
+			So(Within("/saves/World/region", "/saves/"), ShouldBeTrue)
+		})
+
+		Convey("It should not hold paths that only start like it or go up out of it", func() {
+			So(Within("/saves2", "/saves"), ShouldBeFalse)
+			So(Within("/saves/../backups", "/saves"), ShouldBeFalse)
+			So(Within("/", "/saves"), ShouldBeFalse)
+		})
+	})
+}
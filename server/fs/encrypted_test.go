@@ -0,0 +1,75 @@
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"world-backup/server/crypt"
+	"world-backup/server/filter"
+
+	"filippo.io/age"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+func TestFileSystem_EncryptedArchive(t *testing.T) {
+	Convey("Given a backup encrypted to an age public key", t, func() {
+		dir, _ := ioutil.TempDir("", "encrypted")
+		defer os.RemoveAll(dir)
+
+		world := filepath.Join(dir, "MyWorld")
+		os.MkdirAll(world, 0755)
+		ioutil.WriteFile(filepath.Join(world, "level.dat"), []byte("level"), 0644)
+
+		id, _ := age.GenerateX25519Identity()
+		opts := ArchiveOptions{Format: Zip, Encryption: &crypt.Config{Recipients: []string{id.Recipient().String()}}}
+
+		f := NewFs(afero.NewOsFs())
+		file := ArchiveFile{Path: filepath.Join(dir, "backup"+opts.Extension()), Format: Zip, Encrypted: true}
+		So(f.Archive(world, file.Path, opts, filter.Rules{}), ShouldBeNil)
+
+		Convey("It should not be readable without the key", func() {
+			b, _ := ioutil.ReadFile(file.Path)
+			So(bytes.HasPrefix(b, []byte("age-encryption.org/v1")), ShouldBeTrue)
+
+			_, err := f.OpenArchive(file)
+			So(err, ShouldEqual, crypt.NoKeyError)
+		})
+
+		Convey("When the identity is given", func() {
+			file.Keys = &crypt.Config{Identities: []string{id.String()}}
+
+			Convey("It should browse, verify and extract it", func() {
+				a, err := f.OpenArchive(file)
+				So(err, ShouldBeNil)
+				So(a.Entries()[0].Name, ShouldEqual, "MyWorld/level.dat")
+				So(a.Close(), ShouldBeNil)
+
+				So(f.VerifyArchive(file), ShouldBeNil)
+
+				out := filepath.Join(dir, "restore")
+				So(f.Extract(file, out), ShouldBeNil)
+				b, _ := ioutil.ReadFile(filepath.Join(out, "MyWorld", "level.dat"))
+				So(string(b), ShouldEqual, "level")
+			})
+
+			Convey("It should copy out the plain archive", func() {
+				var out bytes.Buffer
+				So(f.CopyArchive(file, &out), ShouldBeNil)
+				So(zipNames(out.Bytes()), ShouldResemble, []string{"MyWorld/", "MyWorld/level.dat"})
+			})
+		})
+
+		Convey("When another identity is given", func() {
+			other, _ := age.GenerateX25519Identity()
+			file.Keys = &crypt.Config{Identities: []string{other.String()}}
+
+			Convey("It should fail with WrongKeyError", func() {
+				So(f.VerifyArchive(file), ShouldEqual, crypt.WrongKeyError)
+			})
+		})
+	})
+}
@@ -3,21 +3,29 @@ package fs
 import (
 	"os"
 
+	"world-backup/server/throttle"
+
 	"github.com/spf13/afero"
 )
 
 type FileSystem struct {
-	af afero.Afero
+	af       afero.Afero
+	throttle *throttle.Throttle
 }
 
 func NewFs(fs afero.Fs) *FileSystem {
 	f := FileSystem{
-		afero.Afero{Fs: fs},
+		af: afero.Afero{Fs: fs},
 	}
 
 	return &f
 }
 
+// SetThrottle limits how fast backups are made from then on
+func (f *FileSystem) SetThrottle(t *throttle.Throttle) {
+	f.throttle = t
+}
+
 func (f *FileSystem) Chdir(dir string) error {
 	return os.Chdir(dir)
 }
@@ -30,6 +38,10 @@ func (f *FileSystem) ReadDir(dirname string) ([]os.FileInfo, error) {
 	return f.af.ReadDir(dirname)
 }
 
+func (f *FileSystem) ReadFile(filename string) ([]byte, error) {
+	return f.af.ReadFile(filename)
+}
+
 func (f *FileSystem) Remove(name string) error {
 	return f.af.Remove(name)
 }
@@ -42,6 +54,32 @@ func (f *FileSystem) Exists(path string) (bool, error) {
 	return f.af.Exists(path)
 }
 
+func (f *FileSystem) DirExists(path string) (bool, error) {
+	return f.af.DirExists(path)
+}
+
 func (f *FileSystem) Rename(oldname, newname string) error {
 	return f.af.Rename(oldname, newname)
 }
+
+func (f *FileSystem) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	return f.af.WriteFile(filename, data, perm)
+}
+
+func (f *FileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return f.af.MkdirAll(path, perm)
+}
+
+func (f *FileSystem) Open(name string) (afero.File, error) {
+	return f.af.Open(name)
+}
+
+func (f *FileSystem) Create(name string) (afero.File, error) {
+	return f.af.Create(name)
+}
+
+// FreeSpace is how many bytes can still be written to the disk the path is
+// on
+func (f *FileSystem) FreeSpace(path string) (uint64, error) {
+	return freeSpace(path)
+}
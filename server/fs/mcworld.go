@@ -0,0 +1,114 @@
+package fs
+
+import (
+	"archive/zip"
+	"io"
+	"strings"
+
+	"world-backup/server/crypt"
+)
+
+// ExportMcworld converts a backup, which keeps the world inside a folder
+// named after the world directory, into a Bedrock .mcworld archive where the
+// world files sit at the root.
+func (f *FileSystem) ExportMcworld(backup ArchiveFile, worldDir string, w io.Writer) error {
+	r, err := f.OpenArchive(backup)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	prefix := worldDir + "/"
+
+	archive := zip.NewWriter(w)
+
+	err = r.Walk(func(e ArchiveEntry, rc io.Reader) error {
+		name := strings.TrimPrefix(e.Name, prefix)
+		if name == "" || name == worldDir {
+			return nil
+		}
+
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: e.ModTime})
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(writer, rc)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// ImportMcworld takes a Bedrock .mcworld archive and writes it out as a
+// backup zip with the files nested under worldDir, so it can be restored like
+// any other backup. The backup is encrypted when encryption is enabled.
+func (f *FileSystem) ImportMcworld(src io.ReaderAt, size int64, worldDir, target string, encryption *crypt.Config) error {
+	r, err := zip.NewReader(src, size)
+	if err != nil {
+		return err
+	}
+
+	dst, err := f.af.Create(target)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	var out io.Writer = dst
+	var enc io.WriteCloser
+	if encryption.Enabled() {
+		if enc, err = crypt.Encrypt(dst, encryption); err != nil {
+			return err
+		}
+		out = enc
+	}
+
+	archive := zip.NewWriter(out)
+
+	for _, file := range r.File {
+		name := strings.TrimPrefix(strings.Replace(file.Name, "\\", "/", -1), "/")
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue
+		}
+
+		if err := copyZipFile(archive, file, worldDir+"/"+name); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return err
+		}
+	}
+
+	return dst.Close()
+}
+
+func copyZipFile(archive *zip.Writer, file *zip.File, name string) error {
+	header := file.FileHeader
+	header.Name = name
+	header.Method = zip.Deflate
+
+	writer, err := archive.CreateHeader(&header)
+	if err != nil {
+		return err
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(writer, rc)
+	return err
+}
@@ -0,0 +1,71 @@
+package fs
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+func zipNames(b []byte) []string {
+	r, _ := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestFileSystem_Mcworld(t *testing.T) {
+	Convey("Given a .mcworld file", t, func() {
+		dir, _ := ioutil.TempDir("", "mcworld")
+		defer os.RemoveAll(dir)
+
+		f := NewFs(afero.NewOsFs())
+
+		var mcworld bytes.Buffer
+		zw := zip.NewWriter(&mcworld)
+		for _, name := range []string{"level.dat", "levelname.txt", "db/CURRENT"} {
+			w, _ := zw.Create(name)
+			w.Write([]byte(name))
+		}
+		zw.Close()
+
+		backup := filepath.Join(dir, "backup.zip")
+
+		Convey("When it is imported", func() {
+			err := f.ImportMcworld(bytes.NewReader(mcworld.Bytes()), int64(mcworld.Len()), "AbCd=", backup, nil)
+			So(err, ShouldBeNil)
+
+			Convey("It should nest the files under the world folder", func() {
+				b, _ := ioutil.ReadFile(backup)
+				So(zipNames(b), ShouldResemble, []string{"AbCd=/db/CURRENT", "AbCd=/level.dat", "AbCd=/levelname.txt"})
+			})
+
+			Convey("And exported again it should match the original layout", func() {
+				var out bytes.Buffer
+				err := f.ExportMcworld(ArchiveFile{Path: backup, Format: Zip}, "AbCd=", &out)
+
+				So(err, ShouldBeNil)
+				So(zipNames(out.Bytes()), ShouldResemble, []string{"db/CURRENT", "level.dat", "levelname.txt"})
+			})
+		})
+
+		Convey("When the file is not a zip", func() {
+			err := f.ImportMcworld(bytes.NewReader([]byte("nope")), 4, "AbCd=", backup, nil)
+
+			Convey("It should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -1,6 +1,8 @@
 package fs
 
 import (
+	"world-backup/server/filter"
+
 	"github.com/stretchr/testify/mock"
 )
 
@@ -8,17 +10,7 @@ type IBackupFsMock struct {
 	mock.Mock
 }
 
-func (m *IBackupFsMock) Chdir(dir string) error {
-	args := m.Called(dir)
-	return args.Error(0)
-}
-
-func (m *IBackupFsMock) Getwd() (dir string, err error) {
-	args := m.Called()
-	return args.String(0), args.Error(1)
-}
-
-func (m *IBackupFsMock) Zip(source, target string) error {
-	args := m.Called(source, target)
+func (m *IBackupFsMock) Archive(source, target string, opts ArchiveOptions, rules filter.Rules) error {
+	args := m.Called(source, target, opts, rules)
 	return args.Error(0)
 }
@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+import "syscall"
+
+// freeSpace is how many bytes can still be written to the disk the path is
+// on, without the ones only root may use
+func freeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,369 @@
+package fs
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"world-backup/server/filter"
+	"world-backup/server/jobs"
+	"world-backup/server/throttle"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compression wraps the tar stream of a tar archiver
+type compression interface {
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+type gzipCompression struct {
+	level int
+}
+
+func (g gzipCompression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if g.level == 0 {
+		return gzip.NewWriter(w), nil
+	}
+
+	return gzip.NewWriterLevel(w, g.level)
+}
+
+func (g gzipCompression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+type zstdCompression struct {
+	level   int
+	workers int
+}
+
+func (z zstdCompression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	var opts []zstd.EOption
+	if z.level != 0 {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(z.level)))
+	}
+	if z.workers != 0 {
+		opts = append(opts, zstd.WithEncoderConcurrency(z.workers))
+	}
+
+	return zstd.NewWriter(w, opts...)
+}
+
+func (z zstdCompression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.IOReadCloser(), nil
+}
+
+// tarArchiver keeps permissions, owners and symlinks, which zip can't
+type tarArchiver struct {
+	compression compression
+	reads       *throttle.Limiter
+	progress    *jobs.Progress
+}
+
+func (t *tarArchiver) Create(source string, w io.Writer, rules filter.Rules) error {
+	buf := bufio.NewWriter(w)
+
+	cw, err := t.compression.NewWriter(buf)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(cw)
+
+	err = walkSource(source, rules, func(path, name string, info os.FileInfo) error {
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, closeFile, err := openSource(path, t.reads, t.progress)
+		if err != nil {
+			return err
+		}
+		defer closeFile()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+
+	return buf.Flush()
+}
+
+func (t *tarArchiver) Extract(src, dest string) error {
+	os.MkdirAll(dest, 0755)
+
+	return t.read(src, func(header *tar.Header, r io.Reader) error {
+		path, err := extractPath(dest, header.Name)
+		if err != nil {
+			return err
+		}
+
+		if err := checkNoSymlinks(dest, path); err != nil {
+			return err
+		}
+
+		mode := header.FileInfo().Mode()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(path, mode.Perm())
+		case tar.TypeSymlink:
+			// links stay inside of the restore folder, like the files do
+			link := filepath.FromSlash(header.Linkname)
+			if filepath.IsAbs(link) || !Within(filepath.Join(filepath.Dir(path), link), dest) {
+				return fmt.Errorf("%s links to %s, outside of the restore folder", header.Name, header.Linkname)
+			}
+
+			os.MkdirAll(filepath.Dir(path), 0755)
+			os.Remove(path)
+			return os.Symlink(header.Linkname, path)
+		}
+
+		if !mode.IsRegular() {
+			return nil
+		}
+
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := writeFile(path, t.progress.Reader(r), mode.Perm()); err != nil {
+			return err
+		}
+		t.progress.Add(1, 0)
+
+		return os.Chtimes(path, header.ModTime, header.ModTime)
+	})
+}
+
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+
+	// the umask may have taken bits off the permissions we asked for
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// Open reads through the whole archive once to list its files. A tar has no
+// index or checksums of its own, so the CRC32 of every file is worked out
+// here to keep entries comparable with zip ones.
+func (t *tarArchiver) Open(path string) (ArchiveReader, error) {
+	a := tarArchive{archiver: t, path: path}
+
+	err := t.read(path, func(header *tar.Header, r io.Reader) error {
+		if !header.FileInfo().Mode().IsRegular() {
+			return nil
+		}
+
+		h := crc32.NewIEEE()
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+
+		a.entries = append(a.entries, tarEntry(header, h.Sum32()))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+// read calls fn for every header in the archive with a reader for its contents
+func (t *tarArchiver) read(path string, fn func(header *tar.Header, r io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	cr, err := t.compression.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+	defer cr.Close()
+
+	tr := tar.NewReader(cr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+
+	// drain the compression stream so its trailing checksum is checked
+	_, err = io.Copy(ioutil.Discard, cr)
+	return err
+}
+
+type tarArchive struct {
+	archiver *tarArchiver
+	path     string
+	entries  []ArchiveEntry
+
+	// files has every file of the archive uncompressed, one after the
+	// other, once ReadFile was called. index is where each one is.
+	files *os.File
+	index map[string]tarFile
+}
+
+type tarFile struct {
+	offset int64
+	size   int64
+}
+
+func (a *tarArchive) Entries() []ArchiveEntry {
+	return a.entries
+}
+
+// ReadFile reads the archive once, the first time it is called, and keeps
+// its files in a temp file for the calls after. Use Walk to go through all
+// of the files.
+func (a *tarArchive) ReadFile(name string) ([]byte, error) {
+	if a.index == nil {
+		if err := a.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	f, ok := a.index[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not in the archive", name)
+	}
+
+	b := make([]byte, f.size)
+	if _, err := a.files.ReadAt(b, f.offset); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (a *tarArchive) load() error {
+	files, err := ioutil.TempFile("", "world-backup-tar")
+	if err != nil {
+		return err
+	}
+
+	index := map[string]tarFile{}
+	var offset int64
+	err = a.archiver.read(a.path, func(header *tar.Header, r io.Reader) error {
+		name := entryName(header.Name)
+		if _, seen := index[name]; seen || !header.FileInfo().Mode().IsRegular() {
+			return nil
+		}
+
+		n, err := io.Copy(files, r)
+		if err != nil {
+			return err
+		}
+
+		index[name] = tarFile{offset: offset, size: n}
+		offset += n
+		return nil
+	})
+	if err != nil {
+		files.Close()
+		os.Remove(files.Name())
+		return err
+	}
+
+	a.files, a.index = files, index
+	return nil
+}
+
+func (a *tarArchive) Walk(fn func(e ArchiveEntry, r io.Reader) error) error {
+	i := 0
+
+	return a.archiver.read(a.path, func(header *tar.Header, r io.Reader) error {
+		if !header.FileInfo().Mode().IsRegular() {
+			return nil
+		}
+
+		// files come back in the order Open listed them
+		e := tarEntry(header, 0)
+		if i < len(a.entries) {
+			e = a.entries[i]
+		}
+		i++
+
+		return fn(e, r)
+	})
+}
+
+func (a *tarArchive) Close() error {
+	if a.files == nil {
+		return nil
+	}
+
+	defer os.Remove(a.files.Name())
+	return a.files.Close()
+}
+
+func tarEntry(header *tar.Header, crc uint32) ArchiveEntry {
+	return ArchiveEntry{
+		Name:    entryName(header.Name),
+		Size:    header.Size,
+		CRC32:   crc,
+		ModTime: header.ModTime,
+	}
+}
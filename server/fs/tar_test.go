@@ -0,0 +1,224 @@
+package fs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"world-backup/server/filter"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+func TestFileSystem_Tar(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions")
+	}
+
+	Convey("Given a server world with scripts and links", t, func() {
+		dir, _ := ioutil.TempDir("", "tar")
+		defer os.RemoveAll(dir)
+
+		world := filepath.Join(dir, "MyWorld")
+		os.MkdirAll(filepath.Join(world, "datapacks"), 0750)
+		ioutil.WriteFile(filepath.Join(world, "start.sh"), []byte("#!/bin/sh"), 0755)
+		ioutil.WriteFile(filepath.Join(world, "session.lock"), []byte("lock"), 0644)
+		os.Chmod(filepath.Join(world, "start.sh"), 0755)
+		os.Symlink("start.sh", filepath.Join(world, "run.sh"))
+
+		f := NewFs(afero.NewOsFs())
+		file := ArchiveFile{Path: filepath.Join(dir, "backup.tar.zst"), Format: TarZst}
+		So(f.Archive(world, file.Path, ArchiveOptions{Format: TarZst, Level: 19}, filter.Rules{Exclude: []string{"session.lock"}}), ShouldBeNil)
+
+		Convey("When it is extracted", func() {
+			out := filepath.Join(dir, "restore")
+			So(f.Extract(file, out), ShouldBeNil)
+
+			Convey("It should keep the permissions", func() {
+				script, err := os.Stat(filepath.Join(out, "MyWorld", "start.sh"))
+				So(err, ShouldBeNil)
+				So(script.Mode().Perm(), ShouldEqual, os.FileMode(0755))
+
+				packs, _ := os.Stat(filepath.Join(out, "MyWorld", "datapacks"))
+				So(packs.Mode().Perm(), ShouldEqual, os.FileMode(0750))
+			})
+
+			Convey("It should keep the symlinks", func() {
+				link, err := os.Readlink(filepath.Join(out, "MyWorld", "run.sh"))
+				So(err, ShouldBeNil)
+				So(link, ShouldEqual, "start.sh")
+			})
+
+			Convey("It should leave out the excluded files", func() {
+				_, err := os.Stat(filepath.Join(out, "MyWorld", "session.lock"))
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+// writeTar writes a tar.gz with the headers given, files get their name as
+// their contents
+func writeTar(path string, headers ...*tar.Header) {
+	f, _ := os.Create(path)
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	defer gw.Close()
+
+	tw := tar.NewWriter(gw)
+	defer tw.Close()
+
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(h.Name))
+			h.Mode = 0644
+		}
+		tw.WriteHeader(h)
+		if h.Typeflag == tar.TypeReg {
+			tw.Write([]byte(h.Name))
+		}
+	}
+}
+
+func TestFileSystem_TarSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix symlinks")
+	}
+
+	Convey("Given a restore folder and a folder next to it", t, func() {
+		dir, _ := ioutil.TempDir("", "tar")
+		defer os.RemoveAll(dir)
+
+		out := filepath.Join(dir, "restore")
+		outside := filepath.Join(dir, "outside")
+		os.MkdirAll(filepath.Join(out, "MyWorld"), 0755)
+		os.MkdirAll(outside, 0755)
+		ioutil.WriteFile(filepath.Join(outside, "level.dat"), []byte("mine"), 0644)
+
+		f := NewFs(afero.NewOsFs())
+		file := ArchiveFile{Path: filepath.Join(dir, "backup.tar.gz"), Format: TarGz}
+
+		Convey("When the archive links outside of it", func() {
+			writeTar(file.Path, &tar.Header{Name: "MyWorld/escape", Typeflag: tar.TypeSymlink, Linkname: "../../outside"})
+
+			Convey("It should refuse to extract", func() {
+				So(f.Extract(file, out), ShouldNotBeNil)
+
+				_, err := os.Lstat(filepath.Join(out, "MyWorld", "escape"))
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the archive links to an absolute path", func() {
+			writeTar(file.Path, &tar.Header{Name: "MyWorld/escape", Typeflag: tar.TypeSymlink, Linkname: outside})
+
+			Convey("It should refuse to extract", func() {
+				So(f.Extract(file, out), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the archive links to a file and writes through the link", func() {
+			writeTar(file.Path,
+				&tar.Header{Name: "MyWorld/data", Typeflag: tar.TypeSymlink, Linkname: "../../outside"},
+				&tar.Header{Name: "MyWorld/data/level.dat", Typeflag: tar.TypeReg},
+			)
+
+			Convey("It should refuse to extract and leave the file alone", func() {
+				So(f.Extract(file, out), ShouldNotBeNil)
+
+				b, _ := ioutil.ReadFile(filepath.Join(outside, "level.dat"))
+				So(string(b), ShouldEqual, "mine")
+			})
+		})
+
+		Convey("When the restore folder has a link to a folder outside of it", func() {
+			os.Symlink(outside, filepath.Join(out, "MyWorld", "data"))
+			writeTar(file.Path, &tar.Header{Name: "MyWorld/data/level.dat", Typeflag: tar.TypeReg})
+
+			Convey("It should refuse to write through it", func() {
+				So(f.Extract(file, out), ShouldNotBeNil)
+
+				b, _ := ioutil.ReadFile(filepath.Join(outside, "level.dat"))
+				So(string(b), ShouldEqual, "mine")
+			})
+		})
+
+		Convey("When the restore folder has a link to a file outside of it", func() {
+			os.Symlink(filepath.Join(outside, "level.dat"), filepath.Join(out, "MyWorld", "level.dat"))
+			writeTar(file.Path, &tar.Header{Name: "MyWorld/level.dat", Typeflag: tar.TypeReg})
+
+			Convey("It should replace the link instead of writing through it", func() {
+				So(f.Extract(file, out), ShouldBeNil)
+
+				info, _ := os.Lstat(filepath.Join(out, "MyWorld", "level.dat"))
+				So(info.Mode().IsRegular(), ShouldBeTrue)
+
+				b, _ := ioutil.ReadFile(filepath.Join(outside, "level.dat"))
+				So(string(b), ShouldEqual, "mine")
+			})
+		})
+
+		Convey("When the archive links inside of it", func() {
+			writeTar(file.Path,
+				&tar.Header{Name: "MyWorld/start.sh", Typeflag: tar.TypeReg},
+				&tar.Header{Name: "MyWorld/bin/run.sh", Typeflag: tar.TypeSymlink, Linkname: "../start.sh"},
+			)
+
+			Convey("It should keep the link", func() {
+				So(f.Extract(file, out), ShouldBeNil)
+
+				link, _ := os.Readlink(filepath.Join(out, "MyWorld", "bin", "run.sh"))
+				So(link, ShouldEqual, "../start.sh")
+			})
+		})
+	})
+}
+
+func TestFileSystem_TarReadFile(t *testing.T) {
+	Convey("Given an open tar backup", t, func() {
+		dir, _ := ioutil.TempDir("", "tar")
+		defer os.RemoveAll(dir)
+
+		file := ArchiveFile{Path: filepath.Join(dir, "backup.tar.gz"), Format: TarGz}
+		writeTar(file.Path,
+			&tar.Header{Name: "MyWorld/level.dat", Typeflag: tar.TypeReg},
+			&tar.Header{Name: "MyWorld/region/r.0.0.mca", Typeflag: tar.TypeReg},
+		)
+
+		a, err := NewFs(afero.NewOsFs()).OpenArchive(file)
+		So(err, ShouldBeNil)
+		defer a.Close()
+
+		Convey("When a file was read", func() {
+			b, err := a.ReadFile("MyWorld/level.dat")
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "MyWorld/level.dat")
+
+			Convey("It should read the others without reading the archive again", func() {
+				os.Remove(file.Path)
+
+				b, err := a.ReadFile("MyWorld/region/r.0.0.mca")
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "MyWorld/region/r.0.0.mca")
+
+				b, err = a.ReadFile("MyWorld/level.dat")
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, "MyWorld/level.dat")
+			})
+
+			Convey("It should remove the files it kept once closed", func() {
+				kept := a.(*plainArchiveReader).ArchiveReader.(*tarArchive).files.Name()
+				So(a.Close(), ShouldBeNil)
+
+				_, err := os.Stat(kept)
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+	})
+}
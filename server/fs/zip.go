@@ -2,45 +2,40 @@ package fs
 
 import (
 	"archive/zip"
+	"compress/flate"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
-)
 
-func (f *FileSystem) Zip(source, target string) error {
-	zipfile, err := os.Create(target)
-	if err != nil {
-		return err
-	}
-	defer zipfile.Close()
+	"world-backup/server/filter"
+	"world-backup/server/jobs"
+	"world-backup/server/throttle"
+)
 
-	archive := zip.NewWriter(zipfile)
-	defer archive.Close()
+type zipArchiver struct {
+	level    int
+	reads    *throttle.Limiter
+	progress *jobs.Progress
+}
 
-	info, err := os.Stat(source)
-	if err != nil {
-		return nil
-	}
+func (z *zipArchiver) Create(source string, w io.Writer, rules filter.Rules) error {
+	archive := zip.NewWriter(w)
 
-	var baseDir string
-	if info.IsDir() {
-		baseDir = filepath.Base(source)
+	if z.level != 0 {
+		archive.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, z.level)
+		})
 	}
 
-	filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
+	err := walkSource(source, rules, func(path, name string, info os.FileInfo) error {
 		header, err := zip.FileInfoHeader(info)
 		if err != nil {
 			return err
 		}
 
-		if baseDir != "" {
-			header.Name = filepath.Join(baseDir, strings.TrimPrefix(path, source))
-		}
+		header.Name = name
 
 		if info.IsDir() {
 			header.Name += "/"
@@ -57,19 +52,22 @@ func (f *FileSystem) Zip(source, target string) error {
 			return nil
 		}
 
-		file, err := os.Open(path)
+		file, closeFile, err := openSource(path, z.reads, z.progress)
 		if err != nil {
 			return err
 		}
-		defer file.Close()
+		defer closeFile()
 		_, err = io.Copy(writer, file)
 		return err
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	return archive.Close()
 }
 
-func (f *FileSystem) Unzip(src, dest string) error {
+func (z *zipArchiver) Extract(src, dest string) error {
 	r, err := zip.OpenReader(src)
 	if err != nil {
 		return err
@@ -94,7 +92,10 @@ func (f *FileSystem) Unzip(src, dest string) error {
 			}
 		}()
 
-		path := filepath.Join(dest, f.Name)
+		path, err := extractPath(dest, f.Name)
+		if err != nil {
+			return err
+		}
 
 		if f.FileInfo().IsDir() {
 			os.MkdirAll(path, f.Mode())
@@ -110,14 +111,27 @@ func (f *FileSystem) Unzip(src, dest string) error {
 				}
 			}()
 
-			_, err = io.Copy(f, rc)
+			_, err = io.Copy(f, z.progress.Reader(rc))
 			if err != nil {
 				return err
 			}
+			z.progress.Add(1, 0)
 		}
 		return nil
 	}
 
+	if z.progress != nil {
+		var size int64
+		files := 0
+		for _, f := range r.File {
+			if !f.FileInfo().IsDir() {
+				files++
+				size += int64(f.UncompressedSize64)
+			}
+		}
+		z.progress.SetTotal(files, size)
+	}
+
 	for _, f := range r.File {
 		err := extractAndWriteFile(f)
 		if err != nil {
@@ -127,3 +141,84 @@ func (f *FileSystem) Unzip(src, dest string) error {
 
 	return nil
 }
+
+func (z *zipArchiver) Open(path string) (ArchiveReader, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zipArchive{r: r}, nil
+}
+
+type zipArchive struct {
+	r *zip.ReadCloser
+}
+
+func (a *zipArchive) Entries() []ArchiveEntry {
+	var entries []ArchiveEntry
+	for _, file := range a.r.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		entries = append(entries, zipEntry(file))
+	}
+
+	return entries
+}
+
+func (a *zipArchive) ReadFile(name string) ([]byte, error) {
+	for _, file := range a.r.File {
+		if entryName(file.Name) != name {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		return ioutil.ReadAll(rc)
+	}
+
+	return nil, fmt.Errorf("%s is not in the archive", name)
+}
+
+func (a *zipArchive) Walk(fn func(e ArchiveEntry, r io.Reader) error) error {
+	for _, file := range a.r.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		if err := walkZipFile(file, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkZipFile(file *zip.File, fn func(e ArchiveEntry, r io.Reader) error) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return fn(zipEntry(file), rc)
+}
+
+func (a *zipArchive) Close() error {
+	return a.r.Close()
+}
+
+func zipEntry(file *zip.File) ArchiveEntry {
+	return ArchiveEntry{
+		Name:    entryName(file.Name),
+		Size:    int64(file.UncompressedSize64),
+		CRC32:   file.CRC32,
+		ModTime: file.Modified,
+	}
+}
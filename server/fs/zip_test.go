@@ -0,0 +1,57 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"world-backup/server/filter"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+func TestFileSystem_Zip(t *testing.T) {
+	Convey("Given a world folder", t, func() {
+		dir, _ := ioutil.TempDir("", "zip")
+		defer os.RemoveAll(dir)
+
+		world := filepath.Join(dir, "MyWorld")
+		for _, name := range []string{"level.dat", "session.lock", "region/r.0.0.mca", "bluemap/web/index.html"} {
+			p := filepath.Join(world, filepath.FromSlash(name))
+			os.MkdirAll(filepath.Dir(p), 0755)
+			ioutil.WriteFile(p, []byte(name), 0644)
+		}
+
+		f := NewFs(afero.NewOsFs())
+		target := filepath.Join(dir, "backup.zip")
+
+		Convey("When it is zipped with exclude rules", func() {
+			err := f.Archive(world, target, ArchiveOptions{Format: Zip}, filter.Rules{Exclude: []string{"session.lock", "bluemap/"}})
+			So(err, ShouldBeNil)
+
+			Convey("It should leave out the excluded files", func() {
+				b, _ := ioutil.ReadFile(target)
+				So(zipNames(b), ShouldResemble, []string{"MyWorld/", "MyWorld/level.dat", "MyWorld/region/", "MyWorld/region/r.0.0.mca"})
+			})
+		})
+
+		Convey("When it is zipped with a compression level", func() {
+			fast := filepath.Join(dir, "fast.zip")
+			So(f.Archive(world, fast, ArchiveOptions{Format: Zip, Level: 1}, filter.Rules{}), ShouldBeNil)
+
+			Convey("It should still read back", func() {
+				So(f.VerifyArchive(ArchiveFile{Path: fast, Format: Zip}), ShouldBeNil)
+			})
+		})
+
+		Convey("When the source does not exist", func() {
+			err := f.Archive(filepath.Join(dir, "Nope"), target, ArchiveOptions{}, filter.Rules{})
+
+			Convey("It should return an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
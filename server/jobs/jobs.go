@@ -0,0 +1,394 @@
+// Package jobs runs backups, restores, verifies and prunes in the background,
+// one at a time per world and no more than a few at once overall
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/teris-io/shortid"
+)
+
+var getNow = time.Now
+var getId = shortid.MustGenerate
+
+// Kinds of job
+const (
+	Backup  = "backup"
+	Restore = "restore"
+	Verify  = "verify"
+	Prune   = "prune"
+)
+
+// States of a job
+const (
+	Queued   = "queued"
+	Running  = "running"
+	Done     = "done"
+	Failed   = "failed"
+	Canceled = "canceled"
+)
+
+var NotFoundError = errors.New("Job not found")
+var FinishedError = errors.New("The job has already finished")
+var CanceledError = errors.New("The job was canceled")
+
+// Config holds the settings for running jobs. Workers is how many jobs run
+// at once, jobs on the same world always run one after the other. Finished
+// jobs can be looked up for KeepFor, at least MinKeepFor so whoever waited
+// for a job can still get it.
+type Config struct {
+	Workers int    `json:"workers"`
+	KeepFor string `json:"keepFor"`
+}
+
+const (
+	defaultWorkers = 1
+	defaultKeepFor = time.Hour
+
+	MinKeepFor = time.Minute
+)
+
+// Job is a piece of work on a world
+type Job struct {
+	Id         string      `json:"id"`
+	Kind       string      `json:"kind"`
+	WorldId    string      `json:"worldId"`
+	BackupId   string      `json:"backupId,omitempty"`
+	State      string      `json:"state"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	StartedAt  *time.Time  `json:"startedAt,omitempty"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+	Progress   Counts      `json:"progress"`
+	Result     interface{} `json:"result,omitempty"`
+}
+
+// Finished is true once the job is done, failed or was canceled
+func (j Job) Finished() bool {
+	return j.State == Done || j.State == Failed || j.State == Canceled
+}
+
+// Listener is told when a job starts, how it is getting on while it runs,
+// and when it finishes. It is called with the manager locked, so it must
+// not call back into the manager or block.
+type Listener interface {
+	JobStarted(job Job)
+	JobProgress(job Job)
+	JobFinished(job Job)
+}
+
+// progressInterval is how often a listener hears how a running job is doing
+var progressInterval = time.Second
+
+// Func is the work of a job. It counts what it gets through on p, and
+// stops with p.Err() once the job is canceled. Jobs run alongside the
+// watcher and the API, so a Func changes the catalog only holding its lock.
+type Func func(p *Progress) error
+
+type entry struct {
+	job      Job
+	fn       Func
+	progress *Progress
+	done     chan bool
+}
+
+// Manager queues jobs and runs them in the order they came in, skipping
+// over jobs whose world is busy
+type Manager struct {
+	log      *logrus.Entry
+	workers  int
+	keepFor  time.Duration
+	listener Listener
+
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	queue   []*entry
+	running int
+	busy    map[string]bool
+}
+
+// NewManager creates a manager running jobs with the given settings
+func NewManager(log *logrus.Entry, c Config) (*Manager, error) {
+	m := Manager{
+		log:     log.WithField("component", "jobs"),
+		workers: c.Workers,
+		keepFor: defaultKeepFor,
+		jobs:    map[string]*entry{},
+		busy:    map[string]bool{},
+	}
+
+	if c.Workers < 0 {
+		return nil, fmt.Errorf("Invalid number of job workers [%d]", c.Workers)
+	}
+	if m.workers == 0 {
+		m.workers = defaultWorkers
+	}
+
+	if c.KeepFor != "" {
+		var err error
+		if m.keepFor, err = time.ParseDuration(c.KeepFor); err != nil || m.keepFor < MinKeepFor {
+			return nil, fmt.Errorf("Invalid job keep for [%s], it has to be at least %s", c.KeepFor, MinKeepFor)
+		}
+	}
+
+	return &m, nil
+}
+
+// SetListener has the listener told about every job from now on
+func (m *Manager) SetListener(l Listener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.listener = l
+}
+
+// Submit queues fn as a job of the kind on the world, backupId is the
+// backup it works on, if any
+func (m *Manager) Submit(kind, worldId, backupId string, fn Func) Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := &entry{
+		job: Job{
+			Id:        getId(),
+			Kind:      kind,
+			WorldId:   worldId,
+			BackupId:  backupId,
+			State:     Queued,
+			CreatedAt: getNow(),
+		},
+		fn:       fn,
+		progress: newProgress(),
+		done:     make(chan bool),
+	}
+
+	m.forgetFinished()
+	m.jobs[e.job.Id] = e
+	m.queue = append(m.queue, e)
+	m.schedule()
+
+	return m.snapshot(e)
+}
+
+// Get returns the job with its progress so far
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, NotFoundError
+	}
+
+	return m.snapshot(e), nil
+}
+
+// List returns every job that is queued, running or recently finished,
+// oldest first
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.forgetFinished()
+
+	list := []Job{}
+	for _, e := range m.jobs {
+		list = append(list, m.snapshot(e))
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	return list
+}
+
+// Cancel takes a queued job off the queue, or asks a running one to stop.
+// A running job is canceled once its work notices.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, NotFoundError
+	}
+
+	switch e.job.State {
+	case Queued:
+		for i, q := range m.queue {
+			if q == e {
+				m.queue = append(m.queue[:i], m.queue[i+1:]...)
+				break
+			}
+		}
+		m.finish(e, CanceledError)
+	case Running:
+		e.progress.cancel()
+	default:
+		return m.snapshot(e), FinishedError
+	}
+
+	return m.snapshot(e), nil
+}
+
+// Wait blocks until the job finished and returns it
+func (m *Manager) Wait(id string) (Job, error) {
+	m.mu.Lock()
+	e, ok := m.jobs[id]
+	m.mu.Unlock()
+
+	if !ok {
+		return Job{}, NotFoundError
+	}
+
+	<-e.done
+	return m.Get(id)
+}
+
+// schedule starts the queued jobs that can run, the lock must be held
+func (m *Manager) schedule() {
+	kept := m.queue[:0]
+	for _, e := range m.queue {
+		if m.running >= m.workers || m.busy[e.job.WorldId] {
+			kept = append(kept, e)
+			continue
+		}
+
+		now := getNow()
+		e.job.State = Running
+		e.job.StartedAt = &now
+		e.progress.start(now)
+
+		m.running++
+		m.busy[e.job.WorldId] = true
+
+		if m.listener != nil {
+			m.listener.JobStarted(m.snapshot(e))
+			go m.report(e)
+		}
+
+		go m.run(e)
+	}
+
+	for i := len(kept); i < len(m.queue); i++ {
+		m.queue[i] = nil
+	}
+	m.queue = kept
+}
+
+func (m *Manager) run(e *entry) {
+	log := m.log.WithFields(logrus.Fields{"job": e.job.Id, "kind": e.job.Kind})
+	log.Debugf("Starting %s job on world %s", e.job.Kind, e.job.WorldId)
+
+	err := call(log, e)
+	if err != nil && e.progress.Err() != nil {
+		err = CanceledError
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch err {
+	case nil:
+		log.Debugf("Finished %s job on world %s", e.job.Kind, e.job.WorldId)
+	case CanceledError:
+		log.Infof("Canceled %s job on world %s", e.job.Kind, e.job.WorldId)
+	default:
+		log.Errorf("The %s job on world %s failed: %v", e.job.Kind, e.job.WorldId, err)
+	}
+
+	m.running--
+	delete(m.busy, e.job.WorldId)
+	m.finish(e, err)
+	m.schedule()
+}
+
+// call runs the job's work, a panic fails the job instead of taking the
+// server down with it
+func call(log *logrus.Entry, e *entry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("The %s job on world %s panicked: %v\n%s", e.job.Kind, e.job.WorldId, r, debug.Stack())
+			err = fmt.Errorf("The job stopped unexpectedly: %v", r)
+		}
+	}()
+
+	return e.fn(e.progress)
+}
+
+// report tells the listener how the job is getting on until it finishes
+func (m *Manager) report(e *entry) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			if m.listener != nil && !e.job.Finished() {
+				m.listener.JobProgress(m.snapshot(e))
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// finish records how the job ended, the lock must be held
+func (m *Manager) finish(e *entry, err error) {
+	now := getNow()
+	e.job.FinishedAt = &now
+
+	switch err {
+	case nil:
+		e.job.State = Done
+	case CanceledError:
+		e.job.State = Canceled
+	default:
+		e.job.State = Failed
+		e.job.Error = err.Error()
+	}
+
+	close(e.done)
+
+	if m.listener != nil {
+		m.listener.JobFinished(m.snapshot(e))
+	}
+}
+
+// forgetFinished drops jobs that finished more than keepFor ago, the lock
+// must be held
+func (m *Manager) forgetFinished() {
+	now := getNow()
+	for id, e := range m.jobs {
+		if e.job.FinishedAt != nil && now.Sub(*e.job.FinishedAt) > m.keepFor {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// snapshot copies the job with its progress, the lock must be held
+func (m *Manager) snapshot(e *entry) Job {
+	job := e.job
+
+	now := getNow()
+	if job.FinishedAt != nil {
+		now = *job.FinishedAt
+	}
+
+	job.Progress = e.progress.snapshot(now)
+	job.Result = e.progress.getResult()
+	if job.Finished() {
+		job.Progress.ETA = nil
+	}
+
+	return job
+}
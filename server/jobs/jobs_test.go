@@ -0,0 +1,259 @@
+package jobs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestManager(c Config) *Manager {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	m, err := NewManager(logrus.NewEntry(logger), c)
+	So(err, ShouldBeNil)
+	return m
+}
+
+// blocking is work that runs until it is released or canceled
+func blocking(started chan string, release chan bool, name string) Func {
+	return func(p *Progress) error {
+		started <- name
+		select {
+		case <-release:
+			return nil
+		case <-p.canceled:
+			return p.Err()
+		}
+	}
+}
+
+// recorder keeps what a listener was told, the manager calls it locked
+type recorder struct {
+	heard []string
+}
+
+func (r *recorder) JobStarted(job Job)  { r.heard = append(r.heard, "started "+job.State) }
+func (r *recorder) JobProgress(job Job) { r.heard = append(r.heard, "progress "+job.State) }
+func (r *recorder) JobFinished(job Job) { r.heard = append(r.heard, "finished "+job.State) }
+
+func TestManager(t *testing.T) {
+	Convey("Given a manager with two workers", t, func() {
+		m := newTestManager(Config{Workers: 2})
+		started := make(chan string, 10)
+		release := make(chan bool)
+
+		Convey("When jobs are submitted for the same world", func() {
+			first := m.Submit(Backup, "w1", "", blocking(started, release, "first"))
+			second := m.Submit(Prune, "w1", "b1", blocking(started, release, "second"))
+			other := m.Submit(Backup, "w2", "", blocking(started, release, "other"))
+
+			Convey("It should run them one after the other, and other worlds alongside", func() {
+				So(<-started, ShouldNotEqual, "second")
+				So(<-started, ShouldNotEqual, "second")
+
+				job, _ := m.Get(second.Id)
+				So(job.State, ShouldEqual, Queued)
+				So(job.BackupId, ShouldEqual, "b1")
+
+				release <- true
+				release <- true
+				So(<-started, ShouldEqual, "second")
+				release <- true
+
+				for _, id := range []string{first.Id, second.Id, other.Id} {
+					job, err := m.Wait(id)
+					So(err, ShouldBeNil)
+					So(job.State, ShouldEqual, Done)
+					So(job.FinishedAt, ShouldNotBeNil)
+				}
+
+				So(len(m.List()), ShouldEqual, 3)
+			})
+		})
+
+		Convey("When a running job is canceled", func() {
+			job := m.Submit(Restore, "w1", "b1", blocking(started, release, "restore"))
+			<-started
+
+			_, err := m.Cancel(job.Id)
+			So(err, ShouldBeNil)
+			job, _ = m.Wait(job.Id)
+
+			Convey("It should be canceled once the work stops", func() {
+				So(job.State, ShouldEqual, Canceled)
+
+				_, err := m.Cancel(job.Id)
+				So(err, ShouldEqual, FinishedError)
+			})
+		})
+
+		Convey("When a queued job is canceled", func() {
+			first := m.Submit(Backup, "w1", "", blocking(started, release, "first"))
+			queued := m.Submit(Backup, "w1", "", blocking(started, release, "queued"))
+			<-started
+
+			job, err := m.Cancel(queued.Id)
+
+			Convey("It should never run", func() {
+				So(err, ShouldBeNil)
+				So(job.State, ShouldEqual, Canceled)
+
+				release <- true
+				m.Wait(first.Id)
+				So(len(started), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When a job fails", func() {
+			job := m.Submit(Verify, "w1", "b1", func(p *Progress) error {
+				return errors.New("bad checksum")
+			})
+			job, _ = m.Wait(job.Id)
+
+			Convey("It should keep the error", func() {
+				So(job.State, ShouldEqual, Failed)
+				So(job.Error, ShouldEqual, "bad checksum")
+			})
+		})
+
+		Convey("When a job panics", func() {
+			job := m.Submit(Restore, "w1", "b1", func(p *Progress) error {
+				var world map[string]string
+				world["name"] = "gone"
+				return nil
+			})
+			job, _ = m.Wait(job.Id)
+
+			next := m.Submit(Verify, "w1", "b1", func(p *Progress) error { return nil })
+			next, _ = m.Wait(next.Id)
+
+			Convey("It should fail the job and keep running others", func() {
+				So(job.State, ShouldEqual, Failed)
+				So(job.Error, ShouldContainSubstring, "The job stopped unexpectedly")
+				So(next.State, ShouldEqual, Done)
+			})
+		})
+
+		Convey("When a job has a result", func() {
+			job := m.Submit(Restore, "w1", "b1", func(p *Progress) error {
+				p.SetResult(42)
+				return nil
+			})
+			job, _ = m.Wait(job.Id)
+
+			Convey("It should be returned with the job", func() {
+				So(job.State, ShouldEqual, Done)
+				So(job.Result, ShouldEqual, 42)
+			})
+		})
+
+		Convey("When a listener is set", func() {
+			defer func() { progressInterval = time.Second }()
+			progressInterval = time.Millisecond
+
+			r := &recorder{}
+			m.SetListener(r)
+
+			job := m.Submit(Backup, "w1", "", func(p *Progress) error {
+				time.Sleep(20 * time.Millisecond)
+				return nil
+			})
+			m.Wait(job.Id)
+
+			Convey("It should hear how the job went", func() {
+				So(r.heard[0], ShouldEqual, "started running")
+				So(r.heard[1], ShouldEqual, "progress running")
+				So(r.heard[len(r.heard)-1], ShouldEqual, "finished done")
+			})
+		})
+
+		Convey("When a job is looked up that doesn't exist", func() {
+			_, err := m.Get("missing")
+			_, cErr := m.Cancel("missing")
+
+			Convey("It should not be found", func() {
+				So(err, ShouldEqual, NotFoundError)
+				So(cErr, ShouldEqual, NotFoundError)
+			})
+		})
+	})
+
+	Convey("Given a job that finished a while ago", t, func() {
+		defer func() { getNow = time.Now }()
+
+		m := newTestManager(Config{KeepFor: "1m"})
+		job := m.Submit(Backup, "w1", "", func(p *Progress) error { return nil })
+		m.Wait(job.Id)
+
+		Convey("It should be forgotten", func() {
+			getNow = func() time.Time { return time.Now().Add(2 * time.Minute) }
+			So(m.List(), ShouldBeEmpty)
+
+			_, err := m.Get(job.Id)
+			So(err, ShouldEqual, NotFoundError)
+		})
+	})
+
+	Convey("Given invalid settings", t, func() {
+		_, wErr := NewManager(logrus.NewEntry(logrus.New()), Config{Workers: -1})
+		_, kErr := NewManager(logrus.NewEntry(logrus.New()), Config{KeepFor: "soon"})
+		_, zeroErr := NewManager(logrus.NewEntry(logrus.New()), Config{KeepFor: "0s"})
+
+		Convey("It should refuse them", func() {
+			So(wErr, ShouldNotBeNil)
+			So(kErr, ShouldNotBeNil)
+			So(zeroErr, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestProgress(t *testing.T) {
+	Convey("Given the progress of a job halfway through", t, func() {
+		start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		p := newProgress()
+		p.start(start)
+		p.SetTotal(4, 1000)
+
+		r := p.Reader(bytes.NewReader(make([]byte, 500)))
+		ioutil.ReadAll(r)
+		p.Add(2, 0)
+
+		Convey("It should count the files and bytes and expect the rest to take as long", func() {
+			c := p.snapshot(start.Add(time.Minute))
+			So(c.Files, ShouldEqual, 2)
+			So(c.Bytes, ShouldEqual, 500)
+			So(*c.ETA, ShouldResemble, start.Add(2*time.Minute))
+		})
+
+		Convey("When it is canceled", func() {
+			p.cancel()
+			p.cancel()
+
+			Convey("It should fail reading", func() {
+				So(p.Err(), ShouldEqual, CanceledError)
+
+				_, err := p.Reader(bytes.NewReader([]byte("more"))).Read(make([]byte, 4))
+				So(err, ShouldEqual, CanceledError)
+			})
+		})
+	})
+
+	Convey("Given no progress", t, func() {
+		var p *Progress
+
+		Convey("It should count nothing and never be canceled", func() {
+			p.SetTotal(1, 1)
+			p.Add(1, 1)
+			So(p.Err(), ShouldBeNil)
+
+			r := bytes.NewReader(nil)
+			So(p.Reader(r), ShouldEqual, r)
+		})
+	})
+}
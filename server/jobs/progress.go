@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Counts is how far a job got. Totals are 0 until they are known.
+type Counts struct {
+	Files      int   `json:"files"`
+	FilesTotal int   `json:"filesTotal"`
+	Bytes      int64 `json:"bytes"`
+	BytesTotal int64 `json:"bytesTotal"`
+
+	// ETA is when the job should be done going by how fast it has been so far
+	ETA *time.Time `json:"eta,omitempty"`
+}
+
+// Progress is handed to the work of a job to count what it got through, and
+// tells it when the job was canceled. A nil Progress counts nothing and is
+// never canceled, so work can run without a job.
+type Progress struct {
+	mu       sync.Mutex
+	counts   Counts
+	result   interface{}
+	started  time.Time
+	canceled chan bool
+}
+
+func newProgress() *Progress {
+	return &Progress{canceled: make(chan bool)}
+}
+
+// SetTotal sets how many files and bytes the job has to get through
+func (p *Progress) SetTotal(files int, bytes int64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.counts.FilesTotal = files
+	p.counts.BytesTotal = bytes
+}
+
+// Add counts files and bytes that were processed
+func (p *Progress) Add(files int, bytes int64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.counts.Files += files
+	p.counts.Bytes += bytes
+}
+
+// SetResult keeps what the job came up with, to return with the job
+func (p *Progress) SetResult(v interface{}) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.result = v
+}
+
+// Err is CanceledError once the job was canceled, work should stop as soon
+// as it sees it
+func (p *Progress) Err() error {
+	if p == nil {
+		return nil
+	}
+
+	select {
+	case <-p.canceled:
+		return CanceledError
+	default:
+		return nil
+	}
+}
+
+// Reader counts the bytes read from r, and fails reading once the job was
+// canceled
+func (p *Progress) Reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+
+	return &progressReader{r: r, p: p}
+}
+
+func (p *Progress) getResult() interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.result
+}
+
+func (p *Progress) start(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.started = now
+}
+
+func (p *Progress) cancel() {
+	select {
+	case <-p.canceled:
+	default:
+		close(p.canceled)
+	}
+}
+
+// snapshot is the counts so far, with the ETA worked out from the bytes, or
+// the files when the size isn't known
+func (p *Progress) snapshot(now time.Time) Counts {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c := p.counts
+	if p.started.IsZero() {
+		return c
+	}
+
+	var done float64
+	switch {
+	case c.BytesTotal > 0 && c.Bytes > 0:
+		done = float64(c.Bytes) / float64(c.BytesTotal)
+	case c.FilesTotal > 0 && c.Files > 0:
+		done = float64(c.Files) / float64(c.FilesTotal)
+	default:
+		return c
+	}
+
+	if done > 1 {
+		done = 1
+	}
+
+	elapsed := now.Sub(p.started)
+	eta := p.started.Add(time.Duration(float64(elapsed) / done))
+	c.ETA = &eta
+
+	return c
+}
+
+type progressReader struct {
+	r io.Reader
+	p *Progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	if err := pr.p.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := pr.r.Read(b)
+	pr.p.Add(0, int64(n))
+	return n, err
+}
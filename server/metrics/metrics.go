@@ -0,0 +1,108 @@
+// Package metrics holds the Prometheus metrics of the server, served by the
+// api at /metrics
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "worldbackup"
+
+// Registry has every metric of the server, along with the Go runtime and
+// process ones
+var Registry = prometheus.NewRegistry()
+
+var (
+	BackupsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backups_created_total",
+		Help:      "Backups made of a world.",
+	}, []string{"folder", "world"})
+
+	BackupsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backups_failed_total",
+		Help:      "Backups of a world that failed.",
+	}, []string{"folder", "world"})
+
+	BackupDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "backup_duration_seconds",
+		Help:      "How long archiving a world took, waiting for the throttle included.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12),
+	})
+
+	ArchiveSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "archive_size_bytes",
+		Help:      "Size of the backup archives written.",
+		Buckets:   prometheus.ExponentialBuckets(1024*1024, 4, 10),
+	})
+
+	BackupsPruned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backups_pruned_total",
+		Help:      "Backups removed by pruning, as another was made soon after them.",
+	}, []string{"folder", "world"})
+
+	CheckDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "watcher_check_duration_seconds",
+		Help:      "How long the watcher took to check every folder, backups made included.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+	})
+
+	CatalogSaveDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "catalog_save_duration_seconds",
+		Help:      "How long writing the catalog took.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 8),
+	})
+
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests to the api by route and status code.",
+	}, []string{"method", "route", "code"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "How long requests to the api took by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		BackupsCreated,
+		BackupsFailed,
+		BackupDuration,
+		ArchiveSize,
+		BackupsPruned,
+		CheckDuration,
+		CatalogSaveDuration,
+		HTTPRequests,
+		HTTPRequestDuration,
+	)
+}
+
+// BackupDone counts a backup of the world as created, or as failed when
+// there is an error
+func BackupDone(folderId, worldId string, err error) {
+	if err != nil {
+		BackupsFailed.WithLabelValues(folderId, worldId).Inc()
+		return
+	}
+
+	BackupsCreated.WithLabelValues(folderId, worldId).Inc()
+}
+
+// Since observes the time from start in the histogram
+func Since(h prometheus.Observer, start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
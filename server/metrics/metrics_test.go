@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics_BackupDone(t *testing.T) {
+	Convey("Given a world backed up", t, func() {
+		created := testutil.ToFloat64(BackupsCreated.WithLabelValues("f1", "w1"))
+		failed := testutil.ToFloat64(BackupsFailed.WithLabelValues("f1", "w1"))
+
+		Convey("When the backup worked", func() {
+			BackupDone("f1", "w1", nil)
+
+			Convey("It should count it as created", func() {
+				So(testutil.ToFloat64(BackupsCreated.WithLabelValues("f1", "w1")), ShouldEqual, created+1)
+				So(testutil.ToFloat64(BackupsFailed.WithLabelValues("f1", "w1")), ShouldEqual, failed)
+			})
+		})
+
+		Convey("When the backup failed", func() {
+			BackupDone("f1", "w1", errors.New("disk full"))
+
+			Convey("It should count it as failed", func() {
+				So(testutil.ToFloat64(BackupsCreated.WithLabelValues("f1", "w1")), ShouldEqual, created)
+				So(testutil.ToFloat64(BackupsFailed.WithLabelValues("f1", "w1")), ShouldEqual, failed+1)
+			})
+		})
+	})
+}
+
+func TestMetrics_WithoutWorlds(t *testing.T) {
+	Convey("Given backups counted for two worlds", t, func() {
+		registry := prometheus.NewRegistry()
+		created := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "created_total", Help: "Created."}, []string{"folder", "world"})
+		requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total", Help: "Requests."}, []string{"code"})
+		registry.MustRegister(created, requests)
+
+		created.WithLabelValues("f1", "w1").Add(2)
+		created.WithLabelValues("f2", "w2").Add(3)
+		requests.WithLabelValues("200").Inc()
+
+		Convey("When they are gathered without the worlds", func() {
+			expected := `
+# HELP created_total Created.
+# TYPE created_total counter
+created_total 5
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{code="200"} 1
+`
+			err := testutil.GatherAndCompare(WithoutWorlds{Gatherer: registry}, strings.NewReader(expected))
+
+			Convey("It should add them up and leave the other labels", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
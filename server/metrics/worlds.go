@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// worldLabels name the folder and world a series is about
+var worldLabels = map[string]bool{"folder": true, "world": true}
+
+// WithoutWorlds gathers the metrics with the folder and world labels taken
+// out, so they don't tell who can scrape them which worlds there are. The
+// series of every world are added up for counters, gauges keep the highest.
+type WithoutWorlds struct {
+	prometheus.Gatherer
+}
+
+func (w WithoutWorlds) Gather() ([]*dto.MetricFamily, error) {
+	families, err := w.Gatherer.Gather()
+
+	for _, mf := range families {
+		if mf.GetType() != dto.MetricType_COUNTER && mf.GetType() != dto.MetricType_GAUGE {
+			continue
+		}
+
+		var merged []*dto.Metric
+		byLabels := map[string]*dto.Metric{}
+		for _, m := range mf.Metric {
+			labels, key := withoutWorldLabels(m.Label)
+			if len(labels) == len(m.Label) {
+				merged = append(merged, m)
+				continue
+			}
+
+			into, ok := byLabels[key]
+			if !ok {
+				m.Label = labels
+				byLabels[key] = m
+				merged = append(merged, m)
+				continue
+			}
+
+			if mf.GetType() == dto.MetricType_COUNTER {
+				sum := into.Counter.GetValue() + m.Counter.GetValue()
+				into.Counter.Value = &sum
+			} else if m.Gauge.GetValue() > into.Gauge.GetValue() {
+				into.Gauge.Value = m.Gauge.Value
+			}
+		}
+		mf.Metric = merged
+	}
+
+	return families, err
+}
+
+// withoutWorldLabels is the labels other than the folder and world, with a
+// key that is the same for series with the same ones
+func withoutWorldLabels(labels []*dto.LabelPair) ([]*dto.LabelPair, string) {
+	var kept []*dto.LabelPair
+	var key []string
+	for _, l := range labels {
+		if worldLabels[l.GetName()] {
+			continue
+		}
+		kept = append(kept, l)
+		key = append(key, l.GetName()+"="+l.GetValue())
+	}
+
+	sort.Strings(key)
+	return kept, strings.Join(key, ",")
+}
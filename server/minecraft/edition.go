@@ -0,0 +1,51 @@
+package minecraft
+
+import (
+	"os"
+)
+
+// Edition is the flavour of Minecraft that wrote a world folder
+type Edition string
+
+const (
+	Unknown Edition = ""
+	Java    Edition = "java"
+	Bedrock Edition = "bedrock"
+)
+
+const (
+	LevelDat      = "level.dat"
+	LevelNameFile = "levelname.txt"
+	bedrockDbDir  = "db"
+)
+
+// DetectEdition looks at the entries of a world folder and decides which
+// edition it belongs to. Bedrock worlds keep their chunks in a LevelDB "db"
+// directory, Java worlds only need a level.dat.
+func DetectEdition(entries []os.FileInfo) Edition {
+	hasLevelDat := false
+	hasLevelName := false
+	hasDb := false
+
+	for i := range entries {
+		e := entries[i]
+		switch {
+		case e.IsDir() && e.Name() == bedrockDbDir:
+			hasDb = true
+		case !e.IsDir() && e.Name() == LevelDat:
+			hasLevelDat = true
+		case !e.IsDir() && e.Name() == LevelNameFile:
+			hasLevelName = true
+		}
+	}
+
+	if hasDb && (hasLevelDat || hasLevelName) {
+		return Bedrock
+	}
+
+	if hasLevelDat {
+		return Java
+	}
+
+	return Unknown
+}
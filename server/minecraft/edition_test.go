@@ -0,0 +1,57 @@
+package minecraft
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeInfo struct {
+	name string
+	dir  bool
+}
+
+func (f fakeInfo) Name() string       { return f.name }
+func (f fakeInfo) Size() int64        { return 0 }
+func (f fakeInfo) Mode() os.FileMode  { return 0 }
+func (f fakeInfo) ModTime() time.Time { return time.Time{} }
+func (f fakeInfo) IsDir() bool        { return f.dir }
+func (f fakeInfo) Sys() interface{}   { return nil }
+
+func TestDetectEdition(t *testing.T) {
+	Convey("Given the entries of a folder", t, func() {
+		Convey("When it has a db directory and levelname.txt", func() {
+			entries := []os.FileInfo{fakeInfo{"db", true}, fakeInfo{"levelname.txt", false}}
+
+			Convey("It should be Bedrock", func() {
+				So(DetectEdition(entries), ShouldEqual, Bedrock)
+			})
+		})
+
+		Convey("When it has a level.dat and region directory", func() {
+			entries := []os.FileInfo{fakeInfo{"region", true}, fakeInfo{"level.dat", false}}
+
+			Convey("It should be Java", func() {
+				So(DetectEdition(entries), ShouldEqual, Java)
+			})
+		})
+
+		Convey("When it has a db file rather than a directory", func() {
+			entries := []os.FileInfo{fakeInfo{"db", false}, fakeInfo{"level.dat", false}}
+
+			Convey("It should be Java", func() {
+				So(DetectEdition(entries), ShouldEqual, Java)
+			})
+		})
+
+		Convey("When it has no level files", func() {
+			entries := []os.FileInfo{fakeInfo{"screenshots", true}, fakeInfo{"notes.txt", false}}
+
+			Convey("It should be Unknown", func() {
+				So(DetectEdition(entries), ShouldEqual, Unknown)
+			})
+		})
+	})
+}
@@ -0,0 +1,106 @@
+package minecraft
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Level is the metadata we keep about a world, read from its level.dat
+type Level struct {
+	Name       string
+	LastPlayed time.Time
+	GameType   int
+	Version    string
+}
+
+// bedrockHeaderSize is the storage version and payload length that prefix a
+// Bedrock level.dat
+const bedrockHeaderSize = 8
+
+// ReadJavaLevel reads a gzipped, big-endian Java Edition level.dat
+func ReadJavaLevel(r io.Reader) (*Level, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	root, err := ReadNbt(gz, binary.BigEndian)
+	if err != nil {
+		return nil, err
+	}
+
+	d := root.Compound("Data")
+	if d == nil {
+		return nil, InvalidNbtError
+	}
+
+	l := Level{
+		Name:     d.String("LevelName"),
+		GameType: int(d.Int("GameType")),
+	}
+
+	if lp := d.Int("LastPlayed"); lp > 0 {
+		l.LastPlayed = time.Unix(0, lp*int64(time.Millisecond))
+	}
+
+	if v := d.Compound("Version"); v != nil {
+		l.Version = v.String("Name")
+	}
+
+	return &l, nil
+}
+
+// ReadBedrockLevel reads an uncompressed, little-endian Bedrock Edition level.dat
+func ReadBedrockLevel(r io.Reader) (*Level, error) {
+	header := make([]byte, bedrockHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	root, err := ReadNbt(r, binary.LittleEndian)
+	if err != nil {
+		return nil, err
+	}
+
+	l := Level{
+		Name:     root.String("LevelName"),
+		GameType: int(root.Int("GameType")),
+	}
+
+	if lp := root.Int("LastPlayed"); lp > 0 {
+		l.LastPlayed = time.Unix(lp, 0)
+	}
+
+	if v, ok := root["lastOpenedWithVersion"].([]interface{}); ok {
+		var parts []string
+		for i := range v {
+			parts = append(parts, fmt.Sprint(v[i]))
+		}
+		l.Version = strings.Join(parts, ".")
+	}
+
+	return &l, nil
+}
+
+// ReadLevel reads the level.dat contents for the given edition
+func ReadLevel(edition Edition, levelDat []byte) (*Level, error) {
+	switch edition {
+	case Java:
+		return ReadJavaLevel(bytes.NewReader(levelDat))
+	case Bedrock:
+		return ReadBedrockLevel(bytes.NewReader(levelDat))
+	}
+
+	return nil, fmt.Errorf("Unknown edition: %q", edition)
+}
+
+// ParseLevelName cleans up the contents of a Bedrock levelname.txt
+func ParseLevelName(contents []byte) string {
+	return strings.TrimSpace(strings.TrimPrefix(string(contents), "\ufeff"))
+}
@@ -0,0 +1,89 @@
+package minecraft
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReadLevel(t *testing.T) {
+	lastPlayed := time.Unix(1495807405, 0)
+
+	Convey("Given a Java level.dat", t, func() {
+		w := nbtWriter{order: binary.BigEndian}
+		w.begin("")
+		w.begin("Data")
+		w.str("LevelName", "Paul's World")
+		w.long("LastPlayed", lastPlayed.Unix()*1000)
+		w.int("GameType", 1)
+		w.begin("Version")
+		w.str("Name", "1.12")
+		w.end()
+		w.end()
+		w.end()
+
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		zw.Write(w.buf.Bytes())
+		zw.Close()
+
+		Convey("It should read the level metadata", func() {
+			l, err := ReadLevel(Java, gz.Bytes())
+
+			So(err, ShouldBeNil)
+			So(l.Name, ShouldEqual, "Paul's World")
+			So(l.LastPlayed.Equal(lastPlayed), ShouldBeTrue)
+			So(l.GameType, ShouldEqual, 1)
+			So(l.Version, ShouldEqual, "1.12")
+		})
+
+		Convey("It should fail to read it as Bedrock", func() {
+			_, err := ReadLevel(Bedrock, gz.Bytes())
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a Bedrock level.dat", t, func() {
+		w := nbtWriter{order: binary.LittleEndian}
+		w.begin("")
+		w.str("LevelName", "Logan's Island")
+		w.long("LastPlayed", lastPlayed.Unix())
+		w.int("GameType", 0)
+		w.intList("lastOpenedWithVersion", 1, 20, 1, 0, 0)
+		w.end()
+
+		var levelDat bytes.Buffer
+		binary.Write(&levelDat, binary.LittleEndian, int32(10))
+		binary.Write(&levelDat, binary.LittleEndian, int32(w.buf.Len()))
+		levelDat.Write(w.buf.Bytes())
+
+		Convey("It should read the level metadata", func() {
+			l, err := ReadLevel(Bedrock, levelDat.Bytes())
+
+			So(err, ShouldBeNil)
+			So(l.Name, ShouldEqual, "Logan's Island")
+			So(l.LastPlayed.Equal(lastPlayed), ShouldBeTrue)
+			So(l.GameType, ShouldEqual, 0)
+			So(l.Version, ShouldEqual, "1.20.1.0.0")
+		})
+	})
+
+	Convey("Given an unknown edition", t, func() {
+		Convey("It should return an error", func() {
+			_, err := ReadLevel(Unknown, []byte{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseLevelName(t *testing.T) {
+	Convey("Given the contents of a levelname.txt", t, func() {
+		Convey("It should strip the byte order mark and whitespace", func() {
+			So(ParseLevelName([]byte("\ufeffMy World\r\n")), ShouldEqual, "My World")
+		})
+	})
+}
@@ -0,0 +1,27 @@
+package minecraft
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// lockFiles are held open by the game while a world is loaded, session.lock
+// by Java Edition and the LevelDB LOCK by Bedrock
+var lockFiles = []string{"session.lock", filepath.Join("db", "LOCK")}
+
+// IsOpen reports whether the game currently has the world in worldDir loaded.
+// Java Edition only locks session.lock since 1.15, older versions will always
+// look closed.
+func IsOpen(worldDir string) (bool, error) {
+	for _, name := range lockFiles {
+		locked, err := isLocked(filepath.Join(worldDir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil || locked {
+			return locked, err
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,37 @@
+package minecraft
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIsOpen(t *testing.T) {
+	Convey("Given a world folder", t, func() {
+		dir, _ := ioutil.TempDir("", "world")
+		defer os.RemoveAll(dir)
+
+		Convey("When it has no lock files", func() {
+			open, err := IsOpen(dir)
+
+			Convey("It should not be open", func() {
+				So(err, ShouldBeNil)
+				So(open, ShouldBeFalse)
+			})
+		})
+
+		Convey("When nothing holds the session.lock", func() {
+			ioutil.WriteFile(filepath.Join(dir, "session.lock"), []byte("\xe2\x98\x83"), 0644)
+
+			open, err := IsOpen(dir)
+
+			Convey("It should not be open", func() {
+				So(err, ShouldBeNil)
+				So(open, ShouldBeFalse)
+			})
+		})
+	})
+}
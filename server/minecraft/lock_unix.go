@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package minecraft
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// isLocked asks for the fcntl lock both Java and LevelDB take, without
+// taking it ourselves
+func isLocked(name string) (bool, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: io.SeekStart}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, &lock); err != nil {
+		return false, err
+	}
+
+	return lock.Type != syscall.F_UNLCK, nil
+}
@@ -0,0 +1,64 @@
+//go:build !windows
+// +build !windows
+
+package minecraft
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestLockHelper stands in for the game, fcntl locks held by our own process
+// are invisible to F_GETLK
+func TestLockHelper(t *testing.T) {
+	name := os.Getenv("WB_LOCK_FILE")
+	if name == "" {
+		return
+	}
+
+	f, _ := os.OpenFile(name, os.O_RDWR, 0)
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: io.SeekStart}
+	syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, &lock)
+
+	os.Stdout.WriteString("locked\n")
+	ioutil.ReadAll(os.Stdin)
+	os.Exit(0)
+}
+
+func TestIsOpen_Locked(t *testing.T) {
+	Convey("Given a world the game has open", t, func() {
+		dir, _ := ioutil.TempDir("", "world")
+		defer os.RemoveAll(dir)
+
+		os.MkdirAll(filepath.Join(dir, "db"), 0755)
+		lockFile := filepath.Join(dir, "db", "LOCK")
+		ioutil.WriteFile(lockFile, nil, 0644)
+
+		cmd := exec.Command(os.Args[0], "-test.run=TestLockHelper")
+		cmd.Env = append(os.Environ(), "WB_LOCK_FILE="+lockFile)
+		stdin, _ := cmd.StdinPipe()
+		stdout, _ := cmd.StdoutPipe()
+		So(cmd.Start(), ShouldBeNil)
+		defer func() {
+			stdin.Close()
+			cmd.Wait()
+		}()
+
+		bufio.NewReader(stdout).ReadString('\n')
+
+		Convey("It should be open", func() {
+			open, err := IsOpen(dir)
+
+			So(err, ShouldBeNil)
+			So(open, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package minecraft
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// isLocked tries to read the file. Windows locks are mandatory so the read
+// fails while the game holds the lock.
+func isLocked(name string) (bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		if isViolation(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	if _, err := f.Read(make([]byte, 1)); err != nil && isViolation(err) {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func isViolation(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+
+	return err == errorSharingViolation || err == errorLockViolation
+}
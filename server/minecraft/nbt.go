@@ -0,0 +1,260 @@
+package minecraft
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	tagEnd byte = iota
+	tagByte
+	tagShort
+	tagInt
+	tagLong
+	tagFloat
+	tagDouble
+	tagByteArray
+	tagString
+	tagList
+	tagCompound
+	tagIntArray
+	tagLongArray
+)
+
+// Compound is a decoded NBT compound tag
+type Compound map[string]interface{}
+
+var InvalidNbtError = errors.New("Invalid NBT data")
+
+// maxNbtArray is the most bytes an array or list is allowed to take, far
+// more than any level.dat holds, so a corrupt length can't ask for more
+const maxNbtArray = 16 * 1024 * 1024
+
+// ReadNbt decodes a named root compound tag. Java Edition stores NBT big-endian
+// while Bedrock Edition uses little-endian.
+func ReadNbt(r io.Reader, order binary.ByteOrder) (Compound, error) {
+	d := nbtDecoder{r: r, order: order}
+
+	t, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	if t != tagCompound {
+		return nil, InvalidNbtError
+	}
+
+	if _, err := d.string(); err != nil {
+		return nil, err
+	}
+
+	v, err := d.payload(t)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(Compound), nil
+}
+
+func (c Compound) Compound(name string) Compound {
+	if v, ok := c[name].(Compound); ok {
+		return v
+	}
+
+	return nil
+}
+
+func (c Compound) String(name string) string {
+	if v, ok := c[name].(string); ok {
+		return v
+	}
+
+	return ""
+}
+
+// Int returns any integer tag widened to int64
+func (c Compound) Int(name string) int64 {
+	switch v := c[name].(type) {
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	}
+
+	return 0
+}
+
+type nbtDecoder struct {
+	r     io.Reader
+	order binary.ByteOrder
+}
+
+func (d *nbtDecoder) read(v interface{}) error {
+	return binary.Read(d.r, d.order, v)
+}
+
+func (d *nbtDecoder) byte() (byte, error) {
+	var b byte
+	err := d.read(&b)
+	return b, err
+}
+
+// length reads the length of an array or list with items of size bytes,
+// rejecting lengths that are negative or more than could be left to read
+func (d *nbtDecoder) length(size int) (int, error) {
+	var l int32
+	if err := d.read(&l); err != nil {
+		return 0, err
+	}
+
+	if l < 0 {
+		return 0, InvalidNbtError
+	}
+
+	return int(l), d.fits(int64(l) * int64(size))
+}
+
+// fits fails for n bytes that can't be in the data, bytes.Reader and the
+// like tell how much is left
+func (d *nbtDecoder) fits(n int64) error {
+	if n > maxNbtArray {
+		return InvalidNbtError
+	}
+
+	if r, ok := d.r.(interface{ Len() int }); ok && n > int64(r.Len()) {
+		return InvalidNbtError
+	}
+
+	return nil
+}
+
+func (d *nbtDecoder) string() (string, error) {
+	var l uint16
+	if err := d.read(&l); err != nil {
+		return "", err
+	}
+
+	if err := d.fits(int64(l)); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, l)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (d *nbtDecoder) payload(t byte) (interface{}, error) {
+	switch t {
+	case tagByte:
+		var v int8
+		return v, d.read(&v)
+	case tagShort:
+		var v int16
+		return v, d.read(&v)
+	case tagInt:
+		var v int32
+		return v, d.read(&v)
+	case tagLong:
+		var v int64
+		return v, d.read(&v)
+	case tagFloat:
+		var v float32
+		return v, d.read(&v)
+	case tagDouble:
+		var v float64
+		return v, d.read(&v)
+	case tagString:
+		return d.string()
+	case tagByteArray:
+		l, err := d.length(1)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]byte, l)
+		_, err = io.ReadFull(d.r, v)
+		return v, err
+	case tagIntArray:
+		l, err := d.length(4)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int32, l)
+		return v, d.read(v)
+	case tagLongArray:
+		l, err := d.length(8)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int64, l)
+		return v, d.read(v)
+	case tagList:
+		return d.list()
+	case tagCompound:
+		return d.compound()
+	}
+
+	return nil, fmt.Errorf("Unknown NBT tag type: %d", t)
+}
+
+func (d *nbtDecoder) list() ([]interface{}, error) {
+	t, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	// every item takes at least a byte, only empty lists have no type
+	size := 1
+	if t == tagEnd {
+		size = 0
+	}
+	l, err := d.length(size)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []interface{}
+	for i := 0; i < l; i++ {
+		v, err := d.payload(t)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+	}
+
+	return items, nil
+}
+
+func (d *nbtDecoder) compound() (Compound, error) {
+	c := Compound{}
+	for {
+		t, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+
+		if t == tagEnd {
+			return c, nil
+		}
+
+		name, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := d.payload(t)
+		if err != nil {
+			return nil, err
+		}
+
+		c[name] = v
+	}
+}
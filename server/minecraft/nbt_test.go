@@ -0,0 +1,148 @@
+package minecraft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// nbtWriter is a tiny encoder used to build level.dat fixtures
+type nbtWriter struct {
+	buf   bytes.Buffer
+	order binary.ByteOrder
+}
+
+func (w *nbtWriter) name(t byte, name string) {
+	w.buf.WriteByte(t)
+	binary.Write(&w.buf, w.order, uint16(len(name)))
+	w.buf.WriteString(name)
+}
+
+func (w *nbtWriter) begin(name string) { w.name(tagCompound, name) }
+
+func (w *nbtWriter) end() { w.buf.WriteByte(tagEnd) }
+
+func (w *nbtWriter) str(name, v string) {
+	w.name(tagString, name)
+	binary.Write(&w.buf, w.order, uint16(len(v)))
+	w.buf.WriteString(v)
+}
+
+func (w *nbtWriter) int(name string, v int32) {
+	w.name(tagInt, name)
+	binary.Write(&w.buf, w.order, v)
+}
+
+func (w *nbtWriter) long(name string, v int64) {
+	w.name(tagLong, name)
+	binary.Write(&w.buf, w.order, v)
+}
+
+func (w *nbtWriter) intList(name string, v ...int32) {
+	w.name(tagList, name)
+	w.buf.WriteByte(tagInt)
+	binary.Write(&w.buf, w.order, int32(len(v)))
+	for i := range v {
+		binary.Write(&w.buf, w.order, v[i])
+	}
+}
+
+func (w *nbtWriter) array(t byte, name string, length int32, itemSize int) {
+	w.name(t, name)
+	binary.Write(&w.buf, w.order, length)
+	w.buf.Write(make([]byte, int(length)*itemSize))
+}
+
+func TestReadNbt(t *testing.T) {
+	Convey("Given a big-endian compound", t, func() {
+		w := nbtWriter{order: binary.BigEndian}
+		w.begin("")
+		w.str("Name", "Sydney")
+		w.int("Count", 42)
+		w.begin("Inner")
+		w.long("Big", 1<<40)
+		w.end()
+		w.intList("List", 1, 2, 3)
+		w.end()
+
+		Convey("It should decode every tag", func() {
+			c, err := ReadNbt(&w.buf, binary.BigEndian)
+
+			So(err, ShouldBeNil)
+			So(c.String("Name"), ShouldEqual, "Sydney")
+			So(c.Int("Count"), ShouldEqual, 42)
+			So(c.Compound("Inner").Int("Big"), ShouldEqual, 1<<40)
+			So(len(c["List"].([]interface{})), ShouldEqual, 3)
+		})
+	})
+
+	Convey("Given data that does not start with a compound", t, func() {
+		Convey("It should return InvalidNbtError", func() {
+			_, err := ReadNbt(bytes.NewReader([]byte{tagString, 0, 0}), binary.BigEndian)
+			So(err, ShouldEqual, InvalidNbtError)
+		})
+	})
+
+	Convey("Given truncated data", t, func() {
+		w := nbtWriter{order: binary.LittleEndian}
+		w.begin("")
+		w.str("Name", "Sydney")
+
+		Convey("It should return an error", func() {
+			_, err := ReadNbt(bytes.NewReader(w.buf.Bytes()[:w.buf.Len()-2]), binary.LittleEndian)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given arrays with corrupt lengths", t, func() {
+		for _, tag := range []byte{tagByteArray, tagIntArray, tagLongArray, tagList} {
+			for _, length := range []int32{-1, -1 << 31, 1<<31 - 1, 1 << 24, 9} {
+				w := nbtWriter{order: binary.BigEndian}
+				w.begin("")
+				w.name(tag, "Array")
+				if tag == tagList {
+					w.buf.WriteByte(tagInt)
+				}
+				binary.Write(&w.buf, w.order, length)
+				w.buf.Write(make([]byte, 8))
+				w.end()
+
+				Convey(fmt.Sprintf("It should reject tag %d with length %d", tag, length), func() {
+					var err error
+					So(func() { _, err = ReadNbt(bytes.NewReader(w.buf.Bytes()), binary.BigEndian) }, ShouldNotPanic)
+					So(err, ShouldNotBeNil)
+				})
+			}
+		}
+	})
+
+	Convey("Given valid data with random bytes overwritten", t, func() {
+		w := nbtWriter{order: binary.BigEndian}
+		w.begin("")
+		w.str("Name", "Sydney")
+		w.array(tagByteArray, "Bytes", 4, 1)
+		w.array(tagIntArray, "Ints", 3, 4)
+		w.array(tagLongArray, "Longs", 2, 8)
+		w.intList("List", 1, 2, 3)
+		w.end()
+		valid := w.buf.Bytes()
+
+		Convey("It should never panic", func() {
+			r := rand.New(rand.NewSource(1))
+			So(func() {
+				for i := 0; i < 5000; i++ {
+					data := append([]byte{}, valid...)
+					for j := 0; j < 1+r.Intn(4); j++ {
+						data[r.Intn(len(data))] = byte(r.Intn(256))
+					}
+
+					ReadNbt(bytes.NewReader(data), binary.BigEndian)
+				}
+			}, ShouldNotPanic)
+		})
+	})
+}
@@ -0,0 +1,74 @@
+package region
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	Overworld = "minecraft:overworld"
+	Nether    = "minecraft:the_nether"
+	End       = "minecraft:the_end"
+)
+
+// DimensionName maps the folder a dimension is saved in, relative to the
+// world, to its namespaced id
+func DimensionName(dir string) string {
+	switch {
+	case dir == "." || dir == "":
+		return Overworld
+	case dir == "DIM-1":
+		return Nether
+	case dir == "DIM1":
+		return End
+	case strings.HasPrefix(dir, "dimensions/"):
+		parts := strings.SplitN(strings.TrimPrefix(dir, "dimensions/"), "/", 2)
+		if len(parts) == 2 {
+			return parts[0] + ":" + parts[1]
+		}
+	}
+
+	return dir
+}
+
+// DimensionDir is the reverse of DimensionName. Ids without a namespace are
+// taken to be vanilla minecraft ones.
+func DimensionDir(name string) string {
+	if !strings.Contains(name, ":") {
+		name = "minecraft:" + name
+	}
+
+	switch name {
+	case Overworld:
+		return "."
+	case Nether:
+		return "DIM-1"
+	case End:
+		return "DIM1"
+	}
+
+	parts := strings.SplitN(name, ":", 2)
+	return path.Join("dimensions", parts[0], parts[1])
+}
+
+// The folders of a dimension that hold region files, the terrain, the
+// entities and the points of interest like villager beds of each area
+const (
+	Terrain  = "region"
+	Entities = "entities"
+	Poi      = "poi"
+)
+
+// Kinds are all the folders of region files, terrain first
+var Kinds = []string{Terrain, Entities, Poi}
+
+// FilePath is the path of a terrain region file relative to the world folder
+func FilePath(dimension string, regionX, regionZ int) string {
+	return KindPath(dimension, Terrain, regionX, regionZ)
+}
+
+// KindPath is the path of a region file of the kind relative to the world
+// folder
+func KindPath(dimension, kind string, regionX, regionZ int) string {
+	return path.Join(DimensionDir(dimension), kind, FileName(regionX, regionZ))
+}
@@ -0,0 +1,209 @@
+package region
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// SectorSize is the unit region files are allocated in
+	SectorSize = 4096
+	// Width is the number of chunks along each side of a region
+	Width = 32
+	// ChunkCount is the number of chunk slots in a region
+	ChunkCount = Width * Width
+
+	headerSize = SectorSize * 2
+)
+
+var InvalidRegionError = errors.New("Invalid region file")
+
+// Region is a parsed Anvil (.mca) region file. The first sector holds the
+// location of each chunk (3 byte sector offset, 1 byte sector count) and the
+// second sector the time each chunk was last saved.
+type Region struct {
+	locations  [ChunkCount]uint32
+	timestamps [ChunkCount]uint32
+	data       []byte
+	replaced   map[int]*Chunk
+}
+
+// Chunk is a single chunk slot of a region
+type Chunk struct {
+	Index     int
+	Timestamp uint32
+	// Payload is the compression type byte followed by the compressed chunk
+	Payload []byte
+}
+
+// Parse reads the header of a region file. An empty file is a valid region
+// with no chunks.
+func Parse(b []byte) (*Region, error) {
+	r := Region{data: b}
+
+	if len(b) == 0 {
+		return &r, nil
+	}
+
+	if len(b) < headerSize {
+		return nil, InvalidRegionError
+	}
+
+	for i := 0; i < ChunkCount; i++ {
+		r.locations[i] = binary.BigEndian.Uint32(b[i*4:])
+		r.timestamps[i] = binary.BigEndian.Uint32(b[SectorSize+i*4:])
+	}
+
+	return &r, nil
+}
+
+// Chunk returns the chunk at index i, or nil if the slot is empty
+func (r *Region) Chunk(i int) (*Chunk, error) {
+	if c, ok := r.replaced[i]; ok {
+		return c, nil
+	}
+
+	loc := r.locations[i]
+	if loc == 0 {
+		return nil, nil
+	}
+
+	offset := int(loc>>8) * SectorSize
+	sectors := int(loc & 0xff)
+
+	if offset < headerSize || offset+4 > len(r.data) {
+		return nil, fmt.Errorf("Chunk %d points outside of the region", i)
+	}
+
+	length := int(binary.BigEndian.Uint32(r.data[offset:]))
+	if length == 0 || length > sectors*SectorSize || offset+4+length > len(r.data) {
+		return nil, fmt.Errorf("Chunk %d has an invalid length", i)
+	}
+
+	return &Chunk{
+		Index:     i,
+		Timestamp: r.timestamps[i],
+		Payload:   r.data[offset+4 : offset+4+length],
+	}, nil
+}
+
+// Timestamp is the last save time of the chunk at index i
+func (r *Region) Timestamp(i int) uint32 {
+	if c, ok := r.replaced[i]; ok {
+		if c == nil {
+			return 0
+		}
+		return c.Timestamp
+	}
+
+	return r.timestamps[i]
+}
+
+// HasChunk is true when the slot at index i is in use
+func (r *Region) HasChunk(i int) bool {
+	if c, ok := r.replaced[i]; ok {
+		return c != nil
+	}
+
+	return r.locations[i] != 0
+}
+
+// SetChunk replaces the chunk in slot c.Index, a nil payload empties the slot
+// so the game generates it again
+func (r *Region) SetChunk(c *Chunk) {
+	if r.replaced == nil {
+		r.replaced = map[int]*Chunk{}
+	}
+
+	if c.Payload == nil {
+		r.replaced[c.Index] = nil
+		return
+	}
+
+	r.replaced[c.Index] = c
+}
+
+// Bytes writes the region back out. Chunks are packed one after the other
+// and the location and timestamp headers are rebuilt to match.
+func (r *Region) Bytes() ([]byte, error) {
+	header := make([]byte, headerSize)
+	var body []byte
+
+	for i := 0; i < ChunkCount; i++ {
+		c, err := r.Chunk(i)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			continue
+		}
+
+		sectors := (len(c.Payload) + 4 + SectorSize - 1) / SectorSize
+		if sectors > 0xff {
+			return nil, fmt.Errorf("Chunk %d is too big for a region file", i)
+		}
+
+		offset := 2 + len(body)/SectorSize
+		binary.BigEndian.PutUint32(header[i*4:], uint32(offset<<8|sectors))
+		binary.BigEndian.PutUint32(header[SectorSize+i*4:], c.Timestamp)
+
+		s := make([]byte, sectors*SectorSize)
+		binary.BigEndian.PutUint32(s, uint32(len(c.Payload)))
+		copy(s[4:], c.Payload)
+		body = append(body, s...)
+	}
+
+	return append(header, body...), nil
+}
+
+// External is true for chunks too big for the region, their data is in a
+// .mcc file next to it and the payload is only the compression type
+func (c *Chunk) External() bool {
+	return len(c.Payload) > 0 && c.Payload[0]&externalFlag != 0
+}
+
+// externalFlag is set on the compression type of chunks kept in .mcc files
+const externalFlag = 0x80
+
+// ExternalFileName is the name of the .mcc file holding the data of a chunk
+// too big for its region
+func ExternalFileName(chunkX, chunkZ int) string {
+	return fmt.Sprintf("c.%d.%d.mcc", chunkX, chunkZ)
+}
+
+// Hash is a digest of the compressed chunk. Chunks too big for a region are
+// stored in separate .mcc files, for those only the marker is hashed.
+func (c *Chunk) Hash() [sha1.Size]byte {
+	return sha1.Sum(c.Payload)
+}
+
+// Index returns the slot of a chunk within its region
+func Index(chunkX, chunkZ int) int {
+	return (chunkX & (Width - 1)) + (chunkZ&(Width-1))*Width
+}
+
+// ChunkCoords converts a region position and slot index to chunk coordinates
+func ChunkCoords(regionX, regionZ, i int) (int, int) {
+	return regionX*Width + i%Width, regionZ*Width + i/Width
+}
+
+// FileName is the name of the region file holding the given region
+func FileName(regionX, regionZ int) string {
+	return fmt.Sprintf("r.%d.%d.mca", regionX, regionZ)
+}
+
+// RegionCoords returns the region a chunk belongs to
+func RegionCoords(chunkX, chunkZ int) (int, int) {
+	return chunkX >> 5, chunkZ >> 5
+}
+
+// ParseName reads the region coordinates from a file name like r.-1.2.mca
+func ParseName(name string) (x, z int, ok bool) {
+	if n, err := fmt.Sscanf(name, "r.%d.%d.mca", &x, &z); err != nil || n != 2 {
+		return 0, 0, false
+	}
+
+	return x, z, FileName(x, z) == name
+}
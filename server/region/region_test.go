@@ -0,0 +1,176 @@
+package region
+
+import (
+	"encoding/binary"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// buildRegion lays out the given chunk payloads one sector each after the header
+func buildRegion(chunks map[int][]byte, timestamps map[int]uint32) []byte {
+	b := make([]byte, headerSize)
+	sector := 2
+
+	for i := 0; i < ChunkCount; i++ {
+		payload, ok := chunks[i]
+		if !ok {
+			continue
+		}
+
+		binary.BigEndian.PutUint32(b[i*4:], uint32(sector<<8|1))
+		binary.BigEndian.PutUint32(b[SectorSize+i*4:], timestamps[i])
+
+		s := make([]byte, SectorSize)
+		binary.BigEndian.PutUint32(s, uint32(len(payload)))
+		copy(s[4:], payload)
+		b = append(b, s...)
+		sector++
+	}
+
+	return b
+}
+
+func TestParse(t *testing.T) {
+	Convey("Given a region with two chunks", t, func() {
+		b := buildRegion(
+			map[int][]byte{0: {2, 'a', 'b'}, 33: {2, 'c'}},
+			map[int]uint32{0: 100, 33: 200},
+		)
+
+		r, err := Parse(b)
+		So(err, ShouldBeNil)
+
+		Convey("It should read the chunks", func() {
+			c0, err0 := r.Chunk(0)
+			c33, err33 := r.Chunk(33)
+
+			So(err0, ShouldBeNil)
+			So(err33, ShouldBeNil)
+			So(c0.Payload, ShouldResemble, []byte{2, 'a', 'b'})
+			So(c0.Timestamp, ShouldEqual, 100)
+			So(c33.Payload, ShouldResemble, []byte{2, 'c'})
+			So(c33.Timestamp, ShouldEqual, 200)
+			So(c0.Hash(), ShouldNotResemble, c33.Hash())
+		})
+
+		Convey("It should return nil for empty slots", func() {
+			c, err := r.Chunk(1)
+
+			So(err, ShouldBeNil)
+			So(c, ShouldBeNil)
+			So(r.HasChunk(1), ShouldBeFalse)
+		})
+
+		Convey("It should report chunks that point past the end of the file", func() {
+			r2, _ := Parse(b[:headerSize+2])
+			_, err := r2.Chunk(0)
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an empty file", t, func() {
+		r, err := Parse([]byte{})
+
+		Convey("It should be a region without chunks", func() {
+			So(err, ShouldBeNil)
+			So(r.HasChunk(0), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given a truncated header", t, func() {
+		_, err := Parse(make([]byte, 100))
+
+		Convey("It should return InvalidRegionError", func() {
+			So(err, ShouldEqual, InvalidRegionError)
+		})
+	})
+}
+
+func TestRegion_Bytes(t *testing.T) {
+	Convey("Given a region with chunks replaced", t, func() {
+		r, _ := Parse(buildRegion(
+			map[int][]byte{0: {2, 'a'}, 1: {2, 'b'}, 2: {2, 'c'}},
+			map[int]uint32{0: 100, 1: 100, 2: 100},
+		))
+
+		big := make([]byte, SectorSize+10)
+		big[0] = 2
+		r.SetChunk(&Chunk{Index: 1, Timestamp: 50, Payload: big})
+		r.SetChunk(&Chunk{Index: 2})
+		r.SetChunk(&Chunk{Index: 900, Timestamp: 60, Payload: []byte{2, 'z'}})
+
+		Convey("It should write a region that reads back the same", func() {
+			b, err := r.Bytes()
+			So(err, ShouldBeNil)
+			So(len(b)%SectorSize, ShouldEqual, 0)
+
+			r2, err := Parse(b)
+			So(err, ShouldBeNil)
+
+			c0, _ := r2.Chunk(0)
+			So(c0.Payload, ShouldResemble, []byte{2, 'a'})
+			So(c0.Timestamp, ShouldEqual, 100)
+
+			c1, _ := r2.Chunk(1)
+			So(c1.Payload, ShouldResemble, big)
+			So(c1.Timestamp, ShouldEqual, 50)
+
+			So(r2.HasChunk(2), ShouldBeFalse)
+
+			c900, _ := r2.Chunk(900)
+			So(c900.Payload, ShouldResemble, []byte{2, 'z'})
+		})
+	})
+}
+
+func TestDimensions(t *testing.T) {
+	Convey("Given dimension folders and ids", t, func() {
+		Convey("It should map folders to ids", func() {
+			So(DimensionName("."), ShouldEqual, Overworld)
+			So(DimensionName("DIM-1"), ShouldEqual, Nether)
+			So(DimensionName("DIM1"), ShouldEqual, End)
+			So(DimensionName("dimensions/mymod/sky"), ShouldEqual, "mymod:sky")
+		})
+
+		Convey("It should map ids back to region paths", func() {
+			So(FilePath("overworld", 0, -1), ShouldEqual, "region/r.0.-1.mca")
+			So(FilePath(Nether, 1, 1), ShouldEqual, "DIM-1/region/r.1.1.mca")
+			So(FilePath("the_end", 0, 0), ShouldEqual, "DIM1/region/r.0.0.mca")
+			So(FilePath("mymod:sky", 0, 0), ShouldEqual, "dimensions/mymod/sky/region/r.0.0.mca")
+		})
+	})
+}
+
+func TestCoords(t *testing.T) {
+	Convey("Given region and chunk coordinates", t, func() {
+		Convey("It should convert between chunk slots and coordinates", func() {
+			x, z := ChunkCoords(-1, 2, Index(-3, 70))
+
+			So(x, ShouldEqual, -3)
+			So(z, ShouldEqual, 70)
+		})
+
+		Convey("It should find the region of a chunk", func() {
+			x, z := RegionCoords(-1, 40)
+
+			So(x, ShouldEqual, -1)
+			So(z, ShouldEqual, 1)
+			So(FileName(x, z), ShouldEqual, "r.-1.1.mca")
+		})
+
+		Convey("It should parse region file names", func() {
+			x, z, ok := ParseName("r.-1.2.mca")
+			So(ok, ShouldBeTrue)
+			So(x, ShouldEqual, -1)
+			So(z, ShouldEqual, 2)
+
+			_, _, ok = ParseName("r.1.2.mca.bak")
+			So(ok, ShouldBeFalse)
+
+			_, _, ok = ParseName("level.dat")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
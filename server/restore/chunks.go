@@ -0,0 +1,285 @@
+package restore
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"world-backup/server/fs"
+	"world-backup/server/region"
+)
+
+// Area is a rectangle of chunks in one dimension, the corners are inclusive
+type Area struct {
+	Dimension string `json:"dimension"`
+	MinX      int    `json:"minX"`
+	MinZ      int    `json:"minZ"`
+	MaxX      int    `json:"maxX"`
+	MaxZ      int    `json:"maxZ"`
+}
+
+// ChunkArea builds an area from two opposite corners given in chunk coordinates
+func ChunkArea(dimension string, x1, z1, x2, z2 int) Area {
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	if z1 > z2 {
+		z1, z2 = z2, z1
+	}
+
+	return Area{Dimension: dimension, MinX: x1, MinZ: z1, MaxX: x2, MaxZ: z2}
+}
+
+// BlockArea builds an area covering every chunk touched by the block
+// bounding box given by two opposite corners
+func BlockArea(dimension string, x1, z1, x2, z2 int) Area {
+	return ChunkArea(dimension, x1>>4, z1>>4, x2>>4, z2>>4)
+}
+
+func (a Area) contains(x, z int) bool {
+	return x >= a.MinX && x <= a.MaxX && z >= a.MinZ && z <= a.MaxZ
+}
+
+// Result counts what a chunk restore changed in the live world
+type Result struct {
+	Regions  int `json:"regions"`
+	Restored int `json:"restored"`
+	Removed  int `json:"removed"`
+}
+
+type IRestoreFs interface {
+	OpenArchive(file fs.ArchiveFile) (fs.ArchiveReader, error)
+	ReadFile(filename string) ([]byte, error)
+	WriteFile(filename string, data []byte, perm os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+	Exists(path string) (bool, error)
+	Rename(oldname, newname string) error
+	Remove(name string) error
+}
+
+// MaxRegions is how many regions across either way an area can be, 64
+// regions are 32768 blocks
+const MaxRegions = 64
+
+var AreaTooBigError = fmt.Errorf("The area can be at most %d regions, %d blocks, across", MaxRegions, MaxRegions*region.Width*16)
+
+// TooBig is true for areas more than MaxRegions across either way
+func (a Area) TooBig() bool {
+	minRX, minRZ := region.RegionCoords(a.MinX, a.MinZ)
+	maxRX, maxRZ := region.RegionCoords(a.MaxX, a.MaxZ)
+
+	return int64(maxRX)-int64(minRX) >= MaxRegions || int64(maxRZ)-int64(minRZ) >= MaxRegions
+}
+
+// Chunks copies the chunks inside area from the backup file into the
+// world at worldPath, along with their entities and points of interest.
+// Chunks that did not exist yet when the backup was taken are removed so the
+// game generates them again. Everything outside of the area is left as it is.
+var Chunks = func(f IRestoreFs, backupFile fs.ArchiveFile, worldPath string, area Area) (*Result, error) {
+	if area.TooBig() {
+		return nil, AreaTooBigError
+	}
+
+	backup, err := f.OpenArchive(backupFile)
+	if err != nil {
+		return nil, err
+	}
+	defer backup.Close()
+
+	entries := map[string]string{}
+	for _, e := range backup.Entries() {
+		entries[worldRelative(e.Name)] = e.Name
+	}
+
+	result := Result{}
+
+	minRX, minRZ := region.RegionCoords(area.MinX, area.MinZ)
+	maxRX, maxRZ := region.RegionCoords(area.MaxX, area.MaxZ)
+
+	for rx := minRX; rx <= maxRX; rx++ {
+		for rz := minRZ; rz <= maxRZ; rz++ {
+			for _, kind := range region.Kinds {
+				rel := region.KindPath(area.Dimension, kind, rx, rz)
+
+				changed, err := restoreRegion(f, backup, entries, worldPath, rel, rx, rz, area)
+				if err != nil {
+					return &result, err
+				}
+				if len(changed) == 0 {
+					continue
+				}
+				result.Regions++
+
+				// the entities and points of interest go with the terrain,
+				// only its chunks are counted
+				if kind != region.Terrain {
+					continue
+				}
+				for _, c := range changed {
+					if c.removed {
+						result.Removed++
+					} else {
+						result.Restored++
+					}
+				}
+			}
+		}
+	}
+
+	return &result, nil
+}
+
+// changedChunk is a chunk of the area that was restored, or removed when
+// the backup didn't have it
+type changedChunk struct {
+	x, z     int
+	removed  bool
+	external bool
+}
+
+// restoreRegion restores the area in one region file, rel is its path in
+// the world. Chunks kept in .mcc files have them copied before the region
+// points to them, the files of chunks that aren't kept in them any more
+// are removed after.
+func restoreRegion(f IRestoreFs, backup fs.ArchiveReader, entries map[string]string, worldPath, rel string, rx, rz int, area Area) ([]changedChunk, error) {
+	from, err := backupRegion(backup, entries[rel])
+	if err != nil {
+		return nil, err
+	}
+
+	livePath := path.Join(worldPath, rel)
+	to, err := liveRegion(f, livePath)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Dir(rel)
+	external := func(x, z int) string {
+		return entries[path.Join(dir, region.ExternalFileName(x, z))]
+	}
+
+	changed := copyChunks(from, to, rx, rz, area, external)
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	for _, c := range changed {
+		if !c.external {
+			continue
+		}
+
+		b, err := backup.ReadFile(external(c.x, c.z))
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFile(f, path.Join(worldPath, dir, region.ExternalFileName(c.x, c.z)), b); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := to.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(f, livePath, b); err != nil {
+		return nil, err
+	}
+
+	for _, c := range changed {
+		if c.external {
+			continue
+		}
+
+		name := path.Join(worldPath, dir, region.ExternalFileName(c.x, c.z))
+		if exists, _ := f.Exists(name); exists {
+			if err := f.Remove(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return changed, nil
+}
+
+// copyChunks replaces the chunks of to that fall inside the area with the
+// ones from the backup. external is the backup's .mcc file of a chunk, a
+// chunk kept in one that the backup is missing is left as it is.
+func copyChunks(from, to *region.Region, rx, rz int, area Area, external func(x, z int) string) []changedChunk {
+	var changed []changedChunk
+
+	for i := 0; i < region.ChunkCount; i++ {
+		x, z := region.ChunkCoords(rx, rz, i)
+		if !area.contains(x, z) {
+			continue
+		}
+
+		c, err := from.Chunk(i)
+		switch {
+		case err != nil:
+			// a chunk the backup can't give back is left as it is now
+			continue
+		case c != nil:
+			if c.External() && external(x, z) == "" {
+				continue
+			}
+			to.SetChunk(c)
+			changed = append(changed, changedChunk{x: x, z: z, external: c.External()})
+		case to.HasChunk(i):
+			to.SetChunk(&region.Chunk{Index: i})
+			changed = append(changed, changedChunk{x: x, z: z, removed: true})
+		}
+	}
+
+	return changed
+}
+
+func backupRegion(a fs.ArchiveReader, name string) (*region.Region, error) {
+	if name == "" {
+		return region.Parse(nil)
+	}
+
+	b, err := a.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return region.Parse(b)
+}
+
+func liveRegion(f IRestoreFs, name string) (*region.Region, error) {
+	if exists, _ := f.Exists(name); !exists {
+		return region.Parse(nil)
+	}
+
+	b, err := f.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return region.Parse(b)
+}
+
+// writeFile writes next to the file and renames it into place so the
+// world never sees a half written one
+func writeFile(f IRestoreFs, name string, b []byte) error {
+	if err := f.MkdirAll(path.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	tmp := name + ".restore"
+	if err := f.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+
+	return f.Rename(tmp, name)
+}
+
+// worldRelative drops the world folder every backup nests its files under
+func worldRelative(name string) string {
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+
+	return name
+}
@@ -0,0 +1,254 @@
+package restore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"world-backup/server/fs"
+	"world-backup/server/region"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+type fakeArchive struct {
+	files map[string][]byte
+}
+
+func (a *fakeArchive) Entries() []fs.ArchiveEntry {
+	var entries []fs.ArchiveEntry
+	for name, b := range a.files {
+		entries = append(entries, fs.ArchiveEntry{Name: name, Size: int64(len(b))})
+	}
+	return entries
+}
+
+func (a *fakeArchive) ReadFile(name string) ([]byte, error) {
+	b, ok := a.files[name]
+	if !ok {
+		return nil, errors.New("missing")
+	}
+	return b, nil
+}
+
+func (a *fakeArchive) Walk(fn func(e fs.ArchiveEntry, r io.Reader) error) error {
+	for _, e := range a.Entries() {
+		if err := fn(e, bytes.NewReader(a.files[e.Name])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *fakeArchive) Close() error { return nil }
+
+// fakeFs keeps the live world in memory next to a single backup
+type fakeFs struct {
+	*fs.FileSystem
+	backup *fakeArchive
+}
+
+func (f *fakeFs) OpenArchive(file fs.ArchiveFile) (fs.ArchiveReader, error) {
+	if file.Path != "/backups/b.zip" {
+		return nil, errors.New("no such archive")
+	}
+	return f.backup, nil
+}
+
+// buildRegion lays out the chunks one sector each after the two header sectors
+func buildRegion(chunks map[int]byte) []byte {
+	b := make([]byte, 8192)
+	sector := 2
+
+	for i := 0; i < 1024; i++ {
+		c, ok := chunks[i]
+		if !ok {
+			continue
+		}
+
+		binary.BigEndian.PutUint32(b[i*4:], uint32(sector<<8|1))
+		binary.BigEndian.PutUint32(b[4096+i*4:], 10)
+
+		s := make([]byte, 4096)
+		binary.BigEndian.PutUint32(s, 2)
+		s[4] = 2
+		s[5] = c
+		b = append(b, s...)
+		sector++
+	}
+
+	return b
+}
+
+func chunkValue(r *region.Region, x, z int) byte {
+	c, _ := r.Chunk(region.Index(x, z))
+	if c == nil {
+		return 0
+	}
+	return c.Payload[1]
+}
+
+func TestArea(t *testing.T) {
+	Convey("Given the corners of a block bounding box", t, func() {
+		a := BlockArea("minecraft:overworld", 40, -1, -17, 15)
+
+		Convey("It should cover every chunk the box touches", func() {
+			So(a, ShouldResemble, Area{Dimension: "minecraft:overworld", MinX: -2, MinZ: -1, MaxX: 2, MaxZ: 0})
+		})
+	})
+}
+
+func TestChunks(t *testing.T) {
+	Convey("Given a live world and a backup of it", t, func() {
+		f := &fakeFs{
+			FileSystem: fs.NewFs(afero.NewMemMapFs()),
+			backup: &fakeArchive{files: map[string][]byte{
+				"World/level.dat":        []byte("level"),
+				"World/region/r.0.0.mca": buildRegion(map[int]byte{region.Index(0, 0): 1, region.Index(1, 0): 1, region.Index(5, 5): 1}),
+			}},
+		}
+
+		f.WriteFile("/saves/World/region/r.0.0.mca", buildRegion(map[int]byte{
+			region.Index(0, 0): 2,
+			region.Index(1, 0): 2,
+			region.Index(2, 0): 2,
+			region.Index(5, 5): 2,
+		}), 0644)
+		f.WriteFile("/saves/World/region/r.-1.0.mca", buildRegion(map[int]byte{region.Index(-1, 0): 2}), 0644)
+
+		Convey("When restoring an area", func() {
+			result, err := Chunks(f, fs.ArchiveFile{Path: "/backups/b.zip"}, "/saves/World", ChunkArea("overworld", -1, 0, 2, 0))
+			So(err, ShouldBeNil)
+
+			live, _ := f.ReadFile("/saves/World/region/r.0.0.mca")
+			r, err := region.Parse(live)
+			So(err, ShouldBeNil)
+
+			Convey("It should put back the chunks from the backup", func() {
+				So(chunkValue(r, 0, 0), ShouldEqual, 1)
+				So(chunkValue(r, 1, 0), ShouldEqual, 1)
+			})
+
+			Convey("It should remove chunks the backup did not have", func() {
+				So(r.HasChunk(region.Index(2, 0)), ShouldBeFalse)
+
+				other, _ := f.ReadFile("/saves/World/region/r.-1.0.mca")
+				o, _ := region.Parse(other)
+				So(o.HasChunk(region.Index(-1, 0)), ShouldBeFalse)
+			})
+
+			Convey("It should leave chunks outside of the area alone", func() {
+				So(chunkValue(r, 5, 5), ShouldEqual, 2)
+			})
+
+			Convey("It should count what changed", func() {
+				So(result, ShouldResemble, &Result{Regions: 2, Restored: 2, Removed: 2})
+			})
+		})
+
+		Convey("When the live world is missing the region", func() {
+			f.Remove("/saves/World/region/r.0.0.mca")
+
+			_, err := Chunks(f, fs.ArchiveFile{Path: "/backups/b.zip"}, "/saves/World", ChunkArea("minecraft:overworld", 0, 0, 0, 0))
+			So(err, ShouldBeNil)
+
+			Convey("It should create it", func() {
+				live, _ := f.ReadFile("/saves/World/region/r.0.0.mca")
+				r, _ := region.Parse(live)
+				So(chunkValue(r, 0, 0), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the area is in another dimension", func() {
+			result, err := Chunks(f, fs.ArchiveFile{Path: "/backups/b.zip"}, "/saves/World", ChunkArea("minecraft:the_nether", 0, 0, 0, 0))
+
+			Convey("It should not touch the overworld", func() {
+				So(err, ShouldBeNil)
+				So(result.Regions, ShouldEqual, 0)
+
+				exists, _ := f.Exists("/saves/World/DIM-1/region/r.0.0.mca")
+				So(exists, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the backup has entities and points of interest", func() {
+			f.backup.files["World/entities/r.0.0.mca"] = buildRegion(map[int]byte{region.Index(0, 0): 1})
+			f.backup.files["World/poi/r.0.0.mca"] = buildRegion(map[int]byte{region.Index(0, 0): 1})
+			f.WriteFile("/saves/World/entities/r.0.0.mca", buildRegion(map[int]byte{region.Index(0, 0): 2, region.Index(1, 0): 2}), 0644)
+
+			result, err := Chunks(f, fs.ArchiveFile{Path: "/backups/b.zip"}, "/saves/World", ChunkArea("overworld", 0, 0, 1, 0))
+			So(err, ShouldBeNil)
+
+			Convey("It should restore them along with the terrain", func() {
+				live, _ := f.ReadFile("/saves/World/entities/r.0.0.mca")
+				entities, _ := region.Parse(live)
+				So(chunkValue(entities, 0, 0), ShouldEqual, 1)
+				So(entities.HasChunk(region.Index(1, 0)), ShouldBeFalse)
+
+				live, _ = f.ReadFile("/saves/World/poi/r.0.0.mca")
+				poi, _ := region.Parse(live)
+				So(chunkValue(poi, 0, 0), ShouldEqual, 1)
+			})
+
+			Convey("It should only count the terrain chunks", func() {
+				So(result, ShouldResemble, &Result{Regions: 3, Restored: 2, Removed: 0})
+			})
+		})
+
+		Convey("When a chunk is kept in its own file", func() {
+			b := buildRegion(map[int]byte{region.Index(0, 0): 1, region.Index(1, 0): 1})
+			// the compression byte of the first chunk, sector 2, flags it external
+			b[2*4096+4] |= 0x80
+			f.backup.files["World/region/r.0.0.mca"] = b
+			f.backup.files["World/region/c.0.0.mcc"] = []byte("big chunk")
+			f.WriteFile("/saves/World/region/c.1.0.mcc", []byte("stale"), 0644)
+
+			_, err := Chunks(f, fs.ArchiveFile{Path: "/backups/b.zip"}, "/saves/World", ChunkArea("overworld", 0, 0, 1, 0))
+			So(err, ShouldBeNil)
+
+			Convey("It should copy its file from the backup", func() {
+				content, _ := f.ReadFile("/saves/World/region/c.0.0.mcc")
+				So(string(content), ShouldEqual, "big chunk")
+			})
+
+			Convey("It should remove the file of a chunk that isn't kept in one any more", func() {
+				exists, _ := f.Exists("/saves/World/region/c.1.0.mcc")
+				So(exists, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the backup is missing the file of a chunk kept in one", func() {
+			b := buildRegion(map[int]byte{region.Index(0, 0): 1})
+			b[2*4096+4] |= 0x80
+			f.backup.files["World/region/r.0.0.mca"] = b
+
+			_, err := Chunks(f, fs.ArchiveFile{Path: "/backups/b.zip"}, "/saves/World", ChunkArea("overworld", 0, 0, 0, 0))
+			So(err, ShouldBeNil)
+
+			Convey("It should leave the live chunk alone", func() {
+				live, _ := f.ReadFile("/saves/World/region/r.0.0.mca")
+				r, _ := region.Parse(live)
+				So(chunkValue(r, 0, 0), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the area is too big", func() {
+			_, err := Chunks(f, fs.ArchiveFile{Path: "/backups/b.zip"}, "/saves/World", ChunkArea("overworld", 0, 0, MaxRegions*region.Width, 0))
+
+			Convey("It should refuse it", func() {
+				So(err, ShouldEqual, AreaTooBigError)
+			})
+		})
+
+		Convey("When the backup can not be opened", func() {
+			_, err := Chunks(f, fs.ArchiveFile{Path: "/backups/c.zip"}, "/saves/World", ChunkArea("overworld", 0, 0, 0, 0))
+
+			Convey("It should return the error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,355 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"world-backup/server/data"
+	"world-backup/server/throttle"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// QueueConfig holds the settings for copying backups in the background. A
+// failed copy is tried again after RetryDelay, doubling each time up to
+// MaxRetryDelay, until MaxAttempts have failed.
+type QueueConfig struct {
+	MaxAttempts   int    `json:"maxAttempts"`
+	RetryDelay    string `json:"retryDelay"`
+	MaxRetryDelay string `json:"maxRetryDelay"`
+}
+
+const (
+	defaultMaxAttempts   = 10
+	defaultRetryDelay    = time.Minute
+	defaultMaxRetryDelay = 6 * time.Hour
+)
+
+// idleWait is how long the queue sleeps when nothing is waiting to be retried
+const idleWait = time.Hour
+
+type IQueueDb interface {
+	Lock()
+	Unlock()
+	Save() error
+	Replications() []*data.Replication
+	QueueReplication(backupId, destination string, at time.Time) *data.Replication
+	GetReplication(backupId, destination string) *data.Replication
+	GetReplications(backupId string) []*data.Replication
+	RemoveReplications(backupId string)
+	FindBackup(id string) *data.Backup
+}
+
+// Queue copies backups to the destinations one at a time in the background.
+// What is queued is kept in the db, so copying carries on after a restart.
+type Queue struct {
+	log       *logrus.Entry
+	fs        IStorageFs
+	db        IQueueDb
+	dests     Set
+	backupDir string
+	limiter   *throttle.Limiter
+
+	maxAttempts   int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+
+	// mu guards dests, it is taken holding the catalog and never the other
+	// way around
+	mu      sync.Mutex
+	wake    chan bool
+	stop    chan bool
+	stopped chan bool
+}
+
+// NewQueue creates a queue copying backups from backupDir to the
+// destinations, uploading no faster than limiter allows
+func NewQueue(log *logrus.Entry, c QueueConfig, f IStorageFs, db IQueueDb, dests Set, backupDir string, limiter *throttle.Limiter) (*Queue, error) {
+	q := Queue{
+		log:           log.WithField("component", "replication"),
+		fs:            f,
+		db:            db,
+		dests:         dests,
+		backupDir:     backupDir,
+		limiter:       limiter,
+		maxAttempts:   c.MaxAttempts,
+		retryDelay:    defaultRetryDelay,
+		maxRetryDelay: defaultMaxRetryDelay,
+		wake:          make(chan bool, 1),
+		stop:          make(chan bool),
+		stopped:       make(chan bool),
+	}
+
+	if q.maxAttempts <= 0 {
+		q.maxAttempts = defaultMaxAttempts
+	}
+
+	var err error
+	if c.RetryDelay != "" {
+		if q.retryDelay, err = time.ParseDuration(c.RetryDelay); err != nil || q.retryDelay <= 0 {
+			return nil, fmt.Errorf("Invalid replication retry delay [%s]", c.RetryDelay)
+		}
+	}
+	if c.MaxRetryDelay != "" {
+		if q.maxRetryDelay, err = time.ParseDuration(c.MaxRetryDelay); err != nil || q.maxRetryDelay < q.retryDelay {
+			return nil, fmt.Errorf("Invalid replication max retry delay [%s]", c.MaxRetryDelay)
+		}
+	}
+
+	return &q, nil
+}
+
+// Enqueue queues copying the backup to every destination that has no copy
+// of it and isn't already copying it, a failed copy is tried again. The
+// caller holds the catalog and saves it.
+func (q *Queue) Enqueue(backup *data.Backup) {
+	q.mu.Lock()
+	queued := false
+	for _, d := range q.dests {
+		if backup.GetCopy(d.Name()) != nil {
+			continue
+		}
+
+		r := q.db.GetReplication(backup.Id, d.Name())
+		if r != nil && (r.State == data.ReplicationPending || r.State == data.ReplicationInProgress) {
+			continue
+		}
+
+		q.db.QueueReplication(backup.Id, d.Name(), getNow())
+		queued = true
+	}
+	q.mu.Unlock()
+
+	if queued {
+		select {
+		case q.wake <- true:
+		default:
+		}
+	}
+}
+
+// SetDestinations changes where backups are copied to, copies queued for
+// a destination that was removed fail
+func (q *Queue) SetDestinations(dests Set) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.dests = dests
+}
+
+// Forget drops what is queued for a backup that was removed, the caller
+// holds the catalog
+func (q *Queue) Forget(backupId string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.db.RemoveReplications(backupId)
+}
+
+// Status is the copying of the backup to each destination. Copies made
+// before the queue knew about them, or found at the destination, are done.
+// The caller holds the catalog.
+func (q *Queue) Status(backup *data.Backup) []data.Replication {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := []data.Replication{}
+	for _, r := range q.db.GetReplications(backup.Id) {
+		status = append(status, *r)
+	}
+
+	for _, c := range backup.Copies {
+		if q.db.GetReplication(backup.Id, c.Destination) == nil {
+			status = append(status, data.Replication{
+				BackupId:    backup.Id,
+				Destination: c.Destination,
+				State:       data.ReplicationDone,
+				UpdatedAt:   c.StoredAt,
+			})
+		}
+	}
+
+	return status
+}
+
+// Start copies queued backups in the background until Stop. Copies that
+// were running when the server stopped are started again, destinations
+// that can resume carry on from where they were.
+func (q *Queue) Start() {
+	q.db.Lock()
+	for _, r := range q.db.Replications() {
+		if r.State == data.ReplicationInProgress {
+			r.State = data.ReplicationPending
+		}
+	}
+	q.db.Unlock()
+
+	go q.run()
+}
+
+// Stop waits for the running copy to finish and stops the queue
+func (q *Queue) Stop() {
+	close(q.stop)
+	<-q.stopped
+}
+
+func (q *Queue) run() {
+	defer close(q.stopped)
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		r, wait := q.next()
+		if r != nil {
+			q.replicate(r)
+			continue
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// next marks the copy that is due first as in progress, or returns how
+// long until one is due
+func (q *Queue) next() (*data.Replication, time.Duration) {
+	q.db.Lock()
+	defer q.db.Unlock()
+
+	now := getNow()
+	wait := idleWait
+
+	var due *data.Replication
+	for _, r := range q.db.Replications() {
+		if r.State != data.ReplicationPending {
+			continue
+		}
+
+		if r.NextAttempt.After(now) {
+			if d := r.NextAttempt.Sub(now); d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		if due == nil || r.NextAttempt.Before(due.NextAttempt) {
+			due = r
+		}
+	}
+
+	if due == nil {
+		return nil, wait
+	}
+
+	due.State = data.ReplicationInProgress
+	due.UpdatedAt = now
+	q.db.Save()
+
+	r := *due
+	return &r, 0
+}
+
+// replicate makes the copy and records how it went
+func (q *Queue) replicate(r *data.Replication) {
+	log := q.log.WithField("destination", r.Destination)
+
+	q.db.Lock()
+	backup := q.db.FindBackup(r.BackupId)
+	var key, checksum string
+	if backup != nil {
+		key = backup.Name
+		checksum = backup.Checksum
+	} else {
+		q.Forget(r.BackupId)
+	}
+	q.db.Unlock()
+
+	if backup == nil {
+		return
+	}
+	dest := q.destination(r.Destination)
+
+	var c *data.Copy
+	err := fmt.Errorf("Destination [%s] is not configured", r.Destination)
+	if dest != nil {
+		localPath := path.Join(q.backupDir, key)
+
+		// the checksum is taken with the first copy, copies fetched back
+		// are checked against it
+		err = nil
+		if checksum == "" {
+			checksum, err = fileChecksum(q.fs, localPath, q.limiter)
+		}
+		if err == nil {
+			c, err = Replicate(q.fs, log, dest, localPath, key, q.limiter)
+		}
+	}
+
+	q.db.Lock()
+	defer q.db.Unlock()
+
+	s := q.db.GetReplication(r.BackupId, r.Destination)
+	if s == nil {
+		// forgotten while it was copied
+		return
+	}
+
+	s.Attempts++
+	s.UpdatedAt = getNow()
+
+	if err == nil {
+		if backup := q.db.FindBackup(r.BackupId); backup != nil {
+			backup.AddCopy(*c)
+			if backup.Checksum == "" {
+				backup.Checksum = checksum
+			}
+		}
+		s.State = data.ReplicationDone
+		s.LastError = ""
+		q.db.Save()
+		return
+	}
+
+	s.LastError = err.Error()
+	if s.Attempts >= q.maxAttempts || os.IsNotExist(err) || q.destination(r.Destination) == nil {
+		log.Errorf("Giving up copying backup %s after %d attempts: %v", key, s.Attempts, err)
+		s.State = data.ReplicationFailed
+	} else {
+		s.State = data.ReplicationPending
+		s.NextAttempt = s.UpdatedAt.Add(q.backoff(s.Attempts))
+		log.Warnf("Failed to copy backup %s, trying again at %s: %v", key, s.NextAttempt.Format(time.RFC3339), err)
+	}
+	q.db.Save()
+}
+
+func (q *Queue) destination(name string) Destination {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.dests.Get(name)
+}
+
+// backoff is how long to wait after the given number of failed attempts
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := q.retryDelay
+	for i := 1; i < attempts && d < q.maxRetryDelay; i++ {
+		d *= 2
+	}
+
+	if d > q.maxRetryDelay {
+		return q.maxRetryDelay
+	}
+
+	return d
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"world-backup/server/data"
+	"world-backup/server/fs"
+	"world-backup/server/throttle"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+func TestNewQueue(t *testing.T) {
+	Convey("Given replication settings", t, func() {
+		log := logrus.WithField("test", "TestNewQueue")
+
+		Convey("When none are given", func() {
+			q, err := NewQueue(log, QueueConfig{}, nil, nil, nil, "/backups", nil)
+
+			Convey("It should use the defaults", func() {
+				So(err, ShouldBeNil)
+				So(q.maxAttempts, ShouldEqual, defaultMaxAttempts)
+				So(q.retryDelay, ShouldEqual, defaultRetryDelay)
+				So(q.maxRetryDelay, ShouldEqual, defaultMaxRetryDelay)
+			})
+		})
+
+		Convey("When they are given", func() {
+			limiter := throttle.NewLimiter(512 << 10)
+			q, err := NewQueue(log, QueueConfig{MaxAttempts: 3, RetryDelay: "10s", MaxRetryDelay: "1m"}, nil, nil, nil, "/backups", limiter)
+
+			Convey("It should use them", func() {
+				So(err, ShouldBeNil)
+				So(q.maxAttempts, ShouldEqual, 3)
+				So(q.retryDelay, ShouldEqual, 10*time.Second)
+				So(q.maxRetryDelay, ShouldEqual, time.Minute)
+				So(q.limiter, ShouldEqual, limiter)
+			})
+		})
+
+		Convey("When a delay is invalid", func() {
+			_, err := NewQueue(log, QueueConfig{RetryDelay: "soon"}, nil, nil, nil, "/backups", nil)
+			_, maxErr := NewQueue(log, QueueConfig{RetryDelay: "1h", MaxRetryDelay: "1m"}, nil, nil, nil, "/backups", nil)
+
+			Convey("It should fail", func() {
+				So(err, ShouldNotBeNil)
+				So(maxErr, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestQueue(t *testing.T) {
+	Convey("Given a queue with two destinations", t, func() {
+		now := time.Unix(1495807405, 0).UTC()
+		oldGetNow := getNow
+		getNow = func() time.Time { return now }
+		defer func() { getNow = oldGetNow }()
+
+		log := logrus.WithField("test", "TestQueue")
+		mem := afero.NewMemMapFs()
+		afero.WriteFile(mem, "/backups/World.zip", []byte("the backup"), 0644)
+
+		db, _ := data.Open("/data.json", afero.Afero{Fs: mem})
+		backup := db.AddFolder("/saves").AddWorld("World").AddBackup("World.zip")
+
+		s3 := newMemDestination("s3")
+		nas := newMemDestination("nas")
+
+		q, _ := NewQueue(log, QueueConfig{MaxAttempts: 3, RetryDelay: "1m", MaxRetryDelay: "90s"}, fs.NewFs(mem), db, Set{s3, nas}, "/backups", nil)
+
+		Convey("When a backup is queued", func() {
+			q.Enqueue(backup)
+
+			Convey("It should be pending for each destination", func() {
+				status := q.Status(backup)
+				So(len(status), ShouldEqual, 2)
+				So(status[0].Destination, ShouldEqual, "s3")
+				So(status[0].State, ShouldEqual, data.ReplicationPending)
+				So(status[1].Destination, ShouldEqual, "nas")
+				So(status[1].State, ShouldEqual, data.ReplicationPending)
+			})
+
+			Convey("It should only be queued once", func() {
+				q.Enqueue(backup)
+				So(len(db.Replications()), ShouldEqual, 2)
+			})
+
+			Convey("It should still be queued after a restart", func() {
+				db.Save()
+				reopened, _ := data.Open("/data.json", afero.Afero{Fs: mem})
+				So(len(reopened.GetReplications(backup.Id)), ShouldEqual, 2)
+			})
+
+			Convey("And the copies are made", func() {
+				for r, _ := q.next(); r != nil; r, _ = q.next() {
+					So(r.State, ShouldEqual, data.ReplicationInProgress)
+					q.replicate(r)
+				}
+
+				Convey("It should record them as done", func() {
+					So(s3.objects["World.zip"], ShouldResemble, []byte("the backup"))
+					So(nas.objects["World.zip"], ShouldResemble, []byte("the backup"))
+					So(backup.GetCopy("s3"), ShouldNotBeNil)
+					So(backup.GetCopy("nas"), ShouldNotBeNil)
+					So(backup.Checksum, ShouldEqual, "sha256:CQ5yiZS/k2HQojNT5KDaiCCNygBGQWZIC1lgGOarrdE=")
+
+					for _, s := range q.Status(backup) {
+						So(s.State, ShouldEqual, data.ReplicationDone)
+						So(s.Attempts, ShouldEqual, 1)
+					}
+				})
+			})
+
+			Convey("And a destination keeps failing", func() {
+				nas.putErr = errors.New("Offline")
+
+				r, _ := q.next()
+				q.replicate(r)
+				r, _ = q.next()
+				q.replicate(r)
+
+				s := db.GetReplication(backup.Id, "nas")
+
+				Convey("It should retry it later", func() {
+					So(s.State, ShouldEqual, data.ReplicationPending)
+					So(s.Attempts, ShouldEqual, 1)
+					So(s.LastError, ShouldEqual, "Offline")
+					So(s.NextAttempt, ShouldEqual, now.Add(time.Minute))
+
+					next, wait := q.next()
+					So(next, ShouldBeNil)
+					So(wait, ShouldEqual, time.Minute)
+				})
+
+				Convey("It should back off up to the max delay", func() {
+					now = now.Add(time.Minute)
+					r, _ := q.next()
+					q.replicate(r)
+					So(s.Attempts, ShouldEqual, 2)
+					So(s.NextAttempt, ShouldEqual, now.Add(90*time.Second))
+
+					Convey("And give up after the max attempts", func() {
+						now = now.Add(90 * time.Second)
+						r, _ := q.next()
+						q.replicate(r)
+
+						So(s.Attempts, ShouldEqual, 3)
+						So(s.State, ShouldEqual, data.ReplicationFailed)
+
+						next, _ := q.next()
+						So(next, ShouldBeNil)
+
+						Convey("Until it is queued again", func() {
+							q.Enqueue(backup)
+							So(s.State, ShouldEqual, data.ReplicationPending)
+							So(s.Attempts, ShouldEqual, 0)
+						})
+					})
+				})
+			})
+
+			Convey("And the backup file is gone", func() {
+				mem.Remove("/backups/World.zip")
+				r, _ := q.next()
+				q.replicate(r)
+
+				Convey("It should give up right away", func() {
+					So(db.GetReplication(backup.Id, "s3").State, ShouldEqual, data.ReplicationFailed)
+				})
+			})
+
+			Convey("And the backup is removed", func() {
+				q.Forget(backup.Id)
+
+				Convey("It should drop it from the queue", func() {
+					So(db.Replications(), ShouldBeEmpty)
+					next, _ := q.next()
+					So(next, ShouldBeNil)
+				})
+			})
+
+			Convey("And the server stopped while copying", func() {
+				q.next()
+				So(db.GetReplication(backup.Id, "s3").State, ShouldEqual, data.ReplicationInProgress)
+
+				q.Start()
+				done := func() bool {
+					db.Lock()
+					defer db.Unlock()
+
+					for _, s := range q.Status(backup) {
+						if s.State != data.ReplicationDone {
+							return false
+						}
+					}
+					return true
+				}
+
+				deadline := time.After(5 * time.Second)
+				for !done() {
+					select {
+					case <-deadline:
+						t.Fatal("the queue did not copy the backup")
+					case <-time.After(10 * time.Millisecond):
+					}
+				}
+				q.Stop()
+
+				Convey("It should copy it again on start", func() {
+					So(db.GetReplication(backup.Id, "s3").State, ShouldEqual, data.ReplicationDone)
+					So(s3.objects["World.zip"], ShouldResemble, []byte("the backup"))
+				})
+			})
+		})
+
+		Convey("When a backup already has a copy", func() {
+			backup.AddCopy(data.Copy{Destination: "s3", Key: "World.zip", Size: 10, StoredAt: now})
+			q.Enqueue(backup)
+
+			Convey("It should only queue the other destination", func() {
+				So(len(db.Replications()), ShouldEqual, 1)
+				So(db.Replications()[0].Destination, ShouldEqual, "nas")
+			})
+
+			Convey("It should show the copy as done", func() {
+				status := q.Status(backup)
+				So(len(status), ShouldEqual, 2)
+				So(status[1], ShouldResemble, data.Replication{BackupId: backup.Id, Destination: "s3", State: data.ReplicationDone, UpdatedAt: now})
+			})
+		})
+	})
+}
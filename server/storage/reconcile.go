@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"world-backup/server/data"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Report is what comparing a destination with the backups we know about found
+type Report struct {
+	Destination string `json:"destination"`
+	// Missing backups were recorded at the destination but are gone from it
+	Missing []string `json:"missing"`
+	// Found backups are at the destination but were not recorded
+	Found []string `json:"found"`
+	// Unknown files are at the destination but are no backup we know about
+	Unknown []string `json:"unknown"`
+}
+
+// Reconcile lists the destination and corrects the copies recorded on the
+// backups to match. Copies that are gone are forgotten so they are uploaded
+// again, and complete copies nobody recorded, say because the server
+// stopped before saving, are recorded. Unknown files are only reported.
+var Reconcile = func(log *logrus.Entry, d Destination, backups []*data.Backup) (*Report, error) {
+	objects, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+
+	stored := map[string]Object{}
+	for _, o := range objects {
+		stored[o.Key] = o
+	}
+
+	report := Report{Destination: d.Name()}
+	known := map[string]bool{}
+
+	for _, b := range backups {
+		c := b.GetCopy(d.Name())
+		key := b.Name
+		if c != nil {
+			key = c.Key
+		}
+		known[key] = true
+
+		o, ok := stored[key]
+		switch {
+		case c != nil && (!ok || o.Size != c.Size):
+			log.Warnf("Backup %s is missing from %s", b.Name, d.Name())
+			b.RemoveCopy(d.Name())
+			report.Missing = append(report.Missing, b.Name)
+		case c == nil && ok:
+			log.Infof("Backup %s was found at %s", b.Name, d.Name())
+			b.AddCopy(data.Copy{Destination: d.Name(), Key: key, Size: o.Size, StoredAt: o.ModifiedAt})
+			report.Found = append(report.Found, b.Name)
+		}
+	}
+
+	for _, o := range objects {
+		if !known[o.Key] {
+			report.Unknown = append(report.Unknown, o.Key)
+		}
+	}
+
+	return &report, nil
+}
+
+// Remove deletes the copies of a backup from the destinations, for when the
+// backup itself is removed. Copies that can't be deleted stay recorded on
+// the backup and the last error is returned.
+var Remove = func(log *logrus.Entry, dests Set, backup *data.Backup) error {
+	var lastErr error
+
+	for _, c := range append([]data.Copy{}, backup.Copies...) {
+		d := dests.Get(c.Destination)
+		if d == nil {
+			log.Warnf("Backup %s has a copy at %s which is not configured", backup.Name, c.Destination)
+			continue
+		}
+
+		if err := d.Delete(c.Key); err != nil {
+			log.Errorf("Failed to delete backup %s from %s: %v", backup.Name, c.Destination, err)
+			lastErr = err
+			continue
+		}
+
+		backup.RemoveCopy(c.Destination)
+	}
+
+	return lastErr
+}
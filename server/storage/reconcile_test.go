@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"world-backup/server/data"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReconcile(t *testing.T) {
+	Convey("Given a destination and the backups we know about", t, func() {
+		log := logrus.WithField("test", "TestReconcile")
+		nas := newMemDestination("nas")
+
+		stored := &data.Backup{Id: "b1", Name: "Stored.zip"}
+		stored.AddCopy(data.Copy{Destination: "nas", Key: "Stored.zip", Size: 6})
+		nas.objects["Stored.zip"] = []byte("stored")
+
+		gone := &data.Backup{Id: "b2", Name: "Gone.zip"}
+		gone.AddCopy(data.Copy{Destination: "nas", Key: "Gone.zip", Size: 4})
+
+		truncated := &data.Backup{Id: "b3", Name: "Truncated.zip"}
+		truncated.AddCopy(data.Copy{Destination: "nas", Key: "Truncated.zip", Size: 100})
+		nas.objects["Truncated.zip"] = []byte("short")
+
+		unrecorded := &data.Backup{Id: "b4", Name: "Unrecorded.zip"}
+		nas.objects["Unrecorded.zip"] = []byte("unrecorded")
+
+		nas.objects["Stranger.zip"] = []byte("?")
+
+		Convey("When they are reconciled", func() {
+			report, err := Reconcile(log, nas, []*data.Backup{stored, gone, truncated, unrecorded})
+
+			Convey("It should forget copies that are gone or incomplete", func() {
+				So(err, ShouldBeNil)
+				So(report.Destination, ShouldEqual, "nas")
+
+				sort.Strings(report.Missing)
+				So(report.Missing, ShouldResemble, []string{"Gone.zip", "Truncated.zip"})
+				So(gone.Copies, ShouldBeEmpty)
+				So(truncated.Copies, ShouldBeEmpty)
+				So(stored.GetCopy("nas"), ShouldNotBeNil)
+			})
+
+			Convey("It should record copies it finds", func() {
+				So(report.Found, ShouldResemble, []string{"Unrecorded.zip"})
+				So(unrecorded.GetCopy("nas"), ShouldResemble, &data.Copy{Destination: "nas", Key: "Unrecorded.zip", Size: 10})
+			})
+
+			Convey("It should only report files it doesn't know", func() {
+				So(report.Unknown, ShouldResemble, []string{"Stranger.zip"})
+				So(nas.objects["Stranger.zip"], ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRemove(t *testing.T) {
+	Convey("Given a backup with copies at two destinations", t, func() {
+		log := logrus.WithField("test", "TestRemove")
+		s3 := newMemDestination("s3")
+		nas := newMemDestination("nas")
+		s3.objects["World.zip"] = []byte("the backup")
+		nas.objects["World.zip"] = []byte("the backup")
+
+		backup := &data.Backup{Id: "b1", Name: "World.zip"}
+		backup.AddCopy(data.Copy{Destination: "s3", Key: "World.zip", Size: 10})
+		backup.AddCopy(data.Copy{Destination: "nas", Key: "World.zip", Size: 10})
+
+		Convey("When it is removed", func() {
+			err := Remove(log, Set{s3, nas}, backup)
+
+			Convey("It should delete and forget both copies", func() {
+				So(err, ShouldBeNil)
+				So(s3.objects, ShouldBeEmpty)
+				So(nas.objects, ShouldBeEmpty)
+				So(backup.Copies, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When one destination fails to delete", func() {
+			s3.deleteErr = errors.New("Offline")
+			err := Remove(log, Set{s3, nas}, backup)
+
+			Convey("It should keep that copy recorded and return the error", func() {
+				So(err, ShouldEqual, s3.deleteErr)
+				So(nas.objects, ShouldBeEmpty)
+				So(len(backup.Copies), ShouldEqual, 1)
+				So(backup.GetCopy("s3"), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When a copy is at a destination that is no longer configured", func() {
+			err := Remove(log, Set{nas}, backup)
+
+			Convey("It should leave it recorded", func() {
+				So(err, ShouldBeNil)
+				So(len(backup.Copies), ShouldEqual, 1)
+				So(backup.GetCopy("s3"), ShouldNotBeNil)
+			})
+		})
+	})
+}
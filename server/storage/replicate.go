@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"time"
+
+	"world-backup/server/data"
+	"world-backup/server/throttle"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/afero"
+)
+
+var getNow = time.Now
+
+type IStorageFs interface {
+	Open(name string) (afero.File, error)
+	Create(name string) (afero.File, error)
+	Rename(oldname, newname string) error
+	Remove(name string) error
+}
+
+// Replicate uploads the backup file at localPath to the destination and
+// returns the copy it made, reading the file no faster than limiter allows
+var Replicate = func(f IStorageFs, log *logrus.Entry, d Destination, localPath, key string, limiter *throttle.Limiter) (*data.Copy, error) {
+	log.Infof("Copying backup %s to %s", key, d.Name())
+
+	file, err := f.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := d.Put(key, throttle.NewReadSeeker(file, limiter), info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Copy{
+		Destination: d.Name(),
+		Key:         obj.Key,
+		Size:        obj.Size,
+		Checksum:    obj.Checksum,
+		StoredAt:    getNow(),
+	}, nil
+}
+
+// Fetch downloads the backup to localPath from the first destination that
+// holds a copy, used when the local file is gone. The download is written
+// next to localPath and only renamed into place once it is complete and
+// matches the checksum of the backup.
+var Fetch = func(f IStorageFs, log *logrus.Entry, dests Set, backup *data.Backup, localPath string) error {
+	err := NotFoundError
+
+	for _, c := range backup.Copies {
+		d := dests.Get(c.Destination)
+		if d == nil {
+			log.Warnf("Backup %s has a copy at %s which is not configured", backup.Name, c.Destination)
+			continue
+		}
+
+		log.Infof("Fetching backup %s from %s", backup.Name, c.Destination)
+
+		if err = download(f, d, c, backup.Checksum, localPath); err == nil {
+			return nil
+		}
+
+		log.Errorf("Failed to fetch backup %s from %s: %v", backup.Name, c.Destination, err)
+	}
+
+	return err
+}
+
+// download fetches the copy to localPath. Backups copied before checksums
+// were taken have none, only their size is checked.
+func download(f IStorageFs, d Destination, c data.Copy, checksum, localPath string) error {
+	tmp := localPath + ".download"
+
+	file, err := f.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := &countingWriter{w: file}
+	h := sha256.New()
+	err = d.Get(c.Key, io.MultiWriter(w, h))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && w.n != c.Size {
+		err = fmt.Errorf("Fetched %d bytes but the copy at %s has %d", w.n, c.Destination, c.Size)
+	}
+	if err == nil && checksum != "" && sha256Checksum(h) != checksum {
+		err = fmt.Errorf("The copy at %s does not match the checksum of the backup", c.Destination)
+	}
+
+	if err != nil {
+		f.Remove(tmp)
+		return err
+	}
+
+	return f.Rename(tmp, localPath)
+}
+
+type countingWriter struct {
+	w afero.File
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"world-backup/server/data"
+	"world-backup/server/fs"
+	"world-backup/server/throttle"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/afero"
+)
+
+type memDestination struct {
+	name      string
+	objects   map[string][]byte
+	putErr    error
+	deleteErr error
+}
+
+func newMemDestination(name string) *memDestination {
+	return &memDestination{name: name, objects: map[string][]byte{}}
+}
+
+func (d *memDestination) Name() string { return d.name }
+
+func (d *memDestination) Put(key string, r io.ReadSeeker, size int64) (*Object, error) {
+	if d.putErr != nil {
+		return nil, d.putErr
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	d.objects[key] = b
+
+	return &Object{Key: key, Size: int64(len(b)), Checksum: "crc32c:test"}, nil
+}
+
+func (d *memDestination) Get(key string, w io.Writer) error {
+	b, ok := d.objects[key]
+	if !ok {
+		return NotFoundError
+	}
+
+	_, err := w.Write(b)
+	return err
+}
+
+func (d *memDestination) Stat(key string) (*Object, error) {
+	b, ok := d.objects[key]
+	if !ok {
+		return nil, NotFoundError
+	}
+
+	return &Object{Key: key, Size: int64(len(b))}, nil
+}
+
+func (d *memDestination) List() ([]Object, error) {
+	var objects []Object
+	for k, b := range d.objects {
+		objects = append(objects, Object{Key: k, Size: int64(len(b))})
+	}
+	return objects, nil
+}
+
+func (d *memDestination) Delete(key string) error {
+	if d.deleteErr != nil {
+		return d.deleteErr
+	}
+
+	delete(d.objects, key)
+	return nil
+}
+
+func TestReplicate(t *testing.T) {
+	Convey("Given a backup and a destination", t, func() {
+		now := time.Unix(1495807405, 0)
+		oldGetNow := getNow
+		getNow = func() time.Time { return now }
+		defer func() { getNow = oldGetNow }()
+
+		log := logrus.WithField("test", "TestReplicate")
+		mem := afero.NewMemMapFs()
+		f := fs.NewFs(mem)
+		afero.WriteFile(mem, "/backups/World.zip", []byte("the backup"), 0644)
+
+		nas := newMemDestination("nas")
+
+		Convey("When the upload succeeds", func() {
+			c, err := Replicate(f, log, nas, "/backups/World.zip", "World.zip", nil)
+
+			Convey("It should store the backup and return the copy", func() {
+				So(err, ShouldBeNil)
+				So(nas.objects["World.zip"], ShouldResemble, []byte("the backup"))
+				So(c, ShouldResemble, &data.Copy{Destination: "nas", Key: "World.zip", Size: 10, Checksum: "crc32c:test", StoredAt: now})
+			})
+		})
+
+		Convey("When the upload is throttled", func() {
+			c, err := Replicate(f, log, nas, "/backups/World.zip", "World.zip", throttle.NewLimiter(1<<20))
+
+			Convey("It should still store all of it", func() {
+				So(err, ShouldBeNil)
+				So(c.Size, ShouldEqual, 10)
+				So(nas.objects["World.zip"], ShouldResemble, []byte("the backup"))
+			})
+		})
+
+		Convey("When the destination fails", func() {
+			nas.putErr = errors.New("Offline")
+			c, err := Replicate(f, log, nas, "/backups/World.zip", "World.zip", nil)
+
+			Convey("It should return the error", func() {
+				So(err, ShouldEqual, nas.putErr)
+				So(c, ShouldBeNil)
+			})
+		})
+
+		Convey("When the backup file is gone", func() {
+			_, err := Replicate(f, log, nas, "/backups/Gone.zip", "Gone.zip", nil)
+
+			Convey("It should say so", func() {
+				So(os.IsNotExist(err), ShouldBeTrue)
+				So(nas.objects, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestFetch(t *testing.T) {
+	Convey("Given a backup that is gone locally", t, func() {
+		log := logrus.WithField("test", "TestFetch")
+		mem := afero.NewMemMapFs()
+		f := fs.NewFs(mem)
+
+		s3 := newMemDestination("s3")
+		nas := newMemDestination("nas")
+		nas.objects["World.zip"] = []byte("the backup")
+
+		backup := &data.Backup{Id: "b1", Name: "World.zip"}
+
+		Convey("When the first copy is missing and the second one is there", func() {
+			backup.Checksum = "sha256:CQ5yiZS/k2HQojNT5KDaiCCNygBGQWZIC1lgGOarrdE="
+			backup.Copies = []data.Copy{
+				{Destination: "s3", Key: "World.zip", Size: 10},
+				{Destination: "nas", Key: "World.zip", Size: 10},
+			}
+			err := Fetch(f, log, Set{s3, nas}, backup, "/backups/World.zip")
+
+			Convey("It should fetch it from the second", func() {
+				So(err, ShouldBeNil)
+				b, _ := afero.ReadFile(mem, "/backups/World.zip")
+				So(b, ShouldResemble, []byte("the backup"))
+			})
+		})
+
+		Convey("When the copy is not the size that was stored", func() {
+			backup.Copies = []data.Copy{{Destination: "nas", Key: "World.zip", Size: 20}}
+			err := Fetch(f, log, Set{s3, nas}, backup, "/backups/World.zip")
+
+			Convey("It should fail without leaving a file behind", func() {
+				So(err, ShouldNotBeNil)
+				exists, _ := afero.Exists(mem, "/backups/World.zip")
+				So(exists, ShouldBeFalse)
+				exists, _ = afero.Exists(mem, "/backups/World.zip.download")
+				So(exists, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the copy is not what was backed up", func() {
+			nas.objects["World.zip"] = []byte("the bakcup")
+			backup.Checksum = "sha256:CQ5yiZS/k2HQojNT5KDaiCCNygBGQWZIC1lgGOarrdE="
+			backup.Copies = []data.Copy{{Destination: "nas", Key: "World.zip", Size: 10}}
+			err := Fetch(f, log, Set{s3, nas}, backup, "/backups/World.zip")
+
+			Convey("It should fail without leaving a file behind", func() {
+				So(err.Error(), ShouldContainSubstring, "checksum")
+				exists, _ := afero.Exists(mem, "/backups/World.zip")
+				So(exists, ShouldBeFalse)
+				exists, _ = afero.Exists(mem, "/backups/World.zip.download")
+				So(exists, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the copy is at a destination that is not configured", func() {
+			backup.Copies = []data.Copy{{Destination: "usb", Key: "World.zip", Size: 10}}
+			err := Fetch(f, log, Set{s3, nas}, backup, "/backups/World.zip")
+
+			Convey("It should return NotFoundError", func() {
+				So(err, ShouldEqual, NotFoundError)
+			})
+		})
+	})
+}
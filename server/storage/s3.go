@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// minPartSize is the smallest part S3 accepts in a multipart upload, in MiB
+const minPartSize = 5
+
+// S3Config holds the settings for an S3 compatible destination such as AWS,
+// MinIO or Backblaze B2. Archives bigger than PartSize MiB are uploaded in
+// parts. Checksum is the algorithm the server verifies each upload with,
+// one of crc32c (the default), crc32, sha1, sha256, crc64nvme or none.
+type S3Config struct {
+	Endpoint     string `json:"endpoint"`
+	Region       string `json:"region"`
+	Bucket       string `json:"bucket"`
+	Prefix       string `json:"prefix"`
+	AccessKey    string `json:"accessKey"`
+	SecretKey    string `json:"secretKey"`
+	Insecure     bool   `json:"insecure"`
+	StorageClass string `json:"storageClass"`
+	PartSize     int64  `json:"partSize"`
+	Checksum     string `json:"checksum"`
+}
+
+var checksumTypes = map[string]minio.ChecksumType{
+	"":          minio.ChecksumCRC32C,
+	"crc32c":    minio.ChecksumCRC32C,
+	"crc32":     minio.ChecksumCRC32,
+	"sha1":      minio.ChecksumSHA1,
+	"sha256":    minio.ChecksumSHA256,
+	"crc64nvme": minio.ChecksumCRC64NVME,
+	"none":      minio.ChecksumNone,
+}
+
+type s3Destination struct {
+	name     string
+	config   S3Config
+	checksum minio.ChecksumType
+	client   *minio.Client
+}
+
+// NewS3 creates a destination storing backups in an S3 bucket
+func NewS3(name string, c S3Config) (Destination, error) {
+	if c.Endpoint == "" || c.Bucket == "" {
+		return nil, fmt.Errorf("Destination [%s] needs an endpoint and a bucket", name)
+	}
+
+	checksum, ok := checksumTypes[strings.ToLower(c.Checksum)]
+	if !ok {
+		return nil, fmt.Errorf("Destination [%s] has an unknown checksum [%s]", name, c.Checksum)
+	}
+
+	if c.PartSize != 0 && c.PartSize < minPartSize {
+		return nil, fmt.Errorf("Destination [%s] part size must be at least %d MiB", name, minPartSize)
+	}
+
+	client, err := minio.New(c.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(c.AccessKey, c.SecretKey, ""),
+		Secure: !c.Insecure,
+		Region: c.Region,
+		// checksums of single part uploads are sent after the body
+		TrailingHeaders: checksum != minio.ChecksumNone,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Destination{name: name, config: c, checksum: checksum, client: client}, nil
+}
+
+func (d *s3Destination) Name() string {
+	return d.name
+}
+
+func (d *s3Destination) key(key string) string {
+	return path.Join(d.config.Prefix, key)
+}
+
+func (d *s3Destination) Put(key string, r io.ReadSeeker, size int64) (*Object, error) {
+	opts := minio.PutObjectOptions{
+		ContentType:  "application/octet-stream",
+		StorageClass: d.config.StorageClass,
+		PartSize:     uint64(d.config.PartSize) << 20,
+		Checksum:     d.checksum,
+	}
+	if d.checksum == minio.ChecksumNone {
+		opts.SendContentMd5 = true
+	} else {
+		// the checksum protects the upload, signing the body as well would
+		// keep it from being sent over plain http
+		opts.DisableContentSha256 = true
+	}
+
+	info, err := d.client.PutObject(context.Background(), d.config.Bucket, d.key(key), r, size, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size != size {
+		return nil, fmt.Errorf("Uploaded %d of %d bytes of %s", info.Size, size, key)
+	}
+
+	return &Object{
+		Key:        key,
+		Size:       info.Size,
+		Checksum:   checksumOf(info.ChecksumCRC32C, info.ChecksumCRC32, info.ChecksumSHA1, info.ChecksumSHA256, info.ChecksumCRC64NVME),
+		ModifiedAt: info.LastModified,
+	}, nil
+}
+
+func (d *s3Destination) Get(key string, w io.Writer) error {
+	obj, err := d.client.GetObject(context.Background(), d.config.Bucket, d.key(key), minio.GetObjectOptions{})
+	if err != nil {
+		return s3Error(err)
+	}
+	defer obj.Close()
+
+	_, err = io.Copy(w, obj)
+	return s3Error(err)
+}
+
+func (d *s3Destination) Stat(key string) (*Object, error) {
+	info, err := d.client.StatObject(context.Background(), d.config.Bucket, d.key(key), minio.StatObjectOptions{Checksum: true})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	return &Object{
+		Key:        key,
+		Size:       info.Size,
+		Checksum:   checksumOf(info.ChecksumCRC32C, info.ChecksumCRC32, info.ChecksumSHA1, info.ChecksumSHA256, info.ChecksumCRC64NVME),
+		ModifiedAt: info.LastModified,
+	}, nil
+}
+
+func (d *s3Destination) List() ([]Object, error) {
+	prefix := ""
+	if d.config.Prefix != "" {
+		prefix = strings.TrimSuffix(d.config.Prefix, "/") + "/"
+	}
+
+	var objects []Object
+	for info := range d.client.ListObjects(context.Background(), d.config.Bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		if strings.HasSuffix(info.Key, "/") {
+			continue
+		}
+
+		objects = append(objects, Object{
+			Key:        strings.TrimPrefix(info.Key, prefix),
+			Size:       info.Size,
+			ModifiedAt: info.LastModified,
+		})
+	}
+
+	return objects, nil
+}
+
+func (d *s3Destination) Delete(key string) error {
+	return s3Error(d.client.RemoveObject(context.Background(), d.config.Bucket, d.key(key), minio.RemoveObjectOptions{}))
+}
+
+// checksumOf names the checksum the server keeps for an object, in the
+// order the values are given: crc32c, crc32, sha1, sha256, crc64nvme
+func checksumOf(values ...string) string {
+	names := []string{"crc32c", "crc32", "sha1", "sha256", "crc64nvme"}
+	for i, v := range values {
+		if v != "" {
+			return names[i] + ":" + v
+		}
+	}
+
+	return ""
+}
+
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if rsp := minio.ToErrorResponse(err); rsp.Code == "NoSuchKey" {
+		return NotFoundError
+	}
+
+	return err
+}
@@ -0,0 +1,347 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeS3 is just enough of S3 for the destination: single and multipart
+// uploads that are checked against their crc32c like S3 does, reads, stats
+// and deletes
+type fakeS3 struct {
+	sync.Mutex
+	server        *httptest.Server
+	bucket        string
+	objects       map[string][]byte
+	uploads       map[string]map[int][]byte
+	storageClass  []string
+	checksummed   int
+	parts         int
+	nextUploadId  int
+	corruptUpload bool
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	f := fakeS3{bucket: bucket, objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return &f
+}
+
+func (f *fakeS3) config() S3Config {
+	return S3Config{
+		Endpoint:  strings.TrimPrefix(f.server.URL, "http://"),
+		Region:    "us-east-1",
+		Bucket:    f.bucket,
+		AccessKey: "key",
+		SecretKey: "secret",
+		Insecure:  true,
+	}
+}
+
+func (f *fakeS3) serve(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/"+f.bucket+"/")
+	q := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodPost && q.Get("uploads") != "" || r.Method == http.MethodPost && strings.HasSuffix(r.URL.RawQuery, "uploads="):
+		f.storageClass = append(f.storageClass, r.Header.Get("X-Amz-Storage-Class"))
+		f.nextUploadId++
+		id := strconv.Itoa(f.nextUploadId)
+		f.uploads[id] = map[int][]byte{}
+		writeXml(w, http.StatusOK, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: f.bucket, Key: key, UploadId: id})
+
+	case r.Method == http.MethodPost && q.Get("uploadId") != "":
+		parts := f.uploads[q.Get("uploadId")]
+		var numbers []int
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+
+		var body []byte
+		for _, n := range numbers {
+			body = append(body, parts[n]...)
+		}
+		f.objects[key] = body
+		delete(f.uploads, q.Get("uploadId"))
+
+		writeXml(w, http.StatusOK, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: f.bucket, Key: key, ETag: `"etag"`})
+
+	case r.Method == http.MethodPut:
+		body, sum, err := readBody(r)
+		if err != nil {
+			s3ErrorResponse(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		if f.corruptUpload && len(body) > 0 {
+			body[0] ^= 0xff
+		}
+		if sum != "" {
+			if sum != crc32c(body) {
+				s3ErrorResponse(w, http.StatusBadRequest, "BadDigest")
+				return
+			}
+			f.checksummed++
+			w.Header().Set("X-Amz-Checksum-Crc32c", sum)
+		}
+
+		if n := q.Get("partNumber"); n != "" {
+			i, _ := strconv.Atoi(n)
+			f.uploads[q.Get("uploadId")][i] = body
+			f.parts++
+		} else {
+			f.storageClass = append(f.storageClass, r.Header.Get("X-Amz-Storage-Class"))
+			f.objects[key] = body
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		body, ok := f.objects[key]
+		if !ok {
+			s3ErrorResponse(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", "Fri, 26 May 2017 14:03:25 GMT")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("X-Amz-Checksum-Crc32c", crc32c(body))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(body)
+		}
+
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s3ErrorResponse(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// readBody returns the uploaded bytes and the crc32c they were sent with,
+// either as a header or in the trailer of an aws-chunked body
+func readBody(r *http.Request) ([]byte, string, error) {
+	sum := r.Header.Get("X-Amz-Checksum-Crc32c")
+
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body, err := ioutil.ReadAll(r.Body)
+		return body, sum, err
+	}
+
+	br := bufio.NewReader(r.Body)
+	var body []byte
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, "", err
+		}
+		size, err := strconv.ParseInt(strings.SplitN(strings.TrimSpace(line), ";", 2)[0], 16, 64)
+		if err != nil {
+			return nil, "", err
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, "", err
+		}
+		body = append(body, chunk[:size]...)
+	}
+
+	rest, _ := ioutil.ReadAll(br)
+	for _, line := range strings.Split(string(rest), "\n") {
+		if kv := strings.SplitN(strings.TrimSpace(line), ":", 2); len(kv) == 2 && strings.EqualFold(kv[0], "x-amz-checksum-crc32c") {
+			sum = kv[1]
+		}
+	}
+	if v := r.Trailer.Get("X-Amz-Checksum-Crc32c"); v != "" {
+		sum = v
+	}
+
+	return body, sum, nil
+}
+
+func crc32c(b []byte) string {
+	sum := crc32.Checksum(b, crc32.MakeTable(crc32.Castagnoli))
+	return base64.StdEncoding.EncodeToString([]byte{byte(sum >> 24), byte(sum >> 16), byte(sum >> 8), byte(sum)})
+}
+
+func writeXml(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func s3ErrorResponse(w http.ResponseWriter, status int, code string) {
+	writeXml(w, status, struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: fmt.Sprintf("fake s3: %s", code)})
+}
+
+func TestS3Destination(t *testing.T) {
+	Convey("Given an S3 destination", t, func() {
+		fake := newFakeS3("backups")
+		defer fake.server.Close()
+
+		c := fake.config()
+		c.Prefix = "minecraft"
+		c.StorageClass = "STANDARD_IA"
+		c.PartSize = 5
+
+		d, err := NewS3("s3", c)
+		So(err, ShouldBeNil)
+		So(d.Name(), ShouldEqual, "s3")
+
+		Convey("When a small backup is stored", func() {
+			content := []byte("a small backup")
+			obj, err := d.Put("World-20170526T090325.zip", bytes.NewReader(content), int64(len(content)))
+
+			Convey("It should be stored under the prefix in one request", func() {
+				So(err, ShouldBeNil)
+				So(obj.Key, ShouldEqual, "World-20170526T090325.zip")
+				So(obj.Size, ShouldEqual, len(content))
+				So(fake.parts, ShouldEqual, 0)
+				So(fake.objects["minecraft/World-20170526T090325.zip"], ShouldResemble, content)
+			})
+
+			Convey("It should be stored with the storage class", func() {
+				So(fake.storageClass, ShouldResemble, []string{"STANDARD_IA"})
+			})
+
+			Convey("It should be checked by the server against its checksum", func() {
+				So(fake.checksummed, ShouldEqual, 1)
+				So(obj.Checksum, ShouldEqual, "crc32c:"+crc32c(content))
+			})
+
+			Convey("It should be read back", func() {
+				stat, err := d.Stat("World-20170526T090325.zip")
+				So(err, ShouldBeNil)
+				So(stat.Size, ShouldEqual, len(content))
+				So(stat.Checksum, ShouldEqual, "crc32c:"+crc32c(content))
+
+				var b bytes.Buffer
+				So(d.Get("World-20170526T090325.zip", &b), ShouldBeNil)
+				So(b.Bytes(), ShouldResemble, content)
+			})
+
+			Convey("It should be gone once deleted", func() {
+				So(d.Delete("World-20170526T090325.zip"), ShouldBeNil)
+
+				_, err := d.Stat("World-20170526T090325.zip")
+				So(err, ShouldEqual, NotFoundError)
+			})
+		})
+
+		Convey("When a backup is corrupted on the way", func() {
+			fake.corruptUpload = true
+			content := []byte("a small backup")
+			_, err := d.Put("World.zip", bytes.NewReader(content), int64(len(content)))
+
+			Convey("It should fail and not be stored", func() {
+				So(err, ShouldNotBeNil)
+				So(fake.objects, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a backup bigger than the part size is stored", func() {
+			content := bytes.Repeat([]byte("0123456789abcdef"), 11<<16)
+			_, err := d.Put("Big.zip", bytes.NewReader(content), int64(len(content)))
+
+			Convey("It should be uploaded in checksummed parts and read back whole", func() {
+				So(err, ShouldBeNil)
+				So(fake.parts, ShouldEqual, 3)
+				So(fake.checksummed, ShouldEqual, 3)
+				So(fake.storageClass, ShouldResemble, []string{"STANDARD_IA"})
+
+				var b bytes.Buffer
+				So(d.Get("Big.zip", &b), ShouldBeNil)
+				So(bytes.Equal(b.Bytes(), content), ShouldBeTrue)
+			})
+		})
+
+		Convey("When a backup that was never stored is read", func() {
+			_, statErr := d.Stat("Missing.zip")
+			getErr := d.Get("Missing.zip", new(bytes.Buffer))
+
+			Convey("It should return NotFoundError", func() {
+				So(statErr, ShouldEqual, NotFoundError)
+				So(getErr, ShouldEqual, NotFoundError)
+			})
+		})
+	})
+
+	Convey("Given invalid S3 settings", t, func() {
+		Convey("It should refuse a missing bucket", func() {
+			_, err := NewS3("s3", S3Config{Endpoint: "localhost:9000"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should refuse an unknown checksum", func() {
+			_, err := NewS3("s3", S3Config{Endpoint: "localhost:9000", Bucket: "b", Checksum: "md4"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should refuse parts smaller than S3 allows", func() {
+			_, err := NewS3("s3", S3Config{Endpoint: "localhost:9000", Bucket: "b", PartSize: 1})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestOpen(t *testing.T) {
+	Convey("Given destination configs", t, func() {
+		s3 := &S3Config{Endpoint: "localhost:9000", Bucket: "backups"}
+
+		Convey("It should create each destination", func() {
+			s, err := Open([]Config{{Name: "a", Type: S3, S3: s3}, {Name: "b", Type: S3, S3: s3}})
+
+			So(err, ShouldBeNil)
+			So(len(s), ShouldEqual, 2)
+			So(s.Get("b").Name(), ShouldEqual, "b")
+			So(s.Get("c"), ShouldBeNil)
+		})
+
+		Convey("It should refuse two destinations with the same name", func() {
+			_, err := Open([]Config{{Name: "a", Type: S3, S3: s3}, {Name: "a", Type: S3, S3: s3}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should refuse an unknown type", func() {
+			_, err := Open([]Config{{Name: "a", Type: "floppy"}})
+			So(err, ShouldEqual, UnknownTypeError("floppy"))
+		})
+	})
+}
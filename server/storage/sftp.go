@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SftpConfig holds the settings for a destination reached over SFTP. The
+// server is checked against HostKey, given in authorized_keys format, unless
+// InsecureIgnoreHostKey is set. PrivateKey is the path to a key file and
+// can be used along with or instead of Password.
+type SftpConfig struct {
+	Host                  string `json:"host"`
+	User                  string `json:"user"`
+	Password              string `json:"password"`
+	PrivateKey            string `json:"privateKey"`
+	HostKey               string `json:"hostKey"`
+	InsecureIgnoreHostKey bool   `json:"insecureIgnoreHostKey"`
+	Path                  string `json:"path"`
+}
+
+type sftpDestination struct {
+	name   string
+	config SftpConfig
+	ssh    *ssh.ClientConfig
+}
+
+// NewSftp creates a destination storing backups in a folder on an SFTP server
+func NewSftp(name string, c SftpConfig) (Destination, error) {
+	if c.Host == "" || c.User == "" {
+		return nil, fmt.Errorf("Destination [%s] needs a host and a user", name)
+	}
+
+	var auth []ssh.AuthMethod
+	if c.PrivateKey != "" {
+		b, err := ioutil.ReadFile(c.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(b)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if c.Password != "" {
+		auth = append(auth, ssh.Password(c.Password))
+	}
+
+	var hostKey ssh.HostKeyCallback
+	switch {
+	case c.HostKey != "":
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(c.HostKey))
+		if err != nil {
+			return nil, err
+		}
+		hostKey = ssh.FixedHostKey(key)
+	case c.InsecureIgnoreHostKey:
+		hostKey = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("Destination [%s] needs the host key of the server", name)
+	}
+
+	return &sftpDestination{
+		name:   name,
+		config: c,
+		ssh: &ssh.ClientConfig{
+			User:            c.User,
+			Auth:            auth,
+			HostKeyCallback: hostKey,
+			Timeout:         30 * time.Second,
+		},
+	}, nil
+}
+
+func (d *sftpDestination) Name() string {
+	return d.name
+}
+
+// connect opens a session for a single operation, backups are copied rarely
+// enough that keeping a connection open isn't worth it
+func (d *sftpDestination) connect() (*sftp.Client, func(), error) {
+	conn, err := ssh.Dial("tcp", d.config.Host, d.ssh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return client, func() {
+		client.Close()
+		conn.Close()
+	}, nil
+}
+
+func (d *sftpDestination) path(key string) string {
+	return path.Join(d.config.Path, key)
+}
+
+// Put appends to what an earlier attempt left in the .part file, and only
+// renames it to the key once all of it is there
+func (d *sftpDestination) Put(key string, r io.ReadSeeker, size int64) (*Object, error) {
+	client, done, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	if d.config.Path != "" {
+		if err := client.MkdirAll(d.config.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	part := d.path(key) + partSuffix
+
+	var uploaded int64
+	if info, err := client.Stat(part); err == nil && info.Size() <= size {
+		uploaded = info.Size()
+	}
+
+	f, err := client.OpenFile(part, os.O_WRONLY|os.O_CREATE)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	if err := skipUploaded(r, uploaded, h); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if err := f.Truncate(uploaded); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(uploaded, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if _, err := io.Copy(f, io.TeeReader(r, h)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	info, err := client.Stat(part)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != size {
+		return nil, fmt.Errorf("Uploaded %d of %d bytes of %s", info.Size(), size, key)
+	}
+
+	if err := rename(client, part, d.path(key)); err != nil {
+		return nil, err
+	}
+
+	return &Object{Key: key, Size: size, Checksum: sha256Checksum(h), ModifiedAt: info.ModTime()}, nil
+}
+
+// rename replaces newname, plain SFTP renames fail when it exists
+func rename(client *sftp.Client, oldname, newname string) error {
+	if err := client.PosixRename(oldname, newname); err == nil {
+		return nil
+	}
+
+	if err := client.Remove(newname); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return client.Rename(oldname, newname)
+}
+
+func (d *sftpDestination) Get(key string, w io.Writer) error {
+	client, done, err := d.connect()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	f, err := client.Open(d.path(key))
+	if err != nil {
+		return sftpError(err)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (d *sftpDestination) Stat(key string) (*Object, error) {
+	client, done, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	info, err := client.Stat(d.path(key))
+	if err != nil {
+		return nil, sftpError(err)
+	}
+
+	return &Object{Key: key, Size: info.Size(), ModifiedAt: info.ModTime()}, nil
+}
+
+func (d *sftpDestination) List() ([]Object, error) {
+	client, done, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	dir := d.config.Path
+	if dir == "" {
+		dir = "."
+	}
+
+	files, err := client.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []Object
+	for _, f := range files {
+		if f.IsDir() || strings.HasSuffix(f.Name(), partSuffix) {
+			continue
+		}
+		objects = append(objects, Object{Key: f.Name(), Size: f.Size(), ModifiedAt: f.ModTime()})
+	}
+
+	return objects, nil
+}
+
+func (d *sftpDestination) Delete(key string) error {
+	client, done, err := d.connect()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if err := client.Remove(d.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func sftpError(err error) error {
+	var status *sftp.StatusError
+	if os.IsNotExist(err) || errors.As(err, &status) && status.FxCode() == sftp.ErrSSHFxNoSuchFile {
+		return NotFoundError
+	}
+
+	return err
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/pkg/sftp"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftpServer serves dir over SFTP on a local port, for user/password
+type sftpServer struct {
+	listener net.Listener
+	dir      string
+	hostKey  string
+}
+
+func newSftpServer(dir string) *sftpServer {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := ssh.NewSignerFromKey(key)
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "user" && string(pass) == "password" {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	s := sftpServer{listener: listener, dir: dir, hostKey: string(ssh.MarshalAuthorizedKey(signer.PublicKey()))}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+
+	return &s
+}
+
+func (s *sftpServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for nc := range chans {
+		channel, requests, err := nc.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					server, _ := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(s.dir))
+					server.Serve()
+					channel.Close()
+				}
+			}
+		}()
+	}
+}
+
+func (s *sftpServer) config() SftpConfig {
+	return SftpConfig{
+		Host:     s.listener.Addr().String(),
+		User:     "user",
+		Password: "password",
+		HostKey:  s.hostKey,
+		Path:     "backups",
+	}
+}
+
+func TestSftpDestination(t *testing.T) {
+	Convey("Given an SFTP destination", t, func() {
+		dir, _ := ioutil.TempDir("", "world-backup-sftp-")
+		defer os.RemoveAll(dir)
+
+		server := newSftpServer(dir)
+		defer server.listener.Close()
+
+		d, err := NewSftp("nas", server.config())
+		So(err, ShouldBeNil)
+		So(d.Name(), ShouldEqual, "nas")
+
+		content := bytes.Repeat([]byte("world backup "), 1000)
+		stored := filepath.Join(dir, "backups", "World.zip")
+
+		Convey("When a backup is stored", func() {
+			obj, err := d.Put("World.zip", bytes.NewReader(content), int64(len(content)))
+
+			Convey("It should be in the folder, with no part file left", func() {
+				So(err, ShouldBeNil)
+				So(obj.Size, ShouldEqual, len(content))
+				So(obj.Checksum, ShouldStartWith, "sha256:")
+
+				b, _ := ioutil.ReadFile(stored)
+				So(bytes.Equal(b, content), ShouldBeTrue)
+				_, err := os.Stat(stored + partSuffix)
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+
+			Convey("It should be read back and listed", func() {
+				var b bytes.Buffer
+				So(d.Get("World.zip", &b), ShouldBeNil)
+				So(bytes.Equal(b.Bytes(), content), ShouldBeTrue)
+
+				stat, err := d.Stat("World.zip")
+				So(err, ShouldBeNil)
+				So(stat.Size, ShouldEqual, len(content))
+
+				objects, err := d.List()
+				So(err, ShouldBeNil)
+				So(len(objects), ShouldEqual, 1)
+				So(objects[0].Key, ShouldEqual, "World.zip")
+			})
+
+			Convey("It should be gone once deleted, and deleting again is fine", func() {
+				So(d.Delete("World.zip"), ShouldBeNil)
+				So(d.Delete("World.zip"), ShouldBeNil)
+
+				_, err := d.Stat("World.zip")
+				So(err, ShouldEqual, NotFoundError)
+			})
+		})
+
+		Convey("When an earlier upload was interrupted", func() {
+			os.MkdirAll(filepath.Join(dir, "backups"), 0755)
+			ioutil.WriteFile(stored+partSuffix, []byte("XXXXX"), 0644)
+			ioutil.WriteFile(filepath.Join(dir, "backups", "Other.zip"+partSuffix), []byte("X"), 0644)
+
+			obj, err := d.Put("World.zip", bytes.NewReader(content), int64(len(content)))
+
+			Convey("It should only send the rest", func() {
+				So(err, ShouldBeNil)
+				So(obj.Size, ShouldEqual, len(content))
+
+				b, _ := ioutil.ReadFile(stored)
+				So(string(b[:5]), ShouldEqual, "XXXXX")
+				So(bytes.Equal(b[5:], content[5:]), ShouldBeTrue)
+			})
+
+			Convey("It should not list unfinished uploads", func() {
+				objects, _ := d.List()
+				var keys []string
+				for _, o := range objects {
+					keys = append(keys, o.Key)
+				}
+				sort.Strings(keys)
+				So(keys, ShouldResemble, []string{"World.zip"})
+			})
+		})
+
+		Convey("When a backup that was never stored is read", func() {
+			So(d.Get("Missing.zip", new(bytes.Buffer)), ShouldEqual, NotFoundError)
+		})
+
+		Convey("When the host key does not match", func() {
+			other := newSftpServer(dir)
+			defer other.listener.Close()
+
+			c := other.config()
+			c.HostKey = server.hostKey
+			d, _ := NewSftp("nas", c)
+			_, err := d.Stat("World.zip")
+
+			Convey("It should refuse to connect", func() {
+				So(err, ShouldNotBeNil)
+				So(err, ShouldNotEqual, NotFoundError)
+			})
+		})
+	})
+
+	Convey("Given SFTP settings without a host key", t, func() {
+		_, err := NewSftp("nas", SftpConfig{Host: "nas:22", User: "user"})
+
+		Convey("It should refuse them", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
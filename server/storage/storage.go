@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"world-backup/server/throttle"
+)
+
+// Types of destination
+const (
+	S3     = "s3"
+	SFTP   = "sftp"
+	WebDAV = "webdav"
+)
+
+// partSuffix marks an upload that has not finished yet, destinations that
+// resume keep the bytes received so far under the key with this suffix
+const partSuffix = ".part"
+
+var NotFoundError = errors.New("The backup is not stored at the destination")
+
+// UnknownTypeError is returned for a destination type we can't store to
+type UnknownTypeError string
+
+func (e UnknownTypeError) Error() string {
+	return fmt.Sprintf("Unknown destination type [%s]", string(e))
+}
+
+// Config describes a place backups are copied to, the settings for the
+// type of destination are in the matching field
+type Config struct {
+	Name   string        `json:"name"`
+	Type   string        `json:"type"`
+	S3     *S3Config     `json:"s3"`
+	Sftp   *SftpConfig   `json:"sftp"`
+	WebDav *WebDavConfig `json:"webdav"`
+}
+
+// Object is a backup stored at a destination
+type Object struct {
+	Key        string
+	Size       int64
+	Checksum   string
+	ModifiedAt time.Time
+}
+
+// Destination stores backup archives away from the backup folder
+type Destination interface {
+	Name() string
+	// Put stores size bytes read from r under key and returns what the
+	// destination holds once it has verified them. Destinations that can
+	// resume pick up where an interrupted Put of the same key stopped.
+	Put(key string, r io.ReadSeeker, size int64) (*Object, error)
+	// Get writes the object stored under key to w
+	Get(key string, w io.Writer) error
+	// Stat returns NotFoundError when there is nothing stored under key
+	Stat(key string) (*Object, error)
+	// List returns every complete object at the destination
+	List() ([]Object, error)
+	// Delete removes the object, removing one that is not there is not an error
+	Delete(key string) error
+}
+
+// New creates the destination described by c
+var New = func(c Config) (Destination, error) {
+	if c.Name == "" {
+		return nil, errors.New("A destination needs a name")
+	}
+
+	switch c.Type {
+	case S3:
+		if c.S3 == nil {
+			return nil, fmt.Errorf("Destination [%s] has no s3 settings", c.Name)
+		}
+		return NewS3(c.Name, *c.S3)
+	case SFTP:
+		if c.Sftp == nil {
+			return nil, fmt.Errorf("Destination [%s] has no sftp settings", c.Name)
+		}
+		return NewSftp(c.Name, *c.Sftp)
+	case WebDAV:
+		if c.WebDav == nil {
+			return nil, fmt.Errorf("Destination [%s] has no webdav settings", c.Name)
+		}
+		return NewWebDav(c.Name, *c.WebDav)
+	}
+
+	return nil, UnknownTypeError(c.Type)
+}
+
+// Set is every configured destination
+type Set []Destination
+
+// Open creates a destination for each config
+func Open(configs []Config) (Set, error) {
+	var s Set
+	names := map[string]bool{}
+
+	for _, c := range configs {
+		if names[c.Name] {
+			return nil, fmt.Errorf("There is more than one destination named [%s]", c.Name)
+		}
+		names[c.Name] = true
+
+		d, err := New(c)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, d)
+	}
+
+	return s, nil
+}
+
+// Get returns the destination with the given name, nil when there isn't one
+func (s Set) Get(name string) Destination {
+	for _, d := range s {
+		if d.Name() == name {
+			return d
+		}
+	}
+
+	return nil
+}
+
+// skipUploaded hashes the first n bytes of r, which a resumed upload does
+// not send again, and leaves r positioned after them
+func skipUploaded(r io.ReadSeeker, n int64, h hash.Hash) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err := io.CopyN(h, r, n)
+	return err
+}
+
+func sha256Checksum(h hash.Hash) string {
+	return "sha256:" + base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// fileChecksum is the sha256 of the file at path, the way backups record it,
+// reading it no faster than limiter allows
+func fileChecksum(f IStorageFs, path string, limiter *throttle.Limiter) (string, error) {
+	file, err := f.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, throttle.NewReader(file, limiter)); err != nil {
+		return "", err
+	}
+
+	return sha256Checksum(h), nil
+}
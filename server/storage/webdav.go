@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// WebDavConfig holds the settings for a destination reached over WebDAV,
+// Url is the folder the backups are kept in
+type WebDavConfig struct {
+	Url      string `json:"url"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+type webDavDestination struct {
+	name   string
+	config WebDavConfig
+	base   *url.URL
+	client *http.Client
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/><getlastmodified/></prop></propfind>`
+
+type multistatus struct {
+	Responses []struct {
+		Href string `xml:"href"`
+		Prop struct {
+			ResourceType struct {
+				Collection *struct{} `xml:"collection"`
+			} `xml:"resourcetype"`
+			ContentLength int64  `xml:"getcontentlength"`
+			LastModified  string `xml:"getlastmodified"`
+		} `xml:"propstat>prop"`
+	} `xml:"response"`
+}
+
+// NewWebDav creates a destination storing backups in a WebDAV folder
+func NewWebDav(name string, c WebDavConfig) (Destination, error) {
+	base, err := url.Parse(c.Url)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("Destination [%s] needs an http or https url", name)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	return &webDavDestination{name: name, config: c, base: base, client: &http.Client{}}, nil
+}
+
+func (d *webDavDestination) Name() string {
+	return d.name
+}
+
+func (d *webDavDestination) url(key string) string {
+	u := *d.base
+	u.Path = path.Join(d.base.Path, key)
+	return u.String()
+}
+
+func (d *webDavDestination) do(method, target string, body io.Reader, length int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.ContentLength = length
+	}
+	if d.config.User != "" {
+		req.SetBasicAuth(d.config.User, d.config.Password)
+	}
+
+	return d.client.Do(req)
+}
+
+func webDavError(method, key string, rsp *http.Response) error {
+	if rsp.StatusCode == http.StatusNotFound {
+		return NotFoundError
+	}
+
+	return fmt.Errorf("WebDAV %s of %s failed: %s", method, key, rsp.Status)
+}
+
+func success(rsp *http.Response) bool {
+	return rsp.StatusCode >= 200 && rsp.StatusCode < 300
+}
+
+// Put uploads to a .part file and moves it over the key once complete. An
+// interrupted upload is resumed with a ranged PUT, servers that don't take
+// ranges get the whole file again.
+func (d *webDavDestination) Put(key string, r io.ReadSeeker, size int64) (*Object, error) {
+	if err := d.mkcol(); err != nil {
+		return nil, err
+	}
+
+	part := key + partSuffix
+
+	var uploaded int64
+	if obj, err := d.Stat(part); err == nil && obj.Size <= size {
+		uploaded = obj.Size
+	}
+
+	h := sha256.New()
+	if uploaded > 0 {
+		if err := skipUploaded(r, uploaded, h); err != nil {
+			return nil, err
+		}
+
+		if uploaded < size && !d.putRange(part, r, h, uploaded, size) {
+			uploaded = 0
+		}
+	}
+
+	if uploaded == 0 {
+		h.Reset()
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		rsp, err := d.do(http.MethodPut, d.url(part), io.TeeReader(r, h), size, nil)
+		if err != nil {
+			return nil, err
+		}
+		rsp.Body.Close()
+		if !success(rsp) {
+			return nil, webDavError(http.MethodPut, key, rsp)
+		}
+	}
+
+	obj, err := d.Stat(part)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Size != size {
+		return nil, fmt.Errorf("Uploaded %d of %d bytes of %s", obj.Size, size, key)
+	}
+
+	rsp, err := d.do("MOVE", d.url(part), nil, 0, http.Header{
+		"Destination": {d.url(key)},
+		"Overwrite":   {"T"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	rsp.Body.Close()
+	if !success(rsp) {
+		return nil, webDavError("MOVE", key, rsp)
+	}
+
+	return &Object{Key: key, Size: size, Checksum: sha256Checksum(h), ModifiedAt: obj.ModifiedAt}, nil
+}
+
+// putRange sends the rest of the file and checks the server appended it
+func (d *webDavDestination) putRange(part string, r io.Reader, h io.Writer, uploaded, size int64) bool {
+	rsp, err := d.do(http.MethodPut, d.url(part), io.TeeReader(r, h), size-uploaded, http.Header{
+		"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", uploaded, size-1, size)},
+	})
+	if err != nil {
+		return false
+	}
+	rsp.Body.Close()
+
+	if !success(rsp) {
+		return false
+	}
+
+	obj, err := d.Stat(part)
+	return err == nil && obj.Size == size
+}
+
+// mkcol creates the backup folder, which fails harmlessly when it exists
+func (d *webDavDestination) mkcol() error {
+	rsp, err := d.do("MKCOL", d.base.String(), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+
+	if success(rsp) || rsp.StatusCode == http.StatusMethodNotAllowed || rsp.StatusCode == http.StatusMovedPermanently {
+		return nil
+	}
+
+	return webDavError("MKCOL", d.base.Path, rsp)
+}
+
+func (d *webDavDestination) Get(key string, w io.Writer) error {
+	rsp, err := d.do(http.MethodGet, d.url(key), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	if !success(rsp) {
+		return webDavError(http.MethodGet, key, rsp)
+	}
+
+	_, err = io.Copy(w, rsp.Body)
+	return err
+}
+
+func (d *webDavDestination) propfind(target, depth string) (*multistatus, error) {
+	rsp, err := d.do("PROPFIND", target, strings.NewReader(propfindBody), int64(len(propfindBody)), http.Header{
+		"Depth":        {depth},
+		"Content-Type": {"application/xml"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusMultiStatus {
+		return nil, webDavError("PROPFIND", target, rsp)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(rsp.Body).Decode(&ms); err != nil {
+		return nil, err
+	}
+
+	return &ms, nil
+}
+
+func (d *webDavDestination) Stat(key string) (*Object, error) {
+	ms, err := d.propfind(d.url(key), "0")
+	if err != nil {
+		return nil, err
+	}
+	if len(ms.Responses) == 0 {
+		return nil, NotFoundError
+	}
+
+	p := ms.Responses[0].Prop
+	modified, _ := http.ParseTime(p.LastModified)
+
+	return &Object{Key: key, Size: p.ContentLength, ModifiedAt: modified}, nil
+}
+
+func (d *webDavDestination) List() ([]Object, error) {
+	ms, err := d.propfind(d.base.String(), "1")
+	if err == NotFoundError {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []Object
+	for _, r := range ms.Responses {
+		if r.Prop.ResourceType.Collection != nil {
+			continue
+		}
+
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		name := path.Base(href.Path)
+		if strings.HasSuffix(name, partSuffix) {
+			continue
+		}
+
+		modified, _ := http.ParseTime(r.Prop.LastModified)
+		objects = append(objects, Object{Key: name, Size: r.Prop.ContentLength, ModifiedAt: modified})
+	}
+
+	return objects, nil
+}
+
+func (d *webDavDestination) Delete(key string) error {
+	rsp, err := d.do(http.MethodDelete, d.url(key), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	rsp.Body.Close()
+
+	if success(rsp) || rsp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return webDavError(http.MethodDelete, key, rsp)
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/webdav"
+)
+
+// fakeWebDav is the x/net/webdav handler, which like many servers ignores
+// Content-Range, with the option of appending ranged PUTs as some servers do
+type fakeWebDav struct {
+	fs     webdav.FileSystem
+	dav    *webdav.Handler
+	ranges bool
+	puts   []int64
+}
+
+func newFakeWebDav() *fakeWebDav {
+	fs := webdav.NewMemFS()
+	return &fakeWebDav{fs: fs, dav: &webdav.Handler{FileSystem: fs, LockSystem: webdav.NewMemLS()}}
+}
+
+func (s *fakeWebDav) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if u, p, _ := r.BasicAuth(); u != "user" || p != "password" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		s.puts = append(s.puts, r.ContentLength)
+	}
+
+	var start, end, size int64
+	if r.Method != http.MethodPut || !s.ranges || r.Header.Get("Content-Range") == "" {
+		s.dav.ServeHTTP(w, r)
+		return
+	}
+
+	fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size)
+	f, err := s.fs.OpenFile(context.Background(), r.URL.Path, os.O_WRONLY, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	f.Seek(start, io.SeekStart)
+	io.Copy(f, r.Body)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *fakeWebDav) read(name string) []byte {
+	f, err := s.fs.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	b, _ := ioutil.ReadAll(f)
+	return b
+}
+
+func (s *fakeWebDav) write(name string, b []byte) {
+	s.fs.Mkdir(context.Background(), "/backups", 0755)
+	f, _ := s.fs.OpenFile(context.Background(), name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	f.Write(b)
+	f.Close()
+}
+
+func TestWebDavDestination(t *testing.T) {
+	Convey("Given a WebDAV destination", t, func() {
+		fake := newFakeWebDav()
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		d, err := NewWebDav("cloud", WebDavConfig{Url: server.URL + "/backups", User: "user", Password: "password"})
+		So(err, ShouldBeNil)
+		So(d.Name(), ShouldEqual, "cloud")
+
+		content := bytes.Repeat([]byte("world backup "), 1000)
+		size := int64(len(content))
+
+		Convey("When a backup is stored", func() {
+			obj, err := d.Put("World.zip", bytes.NewReader(content), size)
+
+			Convey("It should be in the folder, with no part file left", func() {
+				So(err, ShouldBeNil)
+				So(obj.Size, ShouldEqual, size)
+				So(obj.Checksum, ShouldStartWith, "sha256:")
+
+				So(bytes.Equal(fake.read("/backups/World.zip"), content), ShouldBeTrue)
+				So(fake.read("/backups/World.zip"+partSuffix), ShouldBeNil)
+			})
+
+			Convey("It should be read back and listed", func() {
+				var b bytes.Buffer
+				So(d.Get("World.zip", &b), ShouldBeNil)
+				So(bytes.Equal(b.Bytes(), content), ShouldBeTrue)
+
+				stat, err := d.Stat("World.zip")
+				So(err, ShouldBeNil)
+				So(stat.Size, ShouldEqual, size)
+
+				objects, err := d.List()
+				So(err, ShouldBeNil)
+				So(len(objects), ShouldEqual, 1)
+				So(objects[0].Key, ShouldEqual, "World.zip")
+				So(objects[0].Size, ShouldEqual, size)
+			})
+
+			Convey("It should be gone once deleted, and deleting again is fine", func() {
+				So(d.Delete("World.zip"), ShouldBeNil)
+				So(d.Delete("World.zip"), ShouldBeNil)
+
+				_, err := d.Stat("World.zip")
+				So(err, ShouldEqual, NotFoundError)
+			})
+		})
+
+		Convey("When an earlier upload was interrupted", func() {
+			fake.write("/backups/World.zip"+partSuffix, []byte("XXXXX"))
+
+			Convey("And the server appends ranged uploads", func() {
+				fake.ranges = true
+				obj, err := d.Put("World.zip", bytes.NewReader(content), size)
+
+				Convey("It should only send the rest", func() {
+					So(err, ShouldBeNil)
+					So(obj.Size, ShouldEqual, size)
+					So(fake.puts, ShouldResemble, []int64{size - 5})
+
+					b := fake.read("/backups/World.zip")
+					So(string(b[:5]), ShouldEqual, "XXXXX")
+					So(bytes.Equal(b[5:], content[5:]), ShouldBeTrue)
+				})
+			})
+
+			Convey("And the server ignores ranges", func() {
+				obj, err := d.Put("World.zip", bytes.NewReader(content), size)
+
+				Convey("It should send all of it again", func() {
+					So(err, ShouldBeNil)
+					So(obj.Size, ShouldEqual, size)
+					So(fake.puts, ShouldResemble, []int64{size - 5, size})
+					So(bytes.Equal(fake.read("/backups/World.zip"), content), ShouldBeTrue)
+				})
+			})
+
+			Convey("It should not list unfinished uploads", func() {
+				objects, err := d.List()
+				So(err, ShouldBeNil)
+				So(objects, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When a backup that was never stored is read", func() {
+			So(d.Get("Missing.zip", new(bytes.Buffer)), ShouldEqual, NotFoundError)
+		})
+
+		Convey("When nothing was ever stored", func() {
+			objects, err := d.List()
+
+			Convey("It should list nothing", func() {
+				So(err, ShouldBeNil)
+				So(objects, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the password is wrong", func() {
+			d, _ := NewWebDav("cloud", WebDavConfig{Url: server.URL + "/backups", User: "user", Password: "wrong"})
+			_, err := d.Put("World.zip", bytes.NewReader(content), size)
+
+			Convey("It should fail", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("Given a url that isn't http", t, func() {
+		_, err := NewWebDav("cloud", WebDavConfig{Url: "ftp://nas/backups"})
+
+		Convey("It should refuse it", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
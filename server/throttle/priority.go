@@ -0,0 +1,19 @@
+package throttle
+
+import "runtime"
+
+// RunLowPriority runs fn on a thread of its own with the lowest I/O and CPU
+// priority the system allows. The thread is thrown away afterwards rather
+// than handed back to the runtime with its priority lowered.
+func RunLowPriority(fn func() error) error {
+	done := make(chan error, 1)
+
+	go func() {
+		// exiting without unlocking ends the thread
+		runtime.LockOSThread()
+		lowerThreadPriority()
+		done <- fn()
+	}()
+
+	return <-done
+}
@@ -0,0 +1,20 @@
+//go:build linux
+// +build linux
+
+package throttle
+
+import "syscall"
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// lowerThreadPriority puts the calling thread in the idle I/O class, as
+// ionice -c3 does, and at the lowest CPU priority. On Linux both apply to
+// the thread when given its id, 0 being the calling one.
+func lowerThreadPriority() {
+	syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, ioprioClassIdle<<ioprioClassShift)
+	syscall.Setpriority(syscall.PRIO_PROCESS, 0, 19)
+}
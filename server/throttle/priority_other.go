@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package throttle
+
+// lowerThreadPriority does nothing where priorities can't be set per thread,
+// the rate limits still apply
+func lowerThreadPriority() {}
@@ -0,0 +1,117 @@
+package throttle
+
+import (
+	"errors"
+	"sync"
+)
+
+var InvalidConfigError = errors.New("Rates and workers can't be negative")
+
+// Config holds the limits for making and copying backups. Rates are in KiB
+// per second, 0 is no limit. Workers is how many goroutines compress a
+// tar.zst backup, 0 leaves it to the compressor, the other formats always
+// use one. LowPriority reads worlds at idle I/O and lowest CPU priority
+// where the system supports it, so the game gets the disk first.
+type Config struct {
+	ReadRate    int64 `json:"readRate"`
+	WriteRate   int64 `json:"writeRate"`
+	UploadRate  int64 `json:"uploadRate"`
+	Workers     int   `json:"workers"`
+	LowPriority bool  `json:"lowPriority"`
+}
+
+// Validate checks the config can be applied
+func (c Config) Validate() error {
+	if c.ReadRate < 0 || c.WriteRate < 0 || c.UploadRate < 0 || c.Workers < 0 {
+		return InvalidConfigError
+	}
+
+	return nil
+}
+
+// Throttle is the limits in effect, they can be changed while backups are
+// made and copied. A nil Throttle doesn't limit anything.
+type Throttle struct {
+	read   *Limiter
+	write  *Limiter
+	upload *Limiter
+
+	mu     sync.Mutex
+	config Config
+}
+
+// New creates the limits for the config
+func New(c Config) (*Throttle, error) {
+	t := Throttle{read: NewLimiter(0), write: NewLimiter(0), upload: NewLimiter(0)}
+	if err := t.Set(c); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Set changes the limits
+func (t *Throttle) Set(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.read.SetRate(c.ReadRate << 10)
+	t.write.SetRate(c.WriteRate << 10)
+	t.upload.SetRate(c.UploadRate << 10)
+	t.config = c
+
+	return nil
+}
+
+// Config returns the limits in effect
+func (t *Throttle) Config() Config {
+	if t == nil {
+		return Config{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.config
+}
+
+// Read limits reading the files of a world into a backup
+func (t *Throttle) Read() *Limiter {
+	if t == nil {
+		return nil
+	}
+
+	return t.read
+}
+
+// Write limits writing backups
+func (t *Throttle) Write() *Limiter {
+	if t == nil {
+		return nil
+	}
+
+	return t.write
+}
+
+// Upload limits copying backups to destinations
+func (t *Throttle) Upload() *Limiter {
+	if t == nil {
+		return nil
+	}
+
+	return t.upload
+}
+
+// Workers is how many goroutines compress a backup, 0 is the default
+func (t *Throttle) Workers() int {
+	return t.Config().Workers
+}
+
+// LowPriority is whether backups are made at low priority
+func (t *Throttle) LowPriority() bool {
+	return t.Config().LowPriority
+}
@@ -0,0 +1,79 @@
+package throttle
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestThrottle(t *testing.T) {
+	Convey("Given a throttle", t, func() {
+		limits, err := New(Config{ReadRate: 100, WriteRate: 200, UploadRate: 50, Workers: 2})
+		So(err, ShouldBeNil)
+
+		Convey("It should set up the limiters in bytes per second", func() {
+			So(limits.Read().Rate(), ShouldEqual, 100<<10)
+			So(limits.Write().Rate(), ShouldEqual, 200<<10)
+			So(limits.Upload().Rate(), ShouldEqual, 50<<10)
+			So(limits.Workers(), ShouldEqual, 2)
+			So(limits.LowPriority(), ShouldBeFalse)
+		})
+
+		Convey("When the limits are changed", func() {
+			read := limits.Read()
+			err := limits.Set(Config{UploadRate: 10, LowPriority: true})
+
+			Convey("It should change the limiters in use", func() {
+				So(err, ShouldBeNil)
+				So(limits.Read(), ShouldEqual, read)
+				So(read.Rate(), ShouldEqual, 0)
+				So(limits.Upload().Rate(), ShouldEqual, 10<<10)
+				So(limits.Config(), ShouldResemble, Config{UploadRate: 10, LowPriority: true})
+			})
+		})
+
+		Convey("When the limits are invalid", func() {
+			err := limits.Set(Config{ReadRate: -1})
+
+			Convey("It should keep the old ones", func() {
+				So(err, ShouldEqual, InvalidConfigError)
+				So(limits.Read().Rate(), ShouldEqual, 100<<10)
+			})
+		})
+	})
+
+	Convey("Given invalid limits", t, func() {
+		_, err := New(Config{Workers: -2})
+
+		Convey("It should fail", func() {
+			So(err, ShouldEqual, InvalidConfigError)
+		})
+	})
+
+	Convey("Given no throttle", t, func() {
+		var limits *Throttle
+
+		Convey("It should not limit anything", func() {
+			So(limits.Read(), ShouldBeNil)
+			So(limits.Write(), ShouldBeNil)
+			So(limits.Upload(), ShouldBeNil)
+			So(limits.Workers(), ShouldEqual, 0)
+			So(limits.LowPriority(), ShouldBeFalse)
+		})
+	})
+}
+
+func TestRunLowPriority(t *testing.T) {
+	Convey("Given work to do at low priority", t, func() {
+		ran := false
+		err := RunLowPriority(func() error {
+			ran = true
+			return InvalidConfigError
+		})
+
+		Convey("It should run it and return its error", func() {
+			So(ran, ShouldBeTrue)
+			So(err, ShouldEqual, InvalidConfigError)
+		})
+	})
+}
@@ -0,0 +1,122 @@
+// Package throttle limits how fast backups are read and written, so copying
+// them doesn't get in the way of the game
+package throttle
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter allows a number of bytes per second, shared between everything
+// it throttles. A rate of 0 is no limit.
+type Limiter struct {
+	l *rate.Limiter
+}
+
+// NewLimiter creates a limiter allowing bytesPerSecond
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	l := Limiter{l: rate.NewLimiter(rate.Inf, 0)}
+	l.SetRate(bytesPerSecond)
+	return &l
+}
+
+// SetRate changes the limit, reads and writes already waiting pick it up
+// with their next chunk
+func (l *Limiter) SetRate(bytesPerSecond int64) {
+	if bytesPerSecond <= 0 {
+		l.l.SetLimit(rate.Inf)
+		return
+	}
+
+	l.l.SetBurst(int(bytesPerSecond))
+	l.l.SetLimit(rate.Limit(bytesPerSecond))
+}
+
+// Rate is the limit in bytes per second, 0 when there is none
+func (l *Limiter) Rate() int64 {
+	if l.l.Limit() == rate.Inf {
+		return 0
+	}
+
+	return int64(l.l.Limit())
+}
+
+// Wait blocks until n more bytes are allowed
+func (l *Limiter) Wait(n int) {
+	for n > 0 {
+		if l.l.Limit() == rate.Inf {
+			return
+		}
+
+		c := n
+		if b := l.l.Burst(); c > b {
+			c = b
+		}
+
+		// this only fails when the rate was lowered since we read the burst
+		if err := l.l.WaitN(context.Background(), c); err == nil {
+			n -= c
+		}
+	}
+}
+
+type reader struct {
+	r io.Reader
+	l *Limiter
+}
+
+// NewReader returns a reader that reads from r no faster than l allows, a
+// nil l doesn't limit it
+func NewReader(r io.Reader, l *Limiter) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return &reader{r: r, l: l}
+}
+
+func (t *reader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.l.Wait(n)
+	return n, err
+}
+
+type readSeeker struct {
+	reader
+	s io.Seeker
+}
+
+// NewReadSeeker is NewReader for uploads, which seek to resume
+func NewReadSeeker(r io.ReadSeeker, l *Limiter) io.ReadSeeker {
+	if l == nil {
+		return r
+	}
+
+	return &readSeeker{reader: reader{r: r, l: l}, s: r}
+}
+
+func (t *readSeeker) Seek(offset int64, whence int) (int64, error) {
+	return t.s.Seek(offset, whence)
+}
+
+type writer struct {
+	w io.Writer
+	l *Limiter
+}
+
+// NewWriter returns a writer that writes to w no faster than l allows, a
+// nil l doesn't limit it
+func NewWriter(w io.Writer, l *Limiter) io.Writer {
+	if l == nil {
+		return w
+	}
+
+	return &writer{w: w, l: l}
+}
+
+func (t *writer) Write(p []byte) (int, error) {
+	t.l.Wait(len(p))
+	return t.w.Write(p)
+}
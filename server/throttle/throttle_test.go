@@ -0,0 +1,84 @@
+package throttle
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLimiter(t *testing.T) {
+	Convey("Given a limiter", t, func() {
+		l := NewLimiter(0)
+
+		Convey("It should not limit without a rate", func() {
+			So(l.Rate(), ShouldEqual, 0)
+
+			start := time.Now()
+			l.Wait(1 << 30)
+			So(time.Since(start), ShouldBeLessThan, 100*time.Millisecond)
+		})
+
+		Convey("When a rate is set", func() {
+			l.SetRate(10 << 10)
+
+			Convey("It should hold reads to it", func() {
+				So(l.Rate(), ShouldEqual, 10<<10)
+
+				start := time.Now()
+				b, err := ioutil.ReadAll(NewReader(bytes.NewReader(make([]byte, 15<<10)), l))
+
+				So(err, ShouldBeNil)
+				So(len(b), ShouldEqual, 15<<10)
+				// the first second is allowed at once
+				So(time.Since(start), ShouldBeGreaterThan, 400*time.Millisecond)
+			})
+
+			Convey("It should lift the limit when the rate is cleared", func() {
+				l.SetRate(0)
+				So(l.Rate(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestNewWriter(t *testing.T) {
+	Convey("Given a throttled writer", t, func() {
+		var b bytes.Buffer
+		w := NewWriter(&b, NewLimiter(10<<10))
+
+		Convey("It should hold writes to the rate", func() {
+			start := time.Now()
+			n, err := w.Write(make([]byte, 15<<10))
+
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 15<<10)
+			So(b.Len(), ShouldEqual, 15<<10)
+			So(time.Since(start), ShouldBeGreaterThan, 400*time.Millisecond)
+		})
+	})
+}
+
+func TestNewReadSeeker(t *testing.T) {
+	Convey("Given a throttled read seeker", t, func() {
+		r := NewReadSeeker(bytes.NewReader([]byte("the backup")), NewLimiter(1<<20))
+
+		Convey("It should seek the reader", func() {
+			r.Seek(4, io.SeekStart)
+			b, _ := ioutil.ReadAll(r)
+			So(string(b), ShouldEqual, "backup")
+		})
+	})
+
+	Convey("Given no limiter", t, func() {
+		src := bytes.NewReader(nil)
+
+		Convey("It should return the reader as is", func() {
+			So(NewReadSeeker(src, nil), ShouldEqual, src)
+			So(NewReader(src, nil), ShouldEqual, src)
+		})
+	})
+}
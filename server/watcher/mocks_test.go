@@ -1,9 +1,15 @@
 package watcher
 
 import (
+	"io"
+	"world-backup/server/audit"
 	"world-backup/server/data"
+	"world-backup/server/filter"
+	"world-backup/server/fs"
+	"world-backup/server/storage"
 
 	"os"
+	"sync"
 
 	"time"
 
@@ -13,6 +19,16 @@ import (
 //region IDb
 type IDbMock struct {
 	mock.Mock
+	// catalog is a real lock, so holding it twice deadlocks the test
+	catalog sync.Mutex
+}
+
+func (m *IDbMock) Lock() {
+	m.catalog.Lock()
+}
+
+func (m *IDbMock) Unlock() {
+	m.catalog.Unlock()
 }
 
 func (m *IDbMock) Save() error {
@@ -24,6 +40,11 @@ func (m *IDbMock) Close() {
 	m.Called()
 }
 
+func (m *IDbMock) Folders() []*data.Folder {
+	args := m.Called()
+	return args.Get(0).([]*data.Folder)
+}
+
 func (m *IDbMock) AddFolder(path string) *data.Folder {
 	args := m.Called(path)
 	return args.Get(0).(*data.Folder)
@@ -55,14 +76,14 @@ func (m *IFileSystemMock) ReadDir(dirname string) ([]os.FileInfo, error) {
 	return args.Get(0).([]os.FileInfo), args.Error(1)
 }
 
-func (m *IFileSystemMock) Chdir(dir string) error {
-	args := m.Called(dir)
-	return args.Error(0)
-}
+func (m *IFileSystemMock) ReadFile(filename string) ([]byte, error) {
+	args := m.Called(filename)
 
-func (m *IFileSystemMock) Getwd() (dir string, err error) {
-	args := m.Called()
-	return args.String(0), args.Error(1)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).([]byte), args.Error(1)
 }
 
 func (m *IFileSystemMock) Remove(name string) error {
@@ -70,8 +91,8 @@ func (m *IFileSystemMock) Remove(name string) error {
 	return args.Error(0)
 }
 
-func (m *IFileSystemMock) Zip(source, target string) error {
-	args := m.Called(source, target)
+func (m *IFileSystemMock) Archive(source, target string, opts fs.ArchiveOptions, rules filter.Rules) error {
+	args := m.Called(source, target, opts, rules)
 	return args.Error(0)
 }
 
@@ -110,3 +131,73 @@ func (m *FileInfoMock) Sys() interface{} {
 }
 
 //endregion
+
+//region Destination
+type DestinationMock struct {
+	mock.Mock
+}
+
+func (m *DestinationMock) Name() string {
+	args := m.Called()
+	return args.String(0)
+}
+
+func (m *DestinationMock) Put(key string, r io.ReadSeeker, size int64) (*storage.Object, error) {
+	args := m.Called(key, r, size)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Object), args.Error(1)
+}
+
+func (m *DestinationMock) Get(key string, w io.Writer) error {
+	args := m.Called(key, w)
+	return args.Error(0)
+}
+
+func (m *DestinationMock) Stat(key string) (*storage.Object, error) {
+	args := m.Called(key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*storage.Object), args.Error(1)
+}
+
+func (m *DestinationMock) List() ([]storage.Object, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]storage.Object), args.Error(1)
+}
+
+func (m *DestinationMock) Delete(key string) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+//endregion
+
+type ReplicationQueueMock struct {
+	mock.Mock
+}
+
+func (m *ReplicationQueueMock) Enqueue(backup *data.Backup) {
+	m.Called(backup)
+}
+
+func (m *ReplicationQueueMock) Forget(backupId string) {
+	m.Called(backupId)
+}
+
+//region IAudit
+type AuditMock struct {
+	mock.Mock
+}
+
+func (m *AuditMock) Record(e audit.Entry) error {
+	args := m.Called(e)
+	return args.Error(0)
+}
+
+//endregion
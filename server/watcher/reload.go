@@ -0,0 +1,122 @@
+package watcher
+
+import (
+	"time"
+
+	"world-backup/server/conf"
+	"world-backup/server/storage"
+)
+
+// reload is a new config, and the destinations opened from it, waiting for
+// the watcher to switch to it between checks
+type reload struct {
+	config       *conf.Config
+	destinations storage.Set
+}
+
+// tickFor is how often the watcher looks for worlds that are due. Worlds
+// have their own schedules so it looks at least every minute.
+func tickFor(c *conf.Config) time.Duration {
+	tick, _ := time.ParseDuration(c.CheckInterval)
+	if tick <= 0 || tick > maxTick {
+		tick = maxTick
+	}
+
+	return tick
+}
+
+// CheckConfig makes sure the watcher can run with the config
+func (w *Watcher) CheckConfig(c *conf.Config) error {
+	if d, err := time.ParseDuration(c.CheckInterval); err != nil || d <= 0 {
+		return InvalidCheckInterval
+	}
+
+	if p := c.ScheduleProblems(); len(p) > 0 {
+		return p
+	}
+
+	return nil
+}
+
+// Reload hands the watcher a new config and destinations, they are used
+// from the next check on. A reload that wasn't picked up yet is replaced.
+func (w *Watcher) Reload(c *conf.Config, destinations storage.Set) {
+	select {
+	case <-w.reloads:
+	default:
+	}
+
+	w.reloads <- reload{config: c, destinations: destinations}
+}
+
+func applyReload(w *Watcher, r reload) {
+	previous := w.config.WatchDirs
+	changedDestinations := !sameDestinations(w.destinations, r.destinations)
+
+	w.config = r.config
+	w.destinations = r.destinations
+
+	w.withCatalog(func() {
+		trackWatchDirs(w, previous)
+		if changedDestinations && len(w.destinations) > 0 {
+			reconcile(w)
+		}
+		w.db.Save()
+	})
+
+	w.log.Infof("Switched to the reloaded config, checking every %s", w.config.CheckInterval)
+}
+
+// trackWatchDirs adds the folders in the config to the catalog. Folders
+// that were in the previous config but no longer are stop being watched,
+// keeping their backups. The config has cleaned up the paths the way the
+// catalog keeps them, so they are compared as they are.
+func trackWatchDirs(w *Watcher, previous []string) {
+	for i, d := range w.config.WatchDirs {
+		w.log.Infof("Checking tracking for dir (%d) [%s]", i, d)
+
+		f := w.db.GetFolderByPath(d)
+		if f == nil {
+			w.log.Infof("Creating tracking for [%s]", d)
+			f = w.db.AddFolder(d)
+		}
+		f.Untracked = false
+
+		w.log.Infof("Watching: %s: %s", f.Id, f.Path)
+	}
+
+	for _, d := range previous {
+		if contains(w.config.WatchDirs, d) {
+			continue
+		}
+
+		if f := w.db.GetFolderByPath(d); f != nil {
+			w.log.Infof("Stopped watching [%s], it is no longer in the config", d)
+			f.Untracked = true
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sameDestinations(a, b storage.Set) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Name() != b[i].Name() {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,181 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"world-backup/server/conf"
+	"world-backup/server/data"
+
+	"github.com/robfig/cron"
+)
+
+// maxTick is the longest the watcher waits between looking for worlds that
+// are due, so cron schedules run within a minute of their time
+const maxTick = time.Minute
+
+// run is one of the schedules a world is backed up on
+type run struct {
+	schedule cron.Schedule
+	forced   bool
+	quiet    *quietHours
+	// interval is how often an every schedule runs, zero for cron ones
+	interval time.Duration
+}
+
+// quietHours are the times of day, since midnight, when no backups are made
+type quietHours struct {
+	from, to time.Duration
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time like 22:30", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func parseSchedule(s conf.Schedule) (run, error) {
+	r := run{forced: s.Forced()}
+
+	switch {
+	case s.Every != "" && s.Cron != "":
+		return r, errors.New("a schedule can have an interval or a cron expression, not both")
+	case s.Every != "":
+		d, err := time.ParseDuration(s.Every)
+		if err != nil || d <= 0 {
+			return r, fmt.Errorf("%q is not an interval like 10m", s.Every)
+		}
+		r.schedule = cron.Every(d)
+		r.interval = d
+	case s.Cron != "":
+		schedule, err := cron.ParseStandard(s.Cron)
+		if err != nil {
+			return r, fmt.Errorf("%q is not a cron expression: %v", s.Cron, err)
+		}
+		r.schedule = schedule
+	default:
+		return r, errors.New("a schedule needs an interval or a cron expression")
+	}
+
+	if s.QuietHours != nil {
+		from, err := parseTimeOfDay(s.QuietHours.From)
+		if err != nil {
+			return r, err
+		}
+		to, err := parseTimeOfDay(s.QuietHours.To)
+		if err != nil {
+			return r, err
+		}
+		r.quiet = &quietHours{from: from, to: to}
+	}
+
+	return r, nil
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+func (q *quietHours) contains(t time.Time) bool {
+	at := sinceMidnight(t)
+	if q.from <= q.to {
+		return at >= q.from && at < q.to
+	}
+
+	return at >= q.from || at < q.to
+}
+
+// end is when the quiet hours t is in are over
+func (q *quietHours) end(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	end := midnight.Add(q.to)
+	if !end.After(t) {
+		end = midnight.AddDate(0, 0, 1).Add(q.to)
+	}
+
+	return end
+}
+
+// next is when the run is due after the given time, runs that fall in quiet
+// hours wait for them to end
+func (r run) next(after time.Time) time.Time {
+	n := r.schedule.Next(after)
+	if r.quiet != nil && r.quiet.contains(n) {
+		n = r.quiet.end(n)
+	}
+
+	return n
+}
+
+// runsFor is when the world is backed up. Schedules that can't be used are
+// logged and left out, without any the world is checked every CheckInterval.
+func (w *Watcher) runsFor(f *data.Folder, world *data.World) []run {
+	var runs []run
+	for _, s := range w.config.SchedulesFor(f.Path, world.Name) {
+		r, err := parseSchedule(s)
+		if err != nil {
+			w.log.Warnf("Skipping schedule for [%s]: %v", world.FullPath, err)
+			continue
+		}
+		runs = append(runs, r)
+	}
+
+	if len(runs) == 0 {
+		interval, _ := time.ParseDuration(w.config.CheckInterval)
+		runs = append(runs, run{schedule: cron.Every(interval), interval: interval})
+	}
+
+	return runs
+}
+
+// dueRuns is true when any of the runs is due since the world was last
+// checked, and forced when one of those backs up whether or not it changed.
+// A world that was never checked is due straight away.
+func dueRuns(runs []run, last, now time.Time) (due bool, forced bool) {
+	for _, r := range runs {
+		if r.due(last, now) {
+			due = true
+			forced = forced || r.forced
+		}
+	}
+
+	return due, forced
+}
+
+// keptRuns is true when a cron or forced run is due, the backups those make
+// are never pruned
+func keptRuns(runs []run, last, now time.Time) bool {
+	for _, r := range runs {
+		if r.due(last, now) && (r.forced || r.interval == 0) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// due is true when the run is due since last and now isn't in its quiet
+// hours
+func (r run) due(last, now time.Time) bool {
+	if r.quiet != nil && r.quiet.contains(now) {
+		return false
+	}
+
+	return last.IsZero() || !r.next(last).After(now)
+}
+
+// nextRun is the first time one of the runs is due after the given time
+func nextRun(runs []run, after time.Time) time.Time {
+	var first time.Time
+	for _, r := range runs {
+		if n := r.next(after); first.IsZero() || n.Before(first) {
+			first = n
+		}
+	}
+
+	return first
+}
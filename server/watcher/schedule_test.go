@@ -0,0 +1,167 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	"world-backup/server/conf"
+	"world-backup/server/data"
+
+	"github.com/Sirupsen/logrus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWatcher_ParseSchedule(t *testing.T) {
+	Convey("Given schedules from the config", t, func() {
+		no := false
+
+		Convey("It should accept intervals and cron expressions", func() {
+			every, err := parseSchedule(conf.Schedule{Every: "10m"})
+			So(err, ShouldBeNil)
+			So(every.forced, ShouldBeFalse)
+
+			weekly, err := parseSchedule(conf.Schedule{Cron: "0 3 * * 0", OnlyIfChanged: &no, QuietHours: &conf.QuietHours{From: "22:00", To: "07:00"}})
+			So(err, ShouldBeNil)
+			So(weekly.forced, ShouldBeTrue)
+			So(weekly.quiet, ShouldResemble, &quietHours{from: 22 * time.Hour, to: 7 * time.Hour})
+		})
+
+		Convey("It should refuse the ones it can't use", func() {
+			for _, s := range []conf.Schedule{
+				{},
+				{Every: "10m", Cron: "* * * * *"},
+				{Every: "often"},
+				{Cron: "every sunday"},
+				{Every: "1h", QuietHours: &conf.QuietHours{From: "10pm", To: "07:00"}},
+			} {
+				_, err := parseSchedule(s)
+				So(err, ShouldNotBeNil)
+			}
+
+			err := new(Watcher).CheckConfig(&conf.Config{CheckInterval: "1m", Folders: []conf.FolderConfig{{Path: "/saves", Worlds: []conf.WorldConfig{{Name: "w", Schedules: []conf.Schedule{{Every: "soon"}}}}}}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestWatcher_DueRuns(t *testing.T) {
+	Convey("Given a world checked every 10 minutes and backed up every Sunday at 3", t, func() {
+		no := false
+		every, _ := parseSchedule(conf.Schedule{Every: "10m", QuietHours: &conf.QuietHours{From: "22:00", To: "07:00"}})
+		weekly, _ := parseSchedule(conf.Schedule{Cron: "0 3 * * 0", OnlyIfChanged: &no})
+		runs := []run{every, weekly}
+
+		// a Saturday
+		last := time.Date(2020, 6, 6, 12, 0, 0, 0, time.Local)
+
+		Convey("When it was never checked", func() {
+			due, forced := dueRuns(runs, time.Time{}, last)
+
+			Convey("It should be due straight away", func() {
+				So(due, ShouldBeTrue)
+				So(forced, ShouldBeTrue)
+			})
+		})
+
+		Convey("When the interval hasn't passed", func() {
+			due, _ := dueRuns(runs, last, last.Add(9*time.Minute))
+
+			Convey("It should not be due", func() {
+				So(due, ShouldBeFalse)
+				So(nextRun(runs, last), ShouldEqual, last.Add(10*time.Minute))
+			})
+		})
+
+		Convey("When the interval passed", func() {
+			due, forced := dueRuns(runs, last, last.Add(10*time.Minute))
+
+			Convey("It should be due if the world changed", func() {
+				So(due, ShouldBeTrue)
+				So(forced, ShouldBeFalse)
+				So(keptRuns(runs, last, last.Add(10*time.Minute)), ShouldBeFalse)
+			})
+		})
+
+		Convey("When it is quiet hours", func() {
+			evening := time.Date(2020, 6, 6, 21, 55, 0, 0, time.Local)
+			due, _ := dueRuns(runs, evening, evening.Add(10*time.Minute))
+
+			Convey("It should wait until they are over", func() {
+				So(due, ShouldBeFalse)
+				So(every.next(evening), ShouldEqual, time.Date(2020, 6, 7, 7, 0, 0, 0, time.Local))
+			})
+		})
+
+		Convey("When it is Sunday at 3", func() {
+			night := time.Date(2020, 6, 7, 2, 59, 0, 0, time.Local)
+			due, forced := dueRuns(runs, night, night.Add(time.Minute))
+
+			Convey("It should back up whether or not it changed", func() {
+				So(due, ShouldBeTrue)
+				So(forced, ShouldBeTrue)
+				So(keptRuns(runs, night, night.Add(time.Minute)), ShouldBeTrue)
+				So(nextRun(runs, night), ShouldEqual, time.Date(2020, 6, 7, 3, 0, 0, 0, time.Local))
+			})
+		})
+	})
+}
+
+func TestWatcher_RunsFor(t *testing.T) {
+	Convey("Given a watcher with a broken world schedule", t, func() {
+		config := conf.Config{
+			CheckInterval: "5m",
+			Folders: []conf.FolderConfig{
+				{Path: "/saves", Worlds: []conf.WorldConfig{{Name: "Broken", Schedules: []conf.Schedule{{Every: "soon"}}}}},
+			},
+		}
+		w := NewWatcher(logrus.WithField("test", "watcher"), &config, nil, nil, nil, nil, nil, nil, nil)
+		folder := data.Folder{Path: "/saves"}
+		start := time.Date(2020, 6, 6, 12, 0, 0, 0, time.Local)
+
+		Convey("It should fall back to the check interval", func() {
+			runs := w.runsFor(&folder, &data.World{Name: "Broken"})
+
+			So(len(runs), ShouldEqual, 1)
+			So(nextRun(runs, start), ShouldEqual, start.Add(5*time.Minute))
+		})
+	})
+}
+
+func TestWatcher_Reload(t *testing.T) {
+	Convey("Given a watcher watching two folders from the config", t, func() {
+		config := conf.Config{CheckInterval: "1m", WatchDirs: []string{"/saves", "/old"}}
+		dbMock := new(IDbMock)
+		w := NewWatcher(logrus.WithField("test", "watcher"), &config, nil, dbMock, nil, nil, nil, nil, nil)
+
+		saves := data.Folder{Id: "01", Path: "/saves"}
+		old := data.Folder{Id: "02", Path: "/old"}
+		server := data.Folder{Id: "03", Path: "/server"}
+		dbMock.On("GetFolderByPath", "/saves").Return(&saves)
+		dbMock.On("GetFolderByPath", "/old").Return(&old)
+		dbMock.On("GetFolderByPath", "/server").Return((*data.Folder)(nil))
+		dbMock.On("AddFolder", "/server").Return(&server)
+		dbMock.On("Save").Return(nil)
+
+		Convey("When the config is reloaded with other folders", func() {
+			next := conf.Config{CheckInterval: "10s", WatchDirs: []string{"/saves", "/server"}}
+			w.Reload(&next, nil)
+			applyReload(w, <-w.reloads)
+
+			Convey("It should watch the new folder and stop watching the old one", func() {
+				So(w.config, ShouldEqual, &next)
+				So(tickFor(w.config), ShouldEqual, 10*time.Second)
+				dbMock.AssertCalled(t, "AddFolder", "/server")
+				So(old.Untracked, ShouldBeTrue)
+				So(saves.Watched(), ShouldBeTrue)
+			})
+		})
+
+		Convey("When the config can't be used", func() {
+			err := w.CheckConfig(&conf.Config{CheckInterval: "1m", Folders: []conf.FolderConfig{{Path: "/saves", Schedules: []conf.Schedule{{Cron: "nope"}}}}})
+
+			Convey("It should say so", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -14,6 +14,16 @@ import (
 
 	"world-backup/server/fs"
 
+	"path"
+	"sync"
+	"world-backup/server/audit"
+	"world-backup/server/events"
+	"world-backup/server/filter"
+	"world-backup/server/jobs"
+	"world-backup/server/metrics"
+	"world-backup/server/minecraft"
+	"world-backup/server/storage"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/spf13/afero"
 )
@@ -21,82 +31,181 @@ import (
 var getNow = time.Now
 
 type IFileSystem interface {
-	Chdir(dir string) error
-	Getwd() (dir string, err error)
 	ReadDir(dirname string) ([]os.FileInfo, error)
+	ReadFile(filename string) ([]byte, error)
 	Remove(name string) error
-	Zip(source, target string) error
+	Archive(source, target string, opts fs.ArchiveOptions, rules filter.Rules) error
 }
 
 type IDb interface {
+	Lock()
+	Unlock()
 	Save() error
 	Close()
 
+	Folders() []*data.Folder
 	AddFolder(path string) *data.Folder
 	GetFolderByPath(path string) *data.Folder
 }
 
+type IReplicationQueue interface {
+	Enqueue(backup *data.Backup)
+	Forget(backupId string)
+}
+
+type IJobs interface {
+	Submit(kind, worldId, backupId string, fn jobs.Func) jobs.Job
+	Wait(id string) (jobs.Job, error)
+}
+
+type IEvents interface {
+	Publish(e events.Event) events.Event
+}
+
+type IAudit interface {
+	Record(e audit.Entry) error
+}
+
 type Watcher struct {
-	log    *logrus.Entry
-	config *conf.Config
-	fs     IFileSystem
-	db     IDb
+	log          *logrus.Entry
+	config       *conf.Config
+	fs           IFileSystem
+	db           IDb
+	destinations storage.Set
+	queue        IReplicationQueue
+	jobs         IJobs
+	events       IEvents
+	audit        IAudit
+
+	reloads chan reload
+
+	// lastCheck is when every folder was last checked, with how long the
+	// watcher was going to wait for the next check then
+	mu        sync.Mutex
+	lastCheck time.Time
+	tick      time.Duration
 }
 
-var NoWatchPathError = errors.New("No paths to watch")
 var InvalidCheckInterval = errors.New("Invalid check interval")
 var InvalidMinBackupAge = errors.New("Invalid min backup age")
 
-func NewWatcher(log *logrus.Entry, config *conf.Config, fs IFileSystem, db IDb) *Watcher {
+func NewWatcher(log *logrus.Entry, config *conf.Config, fs IFileSystem, db IDb, destinations storage.Set, queue IReplicationQueue, jobs IJobs, events IEvents, auditLog IAudit) *Watcher {
 	w := Watcher{
-		config: config,
-		log:    log.WithField("component", "watcher"),
-		fs:     fs,
-		db:     db,
+		config:       config,
+		log:          log.WithField("component", "watcher"),
+		fs:           fs,
+		db:           db,
+		destinations: destinations,
+		queue:        queue,
+		jobs:         jobs,
+		events:       events,
+		audit:        auditLog,
+		reloads:      make(chan reload, 1),
 	}
 
 	return &w
 }
 
-func (w *Watcher) Start() error {
-	if len(w.config.WatchDirs) == 0 {
-		return NoWatchPathError
+// runJob runs fn as a job on the world and waits for it, so it takes its
+// turn with backups and restores started from the api. Without jobs fn is
+// run straight away.
+func (w *Watcher) runJob(kind, worldId, backupId string, fn jobs.Func) error {
+	if w.jobs == nil {
+		return fn(nil)
 	}
 
-	checkInterval, ciError := time.ParseDuration(w.config.CheckInterval)
-	if ciError != nil {
-		return InvalidCheckInterval
+	job, err := w.jobs.Wait(w.jobs.Submit(kind, worldId, backupId, fn).Id)
+	if err != nil {
+		return err
 	}
 
-	for i, d := range w.config.WatchDirs {
-		w.log.Infof("Checking tracking for dir (%d) [%s]", i, d)
+	switch job.State {
+	case jobs.Failed:
+		return errors.New(job.Error)
+	case jobs.Canceled:
+		return jobs.CanceledError
+	}
 
-		f := w.db.GetFolderByPath(d)
-		if f == nil {
-			w.log.Infof("Creating tracking for [%s}", d)
-			f = w.db.AddFolder(d)
-		}
+	return nil
+}
 
-		w.log.Infof("Watching: %s: %s", f.Id, f.Path)
+// Start adds the folders from the config to the catalog and checks every
+// folder in it from then on, so folders added through the api are picked up
+// on the next check
+func (w *Watcher) Start() error {
+	if err := w.CheckConfig(w.config); err != nil {
+		return err
 	}
 
-	w.db.Save()
+	w.withCatalog(func() {
+		trackWatchDirs(w, nil)
+		w.db.Save()
+
+		if len(w.destinations) > 0 {
+			reconcile(w)
+			w.db.Save()
+		}
+	})
 
 	// Run our check right at startup
 	check(w)
 
 	stopChannel := make(chan bool)
-	go watch(w, stopChannel, checkInterval)
+	go watch(w, stopChannel, tickFor(w.config))
 
 	return nil
 }
 
+// withCatalog runs fn holding the catalog. Backups and pruning are run
+// without it, so the api can use the catalog in the meantime.
+func (w *Watcher) withCatalog(fn func()) {
+	w.db.Lock()
+	defer w.db.Unlock()
+
+	fn()
+}
+
+// reconcile checks the destinations still hold the copies we recorded and
+// queues the backups that are missing from any of them, it is called
+// holding the catalog
+var reconcile = func(w *Watcher) {
+	var backups []*data.Backup
+	for _, f := range w.db.Folders() {
+		for _, world := range f.Worlds {
+			backups = append(backups, world.Backups...)
+		}
+	}
+
+	for _, d := range w.destinations {
+		log := w.log.WithField("destination", d.Name())
+
+		report, err := storage.Reconcile(log, d, backups)
+		if err != nil {
+			log.Errorf("Failed to list backups: %v", err)
+			continue
+		}
+
+		if len(report.Unknown) > 0 {
+			log.Infof("%d files are not backups we know of", len(report.Unknown))
+		}
+	}
+
+	for _, b := range backups {
+		if len(b.Copies) < len(w.destinations) {
+			w.queue.Enqueue(b)
+		}
+	}
+}
+
 var watch = func(w *Watcher, stop chan bool, d time.Duration) {
 	shouldStop := false
 	for !shouldStop {
 		select {
 		case shouldStop = <-stop:
 			w.log.Infof("Quit message: %v", shouldStop)
+		case r := <-w.reloads:
+			applyReload(w, r)
+			d = tickFor(w.config)
 		case <-time.After(d):
 			w.log.Info("Checking!")
 			check(w)
@@ -105,19 +214,51 @@ var watch = func(w *Watcher, stop chan bool, d time.Duration) {
 }
 
 var check = func(w *Watcher) {
-	for i := range w.config.WatchDirs {
-		path := w.config.WatchDirs[i]
-		f := w.db.GetFolderByPath(path)
+	defer metrics.Since(metrics.CheckDuration, time.Now())
+
+	var folders []*data.Folder
+	w.withCatalog(func() {
+		for _, f := range w.db.Folders() {
+			if f.Watched() {
+				folders = append(folders, f)
+			}
+		}
+	})
+
+	for _, f := range folders {
 		checkOneDir(w, f)
-		f.LastRun = getNow()
-		w.db.Save()
+
+		w.withCatalog(func() {
+			f.LastRun = getNow()
+			w.db.Save()
+		})
 	}
+
+	w.checked(getNow())
+}
+
+func (w *Watcher) checked(at time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastCheck = at
+	w.tick = tickFor(w.config)
+}
+
+// LastCheck is when the watcher last checked every folder and how long it
+// waits between checks, so a watcher that stopped can be told apart
+func (w *Watcher) LastCheck() (time.Time, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.lastCheck, w.tick
 }
 
 var checkOneDir = func(w *Watcher, f *data.Folder) {
 	log := w.log.WithField("folder", f.Id)
 
 	worldDirs, err := w.fs.ReadDir(f.Path)
+	w.withCatalog(func() { f.SetError(err) })
 	if err != nil {
 		log.Error(err)
 		return
@@ -130,74 +271,269 @@ var checkOneDir = func(w *Watcher, f *data.Folder) {
 			continue
 		}
 
-		world := f.GetWorldByName(v.Name())
-		if world == nil {
-			world = f.AddWorld(v.Name())
+		edition := detectEdition(w.fs, path.Join(f.Path, v.Name()))
+		if edition == minecraft.Unknown {
+			log.Infof("Skipping %s, it does not look like a world", v.Name())
+			continue
+		}
+
+		var world *data.World
+		var worldLog *logrus.Entry
+		var rules filter.Rules
+		var changed, kept bool
+		var backups int
+
+		w.withCatalog(func() {
+			world = f.GetWorldByName(v.Name())
+			if world == nil {
+				world = f.AddWorld(v.Name())
+				world.OwnerId = f.DefaultOwnerId
+				w.publish(events.Event{Type: events.WorldDiscovered, FolderId: f.Id, WorldId: world.Id, Data: world})
+			}
+			world.Edition = string(edition)
+
+			rules = w.config.RulesFor(f.Path, world.Name)
+
+			worldLog = log.WithField("world", world.Id)
+
+			now := getNow()
+			runs := w.runsFor(f, world)
+			due, forced := dueRuns(runs, world.LastCheckedAt, now)
+			if !due {
+				return
+			}
+			kept = keptRuns(runs, world.LastCheckedAt, now)
+			world.LastCheckedAt = now
+			world.NextBackupAt = nextRun(runs, now)
+
+			changed = forced || hasChangedFiles(worldLog, w.fs, world, filter.Compile(rules))
+			if changed {
+				readLevel(worldLog, w.fs, world)
+			}
+			backups = len(world.Backups)
+		})
+		if !changed {
+			continue
 		}
 
-		worldLog := log.WithField("world", world.Id)
-		if hasChangedFiles(worldLog, w.fs, world) {
-			createBackup(w, worldLog, f, world)
-			checkPurgeBackup(w, worldLog, world)
+		createBackup(w, worldLog, f, world, rules)
+		if kept {
+			w.withCatalog(func() {
+				if len(world.Backups) > backups {
+					world.Backups[len(world.Backups)-1].Kept = true
+				}
+			})
 		}
+		checkPurgeBackup(w, worldLog, f, world)
 	}
 }
 
-var hasChangedFiles = func(log *logrus.Entry, fs IFileSystem, world *data.World) bool {
-	files, err := fs.ReadDir(world.FullPath)
+// record adds what the watcher did to the audit log, if there is one
+func (w *Watcher) record(log *logrus.Entry, e audit.Entry, err error) {
+	if w.audit == nil {
+		return
+	}
+
+	e.Actor = audit.Watcher
 	if err != nil {
-		log.Errorf("Failed to check world [%s] for changes: %v", world.FullPath, err)
-		return false
+		e.Error = err.Error()
 	}
 
+	if err := w.audit.Record(e); err != nil {
+		log.Errorf("Failed to record %s in the audit log: %v", e.Action, err)
+	}
+}
+
+// publish passes the event on to anyone listening, if anyone can
+func (w *Watcher) publish(e events.Event) {
+	if w.events != nil {
+		w.events.Publish(e)
+	}
+}
+
+var detectEdition = func(fs IFileSystem, worldPath string) minecraft.Edition {
+	entries, err := fs.ReadDir(worldPath)
+	if err != nil {
+		return minecraft.Unknown
+	}
+
+	return minecraft.DetectEdition(entries)
+}
+
+var readLevel = func(log *logrus.Entry, fs IFileSystem, world *data.World) {
+	edition := minecraft.Edition(world.Edition)
+
+	levelDat, err := fs.ReadFile(path.Join(world.FullPath, minecraft.LevelDat))
+	if err != nil {
+		log.Warnf("Failed to read %s for [%s]: %v", minecraft.LevelDat, world.FullPath, err)
+	} else if level, err := minecraft.ReadLevel(edition, levelDat); err != nil {
+		log.Warnf("Failed to parse %s for [%s]: %v", minecraft.LevelDat, world.FullPath, err)
+	} else {
+		world.LevelName = level.Name
+		world.LastPlayed = level.LastPlayed
+		world.GameType = level.GameType
+		world.Version = level.Version
+	}
+
+	if edition == minecraft.Bedrock {
+		if name, err := fs.ReadFile(path.Join(world.FullPath, minecraft.LevelNameFile)); err == nil {
+			if levelName := minecraft.ParseLevelName(name); levelName != "" {
+				world.LevelName = levelName
+			}
+		}
+	}
+}
+
+var hasChangedFiles = func(log *logrus.Entry, fs IFileSystem, world *data.World, matcher *filter.Matcher) bool {
 	lastBackupTime := world.LastBackupTime()
 	log.Infof("Last backup time: %d", lastBackupTime.Unix())
 
+	changed, err := findChangedFile(fs, world.FullPath, "", lastBackupTime, matcher)
+	if err != nil {
+		log.Errorf("Failed to check world [%s] for changes: %v", world.FullPath, err)
+		world.SetError(fmt.Errorf("Failed to check for changes: %v", err))
+		return false
+	}
+
+	if changed != nil {
+		log.Infof("%s file was changed at %d", changed.Name(), changed.ModTime().Unix())
+		return true
+	}
+
+	return false
+}
+
+// findChangedFile walks the world looking for the first file, not excluded
+// by the rules, that was modified after since
+func findChangedFile(fs IFileSystem, root, rel string, since time.Time, matcher *filter.Matcher) (os.FileInfo, error) {
+	files, err := fs.ReadDir(path.Join(root, rel))
+	if err != nil {
+		return nil, err
+	}
+
 	for i := range files {
 		file := files[i]
-		if lastBackupTime.Before(file.ModTime()) {
-			log.Infof("%s file was changed at %d", file.Name(), file.ModTime().Unix())
-			return true
+		name := path.Join(rel, file.Name())
+
+		if matcher.Excluded(name, file.IsDir()) {
+			continue
+		}
+
+		// a directory's own time changes when excluded files in it come
+		// and go, only the files in it count
+		if file.IsDir() {
+			if changed, err := findChangedFile(fs, root, name, since, matcher); changed != nil || err != nil {
+				return changed, err
+			}
+			continue
+		}
+
+		if since.Before(file.ModTime()) {
+			return file, nil
 		}
 	}
 
-	return false
+	return nil, nil
 }
 
-var createBackup = func(w *Watcher, log *logrus.Entry, f *data.Folder, world *data.World) {
+var createBackup = func(w *Watcher, log *logrus.Entry, f *data.Folder, world *data.World, rules filter.Rules) {
 	t := getNow()
 
-	cleanWorldName := fs.CleanName(world.Name)
+	var cleanWorldName string
+	w.withCatalog(func() { cleanWorldName = fs.CleanName(world.DisplayName()) })
+
+	opts := w.config.ArchiveFor(f.Path)
+	backupName := fmt.Sprintf("%s-%s-%s%s", cleanWorldName, world.Id, t.Format("20060102T150405"), opts.Extension())
 
-	zipName := fmt.Sprintf("%s-%s-%s.zip", cleanWorldName, world.Id, t.Format("20060102T150405"))
+	log.Infof("Creating backup file %s", backupName)
+	var backup *data.Backup
+	err := w.runJob(jobs.Backup, world.Id, "", func(p *jobs.Progress) error {
+		opts.Progress = p
+		if err := fs.CreateBackup(w.fs, log, f.Path, world.Name, w.config.BackupDir, backupName, opts, rules); err != nil {
+			return err
+		}
 
-	log.Infof("Creating backup file %s", zipName)
-	if err := fs.CreateBackup(w.fs, log, f.Path, world.Name, w.config.BackupDir, zipName); err != nil {
-		log.Errorf("Failed to  create zip: %s, %v", zipName, err)
+		w.withCatalog(func() {
+			backup = world.AddBackup(backupName).SetFormat(string(opts.Format)).SetKeyId(opts.Encryption.Id())
+			backup.SetRules(rules)
+		})
+		p.SetResult(backup)
+		return nil
+	})
+
+	entry := audit.Entry{Action: audit.BackupCreated, FolderId: f.Id, WorldId: world.Id}
+	if backup != nil {
+		entry.BackupId = backup.Id
+		entry.After = backup.Id
+	}
+	w.record(log, entry, err)
+	metrics.BackupDone(f.Id, world.Id, err)
+
+	w.db.Lock()
+	defer w.db.Unlock()
+
+	world.SetError(err)
+
+	if err != nil {
+		log.Errorf("Failed to create backup: %s, %v", backupName, err)
 		return
 	}
 
-	world.AddBackup(zipName)
+	if len(w.destinations) > 0 {
+		w.queue.Enqueue(backup)
+	}
 }
 
-var checkPurgeBackup = func(w *Watcher, log *logrus.Entry, world *data.World) {
-	if len(world.Backups) < 2 {
+var checkPurgeBackup = func(w *Watcher, log *logrus.Entry, f *data.Folder, world *data.World) {
+	// the backup as it was, its copies are removed without the catalog held
+	var previousBackup *data.Backup
+
+	w.withCatalog(func() {
+		if len(world.Backups) >= 2 {
+			previousBackup = world.Backups[len(world.Backups)-2].Clone()
+		}
+	})
+	if previousBackup == nil {
 		return
 	}
 
-	now := getNow()
-	previousBackup := world.Backups[len(world.Backups)-2]
-	checkInterval, _ := time.ParseDuration(w.config.CheckInterval)
-	checkIntervalWithBuffer := checkInterval + (time.Second * 2)
+	if previousBackup.Kept {
+		return
+	}
 
-	if previousBackup.CreatedAt.After(now.Add(-checkIntervalWithBuffer)) {
+	now := getNow()
+	window := w.config.PruneWindowFor(f.Path, world.Name)
+	if window > 0 && previousBackup.CreatedAt.After(now.Add(-window)) {
 		zipName := fmt.Sprintf("%s%s%s", w.config.BackupDir, afero.FilePathSeparator, previousBackup.Name)
 		log.Infof("Removing previous backup (%s) %s", previousBackup.Id, zipName)
-		if err := w.fs.Remove(zipName); err != nil {
+		err := w.runJob(jobs.Prune, world.Id, previousBackup.Id, func(p *jobs.Progress) error {
+			if err := w.fs.Remove(zipName); err != nil {
+				return err
+			}
+
+			if len(previousBackup.Copies) > 0 {
+				storage.Remove(log, w.destinations, previousBackup)
+			}
+			if len(w.destinations) > 0 {
+				w.withCatalog(func() { w.queue.Forget(previousBackup.Id) })
+			}
+
+			return nil
+		})
+		w.record(log, audit.Entry{Action: audit.BackupPruned, FolderId: f.Id, WorldId: world.Id, BackupId: previousBackup.Id, Before: previousBackup.Id}, err)
+
+		w.db.Lock()
+		defer w.db.Unlock()
+
+		if err != nil {
 			log.Errorf("Failed to remove previous backup (%s), err: %v", zipName, err)
+			world.SetError(fmt.Errorf("Failed to prune backup %s: %v", previousBackup.Id, err))
 			return
 		}
 
-		world.RemoveBackup(previousBackup.Id)
+		// a delete or prune job through the api may have removed it first
+		if world.RemoveBackup(previousBackup.Id) {
+			metrics.BackupsPruned.WithLabelValues(f.Id, world.Id).Inc()
+		}
 	}
 }
@@ -3,6 +3,7 @@ package watcher
 import (
 	"testing"
 	"world-backup/server/conf"
+	"world-backup/server/crypt"
 
 	"errors"
 	"time"
@@ -10,13 +11,19 @@ import (
 
 	"os"
 
-	"fmt"
-
 	"path"
 
+	"world-backup/server/audit"
+	"world-backup/server/events"
+	"world-backup/server/filter"
+	"world-backup/server/fs"
+	"world-backup/server/jobs"
+	"world-backup/server/minecraft"
+	"world-backup/server/storage"
+
 	"github.com/Sirupsen/logrus"
 	. "github.com/smartystreets/goconvey/convey"
-	"github.com/spf13/afero"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestWatcher_NewWatcher(t *testing.T) {
@@ -28,7 +35,7 @@ func TestWatcher_NewWatcher(t *testing.T) {
 		dbMock := new(IDbMock)
 
 		Convey("It should return a new watcher", func() {
-			w := NewWatcher(log, &config, fs, dbMock)
+			w := NewWatcher(log, &config, fs, dbMock, nil, nil, nil, nil, nil)
 
 			So(w, ShouldNotBeNil)
 			So(w.config, ShouldEqual, &config)
@@ -50,7 +57,7 @@ func TestWatcher_Start(t *testing.T) {
 		fsMock := new(IFileSystemMock)
 		dbMock := new(IDbMock)
 
-		w := NewWatcher(log, &config, fsMock, dbMock)
+		w := NewWatcher(log, &config, fsMock, dbMock, nil, nil, nil, nil, nil)
 
 		wasChecked := false
 		oldCheck := check
@@ -88,18 +95,28 @@ func TestWatcher_Start(t *testing.T) {
 	})
 
 	Convey("Given no directories to watch", t, func() {
-		config := conf.Config{}
+		config := conf.Config{CheckInterval: "1s"}
 		log := logrus.WithField("test", "watcher")
 		fsMock := new(IFileSystemMock)
 		dbMock := new(IDbMock)
 
-		w := NewWatcher(log, &config, fsMock, dbMock)
+		w := NewWatcher(log, &config, fsMock, dbMock, nil, nil, nil, nil, nil)
+
+		oldCheck := check
+		check = func(w *Watcher) {}
+		defer func() { check = oldCheck }()
+
+		oldWatch := watch
+		watch = func(w *Watcher, stop chan bool, d time.Duration) {}
+		defer func() { watch = oldWatch }()
 
-		Convey("It should return NoWatchPathError", func() {
+		dbMock.On("Save").Return(nil)
+
+		Convey("It should start and wait for folders to be added", func() {
 			err := w.Start()
 
-			So(err, ShouldEqual, NoWatchPathError)
-			So(len(dbMock.Calls), ShouldEqual, 0)
+			So(err, ShouldBeNil)
+			So(dbMock.AssertNotCalled(t, "AddFolder", mock.Anything), ShouldBeTrue)
 		})
 	})
 
@@ -112,7 +129,7 @@ func TestWatcher_Start(t *testing.T) {
 		fsMock := new(IFileSystemMock)
 		dbMock := new(IDbMock)
 
-		w := NewWatcher(log, &config, fsMock, dbMock)
+		w := NewWatcher(log, &config, fsMock, dbMock, nil, nil, nil, nil, nil)
 
 		Convey("It should return InvalidCheckInterval", func() {
 			err := w.Start()
@@ -130,7 +147,7 @@ func TestWatcher_Watch(t *testing.T) {
 		fsMock := new(IFileSystemMock)
 		dbMock := new(IDbMock)
 
-		w := NewWatcher(log, &config, fsMock, dbMock)
+		w := NewWatcher(log, &config, fsMock, dbMock, nil, nil, nil, nil, nil)
 
 		checkCount := 0
 		oldCheck := check
@@ -163,7 +180,7 @@ func TestWatcher_Check(t *testing.T) {
 		fsMock := new(IFileSystemMock)
 		dbMock := new(IDbMock)
 
-		w := NewWatcher(log, &config, fsMock, dbMock)
+		w := NewWatcher(log, &config, fsMock, dbMock, nil, nil, nil, nil, nil)
 
 		folders := []*data.Folder{}
 		oldCheckOneDir := checkOneDir
@@ -172,14 +189,14 @@ func TestWatcher_Check(t *testing.T) {
 		}
 		defer func() { checkOneDir = oldCheckOneDir }()
 
-		Convey("It should get the folder from the db", func() {
+		Convey("It should get the folders from the db", func() {
 			f1 := data.Folder{Id: "01", Path: w.config.WatchDirs[0]}
 			f2 := data.Folder{Id: "02", Path: w.config.WatchDirs[1]}
 			f3 := data.Folder{Id: "03", Path: w.config.WatchDirs[2]}
+			paused := data.Folder{Id: "04", Path: "/home/paused", Paused: true}
+			untracked := data.Folder{Id: "05", Path: "/home/old", Untracked: true}
 
-			dbMock.On("GetFolderByPath", w.config.WatchDirs[0]).Return(&f1)
-			dbMock.On("GetFolderByPath", w.config.WatchDirs[1]).Return(&f2)
-			dbMock.On("GetFolderByPath", w.config.WatchDirs[2]).Return(&f3)
+			dbMock.On("Folders").Return([]*data.Folder{&f1, &paused, &f2, &untracked, &f3})
 			dbMock.On("Save").Times(3).Return(nil)
 
 			Convey("and call checkOneDir for each", func() {
@@ -197,6 +214,17 @@ func TestWatcher_Check(t *testing.T) {
 					So(f2.LastRun.UnixNano(), ShouldEqual, now.UnixNano())
 					So(f3.LastRun.UnixNano(), ShouldEqual, now.UnixNano())
 				})
+
+				Convey("and skip the paused and untracked ones", func() {
+					So(paused.LastRun.IsZero(), ShouldBeTrue)
+					So(untracked.LastRun.IsZero(), ShouldBeTrue)
+				})
+
+				Convey("and remember when it checked", func() {
+					last, tick := w.LastCheck()
+					So(last.UnixNano(), ShouldEqual, now.UnixNano())
+					So(tick, ShouldEqual, maxTick)
+				})
 			})
 		})
 	})
@@ -211,12 +239,12 @@ func TestWatcher_CheckOneDir(t *testing.T) {
 		fsMock := new(IFileSystemMock)
 		dbMock := new(IDbMock)
 
-		w := NewWatcher(log, &config, fsMock, dbMock)
+		w := NewWatcher(log, &config, fsMock, dbMock, nil, nil, nil, nil, nil)
 
 		hasChangedFilesCallCount := 0
 		oldHasChangedFiles := hasChangedFiles
 		defer func() { hasChangedFiles = oldHasChangedFiles }()
-		hasChangedFiles = func(log *logrus.Entry, fs IFileSystem, world *data.World) bool {
+		hasChangedFiles = func(log *logrus.Entry, fs IFileSystem, world *data.World, matcher *filter.Matcher) bool {
 			hasChangedFilesCallCount++
 			return false
 		}
@@ -231,6 +259,10 @@ func TestWatcher_CheckOneDir(t *testing.T) {
 				fsMock.AssertExpectations(t)
 				So(hasChangedFilesCallCount, ShouldEqual, 0)
 			})
+
+			Convey("It should keep the error on the folder", func() {
+				So(f.LastError.Message, ShouldEqual, "No worky")
+			})
 		})
 	})
 
@@ -242,17 +274,24 @@ func TestWatcher_CheckOneDir(t *testing.T) {
 
 		config := conf.Config{
 			BackupDir: "/home/backup",
+			Rules:     filter.Rules{Exclude: []string{"logs/"}},
+			Folders: []conf.FolderConfig{
+				{
+					Path:   "/home/world",
+					Worlds: []conf.WorldConfig{{Name: "World one", Rules: filter.Rules{Exclude: []string{"bluemap/"}}}},
+				},
+			},
 		}
 		log := logrus.WithField("test", "watcher")
 		fsMock := new(IFileSystemMock)
 		dbMock := new(IDbMock)
 
-		w := NewWatcher(log, &config, fsMock, dbMock)
+		w := NewWatcher(log, &config, fsMock, dbMock, nil, nil, nil, nil, nil)
 
 		hasChangedFilesCallCount := 0
 		oldHasChangedFiles := hasChangedFiles
 		defer func() { hasChangedFiles = oldHasChangedFiles }()
-		hasChangedFiles = func(log *logrus.Entry, fs IFileSystem, world *data.World) bool {
+		hasChangedFiles = func(log *logrus.Entry, fs IFileSystem, world *data.World, matcher *filter.Matcher) bool {
 			hasChangedFilesCallCount++
 			return (hasChangedFilesCallCount % 2) != 0
 		}
@@ -261,15 +300,31 @@ func TestWatcher_CheckOneDir(t *testing.T) {
 		var backedUpWorld *data.World
 		oldCreateBackup := createBackup
 		defer func() { createBackup = oldCreateBackup }()
-		createBackup = func(w *Watcher, log *logrus.Entry, f *data.Folder, world *data.World) {
+		var backedUpRules filter.Rules
+		createBackup = func(w *Watcher, log *logrus.Entry, f *data.Folder, world *data.World, rules filter.Rules) {
 			backupCreatedCallCount++
 			backedUpWorld = world
+			backedUpRules = rules
 		}
 
 		oldCheckPurgeBackup := checkPurgeBackup
 		defer func() { checkPurgeBackup = oldCheckPurgeBackup }()
 		checkPurgeBackupCallCount := 0
-		checkPurgeBackup = func(w *Watcher, log *logrus.Entry, world *data.World) { checkPurgeBackupCallCount++ }
+		checkPurgeBackup = func(w *Watcher, log *logrus.Entry, f *data.Folder, world *data.World) { checkPurgeBackupCallCount++ }
+
+		oldDetectEdition := detectEdition
+		defer func() { detectEdition = oldDetectEdition }()
+		detectEdition = func(fs IFileSystem, worldPath string) minecraft.Edition {
+			if worldPath == "/home/world/Not A World" {
+				return minecraft.Unknown
+			}
+			return minecraft.Java
+		}
+
+		readLevelCallCount := 0
+		oldReadLevel := readLevel
+		defer func() { readLevel = oldReadLevel }()
+		readLevel = func(log *logrus.Entry, fs IFileSystem, world *data.World) { readLevelCallCount++ }
 
 		Convey("When there are no worlds", func() {
 			fsMock.On("ReadDir", "/home/world").Return([]os.FileInfo{}, nil)
@@ -302,11 +357,20 @@ func TestWatcher_CheckOneDir(t *testing.T) {
 			wDir3.On("IsDir").Return(true)
 			wDir3.On("ModTime").Return(now.Add(time.Second * -100))
 
-			fsMock.On("ReadDir", "/home/world").Return([]os.FileInfo{wDir1, wDir2, wDir3}, nil)
+			wDir4 := new(FileInfoMock)
+			wDir4.On("Name").Return("Not A World")
+			wDir4.On("IsDir").Return(true)
+			wDir4.On("ModTime").Return(now.Add(time.Second * -100))
 
-			f := data.Folder{Path: "/home/world"}
+			fsMock.On("ReadDir", "/home/world").Return([]os.FileInfo{wDir1, wDir2, wDir3, wDir4}, nil)
+
+			f := data.Folder{Id: "f1", Path: "/home/world", DefaultOwnerId: "u1"}
 			world := f.AddWorld("World two")
 
+			bus := events.NewBus(0)
+			w.events = bus
+			sub := bus.Subscribe(0)
+
 			checkOneDir(w, &f)
 
 			Convey("It should create a backup for a changed world and not unchanged ones", func() {
@@ -317,10 +381,29 @@ func TestWatcher_CheckOneDir(t *testing.T) {
 				So(backedUpWorld.Id, ShouldNotBeEmpty)
 				So(backedUpWorld.Id, ShouldNotEqual, world.Id)
 				So(backedUpWorld.Name, ShouldEqual, "World one")
+				So(backedUpWorld.Edition, ShouldEqual, "java")
+				So(backedUpWorld.OwnerId, ShouldEqual, "u1")
+				So(world.OwnerId, ShouldBeEmpty)
+				So(backedUpRules.Exclude, ShouldResemble, []string{"logs/", "bluemap/"})
+				So(readLevelCallCount, ShouldEqual, 1)
 
 				Convey("and call checkPurgeBackup", func() {
 					So(checkPurgeBackupCallCount, ShouldEqual, 1)
 				})
+
+				Convey("and skip directories that are not worlds", func() {
+					So(f.GetWorldByName("Not A World"), ShouldBeNil)
+					So(len(f.Worlds), ShouldEqual, 3)
+				})
+
+				Convey("and publish the worlds it found", func() {
+					So(len(sub.Events()), ShouldEqual, 2)
+
+					e := <-sub.Events()
+					So(e.Type, ShouldEqual, events.WorldDiscovered)
+					So(e.FolderId, ShouldEqual, "f1")
+					So(e.WorldId, ShouldEqual, backedUpWorld.Id)
+				})
 			})
 		})
 
@@ -356,7 +439,7 @@ func TestWatcher_HasChangedFiles(t *testing.T) {
 			fsMock.On("ReadDir", world.FullPath).Return([]os.FileInfo{}, errors.New("failed to read"))
 
 			Convey("Then it should return false", func() {
-				So(hasChangedFiles(log, fsMock, &world), ShouldBeFalse)
+				So(hasChangedFiles(log, fsMock, &world, nil), ShouldBeFalse)
 				fsMock.AssertExpectations(t)
 			})
 		})
@@ -368,7 +451,7 @@ func TestWatcher_HasChangedFiles(t *testing.T) {
 				f2.On("ModTime").Return(now.Add(time.Second * -100))
 
 				Convey("Then it should return false", func() {
-					So(hasChangedFiles(log, fsMock, &world), ShouldBeFalse)
+					So(hasChangedFiles(log, fsMock, &world, nil), ShouldBeFalse)
 					fsMock.AssertExpectations(t)
 				})
 			})
@@ -377,7 +460,17 @@ func TestWatcher_HasChangedFiles(t *testing.T) {
 				f2.On("ModTime").Return(now)
 
 				Convey("Then it should return true", func() {
-					So(hasChangedFiles(log, fsMock, &world), ShouldBeTrue)
+					So(hasChangedFiles(log, fsMock, &world, nil), ShouldBeTrue)
+					fsMock.AssertExpectations(t)
+				})
+			})
+
+			Convey("When the updated file is excluded by the rules", func() {
+				f2.On("ModTime").Return(now)
+				matcher := filter.Compile(filter.Rules{Exclude: []string{"file2.txt"}})
+
+				Convey("Then it should return false", func() {
+					So(hasChangedFiles(log, fsMock, &world, matcher), ShouldBeFalse)
 					fsMock.AssertExpectations(t)
 				})
 			})
@@ -385,6 +478,74 @@ func TestWatcher_HasChangedFiles(t *testing.T) {
 	})
 }
 
+func TestWatcher_HasChangedFilesInSubDirectories(t *testing.T) {
+	Convey("Given a world with a region directory", t, func() {
+		now := time.Now()
+
+		log := logrus.WithField("test", "watcher")
+		fsMock := new(IFileSystemMock)
+
+		world := data.World{
+			Name:     "w1",
+			FullPath: "/home/world/w1",
+			Backups: []*data.Backup{
+				{CreatedAt: now.Add(time.Second * -50)},
+			},
+		}
+
+		region := new(FileInfoMock)
+		region.On("Name").Return("region")
+		region.On("IsDir").Return(true)
+		region.On("ModTime").Return(now.Add(time.Second * -100))
+
+		mca := new(FileInfoMock)
+		mca.On("Name").Return("r.0.0.mca")
+		mca.On("IsDir").Return(false)
+		mca.On("ModTime").Return(now)
+
+		Convey("When a region file was updated", func() {
+			fsMock.On("ReadDir", "/home/world/w1").Return([]os.FileInfo{region}, nil)
+			fsMock.On("ReadDir", "/home/world/w1/region").Return([]os.FileInfo{mca}, nil)
+
+			Convey("Then it should return true", func() {
+				So(hasChangedFiles(log, fsMock, &world, nil), ShouldBeTrue)
+				fsMock.AssertExpectations(t)
+			})
+		})
+
+		Convey("When only an excluded file in a directory changed", func() {
+			logs := new(FileInfoMock)
+			logs.On("Name").Return("logs")
+			logs.On("IsDir").Return(true)
+			logs.On("ModTime").Return(now)
+
+			latest := new(FileInfoMock)
+			latest.On("Name").Return("latest.log")
+			latest.On("IsDir").Return(false)
+			latest.On("ModTime").Return(now)
+
+			fsMock.On("ReadDir", "/home/world/w1").Return([]os.FileInfo{logs}, nil)
+			fsMock.On("ReadDir", "/home/world/w1/logs").Return([]os.FileInfo{latest}, nil)
+			matcher := filter.Compile(filter.Rules{Exclude: []string{"*.log"}})
+
+			Convey("Then the directory's own time should not count", func() {
+				So(hasChangedFiles(log, fsMock, &world, matcher), ShouldBeFalse)
+				fsMock.AssertExpectations(t)
+			})
+		})
+
+		Convey("When the region directory is excluded", func() {
+			fsMock.On("ReadDir", "/home/world/w1").Return([]os.FileInfo{region}, nil)
+			matcher := filter.Compile(filter.Rules{Exclude: []string{"region/"}})
+
+			Convey("Then it should not look inside it", func() {
+				So(hasChangedFiles(log, fsMock, &world, matcher), ShouldBeFalse)
+				fsMock.AssertExpectations(t)
+			})
+		})
+	})
+}
+
 func TestWatcher_CreateBackup(t *testing.T) {
 	Convey("Given a watcher and a world to backup", t, func() {
 		now := time.Unix(1495807405, 0)
@@ -399,7 +560,7 @@ func TestWatcher_CreateBackup(t *testing.T) {
 		fsMock := new(IFileSystemMock)
 		dbMock := new(IDbMock)
 
-		w := NewWatcher(log, &config, fsMock, dbMock)
+		w := NewWatcher(log, &config, fsMock, dbMock, nil, nil, nil, nil, nil)
 
 		folder := data.Folder{Path: "/home/saves"}
 
@@ -409,48 +570,102 @@ func TestWatcher_CreateBackup(t *testing.T) {
 			FullPath: "/home/world/wee",
 		}
 
-		worldPath := path.Join(fmt.Sprintf(".%s", afero.FilePathSeparator), world.Name)
+		worldPath := path.Join(folder.Path, world.Name)
+		rules := filter.Rules{Exclude: []string{"session.lock"}}
 
-		Convey("When we fail to get current working directory", func() {
-			fsMock.On("Getwd").Return("", errors.New("No!"))
+		Convey("When the backup succeeds", func() {
 
-			createBackup(w, log, &folder, &world)
+			fsMock.On("Archive", worldPath, "/back/up/World_One_For_Ever_Dude-WID01-20170526T090325.zip", fs.ArchiveOptions{}, rules).Return(nil)
 
-			Convey("Then it should return", func() {
-				fsMock.AssertExpectations(t)
+			createBackup(w, log, &folder, &world, rules)
+
+			fsMock.AssertExpectations(t)
+
+			Convey("Then it should add the backup to the world", func() {
+				So(len(world.Backups), ShouldEqual, 1)
+				So(world.Backups[0].Name, ShouldEqual, "World_One_For_Ever_Dude-WID01-20170526T090325.zip")
+				So(world.Backups[0].Rules, ShouldResemble, &rules)
 			})
 		})
 
-		Convey("When the backup succeeds", func() {
+		Convey("When the config asks for encrypted tar.zst", func() {
+			config.Archive = fs.ArchiveOptions{Format: fs.TarZst, Level: 19}
+			nas := &crypt.Config{KeyId: "nas", Recipients: []string{"age1nas"}}
+			config.Folders = []conf.FolderConfig{{Path: "/home/saves", Encryption: nas}}
 
-			fsMock.On("Getwd").Return("/app/dir", nil)
-			fsMock.On("Chdir", "/home/saves").Return(nil)
-			fsMock.On("Chdir", "/app/dir").Return(nil)
-			fsMock.On("Zip", worldPath, "/back/up/World_One_For_Ever_Dude-WID01-20170526T090325.zip").Return(nil)
+			fsMock.On("Archive", worldPath, "/back/up/World_One_For_Ever_Dude-WID01-20170526T090325.tar.zst.age", fs.ArchiveOptions{Format: fs.TarZst, Level: 19, Encryption: nas}, rules).Return(nil)
 
-			createBackup(w, log, &folder, &world)
+			createBackup(w, log, &folder, &world, rules)
 
 			fsMock.AssertExpectations(t)
 
-			Convey("Then it should add the backup to the world", func() {
+			Convey("Then it should record the format and key on the backup", func() {
+				So(world.Backups[0].Name, ShouldEqual, "World_One_For_Ever_Dude-WID01-20170526T090325.tar.zst.age")
+				So(world.Backups[0].Format, ShouldEqual, "tar.zst")
+				So(world.Backups[0].KeyId, ShouldEqual, "nas")
+			})
+		})
+
+		Convey("When there are destinations to copy backups to", func() {
+			queueMock := new(ReplicationQueueMock)
+			w.destinations = storage.Set{new(DestinationMock)}
+			w.queue = queueMock
+
+			queueMock.On("Enqueue", mock.Anything).Return()
+
+			fsMock.On("Archive", worldPath, "/back/up/World_One_For_Ever_Dude-WID01-20170526T090325.zip", fs.ArchiveOptions{}, rules).Return(nil)
+
+			createBackup(w, log, &folder, &world, rules)
+
+			Convey("Then it should queue the backup to be copied", func() {
+				queueMock.AssertExpectations(t)
+				So(queueMock.Calls[0].Arguments.Get(0), ShouldEqual, world.Backups[0])
+			})
+		})
+
+		Convey("When backups run as jobs", func() {
+			manager, _ := jobs.NewManager(log, jobs.Config{})
+			w.jobs = manager
+
+			fsMock.On("Archive", worldPath, "/back/up/World_One_For_Ever_Dude-WID01-20170526T090325.zip", mock.Anything, rules).Return(nil)
+
+			createBackup(w, log, &folder, &world, rules)
+
+			Convey("Then it should wait for the job and count its progress", func() {
+				fsMock.AssertExpectations(t)
 				So(len(world.Backups), ShouldEqual, 1)
-				So(world.Backups[0].Name, ShouldEqual, "World_One_For_Ever_Dude-WID01-20170526T090325.zip")
+
+				opts := fsMock.Calls[0].Arguments.Get(2).(fs.ArchiveOptions)
+				So(opts.Progress, ShouldNotBeNil)
+
+				list := manager.List()
+				So(len(list), ShouldEqual, 1)
+				So(list[0].Kind, ShouldEqual, jobs.Backup)
+				So(list[0].WorldId, ShouldEqual, "WID01")
+				So(list[0].State, ShouldEqual, jobs.Done)
 			})
 		})
 
 		Convey("When the backup fails", func() {
-			fsMock.On("Getwd").Return("/app/dir", nil)
-			fsMock.On("Chdir", "/home/saves").Return(nil)
-			fsMock.On("Chdir", "/app/dir").Return(nil)
-			fsMock.On("Zip", worldPath, "/back/up/World_One_For_Ever_Dude-WID01-20170526T090325.zip").Return(errors.New("Didn't work!"))
+			fsMock.On("Archive", worldPath, "/back/up/World_One_For_Ever_Dude-WID01-20170526T090325.zip", fs.ArchiveOptions{}, rules).Return(errors.New("Didn't work!"))
 
-			createBackup(w, log, &folder, &world)
+			createBackup(w, log, &folder, &world, rules)
 
 			fsMock.AssertExpectations(t)
 
 			Convey("Then it should not add the backup to the world", func() {
 				So(len(world.Backups), ShouldEqual, 0)
 			})
+
+			Convey("Then it should keep the error on the world until a backup works", func() {
+				So(world.LastError.Message, ShouldEqual, "Didn't work!")
+
+				fsMock.ExpectedCalls = nil
+				fsMock.On("Archive", worldPath, mock.Anything, fs.ArchiveOptions{}, rules).Return(nil)
+				createBackup(w, log, &folder, &world, rules)
+
+				So(world.LastError, ShouldBeNil)
+			})
 		})
 	})
 }
@@ -470,8 +685,9 @@ func TestWatcher_CheckPurgeBackup(t *testing.T) {
 		fsMock := new(IFileSystemMock)
 		dbMock := new(IDbMock)
 
-		w := NewWatcher(log, &config, fsMock, dbMock)
+		w := NewWatcher(log, &config, fsMock, dbMock, nil, nil, nil, nil, nil)
 
+		folder := data.Folder{Id: "FID01"}
 		world := data.World{
 			Id:       "WID01",
 			Name:     "w1",
@@ -480,7 +696,7 @@ func TestWatcher_CheckPurgeBackup(t *testing.T) {
 
 		Convey("When there are no backups", func() {
 			Convey("It should do nothing", func() {
-				checkPurgeBackup(w, log, &world)
+				checkPurgeBackup(w, log, &folder, &world)
 			})
 		})
 
@@ -490,7 +706,7 @@ func TestWatcher_CheckPurgeBackup(t *testing.T) {
 			}
 
 			Convey("It should do nothing", func() {
-				checkPurgeBackup(w, log, &world)
+				checkPurgeBackup(w, log, &folder, &world)
 			})
 		})
 
@@ -502,7 +718,7 @@ func TestWatcher_CheckPurgeBackup(t *testing.T) {
 			}
 
 			Convey("It should do nothing", func() {
-				checkPurgeBackup(w, log, &world)
+				checkPurgeBackup(w, log, &folder, &world)
 
 				So(len(world.Backups), ShouldEqual, 3)
 			})
@@ -521,23 +737,280 @@ func TestWatcher_CheckPurgeBackup(t *testing.T) {
 				fsMock.On("Remove", "/back/up/b4").Return(nil)
 
 				Convey("It should purge the backup", func() {
-					checkPurgeBackup(w, log, &world)
+					checkPurgeBackup(w, log, &folder, &world)
 
 					So(len(world.Backups), ShouldEqual, 4)
 					fsMock.AssertExpectations(t)
 				})
+
+				Convey("It should record it in the audit log", func() {
+					auditMock := new(AuditMock)
+					auditMock.On("Record", audit.Entry{Actor: audit.Watcher, Action: audit.BackupPruned, FolderId: "FID01", WorldId: "WID01", BackupId: "04", Before: "04"}).Return(nil)
+					w.audit = auditMock
+
+					checkPurgeBackup(w, log, &folder, &world)
+
+					auditMock.AssertExpectations(t)
+				})
 			})
 
 			Convey("And the removal failes", func() {
 				fsMock.On("Remove", "/back/up/b4").Return(errors.New("NO!"))
 
 				Convey("It should not purge the backup", func() {
-					checkPurgeBackup(w, log, &world)
+					checkPurgeBackup(w, log, &folder, &world)
 
 					So(len(world.Backups), ShouldEqual, 5)
 					fsMock.AssertExpectations(t)
 				})
 			})
+
+			Convey("And the backup was copied to a destination", func() {
+				queueMock := new(ReplicationQueueMock)
+				w.destinations = storage.Set{new(DestinationMock)}
+				w.queue = queueMock
+
+				world.Backups[3].AddCopy(data.Copy{Destination: "nas", Key: "b4", Size: 10})
+				fsMock.On("Remove", "/back/up/b4").Return(nil)
+				queueMock.On("Forget", "04").Return()
+
+				var removed *data.Backup
+				oldRemove := storage.Remove
+				storage.Remove = func(log *logrus.Entry, dests storage.Set, backup *data.Backup) error {
+					removed = backup
+					return nil
+				}
+				defer func() { storage.Remove = oldRemove }()
+
+				checkPurgeBackup(w, log, &folder, &world)
+
+				Convey("It should delete the copy too and drop it from the queue", func() {
+					So(removed, ShouldNotBeNil)
+					So(removed.Id, ShouldEqual, "04")
+					So(len(world.Backups), ShouldEqual, 4)
+					queueMock.AssertExpectations(t)
+				})
+			})
+		})
+
+		Convey("When the world is backed up more often than the check interval", func() {
+			config.Folders = []conf.FolderConfig{{Path: "/home/world", Schedules: []conf.Schedule{{Every: "1m"}}}}
+			folder.Path = "/home/world"
+
+			Convey("And the backups are further apart than its schedule", func() {
+				world.Backups = []*data.Backup{
+					{Id: "01", Name: "b1", CreatedAt: now.Add(time.Minute * -3)},
+					{Id: "02", Name: "b2", CreatedAt: now},
+				}
+
+				Convey("It should keep both", func() {
+					checkPurgeBackup(w, log, &folder, &world)
+
+					So(len(world.Backups), ShouldEqual, 2)
+				})
+			})
+
+			Convey("And the backups are as close as its schedule", func() {
+				world.Backups = []*data.Backup{
+					{Id: "01", Name: "b1", CreatedAt: now.Add(time.Minute * -1)},
+					{Id: "02", Name: "b2", CreatedAt: now},
+				}
+				fsMock.On("Remove", "/back/up/b1").Return(nil)
+
+				Convey("It should purge the previous one", func() {
+					checkPurgeBackup(w, log, &folder, &world)
+
+					So(len(world.Backups), ShouldEqual, 1)
+					fsMock.AssertExpectations(t)
+				})
+			})
+		})
+
+		Convey("When the world is only backed up on a cron schedule", func() {
+			config.Folders = []conf.FolderConfig{{Path: "/home/world", Schedules: []conf.Schedule{{Cron: "* * * * *"}}}}
+			folder.Path = "/home/world"
+			world.Backups = []*data.Backup{
+				{Id: "01", Name: "b1", CreatedAt: now.Add(time.Minute * -1)},
+				{Id: "02", Name: "b2", CreatedAt: now},
+			}
+
+			Convey("It should not purge any", func() {
+				checkPurgeBackup(w, log, &folder, &world)
+
+				So(len(world.Backups), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When the previous backup was made on a forced schedule", func() {
+			world.Backups = []*data.Backup{
+				{Id: "01", Name: "b1", CreatedAt: now.Add(time.Minute * -1), Kept: true},
+				{Id: "02", Name: "b2", CreatedAt: now},
+			}
+
+			Convey("It should not purge it", func() {
+				checkPurgeBackup(w, log, &folder, &world)
+
+				So(len(world.Backups), ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestWatcher_ChunkRestoreSafetyBackup(t *testing.T) {
+	Convey("Given a world whose chunks were just restored", t, func() {
+		now := time.Now()
+		oldGetNow := getNow
+		getNow = func() time.Time { return now }
+		defer func() { getNow = oldGetNow }()
+
+		config := conf.Config{BackupDir: "/back/up", CheckInterval: "5m"}
+		log := logrus.WithField("test", "watcher")
+		fsMock := new(IFileSystemMock)
+		dbMock := new(IDbMock)
+
+		w := NewWatcher(log, &config, fsMock, dbMock, nil, nil, nil, nil, nil)
+
+		worldDir := new(FileInfoMock)
+		worldDir.On("Name").Return("World one")
+		worldDir.On("IsDir").Return(true)
+		worldDir.On("ModTime").Return(now)
+		fsMock.On("ReadDir", "/home/world").Return([]os.FileInfo{worldDir}, nil)
+
+		folder := data.Folder{Id: "FID01", Path: "/home/world"}
+		world := folder.AddWorld("World one")
+		world.Backups = []*data.Backup{
+			{Id: "01", Name: "b1.zip", CreatedAt: now.Add(-time.Hour)},
+			{Id: "02", Name: "World_one-before_chunk_restore.zip", CreatedAt: now.Add(-time.Minute), Kept: true},
+		}
+
+		oldDetectEdition := detectEdition
+		defer func() { detectEdition = oldDetectEdition }()
+		detectEdition = func(fs IFileSystem, worldPath string) minecraft.Edition { return minecraft.Java }
+
+		oldHasChangedFiles := hasChangedFiles
+		defer func() { hasChangedFiles = oldHasChangedFiles }()
+		hasChangedFiles = func(log *logrus.Entry, fs IFileSystem, world *data.World, matcher *filter.Matcher) bool { return true }
+
+		oldReadLevel := readLevel
+		defer func() { readLevel = oldReadLevel }()
+		readLevel = func(log *logrus.Entry, fs IFileSystem, world *data.World) {}
+
+		oldCreateBackup := createBackup
+		defer func() { createBackup = oldCreateBackup }()
+		createBackup = func(w *Watcher, log *logrus.Entry, f *data.Folder, world *data.World, rules filter.Rules) {
+			world.Backups = append(world.Backups, &data.Backup{Id: "03", Name: "b3.zip", CreatedAt: now})
+		}
+
+		Convey("When the watcher backs up the restored world", func() {
+			checkOneDir(w, &folder)
+
+			Convey("It should keep the safety backup", func() {
+				So(len(world.Backups), ShouldEqual, 3)
+				So(world.Backups[1].Id, ShouldEqual, "02")
+				fsMock.AssertNotCalled(t, "Remove", mock.Anything)
+			})
+		})
+	})
+}
+
+func TestWatcher_DetectEdition(t *testing.T) {
+	Convey("Given a world directory", t, func() {
+		fsMock := new(IFileSystemMock)
+
+		levelDat := new(FileInfoMock)
+		levelDat.On("Name").Return("level.dat")
+		levelDat.On("IsDir").Return(false)
+
+		db := new(FileInfoMock)
+		db.On("Name").Return("db")
+		db.On("IsDir").Return(true)
+
+		Convey("When it has a db directory and a level.dat", func() {
+			fsMock.On("ReadDir", "/home/world/bedrock").Return([]os.FileInfo{db, levelDat}, nil)
+
+			Convey("Then it should be a Bedrock world", func() {
+				So(detectEdition(fsMock, "/home/world/bedrock"), ShouldEqual, minecraft.Bedrock)
+			})
+		})
+
+		Convey("When it only has a level.dat", func() {
+			fsMock.On("ReadDir", "/home/world/java").Return([]os.FileInfo{levelDat}, nil)
+
+			Convey("Then it should be a Java world", func() {
+				So(detectEdition(fsMock, "/home/world/java"), ShouldEqual, minecraft.Java)
+			})
+		})
+
+		Convey("When we fail to read the directory", func() {
+			fsMock.On("ReadDir", "/home/world/nope").Return(nil, errors.New("nope"))
+
+			Convey("Then it should be unknown", func() {
+				So(detectEdition(fsMock, "/home/world/nope"), ShouldEqual, minecraft.Unknown)
+			})
+		})
+	})
+}
+
+func TestWatcher_ReadLevel(t *testing.T) {
+	Convey("Given a Bedrock world", t, func() {
+		log := logrus.WithField("test", "watcher")
+		fsMock := new(IFileSystemMock)
+
+		world := data.World{
+			Name:     "AbCdEfGh=",
+			FullPath: "/home/world/AbCdEfGh=",
+			Edition:  "bedrock",
+		}
+
+		Convey("When the level.dat can not be read", func() {
+			fsMock.On("ReadFile", "/home/world/AbCdEfGh=/level.dat").Return(nil, errors.New("locked"))
+			fsMock.On("ReadFile", "/home/world/AbCdEfGh=/levelname.txt").Return([]byte("Logan's Island\r\n"), nil)
+
+			readLevel(log, fsMock, &world)
+
+			Convey("It should still use the name from levelname.txt", func() {
+				fsMock.AssertExpectations(t)
+				So(world.LevelName, ShouldEqual, "Logan's Island")
+				So(world.DisplayName(), ShouldEqual, "Logan's Island")
+			})
+		})
+	})
+}
+
+func TestWatcher_Reconcile(t *testing.T) {
+	Convey("Given a watcher with a destination", t, func() {
+		config := conf.Config{WatchDirs: []string{"/home/world"}, BackupDir: "/back/up"}
+		log := logrus.WithField("test", "watcher")
+		dbMock := new(IDbMock)
+		queueMock := new(ReplicationQueueMock)
+		nas := new(DestinationMock)
+		nas.On("Name").Return("nas")
+
+		w := NewWatcher(log, &config, new(IFileSystemMock), dbMock, storage.Set{nas}, queueMock, nil, nil, nil)
+
+		copied := &data.Backup{Id: "01", Name: "b1"}
+		copied.AddCopy(data.Copy{Destination: "nas", Key: "b1", Size: 10})
+		missing := &data.Backup{Id: "02", Name: "b2"}
+
+		folder := data.Folder{Path: "/home/world", Worlds: []*data.World{{Id: "WID01", Backups: []*data.Backup{copied, missing}}}}
+		dbMock.On("Folders").Return([]*data.Folder{&folder})
+
+		var reconciled []*data.Backup
+		oldReconcile := storage.Reconcile
+		storage.Reconcile = func(log *logrus.Entry, d storage.Destination, backups []*data.Backup) (*storage.Report, error) {
+			reconciled = backups
+			return &storage.Report{Destination: d.Name()}, nil
+		}
+		defer func() { storage.Reconcile = oldReconcile }()
+
+		queueMock.On("Enqueue", missing).Return()
+
+		Convey("It should check the backups and queue the ones missing a copy", func() {
+			reconcile(w)
+
+			So(reconciled, ShouldResemble, []*data.Backup{copied, missing})
+			queueMock.AssertExpectations(t)
+			So(len(queueMock.Calls), ShouldEqual, 1)
 		})
 	})
 }